@@ -0,0 +1,550 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// ErrNoAggregateHash is returned by Result.AggregateHash for the rules whose global model does not combine the
+// participants' homomorphic hashes: Median, TrimmedMean and any rule applied to clipped model updates.
+var ErrNoAggregateHash = errors.New("the global model has no aggregate homomorphic hash")
+
+// Metadata keys of the models read and written by the aggregation.
+const (
+	// SampleCountMetadataKey holds the number of training samples behind a model, used as its FedAvg weight.
+	// The global model of a FedAvg aggregation records the total number of samples under it.
+	SampleCountMetadataKey = "num_samples"
+	// RuleMetadataKey holds the rule a global model was aggregated with.
+	RuleMetadataKey = "aggregation_rule"
+	// ProximalMuMetadataKey holds the coefficient of the proximal term participants use in their FedProx training.
+	ProximalMuMetadataKey = "fedprox_mu"
+)
+
+// Parameters of the robust rules, recorded in the AggregationRule of a Result and in the global model metadata.
+const (
+	TrimFractionParameter   = "trim_fraction"
+	ByzantineCountParameter = "byzantine_count"
+	// RejectedParameter lists the ids of the participants whose models Krum or MultiKrum did not select.
+	RejectedParameter = "rejected"
+	ClipNormParameter = shared.ClipNormAggregationParameter
+	// SampleCountsParameter lists the FedAvg weights of the participants, in the order of Result.ParticipantIds.
+	SampleCountsParameter = shared.SampleCountsAggregationParameter
+)
+
+// Rule is how participant models are combined into a global model.
+type Rule int
+
+const (
+	// FedAvg averages the models weighted by their number of training samples.
+	FedAvg Rule = iota
+	// FedProx averages the models with equal weights, as in FedProx, where participants are sampled in proportion to
+	// their data and may perform different amounts of local work. The proximal term itself is part of the
+	// participants' training; its coefficient is recorded in the global model when set.
+	FedProx
+	// Sum adds the models, e.g. fixed-point encoded or masked updates, whose homomorphic hashes then combine into the
+	// hash of the global model.
+	Sum
+	// Median takes the coordinate-wise median of the models, which a minority of poisoned models cannot move
+	// beyond the range of the honest values.
+	Median
+	// TrimmedMean averages each coordinate after dropping its Options.TrimFraction largest and smallest values.
+	TrimmedMean
+	// Krum selects the model closest to its n - f - 2 nearest neighbours, f being Options.ByzantineCount.
+	Krum
+	// MultiKrum averages the Options.SelectionCount models with the best Krum scores.
+	MultiKrum
+)
+
+// String returns the name of the rule, as recorded under RuleMetadataKey.
+func (r Rule) String() string {
+	switch r {
+	case FedAvg:
+		return shared.FedAvgAggregationRule
+	case FedProx:
+		return shared.FedProxAggregationRule
+	case Sum:
+		return shared.SumAggregationRule
+	case Median:
+		return shared.MedianAggregationRule
+	case TrimmedMean:
+		return shared.TrimmedMeanAggregationRule
+	case Krum:
+		return shared.KrumAggregationRule
+	case MultiKrum:
+		return shared.MultiKrumAggregationRule
+	default:
+		return fmt.Sprintf("rule(%d)", int(r))
+	}
+}
+
+// Options holds how an epoch is aggregated.
+// Rule - how the participant models are combined.
+// SampleCounts - the FedAvg weights by participant id. A participant missing from it is weighted with the
+// SampleCountMetadataKey of its model.
+// ProximalMu - the FedProx proximal coefficient recorded in the global model, if positive.
+// TrimFraction - the fraction of the values of each coordinate dropped at each end by TrimmedMean, below 0.5.
+// ByzantineCount - the number of poisoned models Krum and MultiKrum tolerate. There must be more than 2f + 2 models.
+// SelectionCount - the number of models MultiKrum averages, n - f if not positive.
+// ClipNorm - if positive, the L2 norm every model update is clipped to before aggregating, whatever the rule.
+// ClipReference - the model updates are clipped relative to, usually the previous global model. If nil, the
+// participant models are clipped themselves, as when they are deltas.
+// Concurrency - the number of models fetched at once by AggregateEpoch, ipfs_client.DefaultGetFilesConcurrency if not positive.
+type Options struct {
+	Rule           Rule
+	SampleCounts   map[int]int64
+	ProximalMu     float64
+	TrimFraction   float64
+	ByzantineCount int
+	SelectionCount int
+	ClipNorm       float64
+	ClipReference  *weight_pb.TensorModel
+	Concurrency    int
+}
+
+// Participant is a participant model to aggregate.
+// SampleCount - the number of training samples behind the model, 0 if unknown.
+// HomomorphicHash - the homomorphic hash recorded in the participant's model metadata, empty if unknown.
+type Participant struct {
+	Id              int
+	Model           *weight_pb.TensorModel
+	SampleCount     int64
+	HomomorphicHash string
+}
+
+// Result holds a global model ready to be published.
+// Model - the global model.
+// ParticipantIds - the ids of the participants whose models were aggregated, in ascending order, as recorded
+// in the aggregator's model metadata. For Krum and MultiKrum, only the selected participants are listed.
+// Rule - the rule and the parameters that produced the global model, as recorded in the aggregator's model metadata.
+// HomomorphicHash - the aggregate homomorphic hash to record in the aggregator's model metadata, see AggregateHash.
+// It is set when every participant has a homomorphic hash, as with AggregateEpoch, and the rule has one.
+type Result struct {
+	Model           *weight_pb.TensorModel
+	ParticipantIds  []int
+	Rule            shared.AggregationRule
+	HomomorphicHash string
+}
+
+// WeightModel returns the global model as a WeightModel, if the participant models were WeightModels.
+func (r *Result) WeightModel() (*weight_pb.WeightModel, error) {
+	tensors := r.Model.GetTensors()
+	if len(tensors) != 1 || tensors[0].GetName() != weight_pb.LegacyTensorName || len(tensors[0].GetShape()) != 1 ||
+		tensors[0].GetDtype() != weight_pb.DType_DTYPE_INT64 {
+		return nil, errors.New("global model is not a WeightModel")
+	}
+
+	values, err := tensors[0].Int64s()
+	if err != nil {
+		return nil, err
+	}
+
+	return &weight_pb.WeightModel{Values: values}, nil
+}
+
+// AggregateHash returns the aggregate homomorphic hash the chaincode verifies in the aggregator's model metadata:
+// the combination of the homomorphic hashes of the listed participants, given by participant id, weighted by the
+// sample counts recorded in the rule for FedAvg and by 1 for the other rules. For the averaging rules, FedAvg,
+// FedProx and MultiKrum, it is the hash of the weighted sum of the participant models, not of the published global
+// model, which is rounded. ErrNoAggregateHash is returned for the rules whose global model has no such hash.
+func (r *Result) AggregateHash(participantHashes map[int]string) (string, error) {
+	if _, clipped := r.Rule.Parameters[ClipNormParameter]; clipped {
+		return "", ErrNoAggregateHash
+	}
+
+	weights := make([]int64, len(r.ParticipantIds))
+	switch r.Rule.Name {
+	case shared.MedianAggregationRule, shared.TrimmedMeanAggregationRule:
+		return "", ErrNoAggregateHash
+	case shared.FedAvgAggregationRule:
+		sampleCounts := strings.Split(r.Rule.Parameters[SampleCountsParameter], ",")
+		if len(sampleCounts) != len(weights) {
+			return "", fmt.Errorf("%d sample counts recorded for %d participants", len(sampleCounts), len(weights))
+		}
+		for i, sampleCount := range sampleCounts {
+			weight, err := strconv.ParseInt(sampleCount, 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("invalid sample count %q: %w", sampleCount, err)
+			}
+			weights[i] = weight
+		}
+	default:
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	digests := make([]homomorphic_hash.Digest, len(r.ParticipantIds))
+	for i, participantId := range r.ParticipantIds {
+		participantHash, ok := participantHashes[participantId]
+		if !ok {
+			return "", fmt.Errorf("missing the homomorphic hash of participant %d", participantId)
+		}
+		digest, err := homomorphic_hash.ParseDigest(participantHash)
+		if err != nil {
+			return "", fmt.Errorf("invalid homomorphic hash of participant %d: %w", participantId, err)
+		}
+		digests[i] = digest
+	}
+
+	aggregate, err := homomorphic_hash.CombineWeighted(weights, digests)
+	if err != nil {
+		return "", err
+	}
+
+	return aggregate.String(), nil
+}
+
+// Aggregate combines participant models into a global model. All models must have the same architecture and
+// the same tensors, with the same shapes and dtypes. Float tensors are combined in float64 and stored in their dtype.
+// Integer tensors are combined exactly in 128-bit arithmetic, averages and medians being rounded to the nearest
+// integer, and an error is returned if a result does not fit the dtype. The robust rules weight all models equally.
+// Models with NaN or infinite values are rejected, as no rule can combine them meaningfully.
+func Aggregate(participants []Participant, opts Options) (*Result, error) {
+	if len(participants) == 0 {
+		return nil, errors.New("no participant models to aggregate")
+	}
+
+	weights, totalWeight, err := participantWeights(participants, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	reference := participants[0].Model
+	for _, participant := range participants {
+		if err := checkSameLayout(reference, participant); err != nil {
+			return nil, err
+		}
+		if err := checkFinite(participant); err != nil {
+			return nil, err
+		}
+	}
+
+	models := make([]*weight_pb.TensorModel, len(participants))
+	for i, participant := range participants {
+		models[i] = participant.Model
+	}
+
+	rule := shared.AggregationRule{Name: opts.Rule.String(), Parameters: map[string]string{}}
+	if opts.ClipNorm > 0 {
+		if opts.ClipReference != nil {
+			if err := checkSameLayout(reference, Participant{Id: -1, Model: opts.ClipReference}); err != nil {
+				return nil, fmt.Errorf("clip reference: %w", err)
+			}
+			if err := checkFinite(Participant{Id: -1, Model: opts.ClipReference}); err != nil {
+				return nil, fmt.Errorf("clip reference: %w", err)
+			}
+		}
+		if models, err = clipModels(models, opts.ClipReference, opts.ClipNorm); err != nil {
+			return nil, err
+		}
+		rule.Parameters[ClipNormParameter] = formatFloat(opts.ClipNorm)
+	}
+
+	// Every participant contributes unless Krum or MultiKrum leave it out.
+	contributors := make([]int, len(participants))
+	for i := range contributors {
+		contributors[i] = i
+	}
+
+	var global *weight_pb.TensorModel
+	switch opts.Rule {
+	case FedAvg, FedProx, Sum:
+		global, err = weightedAggregate(reference, models, weights, totalWeight, opts.Rule == Sum)
+		if opts.Rule == FedAvg {
+			rule.Parameters[SampleCountMetadataKey] = strconv.FormatInt(totalWeight, 10)
+		}
+		if opts.Rule == FedProx && opts.ProximalMu > 0 {
+			rule.Parameters[ProximalMuMetadataKey] = formatFloat(opts.ProximalMu)
+		}
+	case Median:
+		global, err = coordinateWise(reference, models, median, medianInts)
+	case TrimmedMean:
+		trim := int(opts.TrimFraction * float64(len(models)))
+		if opts.TrimFraction < 0 || opts.TrimFraction >= 0.5 || 2*trim >= len(models) {
+			return nil, fmt.Errorf("invalid trim fraction %g for %d models, it must be in [0, 0.5) and leave a value", opts.TrimFraction, len(models))
+		}
+		global, err = coordinateWise(reference, models, trimmedMean(trim), trimmedMeanInts(trim))
+		rule.Parameters[TrimFractionParameter] = formatFloat(opts.TrimFraction)
+	case Krum, MultiKrum:
+		contributors, err = krumSelect(reference, models, opts)
+		if err != nil {
+			return nil, err
+		}
+		selectedModels := make([]*weight_pb.TensorModel, len(contributors))
+		selectedWeights := make([]int64, len(contributors))
+		for i, index := range contributors {
+			selectedModels[i], selectedWeights[i] = models[index], 1
+		}
+		global, err = weightedAggregate(reference, selectedModels, selectedWeights, int64(len(contributors)), false)
+
+		var rejectedIds []int
+		for i, participant := range participants {
+			if !slices.Contains(contributors, i) {
+				rejectedIds = append(rejectedIds, participant.Id)
+			}
+		}
+		rule.Parameters[ByzantineCountParameter] = strconv.Itoa(opts.ByzantineCount)
+		rule.Parameters[RejectedParameter] = formatIds(rejectedIds)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(contributors, func(a, b int) int { return participants[a].Id - participants[b].Id })
+	participantIds := make([]int, len(contributors))
+	for i, index := range contributors {
+		participantIds[i] = participants[index].Id
+	}
+	if opts.Rule == FedAvg {
+		sampleCounts := make([]string, len(contributors))
+		for i, index := range contributors {
+			sampleCounts[i] = strconv.FormatInt(weights[index], 10)
+		}
+		rule.Parameters[SampleCountsParameter] = strings.Join(sampleCounts, ",")
+	}
+
+	// The rule is recorded in the global model as well, so that it stays with the model.
+	global.Metadata[RuleMetadataKey] = rule.Name
+	for key, value := range rule.Parameters {
+		global.Metadata[key] = value
+	}
+	if len(rule.Parameters) == 0 {
+		rule.Parameters = nil
+	}
+
+	result := &Result{Model: global, ParticipantIds: participantIds, Rule: rule}
+
+	participantHashes := make(map[int]string, len(participants))
+	for _, participant := range participants {
+		if participant.HomomorphicHash != "" {
+			participantHashes[participant.Id] = participant.HomomorphicHash
+		}
+	}
+	if len(participantHashes) == len(participants) {
+		result.HomomorphicHash, err = result.AggregateHash(participantHashes)
+		if err != nil && !errors.Is(err, ErrNoAggregateHash) {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// weightedAggregate combines the tensors of the models with integer weights, into their weighted sum if sum is set
+// and their weighted average otherwise.
+func weightedAggregate(reference *weight_pb.TensorModel, models []*weight_pb.TensorModel, weights []int64, totalWeight int64, sum bool) (*weight_pb.TensorModel, error) {
+	global := weight_pb.NewTensorModel(reference.GetArchitectureId())
+	for _, tensor := range reference.GetTensors() {
+		var aggregated *weight_pb.Tensor
+		var err error
+		if isFloat(tensor.GetDtype()) {
+			aggregated, err = aggregateFloats(tensor, models, weights, totalWeight, sum)
+		} else {
+			aggregated, err = aggregateInts(tensor, models, weights, totalWeight, sum)
+		}
+		if err != nil {
+			return nil, err
+		}
+		global.Tensors = append(global.Tensors, aggregated)
+	}
+
+	return global, nil
+}
+
+// participantWeights returns the weight of each participant under the rule and their total.
+func participantWeights(participants []Participant, opts Options) ([]int64, int64, error) {
+	weights := make([]int64, len(participants))
+	seen := make(map[int]bool, len(participants))
+	var total int64
+
+	for i, participant := range participants {
+		if seen[participant.Id] {
+			return nil, 0, fmt.Errorf("participant %d is aggregated more than once", participant.Id)
+		}
+		seen[participant.Id] = true
+		if participant.Model == nil {
+			return nil, 0, fmt.Errorf("participant %d has no model", participant.Id)
+		}
+
+		switch opts.Rule {
+		case FedAvg:
+			weight, ok := opts.SampleCounts[participant.Id]
+			if !ok {
+				weight = participant.SampleCount
+			}
+			if weight <= 0 {
+				return nil, 0, fmt.Errorf("participant %d has no sample count for FedAvg", participant.Id)
+			}
+			weights[i] = weight
+		case FedProx, Sum, Median, TrimmedMean, Krum, MultiKrum:
+			weights[i] = 1
+		default:
+			return nil, 0, fmt.Errorf("unknown aggregation rule %v", opts.Rule)
+		}
+
+		if total > math.MaxInt64-weights[i] {
+			return nil, 0, errors.New("total sample count overflows")
+		}
+		total += weights[i]
+	}
+
+	return weights, total, nil
+}
+
+// checkSameLayout checks that a participant model has the architecture and the tensors of the reference model.
+func checkSameLayout(reference *weight_pb.TensorModel, participant Participant) error {
+	model := participant.Model
+	if model.GetArchitectureId() != reference.GetArchitectureId() {
+		return fmt.Errorf("model of participant %d has architecture %q, expected %q", participant.Id, model.GetArchitectureId(), reference.GetArchitectureId())
+	}
+	if len(model.GetTensors()) != len(reference.GetTensors()) {
+		return fmt.Errorf("model of participant %d has %d tensors, expected %d", participant.Id, len(model.GetTensors()), len(reference.GetTensors()))
+	}
+
+	for _, tensor := range reference.GetTensors() {
+		other := model.Tensor(tensor.GetName())
+		if other == nil {
+			return fmt.Errorf("model of participant %d has no tensor named %q", participant.Id, tensor.GetName())
+		}
+		if other.GetDtype() != tensor.GetDtype() || !slices.Equal(other.GetShape(), tensor.GetShape()) {
+			return fmt.Errorf("tensor %q of participant %d has shape %v and dtype %v, expected %v and %v",
+				tensor.GetName(), participant.Id, other.GetShape(), other.GetDtype(), tensor.GetShape(), tensor.GetDtype())
+		}
+	}
+
+	return nil
+}
+
+// checkFinite checks that the float tensors of a participant model hold neither NaN nor infinite values.
+func checkFinite(participant Participant) error {
+	for _, tensor := range participant.Model.GetTensors() {
+		if !isFloat(tensor.GetDtype()) {
+			continue
+		}
+		values, err := tensor.Float32s()
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+				return fmt.Errorf("element %d of tensor %q of participant %d is %v", i, tensor.GetName(), participant.Id, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// aggregateFloats combines the float tensors named like tensor in the models.
+func aggregateFloats(tensor *weight_pb.Tensor, models []*weight_pb.TensorModel, weights []int64, totalWeight int64, sum bool) (*weight_pb.Tensor, error) {
+	var accumulator []float64
+	for i, model := range models {
+		values, err := model.Tensor(tensor.GetName()).Float32s()
+		if err != nil {
+			return nil, err
+		}
+		if accumulator == nil {
+			accumulator = make([]float64, len(values))
+		}
+		for j, value := range values {
+			accumulator[j] += float64(weights[i]) * float64(value)
+		}
+	}
+
+	values := make([]float32, len(accumulator))
+	for i, value := range accumulator {
+		if !sum {
+			value /= float64(totalWeight)
+		}
+		values[i] = float32(value)
+	}
+
+	return newFloatTensor(tensor, values)
+}
+
+// newFloatTensor creates a tensor named and shaped like tensor, in its float dtype.
+func newFloatTensor(tensor *weight_pb.Tensor, values []float32) (*weight_pb.Tensor, error) {
+	switch tensor.GetDtype() {
+	case weight_pb.DType_DTYPE_FLOAT16:
+		return weight_pb.NewFloat16Tensor(tensor.GetName(), tensor.GetShape(), values)
+	case weight_pb.DType_DTYPE_BFLOAT16:
+		return weight_pb.NewBFloat16Tensor(tensor.GetName(), tensor.GetShape(), values)
+	default:
+		return weight_pb.NewFloat32Tensor(tensor.GetName(), tensor.GetShape(), values)
+	}
+}
+
+// aggregateInts combines the integer tensors named like tensor in the models, exactly.
+func aggregateInts(tensor *weight_pb.Tensor, models []*weight_pb.TensorModel, weights []int64, totalWeight int64, sum bool) (*weight_pb.Tensor, error) {
+	var accumulator []int128
+	for i, model := range models {
+		values, err := model.Tensor(tensor.GetName()).Int64s()
+		if err != nil {
+			return nil, err
+		}
+		if accumulator == nil {
+			accumulator = make([]int128, len(values))
+		}
+		for j, value := range values {
+			accumulator[j].addProduct(weights[i], value)
+		}
+	}
+
+	values := make([]int64, len(accumulator))
+	for i, value := range accumulator {
+		var err error
+		if sum {
+			values[i], err = value.int64()
+		} else {
+			values[i], err = value.div(totalWeight)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("element %d of tensor %q: %w", i, tensor.GetName(), err)
+		}
+	}
+
+	return newIntTensor(tensor, values)
+}
+
+// newIntTensor creates a tensor named and shaped like tensor, in its integer dtype, if the values fit it.
+func newIntTensor(tensor *weight_pb.Tensor, values []int64) (*weight_pb.Tensor, error) {
+	if tensor.GetDtype() != weight_pb.DType_DTYPE_INT8 {
+		return weight_pb.NewInt64Tensor(tensor.GetName(), tensor.GetShape(), values)
+	}
+
+	narrowed := make([]int8, len(values))
+	for i, value := range values {
+		if value < math.MinInt8 || value > math.MaxInt8 {
+			return nil, fmt.Errorf("element %d of tensor %q: %w", i, tensor.GetName(), errOverflow)
+		}
+		narrowed[i] = int8(value)
+	}
+
+	return weight_pb.NewInt8Tensor(tensor.GetName(), tensor.GetShape(), narrowed)
+}
+
+// formatIds formats a list of participant ids as a parameter of a rule.
+func formatIds(ids []int) string {
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = strconv.Itoa(id)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// formatFloat formats a parameter of a rule.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func isFloat(dtype weight_pb.DType) bool {
+	return dtype == weight_pb.DType_DTYPE_FLOAT32 || dtype == weight_pb.DType_DTYPE_FLOAT16 || dtype == weight_pb.DType_DTYPE_BFLOAT16
+}
@@ -0,0 +1,238 @@
+package aggregation
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// newParticipant creates a participant whose model has a float tensor and an int64 tensor.
+func newParticipant(t *testing.T, id int, sampleCount int64, floats []float32, ints []int64) Participant {
+	t.Helper()
+
+	model := weight_pb.NewTensorModel("mlp")
+	floatTensor, err := weight_pb.NewFloat32Tensor("weight", []int64{int64(len(floats))}, floats)
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+	intTensor, err := weight_pb.NewInt64Tensor("fixed", []int64{int64(len(ints))}, ints)
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+	model.Tensors = []*weight_pb.Tensor{floatTensor, intTensor}
+
+	return Participant{Id: id, Model: model, SampleCount: sampleCount}
+}
+
+func tensorValues(t *testing.T, model *weight_pb.TensorModel) ([]float32, []int64) {
+	t.Helper()
+
+	floats, err := model.Tensor("weight").Float32s()
+	if err != nil {
+		t.Fatalf("Failed to read floats: %v", err)
+	}
+	ints, err := model.Tensor("fixed").Int64s()
+	if err != nil {
+		t.Fatalf("Failed to read ints: %v", err)
+	}
+	return floats, ints
+}
+
+func TestAggregate(t *testing.T) {
+	participants := []Participant{
+		newParticipant(t, 7, 300, []float32{1, -1}, []int64{10, -10}),
+		newParticipant(t, 3, 100, []float32{5, 3}, []int64{20, -3}),
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		floats   []float32
+		ints     []int64
+		metadata map[string]string
+	}{
+		{
+			name:     "fedavg",
+			opts:     Options{Rule: FedAvg},
+			floats:   []float32{2, 0},
+			ints:     []int64{13, -8}, // 12.5 and -8.25 rounded
+			metadata: map[string]string{RuleMetadataKey: "fedavg", SampleCountMetadataKey: "400", SampleCountsParameter: "100,300"},
+		},
+		{
+			name:     "fedavg with sample counts",
+			opts:     Options{Rule: FedAvg, SampleCounts: map[int]int64{3: 300}},
+			floats:   []float32{3, 1},
+			ints:     []int64{15, -7}, // -6.5 rounded away from zero
+			metadata: map[string]string{RuleMetadataKey: "fedavg", SampleCountMetadataKey: "600", SampleCountsParameter: "300,300"},
+		},
+		{
+			name:     "fedprox",
+			opts:     Options{Rule: FedProx, ProximalMu: 0.01},
+			floats:   []float32{3, 1},
+			ints:     []int64{15, -7},
+			metadata: map[string]string{RuleMetadataKey: "fedprox", ProximalMuMetadataKey: "0.01"},
+		},
+		{
+			name:     "sum",
+			opts:     Options{Rule: Sum},
+			floats:   []float32{6, 2},
+			ints:     []int64{30, -13},
+			metadata: map[string]string{RuleMetadataKey: "sum"},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := Aggregate(participants, test.opts)
+		if err != nil {
+			t.Fatalf("%s: failed to aggregate: %v", test.name, err)
+		}
+
+		floats, ints := tensorValues(t, result.Model)
+		if !slices.Equal(floats, test.floats) || !slices.Equal(ints, test.ints) {
+			t.Fatalf("%s: expected %v and %v, got %v and %v", test.name, test.floats, test.ints, floats, ints)
+		}
+		if !slices.Equal(result.ParticipantIds, []int{3, 7}) || result.Model.ArchitectureId != "mlp" {
+			t.Fatalf("%s: unexpected result %v", test.name, result)
+		}
+		for key, value := range test.metadata {
+			if result.Model.Metadata[key] != value {
+				t.Fatalf("%s: expected metadata %s=%s, got %v", test.name, key, value, result.Model.Metadata)
+			}
+		}
+	}
+}
+
+func TestAggregateIntegersWithoutOverflow(t *testing.T) {
+	participants := []Participant{
+		newParticipant(t, 1, math.MaxInt64/2, []float32{0}, []int64{math.MaxInt64}),
+		newParticipant(t, 2, math.MaxInt64/2, []float32{0}, []int64{math.MaxInt64 - 2}),
+	}
+
+	// The weighted sum is far beyond int64, the average is not.
+	result, err := Aggregate(participants, Options{Rule: FedAvg})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if _, ints := tensorValues(t, result.Model); ints[0] != math.MaxInt64-1 {
+		t.Fatalf("Expected %d, got %d", int64(math.MaxInt64-1), ints[0])
+	}
+
+	participants[1] = newParticipant(t, 2, 1, []float32{0}, []int64{math.MinInt64})
+	result, err = Aggregate(participants, Options{Rule: Sum})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if _, ints := tensorValues(t, result.Model); ints[0] != -1 {
+		t.Fatalf("Expected -1, got %d", ints[0])
+	}
+
+	participants[1] = newParticipant(t, 2, 1, []float32{0}, []int64{1})
+	if _, err := Aggregate(participants, Options{Rule: Sum}); err == nil {
+		t.Fatalf("Expected a sum overflowing int64 to be rejected")
+	}
+}
+
+func TestAggregateRejectsInvalidParticipants(t *testing.T) {
+	valid := newParticipant(t, 1, 10, []float32{1, 2}, []int64{1, 2})
+
+	mismatched := newParticipant(t, 2, 10, []float32{1, 2, 3}, []int64{1, 2})
+	if _, err := Aggregate([]Participant{valid, mismatched}, Options{Rule: Sum}); err == nil {
+		t.Fatalf("Expected tensors of different shapes to be rejected")
+	}
+
+	if _, err := Aggregate([]Participant{valid, valid}, Options{Rule: Sum}); err == nil {
+		t.Fatalf("Expected a duplicate participant to be rejected")
+	}
+
+	noSamples := newParticipant(t, 2, 0, []float32{1, 2}, []int64{1, 2})
+	if _, err := Aggregate([]Participant{valid, noSamples}, Options{Rule: FedAvg}); err == nil {
+		t.Fatalf("Expected a participant without sample count to be rejected by FedAvg")
+	}
+
+	if _, err := Aggregate(nil, Options{Rule: Sum}); err == nil {
+		t.Fatalf("Expected an empty aggregation to be rejected")
+	}
+}
+
+func TestResultWeightModel(t *testing.T) {
+	participants := []Participant{
+		{Id: 1, Model: weight_pb.FromWeightModel(&weight_pb.WeightModel{Values: []int64{1, 2, 3}})},
+		{Id: 2, Model: weight_pb.FromWeightModel(&weight_pb.WeightModel{Values: []int64{10, 20, 30}})},
+	}
+
+	result, err := Aggregate(participants, Options{Rule: Sum})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	weightModel, err := result.WeightModel()
+	if err != nil || !slices.Equal(weightModel.Values, []int64{11, 22, 33}) {
+		t.Fatalf("Expected [11 22 33], got %v (%v)", weightModel, err)
+	}
+
+	result.Model.Tensors[0].Name = "weight"
+	if _, err := result.WeightModel(); err == nil {
+		t.Fatalf("Expected a tensor model not to convert to a WeightModel")
+	}
+}
+
+func TestResultAggregateHash(t *testing.T) {
+	values := map[int][]int64{1: {1, 2, 3}, 2: {10, 20, 30}, 3: {100, 200, 300}}
+	participantHashes := make(map[int]string, len(values))
+	var participants []Participant
+	for id := 1; id <= 3; id++ {
+		participantHashes[id] = homomorphic_hash.HashValues(values[id]).String()
+		participants = append(participants, Participant{Id: id, Model: weight_pb.FromWeightModel(&weight_pb.WeightModel{Values: values[id]}), SampleCount: int64(id)})
+	}
+
+	// The hash of a FedAvg result is that of the sum weighted by the sample counts, not of the published average.
+	result, err := Aggregate(participants, Options{Rule: FedAvg})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if result.HomomorphicHash != "" {
+		t.Fatalf("Expected no aggregate hash without the participants' hashes, got %s", result.HomomorphicHash)
+	}
+	aggregateHash, err := result.AggregateHash(participantHashes)
+	if err != nil {
+		t.Fatalf("Failed to compute the aggregate hash: %v", err)
+	}
+	if expected := homomorphic_hash.HashValues([]int64{321, 642, 963}).String(); aggregateHash != expected {
+		t.Fatalf("Expected the hash of the weighted sum %s, got %s", expected, aggregateHash)
+	}
+
+	// With the participants' hashes known, the result carries it.
+	for i := range participants {
+		participants[i].HomomorphicHash = participantHashes[participants[i].Id]
+	}
+	result, err = Aggregate(participants, Options{Rule: FedAvg})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if result.HomomorphicHash != aggregateHash {
+		t.Fatalf("Expected the result to carry %s, got %s", aggregateHash, result.HomomorphicHash)
+	}
+
+	result, err = Aggregate(participants, Options{Rule: Median})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if _, err := result.AggregateHash(participantHashes); !errors.Is(err, ErrNoAggregateHash) {
+		t.Fatalf("Expected ErrNoAggregateHash for a median, got %v", err)
+	}
+	if result.HomomorphicHash != "" {
+		t.Fatalf("Expected no aggregate hash for a median, got %s", result.HomomorphicHash)
+	}
+
+	delete(participantHashes, 2)
+	result, err = Aggregate(participants, Options{Rule: Sum})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if _, err := result.AggregateHash(participantHashes); err == nil {
+		t.Fatalf("Expected a missing participant hash to be rejected")
+	}
+}
@@ -0,0 +1,79 @@
+package aggregation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/wrapper"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// MetadataSource provides the participant model metadata records of an epoch.
+// It is implemented by fabric_client.MetadataService.
+type MetadataSource interface {
+	GetAllParticipantModelMetadataByEpoch(epoch int) ([]shared.ParticipantModelMetadata, error)
+}
+
+// ModelStore retrieves participant models. It is implemented by ipfs_client.IpfsClient.
+type ModelStore interface {
+	GetEpochFiles(ctx context.Context, epoch int, participantMetadata []shared.ParticipantModelMetadata, concurrency int) ([]shared.ParticipantModelMetadata, <-chan ipfs_client.FileResult, error)
+	GetTensorModel(ctx context.Context, cid string) (*weight_pb.TensorModel, error)
+}
+
+// FetchEpoch retrieves the participant models recorded for an epoch, in parallel, ordered by participant id.
+// Models may be stored as WeightModels, TensorModels or model updates, whose bases are retrieved as well.
+// The sample count of each participant is read from the SampleCountMetadataKey of its model, if present, and its
+// homomorphic hash from its metadata record.
+// The first model that cannot be retrieved or decoded fails the whole fetch and cancels the downloads still running.
+func FetchEpoch(ctx context.Context, metadata MetadataSource, store ModelStore, epoch int, concurrency int) ([]Participant, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	participantMetadata, err := metadata.GetAllParticipantModelMetadataByEpoch(epoch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the participant model metadata of epoch %d: %w", epoch, err)
+	}
+
+	records, results, err := store.GetEpochFiles(ctx, epoch, participantMetadata, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	participants := make([]Participant, len(records))
+	for range records {
+		result := <-results
+		record := records[result.Index]
+		if result.Err != nil {
+			return nil, fmt.Errorf("failed to fetch the model of participant %d: %w", record.ParticipantId, result.Err)
+		}
+
+		model, err := weight_pb.DecodeModel(ctx, result.Data, store.GetTensorModel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the model of participant %d: %w", record.ParticipantId, err)
+		}
+
+		participants[result.Index] = Participant{Id: record.ParticipantId, Model: model, HomomorphicHash: record.HomomorphicHash}
+		if sampleCount, ok := model.GetMetadata()[SampleCountMetadataKey]; ok {
+			participants[result.Index].SampleCount, err = strconv.ParseInt(sampleCount, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("model of participant %d has an invalid sample count %q", record.ParticipantId, sampleCount)
+			}
+		}
+	}
+
+	return participants, nil
+}
+
+// AggregateEpoch retrieves the participant models recorded for an epoch and aggregates them with Aggregate.
+// The participants' homomorphic hashes are known, so the result carries its aggregate homomorphic hash, if the rule
+// has one, and can be recorded in the aggregator's model metadata as it is.
+func AggregateEpoch(ctx context.Context, metadata MetadataSource, store ModelStore, epoch int, opts Options) (*Result, error) {
+	participants, err := FetchEpoch(ctx, metadata, store, epoch, opts.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	return Aggregate(participants, opts)
+}
@@ -0,0 +1,147 @@
+package aggregation
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
+	"github.com/thcrull/fabric-ipfs-interface/interface/fabric/wrapper"
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/wrapper"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ MetadataSource = (*fabric_client.MetadataService)(nil)
+var _ ModelStore = (*ipfs_client.IpfsClient)(nil)
+
+// testMetadata is a MetadataSource returning fixed records.
+type testMetadata []shared.ParticipantModelMetadata
+
+func (m testMetadata) GetAllParticipantModelMetadataByEpoch(epoch int) ([]shared.ParticipantModelMetadata, error) {
+	var records []shared.ParticipantModelMetadata
+	for _, record := range m {
+		if record.Epoch == epoch {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// testStore is a ModelStore serving serialised models by CID.
+type testStore map[string][]byte
+
+func (s testStore) GetEpochFiles(ctx context.Context, epoch int, participantMetadata []shared.ParticipantModelMetadata, concurrency int) ([]shared.ParticipantModelMetadata, <-chan ipfs_client.FileResult, error) {
+	records := slices.Clone(participantMetadata)
+	slices.SortFunc(records, func(a, b shared.ParticipantModelMetadata) int { return a.ParticipantId - b.ParticipantId })
+
+	results := make(chan ipfs_client.FileResult, len(records))
+	for i := len(records) - 1; i >= 0; i-- {
+		data, ok := s[records[i].ModelHashCid]
+		result := ipfs_client.FileResult{Index: i, Cid: records[i].ModelHashCid, Data: data}
+		if !ok {
+			result.Err = errors.New("not found")
+		}
+		results <- result
+	}
+	close(results)
+
+	return records, results, nil
+}
+
+func (s testStore) GetTensorModel(ctx context.Context, cid string) (*weight_pb.TensorModel, error) {
+	data, ok := s[cid]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return weight_pb.DecodeModel(ctx, data, s.GetTensorModel)
+}
+
+// cancelStore is a testStore recording the context of the fetch.
+type cancelStore struct {
+	testStore
+	ctx context.Context
+}
+
+func (s *cancelStore) GetEpochFiles(ctx context.Context, epoch int, participantMetadata []shared.ParticipantModelMetadata, concurrency int) ([]shared.ParticipantModelMetadata, <-chan ipfs_client.FileResult, error) {
+	s.ctx = ctx
+	return s.testStore.GetEpochFiles(ctx, epoch, participantMetadata, concurrency)
+}
+
+func marshal(t *testing.T, message proto.Message) []byte {
+	t.Helper()
+
+	data, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	return data
+}
+
+func TestAggregateEpoch(t *testing.T) {
+	base := newParticipant(t, 0, 0, []float32{1, 1}, []int64{1, 1}).Model
+	first := newParticipant(t, 0, 0, []float32{2, 4}, []int64{10, 20}).Model
+	first.Metadata[SampleCountMetadataKey] = "1"
+	second := newParticipant(t, 0, 0, []float32{5, 1}, []int64{40, 50}).Model
+	second.Metadata[SampleCountMetadataKey] = "2"
+	delta, err := weight_pb.EncodeDelta("/ipfs/base", base, second, weight_pb.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to encode delta: %v", err)
+	}
+
+	store := testStore{
+		"/ipfs/base":   marshal(t, base),
+		"/ipfs/first":  marshal(t, first),
+		"/ipfs/second": marshal(t, delta),
+		"/ipfs/other":  marshal(t, base),
+	}
+	metadata := testMetadata{
+		{Epoch: 1, ParticipantId: 9, ModelHashCid: "/ipfs/second", HomomorphicHash: homomorphic_hash.HashValues([]int64{40, 50}).String()},
+		{Epoch: 1, ParticipantId: 4, ModelHashCid: "/ipfs/first", HomomorphicHash: homomorphic_hash.HashValues([]int64{10, 20}).String()},
+		{Epoch: 2, ParticipantId: 4, ModelHashCid: "/ipfs/other"},
+	}
+
+	participants, err := FetchEpoch(context.Background(), metadata, store, 1, 0)
+	if err != nil {
+		t.Fatalf("Failed to fetch epoch: %v", err)
+	}
+	if len(participants) != 2 || participants[0].Id != 4 || participants[1].Id != 9 || participants[1].SampleCount != 2 {
+		t.Fatalf("Unexpected participants %v", participants)
+	}
+
+	result, err := AggregateEpoch(context.Background(), metadata, store, 1, Options{Rule: FedAvg})
+	if err != nil {
+		t.Fatalf("Failed to aggregate epoch: %v", err)
+	}
+	floats, ints := tensorValues(t, result.Model)
+	if !slices.Equal(floats, []float32{4, 2}) || !slices.Equal(ints, []int64{30, 40}) || !slices.Equal(result.ParticipantIds, []int{4, 9}) {
+		t.Fatalf("Unexpected global model %v and %v from %v", floats, ints, result.ParticipantIds)
+	}
+	// The result can be recorded as it is: its hash combines the participants' ones with their sample counts.
+	if expected := homomorphic_hash.HashValues([]int64{10 + 2*40, 20 + 2*50}).String(); result.HomomorphicHash != expected {
+		t.Fatalf("Expected the aggregate hash %s, got %s", expected, result.HomomorphicHash)
+	}
+
+	delete(store, "/ipfs/first")
+	if _, err := AggregateEpoch(context.Background(), metadata, store, 1, Options{Rule: FedAvg}); err == nil {
+		t.Fatalf("Expected a missing model to fail the aggregation")
+	}
+}
+
+func TestFetchEpochCancelsOnError(t *testing.T) {
+	model := newParticipant(t, 0, 0, []float32{1}, []int64{1}).Model
+	store := &cancelStore{testStore: testStore{"/ipfs/first": marshal(t, model)}}
+	metadata := testMetadata{
+		{Epoch: 1, ParticipantId: 1, ModelHashCid: "/ipfs/first"},
+		{Epoch: 1, ParticipantId: 2, ModelHashCid: "/ipfs/missing"},
+	}
+
+	if _, err := FetchEpoch(context.Background(), metadata, store, 1, 0); err == nil {
+		t.Fatalf("Expected a missing model to fail the fetch")
+	}
+	if store.ctx.Err() == nil {
+		t.Fatalf("Expected the remaining downloads to be cancelled")
+	}
+}
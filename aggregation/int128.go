@@ -0,0 +1,90 @@
+package aggregation
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// errOverflow is returned when an aggregated integer does not fit its dtype.
+var errOverflow = errors.New("integer overflow")
+
+// int128 is a signed 128-bit integer in two's complement, wide enough to accumulate weighted sums of int64 values
+// without overflowing: a product of two int64 values takes at most 127 bits.
+type int128 struct {
+	hi uint64
+	lo uint64
+}
+
+// addProduct adds weight * value, weight being positive.
+func (x *int128) addProduct(weight int64, value int64) {
+	hi, lo := bits.Mul64(uint64(weight), magnitude(value))
+	product := int128{hi: hi, lo: lo}
+	if value < 0 {
+		product = product.negate()
+	}
+
+	var carry uint64
+	x.lo, carry = bits.Add64(x.lo, product.lo, 0)
+	x.hi, _ = bits.Add64(x.hi, product.hi, carry)
+}
+
+// negate returns -x.
+func (x int128) negate() int128 {
+	lo, borrow := bits.Sub64(0, x.lo, 0)
+	hi, _ := bits.Sub64(0, x.hi, borrow)
+	return int128{hi: hi, lo: lo}
+}
+
+func (x int128) negative() bool {
+	return x.hi>>63 == 1
+}
+
+// int64 returns x if it fits an int64.
+func (x int128) int64() (int64, error) {
+	if (x.hi == 0 && x.lo>>63 == 0) || (x.hi == math.MaxUint64 && x.lo>>63 == 1) {
+		return int64(x.lo), nil
+	}
+
+	return 0, errOverflow
+}
+
+// div returns x / divisor rounded to the nearest integer, halves away from zero, if it fits an int64.
+// divisor must be positive.
+func (x int128) div(divisor int64) (int64, error) {
+	abs := x
+	if x.negative() {
+		abs = x.negate()
+	}
+	if abs.hi >= uint64(divisor) {
+		return 0, errOverflow
+	}
+
+	quotient, remainder := bits.Div64(abs.hi, abs.lo, uint64(divisor))
+	if remainder >= uint64(divisor)-remainder {
+		if quotient == math.MaxUint64 {
+			return 0, errOverflow
+		}
+		quotient++
+	}
+
+	if x.negative() {
+		if quotient > 1<<63 {
+			return 0, errOverflow
+		}
+		return int64(-quotient), nil
+	}
+	if quotient > math.MaxInt64 {
+		return 0, errOverflow
+	}
+
+	return int64(quotient), nil
+}
+
+// magnitude returns the absolute value of an int64, which fits a uint64 even for math.MinInt64.
+func magnitude(value int64) uint64 {
+	if value < 0 {
+		return -uint64(value)
+	}
+	return uint64(value)
+}
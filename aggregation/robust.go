@@ -0,0 +1,289 @@
+package aggregation
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// coordinateWise combines each element of the tensors of the models on its own, float elements with combineFloats
+// and integer elements with combineInts. Both may reorder the column of values they are given.
+func coordinateWise(reference *weight_pb.TensorModel, models []*weight_pb.TensorModel, combineFloats func([]float64) float64, combineInts func([]int64) (int64, error)) (*weight_pb.TensorModel, error) {
+	global := weight_pb.NewTensorModel(reference.GetArchitectureId())
+
+	for _, tensor := range reference.GetTensors() {
+		var aggregated *weight_pb.Tensor
+		var err error
+		if isFloat(tensor.GetDtype()) {
+			aggregated, err = coordinateWiseFloats(tensor, models, combineFloats)
+		} else {
+			aggregated, err = coordinateWiseInts(tensor, models, combineInts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		global.Tensors = append(global.Tensors, aggregated)
+	}
+
+	return global, nil
+}
+
+func coordinateWiseFloats(tensor *weight_pb.Tensor, models []*weight_pb.TensorModel, combine func([]float64) float64) (*weight_pb.Tensor, error) {
+	rows := make([][]float32, len(models))
+	for i, model := range models {
+		var err error
+		if rows[i], err = model.Tensor(tensor.GetName()).Float32s(); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]float32, len(rows[0]))
+	column := make([]float64, len(models))
+	for j := range values {
+		for i, row := range rows {
+			column[i] = float64(row[j])
+		}
+		values[j] = float32(combine(column))
+	}
+
+	return newFloatTensor(tensor, values)
+}
+
+func coordinateWiseInts(tensor *weight_pb.Tensor, models []*weight_pb.TensorModel, combine func([]int64) (int64, error)) (*weight_pb.Tensor, error) {
+	rows := make([][]int64, len(models))
+	for i, model := range models {
+		var err error
+		if rows[i], err = model.Tensor(tensor.GetName()).Int64s(); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]int64, len(rows[0]))
+	column := make([]int64, len(models))
+	for j := range values {
+		for i, row := range rows {
+			column[i] = row[j]
+		}
+		var err error
+		if values[j], err = combine(column); err != nil {
+			return nil, fmt.Errorf("element %d of tensor %q: %w", j, tensor.GetName(), err)
+		}
+	}
+
+	return newIntTensor(tensor, values)
+}
+
+// median returns the median of values, the mean of the two middle values if their number is even.
+func median(values []float64) float64 {
+	slices.Sort(values)
+	middle := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[middle]
+	}
+
+	return (values[middle-1] + values[middle]) / 2
+}
+
+// medianInts returns the median of values, the mean of the two middle values rounded if their number is even.
+func medianInts(values []int64) (int64, error) {
+	slices.Sort(values)
+	middle := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[middle], nil
+	}
+
+	var sum int128
+	sum.addProduct(1, values[middle-1])
+	sum.addProduct(1, values[middle])
+	return sum.div(2)
+}
+
+// trimmedMean returns a function averaging values without their trim largest and smallest ones.
+func trimmedMean(trim int) func([]float64) float64 {
+	return func(values []float64) float64 {
+		slices.Sort(values)
+
+		var sum float64
+		for _, value := range values[trim : len(values)-trim] {
+			sum += value
+		}
+		return sum / float64(len(values)-2*trim)
+	}
+}
+
+// trimmedMeanInts returns a function averaging values without their trim largest and smallest ones, exactly.
+func trimmedMeanInts(trim int) func([]int64) (int64, error) {
+	return func(values []int64) (int64, error) {
+		slices.Sort(values)
+
+		var sum int128
+		for _, value := range values[trim : len(values)-trim] {
+			sum.addProduct(1, value)
+		}
+		return sum.div(int64(len(values) - 2*trim))
+	}
+}
+
+// krumSelect returns the indices, in ascending order, of the model with the best Krum score, or of the
+// opts.SelectionCount best models for MultiKrum. The score of a model is the sum of its squared distances to its
+// n - f - 2 nearest neighbours, which is low for the honest models clustered together.
+func krumSelect(reference *weight_pb.TensorModel, models []*weight_pb.TensorModel, opts Options) ([]int, error) {
+	n, f := len(models), opts.ByzantineCount
+	if f < 0 || n <= 2*f+2 {
+		return nil, fmt.Errorf("krum needs more than %d models to tolerate %d poisoned ones, got %d", 2*f+2, f, n)
+	}
+
+	selectionCount := 1
+	if opts.Rule == MultiKrum {
+		selectionCount = opts.SelectionCount
+		if selectionCount <= 0 {
+			selectionCount = n - f
+		}
+		if selectionCount > n {
+			return nil, fmt.Errorf("cannot select %d models out of %d", selectionCount, n)
+		}
+	}
+
+	distances := make([][]float64, n)
+	for i := range distances {
+		distances[i] = make([]float64, n)
+	}
+	for _, tensor := range reference.GetTensors() {
+		rows := make([][]float64, n)
+		for i, model := range models {
+			var err error
+			if rows[i], err = float64s(model.Tensor(tensor.GetName())); err != nil {
+				return nil, err
+			}
+		}
+
+		for i := range n {
+			for j := i + 1; j < n; j++ {
+				var distance float64
+				for k := range rows[i] {
+					diff := rows[i][k] - rows[j][k]
+					distance += diff * diff
+				}
+				distances[i][j] += distance
+				distances[j][i] += distance
+			}
+		}
+	}
+
+	scores := make([]float64, n)
+	for i := range n {
+		neighbours := slices.Concat(distances[i][:i], distances[i][i+1:])
+		slices.Sort(neighbours)
+		for _, distance := range neighbours[:n-f-2] {
+			scores[i] += distance
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case scores[a] < scores[b]:
+			return -1
+		case scores[a] > scores[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	selected := order[:selectionCount]
+	slices.Sort(selected)
+	return selected, nil
+}
+
+// clipModels scales down the update of every model, its difference to the reference model or the model itself if
+// reference is nil, whose L2 norm over all tensors exceeds clipNorm, so that a single model cannot dominate the
+// aggregation. Integer elements of clipped models are rounded.
+func clipModels(models []*weight_pb.TensorModel, reference *weight_pb.TensorModel, clipNorm float64) ([]*weight_pb.TensorModel, error) {
+	clipped := make([]*weight_pb.TensorModel, len(models))
+
+	for i, model := range models {
+		updates := make([][]float64, len(model.GetTensors()))
+		bases := make([][]float64, len(model.GetTensors()))
+		var squaredNorm float64
+		for t, tensor := range model.GetTensors() {
+			values, err := float64s(tensor)
+			if err != nil {
+				return nil, err
+			}
+			base := make([]float64, len(values))
+			if reference != nil {
+				if base, err = float64s(reference.Tensor(tensor.GetName())); err != nil {
+					return nil, err
+				}
+			}
+			for k := range values {
+				values[k] -= base[k]
+				squaredNorm += values[k] * values[k]
+			}
+			updates[t], bases[t] = values, base
+		}
+
+		norm := math.Sqrt(squaredNorm)
+		if norm <= clipNorm {
+			clipped[i] = model
+			continue
+		}
+
+		scale := clipNorm / norm
+		clipped[i] = weight_pb.NewTensorModel(model.GetArchitectureId())
+		for t, tensor := range model.GetTensors() {
+			var clippedTensor *weight_pb.Tensor
+			var err error
+			if isFloat(tensor.GetDtype()) {
+				values := make([]float32, len(updates[t]))
+				for k, update := range updates[t] {
+					values[k] = float32(bases[t][k] + update*scale)
+				}
+				clippedTensor, err = newFloatTensor(tensor, values)
+			} else {
+				values := make([]int64, len(updates[t]))
+				for k, update := range updates[t] {
+					values[k] = int64(math.Round(bases[t][k] + update*scale))
+				}
+				clippedTensor, err = newIntTensor(tensor, values)
+			}
+			if err != nil {
+				return nil, err
+			}
+			clipped[i].Tensors = append(clipped[i].Tensors, clippedTensor)
+		}
+	}
+
+	return clipped, nil
+}
+
+// float64s returns the elements of a tensor as float64 values, exactly for integers up to 2^53.
+func float64s(tensor *weight_pb.Tensor) ([]float64, error) {
+	if !isFloat(tensor.GetDtype()) {
+		ints, err := tensor.Int64s()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]float64, len(ints))
+		for i, value := range ints {
+			values[i] = float64(value)
+		}
+		return values, nil
+	}
+
+	floats, err := tensor.Float32s()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, len(floats))
+	for i, value := range floats {
+		values[i] = float64(value)
+	}
+	return values, nil
+}
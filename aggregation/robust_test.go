@@ -0,0 +1,151 @@
+package aggregation
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// newPoisonedParticipants creates four honest participants around (1, 10) and a poisoned one far away.
+func newPoisonedParticipants(t *testing.T) []Participant {
+	t.Helper()
+
+	return []Participant{
+		newParticipant(t, 1, 1, []float32{1, 1.5}, []int64{10, 11}),
+		newParticipant(t, 2, 1, []float32{1.2, 1}, []int64{9, 10}),
+		newParticipant(t, 3, 1, []float32{0.8, 0.5}, []int64{11, 10}),
+		newParticipant(t, 4, 1, []float32{1, 1}, []int64{10, 9}),
+		newParticipant(t, 5, 1, []float32{1000, -1000}, []int64{1 << 40, -1 << 40}),
+	}
+}
+
+func TestMedian(t *testing.T) {
+	participants := newPoisonedParticipants(t)
+
+	result, err := Aggregate(participants, Options{Rule: Median})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	floats, ints := tensorValues(t, result.Model)
+	if !slices.Equal(floats, []float32{1, 1}) || !slices.Equal(ints, []int64{10, 10}) {
+		t.Fatalf("Expected the median to ignore the poisoned model, got %v and %v", floats, ints)
+	}
+	if result.Rule.Name != "median" || result.Model.Metadata[RuleMetadataKey] != "median" {
+		t.Fatalf("Expected the median rule to be recorded, got %v", result.Rule)
+	}
+
+	// With an even number of models, the two middle values are averaged and integers rounded.
+	result, err = Aggregate(participants[:4], Options{Rule: Median})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	floats, ints = tensorValues(t, result.Model)
+	if !slices.Equal(floats, []float32{1, 1}) || !slices.Equal(ints, []int64{10, 10}) {
+		t.Fatalf("Unexpected median %v and %v", floats, ints)
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	participants := newPoisonedParticipants(t)
+
+	result, err := Aggregate(participants, Options{Rule: TrimmedMean, TrimFraction: 0.2})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	floats, ints := tensorValues(t, result.Model)
+	// The smallest and largest value of each coordinate are trimmed, leaving (1, 1, 1.2) and (0.5, 1, 1).
+	if math.Abs(float64(floats[0])-3.2/3) > 1e-6 || math.Abs(float64(floats[1])-2.5/3) > 1e-6 || !slices.Equal(ints, []int64{10, 10}) {
+		t.Fatalf("Expected the trimmed mean to ignore the poisoned model, got %v and %v", floats, ints)
+	}
+	if result.Rule.Parameters[TrimFractionParameter] != "0.2" {
+		t.Fatalf("Expected the trim fraction to be recorded, got %v", result.Rule)
+	}
+
+	if _, err := Aggregate(participants, Options{Rule: TrimmedMean, TrimFraction: 0.5}); err == nil {
+		t.Fatalf("Expected a trim fraction leaving no value to be rejected")
+	}
+}
+
+func TestKrum(t *testing.T) {
+	participants := newPoisonedParticipants(t)
+
+	result, err := Aggregate(participants, Options{Rule: Krum, ByzantineCount: 1})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	floats, ints := tensorValues(t, result.Model)
+	if !slices.Equal(floats, []float32{1, 1}) || !slices.Equal(ints, []int64{10, 9}) {
+		t.Fatalf("Expected Krum to select the model of participant 4, got %v and %v", floats, ints)
+	}
+	// Only the selected participant contributed to the global model, the others are recorded as rejected.
+	if !slices.Equal(result.ParticipantIds, []int{4}) {
+		t.Fatalf("Expected only the selected participant to be listed, got %v", result.ParticipantIds)
+	}
+	if result.Rule.Parameters[RejectedParameter] != "1,2,3,5" || result.Rule.Parameters[ByzantineCountParameter] != "1" {
+		t.Fatalf("Expected the rejected participants to be recorded, got %v", result.Rule)
+	}
+
+	result, err = Aggregate(participants, Options{Rule: MultiKrum, ByzantineCount: 1})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if !slices.Equal(result.ParticipantIds, []int{1, 2, 3, 4}) || result.Rule.Parameters[RejectedParameter] != "5" {
+		t.Fatalf("Expected Multi-Krum to select the honest models, got %v and %v", result.ParticipantIds, result.Rule)
+	}
+	floats, ints = tensorValues(t, result.Model)
+	if !slices.Equal(floats, []float32{1, 1}) || !slices.Equal(ints, []int64{10, 10}) {
+		t.Fatalf("Unexpected Multi-Krum average %v and %v", floats, ints)
+	}
+
+	if _, err := Aggregate(participants, Options{Rule: Krum, ByzantineCount: 2}); err == nil {
+		t.Fatalf("Expected Krum to reject too few models for the poisoned ones tolerated")
+	}
+}
+
+func TestRobustRulesRejectNonFiniteModels(t *testing.T) {
+	// NaN distances would sort first and give the poisoned model the best Krum score.
+	participants := newPoisonedParticipants(t)
+	participants[4] = newParticipant(t, 5, 1, []float32{float32(math.NaN()), 1e30}, []int64{10, 10})
+
+	for _, rule := range []Rule{Krum, MultiKrum, Median, TrimmedMean, FedAvg} {
+		if _, err := Aggregate(participants, Options{Rule: rule, ByzantineCount: 1, TrimFraction: 0.2}); err == nil {
+			t.Fatalf("Expected %v to reject a NaN model", rule)
+		}
+	}
+
+	participants[4] = newParticipant(t, 5, 1, []float32{float32(math.Inf(-1)), 1}, []int64{10, 10})
+	if _, err := Aggregate(participants, Options{Rule: Krum, ByzantineCount: 1}); err == nil {
+		t.Fatalf("Expected Krum to reject an infinite model")
+	}
+}
+
+func TestNormClipping(t *testing.T) {
+	reference := newParticipant(t, 0, 0, []float32{1, 1}, []int64{10, 10}).Model
+	participants := []Participant{
+		newParticipant(t, 1, 1, []float32{1, 1}, []int64{13, 14}), // Update of norm 5.
+		newParticipant(t, 2, 1, []float32{1, 1}, []int64{10, 11}), // Update of norm 1.
+	}
+
+	result, err := Aggregate(participants, Options{Rule: Sum, ClipNorm: 2.5, ClipReference: reference})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	// The first update is halved to (1.5, 2), giving (11.5, 12) rounded, the second is kept.
+	floats, ints := tensorValues(t, result.Model)
+	if !slices.Equal(floats, []float32{2, 2}) || !slices.Equal(ints, []int64{22, 23}) {
+		t.Fatalf("Unexpected clipped sum %v and %v", floats, ints)
+	}
+	if result.Rule.Name != "sum" || result.Rule.Parameters[ClipNormParameter] != "2.5" {
+		t.Fatalf("Expected the clip norm to be recorded, got %v", result.Rule)
+	}
+
+	// Without reference, the models are updates themselves.
+	result, err = Aggregate(participants[1:], Options{Rule: FedProx, ClipNorm: 1})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	floats, _ = tensorValues(t, result.Model)
+	if norm := floats[0] * floats[0] * 223; norm > 1.01 {
+		t.Fatalf("Expected the model to be clipped to norm 1, got %v", floats)
+	}
+}
@@ -2,7 +2,6 @@ package bench
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,8 +9,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
 	"github.com/thcrull/fabric-ipfs-interface/interface/fabric/wrapper"
 	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/wrapper"
+	"github.com/thcrull/fabric-ipfs-interface/model_io"
 	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
 )
 
@@ -23,24 +24,6 @@ var aux = 0
 var participantId = 10
 var aggregatorId = 20
 
-func readVec(path string) ([]int64, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	if len(data)%8 != 0 {
-		return nil, fmt.Errorf("file %s invalid size", path)
-	}
-
-	n := len(data) / 8
-	out := make([]int64, n)
-	for i := range out {
-		bits := binary.LittleEndian.Uint64(data[i*8 : i*8+8])
-		out[i] = int64(bits)
-	}
-	return out, nil
-}
-
 func listDataFiles(dir string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -67,6 +50,7 @@ func runEpoch(
 	meta *fabric_client.MetadataService,
 	ipfs *ipfs_client.IpfsClient,
 	vec []int64,
+	homomorphicHash string,
 	cids *[]string,
 ) error {
 
@@ -82,7 +66,7 @@ func runEpoch(
 	*cids = append(*cids, cid)
 
 	// Add metadata
-	if err := meta.AddParticipantModelMetadata(participantId, aux, cid, "homomorphic-hash"); err != nil {
+	if err := meta.AddParticipantModelMetadata(participantId, aux, cid, homomorphicHash); err != nil {
 		return err
 	}
 	aux++
@@ -94,11 +78,14 @@ func runBenchmark(b *testing.B, file string, epochs int) {
 	// -------------------------------
 	// Load vector once
 	// -------------------------------
-	vec, err := readVec(file)
+	vec, err := model_io.ReadBinFile(file)
 	if err != nil {
 		b.Fatalf("read vec: %v", err)
 	}
 
+	// The vector is the same every epoch, so its homomorphic hash is computed once, outside the measured part.
+	homomorphicHash := homomorphic_hash.HashValues(vec).String()
+
 	// -------------------------------
 	// Setup Fabric & IPFS
 	// -------------------------------
@@ -135,7 +122,7 @@ func runBenchmark(b *testing.B, file string, epochs int) {
 	b.ResetTimer()
 
 	for i := 0; i < epochs; i++ {
-		if err := runEpoch(ctx, meta, ipfs, vec, &createdCids); err != nil {
+		if err := runEpoch(ctx, meta, ipfs, vec, homomorphicHash, &createdCids); err != nil {
 			b.Fatalf("epoch %d: %v", i, err)
 		}
 	}
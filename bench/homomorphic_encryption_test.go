@@ -0,0 +1,120 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/aggregation"
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_encryption"
+	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// These benchmarks compare the aggregation of plaintext models with that of models encrypted with the Paillier
+// cryptosystem, and need neither Fabric nor IPFS. Run them with: go test ./bench -bench Aggregation -run ^$
+
+var encryptionSizes = []int{1_000, 10_000}
+
+const encryptionParticipants = 10
+
+// -------------------------------
+// Helpers
+// -------------------------------
+
+// randomModels returns count weight models of size random values in a range whose sum fits an int64.
+func randomModels(count int, size int) []*pb.WeightModel {
+	random := rand.New(rand.NewPCG(1, 2))
+
+	models := make([]*pb.WeightModel, count)
+	for i := range models {
+		values := make([]int64, size)
+		for j := range values {
+			values[j] = random.Int64N(1<<40) - 1<<39
+		}
+		models[i] = &pb.WeightModel{Values: values}
+	}
+	return models
+}
+
+// benchmarkKey generates a key of the default size, which takes a while, so it is excluded from the timings.
+func benchmarkKey(b *testing.B) *homomorphic_encryption.PrivateKey {
+	b.Helper()
+
+	key, err := homomorphic_encryption.GenerateKey(nil, homomorphic_encryption.DefaultKeyBits)
+	if err != nil {
+		b.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+// -------------------------------
+// Benchmarks
+// -------------------------------
+
+// BenchmarkPlaintextAggregation sums plaintext models at the aggregator.
+func BenchmarkPlaintextAggregation(b *testing.B) {
+	for _, size := range encryptionSizes {
+		b.Run(fmt.Sprintf("%d_values", size), func(b *testing.B) {
+			models := randomModels(encryptionParticipants, size)
+			participants := make([]aggregation.Participant, len(models))
+			for i, model := range models {
+				participants[i] = aggregation.Participant{Id: i, Model: pb.FromWeightModel(model)}
+			}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := aggregation.Aggregate(participants, aggregation.Options{Rule: aggregation.Sum}); err != nil {
+					b.Fatalf("aggregate: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncryptedAggregation measures each step of the encrypted path: a participant encrypting its model,
+// the aggregator adding the encrypted models and a key holder decrypting the sum.
+func BenchmarkEncryptedAggregation(b *testing.B) {
+	key := benchmarkKey(b)
+
+	for _, size := range encryptionSizes {
+		models := randomModels(encryptionParticipants, size)
+		encrypted := make([]*pb.EncryptedModel, len(models))
+		for i, model := range models {
+			var err error
+			if encrypted[i], err = key.PublicKey.EncryptModel(nil, model, 0); err != nil {
+				b.Fatalf("encrypt: %v", err)
+			}
+		}
+		sum, err := homomorphic_encryption.Add(encrypted...)
+		if err != nil {
+			b.Fatalf("add: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("%d_values/encrypt", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := key.PublicKey.EncryptModel(nil, models[0], 0); err != nil {
+					b.Fatalf("encrypt: %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("%d_values/add", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := homomorphic_encryption.Add(encrypted...); err != nil {
+					b.Fatalf("add: %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("%d_values/decrypt", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := key.DecryptModel(sum); err != nil {
+					b.Fatalf("decrypt: %v", err)
+				}
+			}
+		})
+	}
+}
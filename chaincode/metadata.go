@@ -3,7 +3,11 @@ package chaincode
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
 	"github.com/thcrull/fabric-ipfs-interface/shared"
 
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
@@ -395,6 +399,7 @@ func (s *MetadataSmartContract) GetAllAggregators(ctx contractapi.TransactionCon
 // ----------------------------------------------------------
 
 // AddParticipantModelMetadata issues a new participant's model update metadata record to the world state with the given details. Can only be done by the owner of the participant or an admin.
+// The homomorphic hash must be a valid digest, since aggregations listing the participant are verified against it.
 func (s *MetadataSmartContract) AddParticipantModelMetadata(
 	ctx contractapi.TransactionContextInterface,
 	participantId int,
@@ -416,6 +421,10 @@ func (s *MetadataSmartContract) AddParticipantModelMetadata(
 		return fmt.Errorf("permission denied: client is not an admin or owner of participant %d", participantId)
 	}
 
+	if _, err := homomorphic_hash.ParseDigest(homomorphicHash); err != nil {
+		return fmt.Errorf("invalid participant model metadata: %v", err)
+	}
+
 	participantModelMetadata := shared.ParticipantModelMetadata{
 		Epoch:           epoch,
 		ParticipantId:   participantId,
@@ -474,7 +483,8 @@ func (s *MetadataSmartContract) ParticipantModelMetadataExists(ctx contractapi.T
 	return metadataJSON != nil, nil
 }
 
-// DeleteParticipantModelMetadata deletes a given participant model metadata record from the world state. Can only be done by the owner of the participant or an admin.
+// DeleteParticipantModelMetadata deletes a given participant model metadata record from the world state. Can only be done by the owner of the participant or an admin,
+// and not once an aggregator model metadata record lists the participant for the epoch, see frozenCheck.
 func (s *MetadataSmartContract) DeleteParticipantModelMetadata(ctx contractapi.TransactionContextInterface, participantId int, epoch int) error {
 	modelExists, err := s.ParticipantModelMetadataExists(ctx, participantId, epoch)
 	if err != nil {
@@ -490,6 +500,11 @@ func (s *MetadataSmartContract) DeleteParticipantModelMetadata(ctx contractapi.T
 		return fmt.Errorf("permission denied: client is not an admin or owner of participant %d", participantId)
 	}
 
+	err = s.frozenCheck(ctx, participantId, epoch)
+	if err != nil {
+		return err
+	}
+
 	compositeKey, err := ctx.GetStub().CreateCompositeKey("participant_model_metadata", []string{fmt.Sprintf("%d", participantId), fmt.Sprintf("%d", epoch)})
 	if err != nil {
 		return fmt.Errorf("failed creating composite key: %v", err)
@@ -499,6 +514,8 @@ func (s *MetadataSmartContract) DeleteParticipantModelMetadata(ctx contractapi.T
 }
 
 // UpdateParticipantModelMetadata updates an existing participant model metadata record in the world state with provided parameters. Can only be done by the owner of the participant or an admin.
+// The homomorphic hash is validated like in AddParticipantModelMetadata, and the record can no longer be updated once an aggregator model metadata record
+// lists the participant for the epoch, see frozenCheck.
 func (s *MetadataSmartContract) UpdateParticipantModelMetadata(
 	ctx contractapi.TransactionContextInterface,
 	participantId int,
@@ -520,6 +537,15 @@ func (s *MetadataSmartContract) UpdateParticipantModelMetadata(
 		return fmt.Errorf("permission denied: client is not an admin or owner of participant %d", participantId)
 	}
 
+	if _, err := homomorphic_hash.ParseDigest(homomorphicHash); err != nil {
+		return fmt.Errorf("invalid participant model metadata: %v", err)
+	}
+
+	err = s.frozenCheck(ctx, participantId, epoch)
+	if err != nil {
+		return err
+	}
+
 	// overwriting original metadata with new metadata
 	participantModelMetadata := shared.ParticipantModelMetadata{
 		Epoch:           epoch,
@@ -540,6 +566,23 @@ func (s *MetadataSmartContract) UpdateParticipantModelMetadata(
 	return ctx.GetStub().PutState(compositeKey, metadataJSON)
 }
 
+// frozenCheck checks that no aggregator model metadata record lists the participant for the epoch. Such a record was verified against the participant's
+// homomorphic hash, so changing or removing the participant's record afterwards would leave the aggregation unverifiable.
+func (s *MetadataSmartContract) frozenCheck(ctx contractapi.TransactionContextInterface, participantId int, epoch int) error {
+	aggregatorModelMetadataBlocks, err := s.GetAllAggregatorModelMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting all aggregator model metadata records: %v", err)
+	}
+
+	for _, aggregatorModelMetadata := range aggregatorModelMetadataBlocks {
+		if aggregatorModelMetadata.Epoch == epoch && slices.Contains(aggregatorModelMetadata.ParticipantIds, participantId) {
+			return fmt.Errorf("the participant model metadata record from participant %d for epoch %d is frozen, aggregator %d has aggregated it", participantId, epoch, aggregatorModelMetadata.AggregatorId)
+		}
+	}
+
+	return nil
+}
+
 // DeleteAllParticipantModelMetadata deletes all participant model metadata records from the world state. Can only be done by an admin.
 func (s *MetadataSmartContract) DeleteAllParticipantModelMetadata(ctx contractapi.TransactionContextInterface) error {
 	err := adminCheck(ctx)
@@ -676,13 +719,143 @@ func (s *MetadataSmartContract) aggregationCheck(ctx contractapi.TransactionCont
 	return nil
 }
 
+// homomorphicHashCheck checks that the homomorphic hash of the aggregator's record equals the weighted combination of the homomorphic hashes
+// of the listed participants' model updates for the epoch, see shared.AggregatorModelMetadata. The weights are the sample counts recorded under
+// shared.SampleCountsAggregationParameter for "fedavg" and 1 for "sum", an unspecified rule, "fedprox", "krum" and "multi_krum", whose records
+// list only the participants Krum selected. The global models of "median" and "trimmed_mean", of any rule clipping the model updates first, and
+// of a record listing no participants, e.g. for the starting model, do not combine the participants' hashes: only an admin can record them.
+// Any other rule name, and a hash that is not a digest, are rejected whoever records them.
+func (s *MetadataSmartContract) homomorphicHashCheck(ctx contractapi.TransactionContextInterface, aggregatorModelMetadata *shared.AggregatorModelMetadata) error {
+	aggregation := aggregatorModelMetadata.Aggregation
+	weights, checkable, err := aggregationWeights(aggregation, len(aggregatorModelMetadata.ParticipantIds))
+	if err != nil {
+		return err
+	}
+	if _, err := homomorphic_hash.ParseDigest(aggregatorModelMetadata.HomomorphicHash); err != nil {
+		return fmt.Errorf("aggregation denied, invalid aggregate homomorphic hash: %v", err)
+	}
+	if len(aggregatorModelMetadata.ParticipantIds) == 0 {
+		if err := adminCheck(ctx); err != nil {
+			return fmt.Errorf("aggregation denied, a record listing no participants cannot be verified and only an admin can record it: %v", err)
+		}
+		return nil
+	}
+	if !checkable {
+		if err := adminCheck(ctx); err != nil {
+			return fmt.Errorf("aggregation denied, the homomorphic hash of a %q aggregation cannot be verified and only an admin can record it: %v", aggregation.Name, err)
+		}
+		return nil
+	}
+
+	participantHashes := make([]string, len(aggregatorModelMetadata.ParticipantIds))
+	seen := make(map[int]bool, len(aggregatorModelMetadata.ParticipantIds))
+	for i, participantId := range aggregatorModelMetadata.ParticipantIds {
+		if seen[participantId] {
+			return fmt.Errorf("aggregation denied, participant %d is listed more than once", participantId)
+		}
+		seen[participantId] = true
+
+		participantModelMetadata, err := s.GetParticipantModelMetadata(ctx, participantId, aggregatorModelMetadata.Epoch)
+		if err != nil {
+			return fmt.Errorf("aggregation denied, cannot verify the homomorphic hash: %v", err)
+		}
+		participantHashes[i] = participantModelMetadata.HomomorphicHash
+	}
+
+	return verifyAggregateHash(aggregatorModelMetadata.HomomorphicHash, aggregatorModelMetadata.ParticipantIds, participantHashes, weights)
+}
+
+// aggregationWeights returns the weights of the participants' homomorphic hashes under an aggregation rule, or false if the rule's global model
+// cannot be verified against them.
+func aggregationWeights(aggregation shared.AggregationRule, participants int) ([]int64, bool, error) {
+	if _, clipped := aggregation.Parameters[shared.ClipNormAggregationParameter]; clipped {
+		return nil, false, nil
+	}
+
+	switch aggregation.Name {
+	case "", shared.SumAggregationRule, shared.FedProxAggregationRule, shared.KrumAggregationRule, shared.MultiKrumAggregationRule:
+		weights := make([]int64, participants)
+		for i := range weights {
+			weights[i] = 1
+		}
+		return weights, true, nil
+	case shared.FedAvgAggregationRule:
+		var sampleCounts []string
+		if parameter := aggregation.Parameters[shared.SampleCountsAggregationParameter]; parameter != "" {
+			sampleCounts = strings.Split(parameter, ",")
+		}
+		if len(sampleCounts) != participants {
+			return nil, false, fmt.Errorf("aggregation denied, %d sample counts recorded for %d participants", len(sampleCounts), participants)
+		}
+		weights := make([]int64, participants)
+		for i, sampleCount := range sampleCounts {
+			weight, err := strconv.ParseInt(sampleCount, 10, 64)
+			if err != nil || weight <= 0 {
+				return nil, false, fmt.Errorf("aggregation denied, invalid sample count %q", sampleCount)
+			}
+			weights[i] = weight
+		}
+		return weights, true, nil
+	case shared.MedianAggregationRule, shared.TrimmedMeanAggregationRule:
+		return nil, false, nil
+	default:
+		return nil, false, fmt.Errorf("aggregation denied, unknown aggregation rule %q", aggregation.Name)
+	}
+}
+
+// verifyAggregateHash checks that an aggregate homomorphic hash equals the combination of the participants' homomorphic hashes with the given weights.
+func verifyAggregateHash(aggregateHash string, participantIds []int, participantHashes []string, weights []int64) error {
+	aggregate, err := homomorphic_hash.ParseDigest(aggregateHash)
+	if err != nil {
+		return fmt.Errorf("aggregation denied, invalid aggregate homomorphic hash: %v", err)
+	}
+
+	digests := make([]homomorphic_hash.Digest, len(participantHashes))
+	for i, participantHash := range participantHashes {
+		digests[i], err = homomorphic_hash.ParseDigest(participantHash)
+		if err != nil {
+			return fmt.Errorf("aggregation denied, invalid homomorphic hash of participant %d: %v", participantIds[i], err)
+		}
+	}
+
+	combined, err := homomorphic_hash.CombineWeighted(weights, digests)
+	if err != nil {
+		return err
+	}
+	if combined != aggregate {
+		return fmt.Errorf("aggregation denied, homomorphic hash mismatch: the aggregate hash %s does not equal %s, the combination of the hashes of participants %v", aggregate, combined, participantIds)
+	}
+
+	return nil
+}
+
+// unmarshalAggregationRule reads the aggregation rule of an aggregator model metadata record. An empty string leaves the rule unspecified.
+func unmarshalAggregationRule(aggregationJSON string) (shared.AggregationRule, error) {
+	var aggregation shared.AggregationRule
+	if aggregationJSON == "" {
+		return aggregation, nil
+	}
+
+	if err := json.Unmarshal([]byte(aggregationJSON), &aggregation); err != nil {
+		return aggregation, fmt.Errorf("failed to unmarshal aggregation rule JSON: %v", err)
+	}
+
+	return aggregation, nil
+}
+
 // AddAggregatorModelMetadata issues a new aggregator's model aggregation metadata record to the world state with the given details. Can only be done by the owner of the aggregator or an admin.
+// The aggregation rule, given as JSON, is recorded so that auditors know how the global model was produced and must be one of the rules named in shared.
+// For "sum", an unspecified rule, "fedavg", "fedprox", "krum" and "multi_krum", the homomorphic hash must equal the weighted combination of the listed
+// participants' homomorphic hashes for the epoch, otherwise the record is rejected; records of the other rules, of clipped model updates, or listing no
+// participants, can only be added by an admin. See homomorphicHashCheck.
 func (s *MetadataSmartContract) AddAggregatorModelMetadata(
 	ctx contractapi.TransactionContextInterface,
 	aggregatorId int,
 	epoch int,
 	modelHashCid string,
 	participantIdsJSON string,
+	homomorphicHash string,
+	aggregationJSON string,
 ) error {
 	modelExists, err := s.AggregatorModelMetadataExists(ctx, aggregatorId, epoch)
 	if err != nil {
@@ -704,11 +877,18 @@ func (s *MetadataSmartContract) AddAggregatorModelMetadata(
 		return fmt.Errorf("failed to unmarshal participant Ids JSON: %v", err)
 	}
 
+	aggregation, err := unmarshalAggregationRule(aggregationJSON)
+	if err != nil {
+		return err
+	}
+
 	aggregatorModelMetadata := shared.AggregatorModelMetadata{
-		AggregatorId:   aggregatorId,
-		Epoch:          epoch,
-		ParticipantIds: participantIds,
-		ModelHashCid:   modelHashCid,
+		AggregatorId:    aggregatorId,
+		Epoch:           epoch,
+		ParticipantIds:  participantIds,
+		ModelHashCid:    modelHashCid,
+		HomomorphicHash: homomorphicHash,
+		Aggregation:     aggregation,
 	}
 
 	err = s.aggregationCheck(ctx, &aggregatorModelMetadata)
@@ -716,6 +896,11 @@ func (s *MetadataSmartContract) AddAggregatorModelMetadata(
 		return err
 	}
 
+	err = s.homomorphicHashCheck(ctx, &aggregatorModelMetadata)
+	if err != nil {
+		return err
+	}
+
 	metadataJSON, err := json.Marshal(aggregatorModelMetadata)
 	if err != nil {
 		return err
@@ -793,12 +978,15 @@ func (s *MetadataSmartContract) DeleteAggregatorModelMetadata(ctx contractapi.Tr
 }
 
 // UpdateAggregatorModelMetadata updates an existing aggregator model metadata record in the world state with provided parameters. Can only be done by the owner of the aggregator or an admin.
+// The homomorphic hash is verified like in AddAggregatorModelMetadata.
 func (s *MetadataSmartContract) UpdateAggregatorModelMetadata(
 	ctx contractapi.TransactionContextInterface,
 	aggregatorId int,
 	epoch int,
 	modelHashCid string,
 	participantIdsJSON string,
+	homomorphicHash string,
+	aggregationJSON string,
 ) error {
 	modelExists, err := s.AggregatorModelMetadataExists(ctx, aggregatorId, epoch)
 	if err != nil {
@@ -820,12 +1008,19 @@ func (s *MetadataSmartContract) UpdateAggregatorModelMetadata(
 		return fmt.Errorf("failed to unmarshal participant Ids JSON: %v", err)
 	}
 
+	aggregation, err := unmarshalAggregationRule(aggregationJSON)
+	if err != nil {
+		return err
+	}
+
 	// overwriting original metadata with new metadata
 	aggregatorModelMetadata := shared.AggregatorModelMetadata{
-		Epoch:          epoch,
-		AggregatorId:   aggregatorId,
-		ParticipantIds: participantIds,
-		ModelHashCid:   modelHashCid,
+		Epoch:           epoch,
+		AggregatorId:    aggregatorId,
+		ParticipantIds:  participantIds,
+		ModelHashCid:    modelHashCid,
+		HomomorphicHash: homomorphicHash,
+		Aggregation:     aggregation,
 	}
 
 	err = s.aggregationCheck(ctx, &aggregatorModelMetadata)
@@ -833,6 +1028,11 @@ func (s *MetadataSmartContract) UpdateAggregatorModelMetadata(
 		return err
 	}
 
+	err = s.homomorphicHashCheck(ctx, &aggregatorModelMetadata)
+	if err != nil {
+		return err
+	}
+
 	metadataJSON, err := json.Marshal(aggregatorModelMetadata)
 	if err != nil {
 		return err
@@ -926,6 +1126,125 @@ func (s *MetadataSmartContract) GetAllAggregatorModelMetadataByAggregator(ctx co
 	return aggregatorModelMetadataBlocks, nil
 }
 
+// -----------------------------------------------------
+// THIS SECTION DEALS WITH SECURE AGGREGATION MESSAGES
+// -----------------------------------------------------
+
+// AddSecureAggregationMessage issues a participant's message for a round of the secure aggregation protocol of an epoch to the world state.
+// Messages cannot be updated, so every reader sees the same message, and a round of an epoch is closed once a later round has a message.
+// Can only be done by the owner of the participant or an admin.
+func (s *MetadataSmartContract) AddSecureAggregationMessage(
+	ctx contractapi.TransactionContextInterface,
+	participantId int,
+	epoch int,
+	round string,
+	payload string,
+) error {
+	index := slices.Index(shared.SecureAggregationRounds, round)
+	if index < 0 {
+		return fmt.Errorf("unknown secure aggregation round %s", round)
+	}
+
+	compositeKey, err := ctx.GetStub().CreateCompositeKey("secure_aggregation_message", []string{fmt.Sprintf("%d", epoch), round, fmt.Sprintf("%d", participantId)})
+	if err != nil {
+		return fmt.Errorf("failed creating composite key: %v", err)
+	}
+
+	messageJSON, err := ctx.GetStub().GetState(compositeKey)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if messageJSON != nil {
+		return fmt.Errorf("the secure aggregation message from participant %d for round %s of epoch %d already exists", participantId, round, epoch)
+	}
+
+	// A late message must not change what the messages of a later round were based on, e.g. a masked vector
+	// uploaded after some participants revealed the shares of the uploader's mask private key.
+	for _, laterRound := range shared.SecureAggregationRounds[index+1:] {
+		resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("secure_aggregation_message", []string{fmt.Sprintf("%d", epoch), laterRound})
+		if err != nil {
+			return err
+		}
+		started := resultsIterator.HasNext()
+		resultsIterator.Close()
+		if started {
+			return fmt.Errorf("the secure aggregation round %s of epoch %d is closed, round %s has started", round, epoch, laterRound)
+		}
+	}
+
+	errAdminCheck := adminCheck(ctx)
+	errParticipantCheck := s.ownerCheckParticipant(ctx, participantId)
+	if errAdminCheck != nil && errParticipantCheck != nil {
+		return fmt.Errorf("permission denied: client is not an admin or owner of participant %d", participantId)
+	}
+
+	message := shared.SecureAggregationMessage{
+		Epoch:         epoch,
+		Round:         round,
+		ParticipantId: participantId,
+		Payload:       payload,
+	}
+	messageJSON, err = json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(compositeKey, messageJSON)
+}
+
+// GetAllSecureAggregationMessagesByRound returns all secure aggregation messages found in the world state for the given epoch and round.
+func (s *MetadataSmartContract) GetAllSecureAggregationMessagesByRound(ctx contractapi.TransactionContextInterface, epoch int, round string) ([]*shared.SecureAggregationMessage, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("secure_aggregation_message", []string{fmt.Sprintf("%d", epoch), round})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var messages []*shared.SecureAggregationMessage
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var message shared.SecureAggregationMessage
+		if err := json.Unmarshal(queryResponse.Value, &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+
+	return messages, nil
+}
+
+// DeleteAllSecureAggregationMessages deletes all secure aggregation messages from the world state. Can only be done by an admin.
+func (s *MetadataSmartContract) DeleteAllSecureAggregationMessages(ctx contractapi.TransactionContextInterface) error {
+	err := adminCheck(ctx)
+	if err != nil {
+		return fmt.Errorf("permission denied: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("secure_aggregation_message", []string{})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return fmt.Errorf("error deleting secure aggregation message: %v", err)
+		}
+	}
+
+	return nil
+}
+
 // --------------------------------------------
 // THIS SECTION DEALS WITH ACCESSING THE LOGS
 // --------------------------------------------
@@ -0,0 +1,310 @@
+package chaincode
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// memoryStub is an in-memory world state implementing the parts of the chaincode stub the contract uses.
+// Writes are visible at once, unlike on a peer, which is enough for transactions issued one at a time.
+type memoryStub struct {
+	shim.ChaincodeStubInterface
+	state map[string][]byte
+}
+
+func (s *memoryStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *memoryStub) GetState(key string) ([]byte, error) {
+	return s.state[key], nil
+}
+
+func (s *memoryStub) PutState(key string, value []byte) error {
+	s.state[key] = value
+	return nil
+}
+
+func (s *memoryStub) DelState(key string) error {
+	delete(s.state, key)
+	return nil
+}
+
+func (s *memoryStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := shim.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator := &memoryIterator{}
+	for key, value := range s.state {
+		if strings.HasPrefix(key, prefix) {
+			iterator.kvs = append(iterator.kvs, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	sort.Slice(iterator.kvs, func(i, j int) bool { return iterator.kvs[i].Key < iterator.kvs[j].Key })
+
+	return iterator, nil
+}
+
+// memoryIterator iterates over a snapshot of the keys of a memoryStub.
+type memoryIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (i *memoryIterator) HasNext() bool {
+	return len(i.kvs) > 0
+}
+
+func (i *memoryIterator) Next() (*queryresult.KV, error) {
+	kv := i.kvs[0]
+	i.kvs = i.kvs[1:]
+	return kv, nil
+}
+
+func (i *memoryIterator) Close() error {
+	return nil
+}
+
+// testIdentity is a client identity of the Org1MSP, an admin if its certificate has the admin organisational unit.
+type testIdentity struct {
+	cid.ClientIdentity
+	certificate *x509.Certificate
+}
+
+func (i *testIdentity) GetMSPID() (string, error) {
+	return "Org1MSP", nil
+}
+
+func (i *testIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return i.certificate, nil
+}
+
+// testClients returns transaction contexts sharing one world state: an admin and two users.
+func testClients() (admin *contractapi.TransactionContext, user1 *contractapi.TransactionContext, user2 *contractapi.TransactionContext) {
+	stub := &memoryStub{state: map[string][]byte{}}
+
+	newClient := func(serialNumber int64, roles ...string) *contractapi.TransactionContext {
+		ctx := &contractapi.TransactionContext{}
+		ctx.SetStub(stub)
+		ctx.SetClientIdentity(&testIdentity{certificate: &x509.Certificate{
+			SerialNumber: big.NewInt(serialNumber),
+			Subject:      pkix.Name{OrganizationalUnit: roles},
+		}})
+		return ctx
+	}
+
+	return newClient(1, "admin"), newClient(2, "client"), newClient(3, "client")
+}
+
+func TestVerifyAggregateHash(t *testing.T) {
+	first := homomorphic_hash.HashValues([]int64{1, -2, 3}).String()
+	second := homomorphic_hash.HashValues([]int64{10, 20, -30}).String()
+	aggregate := homomorphic_hash.HashValues([]int64{11, 18, -27}).String()
+
+	if err := verifyAggregateHash(aggregate, []int{1, 2}, []string{first, second}, []int64{1, 1}); err != nil {
+		t.Fatalf("Expected the aggregate hash to verify, got %v", err)
+	}
+
+	err := verifyAggregateHash(first, []int{1, 2}, []string{first, second}, []int64{1, 1})
+	if err == nil || !strings.Contains(err.Error(), "homomorphic hash mismatch") {
+		t.Fatalf("Expected a mismatch error, got %v", err)
+	}
+
+	if err := verifyAggregateHash(aggregate, []int{1, 2}, []string{first, "homomorphic-hash-placeholder"}, []int64{1, 1}); err == nil || !strings.Contains(err.Error(), "participant 2") {
+		t.Fatalf("Expected an invalid participant hash to be reported, got %v", err)
+	}
+	if err := verifyAggregateHash("", []int{1}, []string{first}, []int64{1}); err == nil {
+		t.Fatalf("Expected a missing aggregate hash to be rejected")
+	}
+
+	// With sample counts 3 and 1, the aggregate is the hash of 3 * first + second.
+	weighted := homomorphic_hash.HashValues([]int64{13, 14, -21}).String()
+	if err := verifyAggregateHash(weighted, []int{1, 2}, []string{first, second}, []int64{3, 1}); err != nil {
+		t.Fatalf("Expected the weighted aggregate hash to verify, got %v", err)
+	}
+}
+
+func TestAggregationRuleCheck(t *testing.T) {
+	contract := &MetadataSmartContract{}
+	admin, user1, user2 := testClients()
+
+	if err := contract.AddParticipant(user2, 1, "", "", ""); err != nil {
+		t.Fatalf("Failed to add participant 1: %v", err)
+	}
+	if err := contract.AddParticipant(user2, 2, "", "", ""); err != nil {
+		t.Fatalf("Failed to add participant 2: %v", err)
+	}
+	if err := contract.AddAggregator(user1, 1, "{}"); err != nil {
+		t.Fatalf("Failed to add the aggregator: %v", err)
+	}
+
+	first := homomorphic_hash.HashValues([]int64{1, 2})
+	second := homomorphic_hash.HashValues([]int64{3, 4})
+	if err := contract.AddParticipantModelMetadata(user2, 1, 1, "cid-1", first.String()); err != nil {
+		t.Fatalf("Failed to add the model metadata of participant 1: %v", err)
+	}
+	if err := contract.AddParticipantModelMetadata(user2, 2, 1, "cid-2", second.String()); err != nil {
+		t.Fatalf("Failed to add the model metadata of participant 2: %v", err)
+	}
+
+	sum := homomorphic_hash.HashValues([]int64{4, 6}).String()
+	weighted := homomorphic_hash.HashValues([]int64{1*100 + 3*300, 2*100 + 4*300}).String()
+	bogus := homomorphic_hash.HashValues([]int64{42}).String()
+
+	tests := []struct {
+		name        string
+		client      *contractapi.TransactionContext
+		participant string
+		hash        string
+		aggregation string
+		error       string
+	}{
+		{"Sum", user1, "[1,2]", sum, `{"name":"sum"}`, ""},
+		{"Unspecified", user1, "[1,2]", sum, "", ""},
+		{"FedProx", user1, "[1,2]", sum, `{"name":"fedprox"}`, ""},
+		{"FedProxMismatch", user1, "[1,2]", bogus, `{"name":"fedprox"}`, "homomorphic hash mismatch"},
+		{"FedAvg", user1, "[1,2]", weighted, `{"name":"fedavg","parameters":{"sample_counts":"100,300"}}`, ""},
+		{"FedAvgUnweighted", user1, "[1,2]", sum, `{"name":"fedavg","parameters":{"sample_counts":"100,300"}}`, "homomorphic hash mismatch"},
+		{"FedAvgWithoutSampleCounts", user1, "[1,2]", weighted, `{"name":"fedavg"}`, "sample count"},
+		{"Krum", user1, "[2]", second.String(), `{"name":"krum","parameters":{"rejected":"1"}}`, ""},
+		{"UnknownRule", user1, "[1,2]", bogus, `{"name":"Sum"}`, "unknown aggregation rule"},
+		{"MedianByAggregator", user1, "[1,2]", bogus, `{"name":"median"}`, "only an admin"},
+		{"ClippedByAggregator", user1, "[1,2]", bogus, `{"name":"sum","parameters":{"clip_norm":"1"}}`, "only an admin"},
+		{"MedianByAdmin", admin, "[1,2]", bogus, `{"name":"median"}`, ""},
+		{"MedianByAdminInvalidHash", admin, "[1,2]", "homomorphic-hash-placeholder", `{"name":"median"}`, "invalid aggregate homomorphic hash"},
+		{"NoParticipantsByAggregator", user1, "[]", bogus, `{"name":"sum"}`, "only an admin"},
+		{"NoParticipantsByAdmin", admin, "[]", bogus, `{"name":"sum"}`, ""},
+		{"NoParticipantsInvalidHash", admin, "[]", "homomorphic-hash-placeholder", `{"name":"sum"}`, "invalid aggregate homomorphic hash"},
+		{"NoParticipantsUnknownRule", admin, "[]", bogus, `{"name":"Sum"}`, "unknown aggregation rule"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Each record is added and removed, so that the next one can be added for the same epoch.
+			err := contract.AddAggregatorModelMetadata(test.client, 1, 1, "cid-global", test.participant, test.hash, test.aggregation)
+			if test.error == "" {
+				if err != nil {
+					t.Fatalf("Expected the record to be accepted, got %v", err)
+				}
+				if err := contract.DeleteAggregatorModelMetadata(admin, 1, 1); err != nil {
+					t.Fatalf("Failed to delete the record: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Fatalf("Expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
+
+func TestParticipantModelMetadataHash(t *testing.T) {
+	contract := &MetadataSmartContract{}
+	admin, user1, user2 := testClients()
+
+	if err := contract.AddParticipant(user1, 1, "", "", ""); err != nil {
+		t.Fatalf("Failed to add participant 1: %v", err)
+	}
+	if err := contract.AddParticipant(user2, 2, "", "", ""); err != nil {
+		t.Fatalf("Failed to add participant 2: %v", err)
+	}
+	if err := contract.AddAggregator(admin, 1, "{}"); err != nil {
+		t.Fatalf("Failed to add the aggregator: %v", err)
+	}
+
+	first := homomorphic_hash.HashValues([]int64{1, 2}).String()
+	second := homomorphic_hash.HashValues([]int64{3, 4}).String()
+	aggregate := homomorphic_hash.HashValues([]int64{4, 6}).String()
+
+	// A hash that is not a digest would make every aggregation listing the participant unverifiable.
+	if err := contract.AddParticipantModelMetadata(user1, 1, 1, "cid-1", "homomorphic-hash-placeholder"); err == nil || !strings.Contains(err.Error(), "invalid homomorphic hash") {
+		t.Fatalf("Expected an invalid hash to be rejected, got %v", err)
+	}
+	if err := contract.AddParticipantModelMetadata(user1, 1, 1, "cid-1", first); err != nil {
+		t.Fatalf("Failed to add the model metadata of participant 1: %v", err)
+	}
+	if err := contract.AddParticipantModelMetadata(user2, 2, 1, "cid-2", second); err != nil {
+		t.Fatalf("Failed to add the model metadata of participant 2: %v", err)
+	}
+	if err := contract.UpdateParticipantModelMetadata(user2, 2, 1, "cid-2", ""); err == nil {
+		t.Fatalf("Expected an update with an invalid hash to be rejected")
+	}
+
+	// Before any aggregation, the participant may still replace its model.
+	if err := contract.UpdateParticipantModelMetadata(user2, 2, 1, "cid-2", second); err != nil {
+		t.Fatalf("Failed to update the model metadata of participant 2: %v", err)
+	}
+
+	if err := contract.AddAggregatorModelMetadata(admin, 1, 1, "cid-global", "[1,2]", aggregate, `{"name":"sum"}`); err != nil {
+		t.Fatalf("Failed to add the aggregator model metadata: %v", err)
+	}
+
+	// Once aggregated, changing or removing the participant's record would leave the aggregation unverifiable.
+	if err := contract.UpdateParticipantModelMetadata(user2, 2, 1, "cid-other", first); err == nil || !strings.Contains(err.Error(), "frozen") {
+		t.Fatalf("Expected the update of an aggregated record to be rejected, got %v", err)
+	}
+	if err := contract.DeleteParticipantModelMetadata(user1, 1, 1); err == nil || !strings.Contains(err.Error(), "frozen") {
+		t.Fatalf("Expected the deletion of an aggregated record to be rejected, got %v", err)
+	}
+	metadata, err := contract.GetParticipantModelMetadata(user2, 2, 1)
+	if err != nil || metadata.HomomorphicHash != second {
+		t.Fatalf("Expected the record of participant 2 to be unchanged, got %+v, %v", metadata, err)
+	}
+
+	// Records of other epochs are not affected.
+	if err := contract.AddParticipantModelMetadata(user1, 1, 2, "cid-1", first); err != nil {
+		t.Fatalf("Failed to add the model metadata of participant 1 for epoch 2: %v", err)
+	}
+	if err := contract.UpdateParticipantModelMetadata(user1, 1, 2, "cid-1", second); err != nil {
+		t.Fatalf("Failed to update the model metadata of participant 1 for epoch 2: %v", err)
+	}
+}
+
+func TestSecureAggregationRoundOrder(t *testing.T) {
+	contract := &MetadataSmartContract{}
+	_, user1, user2 := testClients()
+
+	if err := contract.AddParticipant(user1, 1, "", "", ""); err != nil {
+		t.Fatalf("Failed to add participant 1: %v", err)
+	}
+	if err := contract.AddParticipant(user2, 2, "", "", ""); err != nil {
+		t.Fatalf("Failed to add participant 2: %v", err)
+	}
+
+	if err := contract.AddSecureAggregationMessage(user1, 1, 1, "late_input", "{}"); err == nil || !strings.Contains(err.Error(), "unknown secure aggregation round") {
+		t.Fatalf("Expected an unknown round to be rejected, got %v", err)
+	}
+	if err := contract.AddSecureAggregationMessage(user1, 1, 1, shared.MaskedInputRound, "{}"); err != nil {
+		t.Fatalf("Failed to add the masked input of participant 1: %v", err)
+	}
+	if err := contract.AddSecureAggregationMessage(user1, 1, 1, shared.UnmaskRound, "{}"); err != nil {
+		t.Fatalf("Failed to add the unmasking of participant 1: %v", err)
+	}
+
+	// Once unmasking started, a masked vector uploaded by participant 2 would have both its secrets revealed.
+	if err := contract.AddSecureAggregationMessage(user2, 2, 1, shared.MaskedInputRound, "{}"); err == nil || !strings.Contains(err.Error(), "is closed") {
+		t.Fatalf("Expected a late masked input to be rejected, got %v", err)
+	}
+	if err := contract.AddSecureAggregationMessage(user2, 2, 1, shared.AdvertiseKeysRound, "{}"); err == nil {
+		t.Fatalf("Expected late advertised keys to be rejected")
+	}
+	// The rounds of other epochs are independent.
+	if err := contract.AddSecureAggregationMessage(user2, 2, 2, shared.MaskedInputRound, "{}"); err != nil {
+		t.Fatalf("Failed to add the masked input of participant 2 for epoch 2: %v", err)
+	}
+	if err := contract.AddSecureAggregationMessage(user2, 2, 1, shared.UnmaskRound, "{}"); err != nil {
+		t.Fatalf("Failed to add the unmasking of participant 2: %v", err)
+	}
+}
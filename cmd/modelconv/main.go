@@ -0,0 +1,77 @@
+// Command modelconv converts models between NumPy npy/npz, safetensors, raw int64 bin and protobuf files, so that
+// models from Python training code can be added to IPFS with modelctl.
+//
+// Usage:
+//
+//	modelconv [-from format] [-to format] [-arch id] <input> <output>
+//
+// Formats are npy, npz, safetensors, bin and pb, and default to the extensions of the files.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/thcrull/fabric-ipfs-interface/model_io"
+)
+
+func main() {
+	from := flag.String("from", "", "format of the input, by default from its extension")
+	to := flag.String("to", "", "format of the output, by default from its extension")
+	architectureId := flag.String("arch", "", "architecture id to set on the model")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := convert(flag.Arg(0), flag.Arg(1), model_io.Format(*from), model_io.Format(*to), *architectureId); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n  modelconv [-from format] [-to format] [-arch id] <input> <output>\n")
+	flag.PrintDefaults()
+}
+
+// convert reads a model from the input file and writes it to the output file, in the given formats if not empty.
+func convert(input string, output string, from model_io.Format, to model_io.Format, architectureId string) error {
+	var err error
+	if from == "" {
+		if from, err = model_io.FormatFromPath(input); err != nil {
+			return err
+		}
+	}
+	if to == "" {
+		if to, err = model_io.FormatFromPath(output); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	model, err := model_io.Decode(data, from)
+	if err != nil {
+		return err
+	}
+	if architectureId != "" {
+		model.ArchitectureId = architectureId
+	}
+
+	data, err = model_io.Encode(model, to)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
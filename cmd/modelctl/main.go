@@ -0,0 +1,134 @@
+// Command modelctl uploads model files to and downloads them from IPFS, showing the progress of the transfer.
+//
+// Usage:
+//
+//	modelctl [-config path] add [-pin] <file>
+//	modelctl [-config path] get <cid> <file>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/wrapper"
+)
+
+func main() {
+	configPath := flag.String("config", "../config/admin.yaml", "path of the client config")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	ipfsClient, err := ipfs_client.NewIpfsClient(*configPath)
+	if err != nil {
+		log.Fatalf("error creating ipfs client: %v", err)
+	}
+	defer ipfsClient.Close()
+
+	ctx := context.Background()
+	args := flag.Args()
+
+	switch args[0] {
+	case "add":
+		err = add(ctx, ipfsClient, args[1:])
+	case "get":
+		err = get(ctx, ipfsClient, args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n  modelctl [-config path] add [-pin] <file>\n  modelctl [-config path] get <cid> <file>\n")
+	flag.PrintDefaults()
+}
+
+// add uploads a file with the client's import settings and prints its CID.
+func add(ctx context.Context, ipfsClient *ipfs_client.IpfsClient, args []string) error {
+	flags := flag.NewFlagSet("add", flag.ExitOnError)
+	pin := flags.Bool("pin", false, "pin the file after adding it")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("add expects one file, got %d arguments", flags.NArg())
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	opts := ipfsClient.AddOptions()
+	opts.Progress = printProgress("add")
+	cid, err := ipfsClient.AddFileBytesWithOptions(ctx, data, opts)
+	if err != nil {
+		return err
+	}
+
+	if *pin {
+		if err := ipfsClient.PinFile(ctx, cid); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(cid)
+	return nil
+}
+
+// get downloads a file and writes it to disk.
+func get(ctx context.Context, ipfsClient *ipfs_client.IpfsClient, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("get expects a CID and a file, got %d arguments", len(args))
+	}
+
+	data, err := ipfsClient.GetFileBytesWithOptions(ctx, args[0], ipfs_client.GetOptions{Progress: printProgress("get")})
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(args[1], data, 0o644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// printProgress returns a progress callback that keeps one status line on stderr up to date.
+func printProgress(operation string) ipfs_client.ProgressFunc {
+	return func(progress ipfs_client.Progress) {
+		line := fmt.Sprintf("%s: %s", operation, formatBytes(float64(progress.Bytes)))
+		if progress.Total > 0 {
+			line += fmt.Sprintf(" / %s (%.1f%%)", formatBytes(float64(progress.Total)), progress.Percent())
+		}
+		line += fmt.Sprintf(" at %s/s", formatBytes(progress.Rate))
+
+		if progress.Done {
+			fmt.Fprintf(os.Stderr, "\r%s in %s\n", line, progress.Elapsed.Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%s", line)
+		}
+	}
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
@@ -2,37 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/binary"
-	"fmt"
 	"log"
-	"os"
 	"strconv"
 	"time"
 
+	"github.com/thcrull/fabric-ipfs-interface/aggregation"
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
 	"github.com/thcrull/fabric-ipfs-interface/interface/fabric/wrapper"
 	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/wrapper"
+	"github.com/thcrull/fabric-ipfs-interface/model_io"
 	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
 )
 
-// readVectorFromFile reads int64 values from a binary file
-func readVectorFromFile(filename string) ([]int64, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(data)%8 != 0 {
-		return nil, fmt.Errorf("file size not multiple of 8")
-	}
-
-	n := len(data) / 8
-	vec := make([]int64, n)
-
-	for i := 0; i < n; i++ {
-		bits := binary.LittleEndian.Uint64(data[i*8 : i*8+8])
-		vec[i] = int64(bits)
+// logProgress returns a progress callback logging the progress of a transfer about once per second
+func logProgress(operation string) ipfs_client.ProgressFunc {
+	var lastLogged time.Duration
+	return func(progress ipfs_client.Progress) {
+		if !progress.Done && progress.Elapsed-lastLogged < time.Second {
+			return
+		}
+		lastLogged = progress.Elapsed
+		log.Printf("%s: %d/%d bytes (%.1f%%) at %.1f MB/s", operation, progress.Bytes, progress.Total, progress.Percent(), progress.Rate/1e6)
 	}
-	return vec, nil
 }
 
 func main() {
@@ -83,7 +74,7 @@ func main() {
 	//-----------------------------------------------------
 	step4Start := time.Now() // start timer for Step 4→6
 
-	vec, err := readVectorFromFile("../data/data_100000000.bin")
+	vec, err := model_io.ReadBinFile("../data/data_100000000.bin")
 	if err != nil {
 		log.Fatalf("failed to read vector: %v", err)
 	}
@@ -91,13 +82,23 @@ func main() {
 
 	weightModel := &pb.WeightModel{Values: vec}
 
-	cid, err := ipfsClient.AddAndPinFile(context.Background(), weightModel)
+	// Uploading 100M values takes a while, so the progress is logged.
+	addOptions := ipfsClient.AddOptions()
+	addOptions.Progress = logProgress("Uploading weight model")
+	cid, err := ipfsClient.AddFileWithOptions(context.Background(), weightModel, addOptions)
 	if err != nil {
 		log.Fatalf("failed to add weight model to IPFS: %v", err)
 	}
+	if err = ipfsClient.PinFile(context.Background(), cid); err != nil {
+		log.Fatalf("failed to pin weight model: %v", err)
+	}
 	log.Printf("Pinned weight model to IPFS with CID: %s", cid)
 
-	err = metadataService.AddParticipantModelMetadata(participantId, 1, cid, "homomorphic-hash-placeholder")
+	// The homomorphic hash lets auditors check aggregated models against the participants' models.
+	homomorphicHash := homomorphic_hash.Hash(weightModel)
+	log.Printf("Computed homomorphic hash of weight model: %s", homomorphicHash)
+
+	err = metadataService.AddParticipantModelMetadata(participantId, 1, cid, homomorphicHash.String())
 	if err != nil {
 		log.Fatalf("failed to add participant model metadata: %v", err)
 	}
@@ -113,22 +114,38 @@ func main() {
 	log.Printf("Fetched participant model metadata: %+v", modelMeta)
 
 	var fetchedModel pb.WeightModel
-	err = ipfsClient.GetFile(context.Background(), modelMeta.ModelHashCid, &fetchedModel)
+	err = ipfsClient.GetFileWithOptions(context.Background(), modelMeta.ModelHashCid, &fetchedModel, ipfs_client.GetOptions{
+		Progress: logProgress("Downloading weight model"),
+	})
 	if err != nil {
 		log.Fatalf("failed to fetch weight model from IPFS: %v", err)
 	}
 
 	//--------------------------------------------------
-	// 6. Add an aggregated weight model (same vector)
+	// 6. Aggregate the participant models and add the result
 	//--------------------------------------------------
-	aggregatedModel := &pb.WeightModel{Values: vec}
+	aggregationResult, err := aggregation.Aggregate([]aggregation.Participant{
+		{Id: participantId, Model: pb.FromWeightModel(&fetchedModel)},
+	}, aggregation.Options{Rule: aggregation.Sum})
+	if err != nil {
+		log.Fatalf("failed to aggregate models: %v", err)
+	}
+	aggregatedModel, err := aggregationResult.WeightModel()
+	if err != nil {
+		log.Fatalf("failed to convert aggregated model: %v", err)
+	}
 	cid, err = ipfsClient.AddAndPinFile(context.Background(), aggregatedModel)
 	if err != nil {
 		log.Fatalf("failed to add aggregated model to IPFS: %v", err)
 	}
 	log.Printf("Pinned aggregated model to IPFS with CID: %s", cid)
 
-	err = metadataService.AddAggregatorModelMetadata(aggregatorId, 1, cid, []int{participantId})
+	// The aggregate hash combines the participants' hashes, as the chaincode verifies.
+	aggregateHash, err := aggregationResult.AggregateHash(map[int]string{participantId: homomorphicHash.String()})
+	if err != nil {
+		log.Fatalf("failed to compute the aggregate homomorphic hash: %v", err)
+	}
+	err = metadataService.AddAggregatorModelMetadata(aggregatorId, 1, cid, aggregationResult.ParticipantIds, aggregateHash, aggregationResult.Rule)
 	if err != nil {
 		log.Fatalf("failed to add aggregator model metadata: %v", err)
 	}
@@ -146,6 +163,11 @@ func main() {
 	}
 	log.Printf("Unpinned participant model with CID: %s", modelMeta.ModelHashCid)
 
+	// The participant's record is frozen while the aggregator's record lists it, so the latter is deleted first.
+	if err = metadataService.DeleteAggregatorModelMetadata(aggregatorId, 1); err != nil {
+		log.Fatalf("failed to delete aggregator model metadata: %v", err)
+	}
+
 	err = metadataService.DeleteParticipantModelMetadata(participantId, 1)
 	if err != nil {
 		log.Fatalf("failed to delete participant model metadata: %v", err)
@@ -165,10 +187,6 @@ func main() {
 		log.Fatalf("failed to delete participant: %v", err)
 	}
 
-	if err = metadataService.DeleteAggregatorModelMetadata(aggregatorId, 1); err != nil {
-		log.Fatalf("failed to delete aggregator model metadata: %v", err)
-	}
-
 	if err = metadataService.DeleteAggregator(aggregatorId); err != nil {
 		log.Fatalf("failed to delete aggregator: %v", err)
 	}
@@ -0,0 +1,164 @@
+package homomorphic_encryption
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKey     *PrivateKey
+)
+
+// newTestKey returns a key of the smallest size, generated once as it takes a while.
+func newTestKey(t *testing.T) *PrivateKey {
+	t.Helper()
+
+	var err error
+	testKeyOnce.Do(func() {
+		testKey, err = GenerateKey(nil, MinKeyBits)
+	})
+	if err != nil || testKey == nil {
+		t.Fatalf("Failed to generate the key: %v", err)
+	}
+	return testKey
+}
+
+func TestEncryptedAggregation(t *testing.T) {
+	key := newTestKey(t)
+
+	models := []*weight_pb.WeightModel{
+		{Values: []int64{1, -2, 3, math.MaxInt64, 0, 100, -100, 7, 8, 9, 10, 11, 12, 13, 14}},
+		{Values: []int64{10, 20, -30, -1, 0, -100, 100, 0, 0, 0, 0, 0, 0, 0, math.MinInt64 + 14}},
+		{Values: []int64{-11, -18, 27, -5, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+	}
+	// A few more values, so that the models need several ciphertexts.
+	for i, model := range models {
+		for j := range 5 {
+			model.Values = append(model.Values, int64((i+1)*(j+1)))
+		}
+	}
+	expected := make([]int64, len(models[0].Values))
+	for _, model := range models {
+		for i, value := range model.Values {
+			expected[i] += value
+		}
+	}
+
+	encrypted := make([]*weight_pb.EncryptedModel, len(models))
+	for i, model := range models {
+		var err error
+		if encrypted[i], err = key.PublicKey.EncryptModel(nil, model, 4); err != nil {
+			t.Fatalf("Failed to encrypt model %d: %v", i, err)
+		}
+	}
+	// 1023 bits of plaintext hold 15 slots of 64 + 2 bits, so 20 values need 2 ciphertexts.
+	if encrypted[0].GetSlots() != 15 || len(encrypted[0].GetCiphertexts()) != 2 {
+		t.Fatalf("Unexpected packing of %d slots in %d ciphertexts", encrypted[0].GetSlots(), len(encrypted[0].GetCiphertexts()))
+	}
+
+	// The ciphertexts survive serialisation, as when they are stored on IPFS.
+	data, err := proto.Marshal(encrypted[2])
+	if err != nil {
+		t.Fatalf("Failed to marshal the encrypted model: %v", err)
+	}
+	encrypted[2] = &weight_pb.EncryptedModel{}
+	if err := proto.Unmarshal(data, encrypted[2]); err != nil {
+		t.Fatalf("Failed to unmarshal the encrypted model: %v", err)
+	}
+
+	sum, err := Add(encrypted...)
+	if err != nil {
+		t.Fatalf("Failed to add the encrypted models: %v", err)
+	}
+	if sum.GetSummands() != 3 {
+		t.Fatalf("Expected 3 summands, got %d", sum.GetSummands())
+	}
+
+	decrypted, err := key.DecryptModel(sum)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the sum: %v", err)
+	}
+	if !slices.Equal(decrypted.GetValues(), expected) {
+		t.Fatalf("Expected %v, got %v", expected, decrypted.GetValues())
+	}
+
+	// Sums can be added further, within the number of summands the slots were made for.
+	if sum, err = Add(sum, encrypted[0]); err != nil {
+		t.Fatalf("Failed to add a fourth model: %v", err)
+	}
+	if _, err := Add(sum, encrypted[0]); err == nil {
+		t.Fatalf("Expected a fifth model to be rejected")
+	}
+}
+
+func TestEncryptedAggregationErrors(t *testing.T) {
+	key := newTestKey(t)
+	model := &weight_pb.WeightModel{Values: []int64{math.MaxInt64, 1}}
+
+	encrypted, err := key.PublicKey.EncryptModel(nil, model, 0)
+	if err != nil {
+		t.Fatalf("Failed to encrypt the model: %v", err)
+	}
+	sum, err := Add(encrypted, encrypted)
+	if err != nil {
+		t.Fatalf("Failed to add the models: %v", err)
+	}
+	if _, err := key.DecryptModel(sum); err == nil {
+		t.Fatalf("Expected a sum overflowing int64 to be rejected")
+	}
+
+	other, err := key.PublicKey.EncryptModel(nil, &weight_pb.WeightModel{Values: []int64{1, 2, 3}}, 0)
+	if err != nil {
+		t.Fatalf("Failed to encrypt the model: %v", err)
+	}
+	if _, err := Add(encrypted, other); err == nil {
+		t.Fatalf("Expected models of different lengths to be rejected")
+	}
+
+	otherKey, err := GenerateKey(nil, MinKeyBits)
+	if err != nil {
+		t.Fatalf("Failed to generate the key: %v", err)
+	}
+	if _, err := otherKey.DecryptModel(encrypted); err == nil {
+		t.Fatalf("Expected a model encrypted with another key to be rejected")
+	}
+}
+
+func TestKeySerialization(t *testing.T) {
+	key := newTestKey(t)
+	model := &weight_pb.WeightModel{Values: []int64{-42, 42}}
+
+	publicKey, err := ParsePublicKey(key.PublicKey.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse the public key: %v", err)
+	}
+	encrypted, err := publicKey.EncryptModel(nil, model, 0)
+	if err != nil {
+		t.Fatalf("Failed to encrypt the model: %v", err)
+	}
+
+	privateKey, err := ParsePrivateKey(key.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse the private key: %v", err)
+	}
+	decrypted, err := privateKey.DecryptModel(encrypted)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the model: %v", err)
+	}
+	if !slices.Equal(decrypted.GetValues(), model.GetValues()) {
+		t.Fatalf("Expected %v, got %v", model.GetValues(), decrypted.GetValues())
+	}
+
+	if _, err := ParsePublicKey([]byte{1, 2, 3}); err == nil {
+		t.Fatalf("Expected a short public key to be rejected")
+	}
+	if _, err := GenerateKey(nil, 512); err == nil {
+		t.Fatalf("Expected a key below the minimum size to be rejected")
+	}
+}
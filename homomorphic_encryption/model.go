@@ -0,0 +1,236 @@
+package homomorphic_encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+	"runtime"
+	"sync"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// DefaultMaxSummands is the number of encrypted models that may be added together unless told otherwise.
+const DefaultMaxSummands = 1 << 16
+
+// valueBits is the size of a packed value, an int64 offset by 2^63.
+const valueBits = 64
+
+// EncryptModel encrypts the values of a weight model, packing as many of them per ciphertext as fit while leaving room
+// for the sum of up to maxSummands encrypted models (DefaultMaxSummands if it is not positive). The ciphertexts are
+// computed in parallel. random is crypto/rand if nil.
+func (k *PublicKey) EncryptModel(random io.Reader, model *weight_pb.WeightModel, maxSummands int) (*weight_pb.EncryptedModel, error) {
+	if maxSummands <= 0 {
+		maxSummands = DefaultMaxSummands
+	}
+	if random == nil {
+		random = rand.Reader
+	} else {
+		random = &lockedReader{reader: random}
+	}
+
+	// Summing up to 2^b values of 64 bits takes 64 + b bits.
+	slotBits := valueBits + max(bits.Len(uint(maxSummands-1)), 1)
+	slots := (k.N.BitLen() - 1) / slotBits
+	if slots == 0 {
+		return nil, fmt.Errorf("a key of %d bits cannot hold slots of %d bits", k.N.BitLen(), slotBits)
+	}
+
+	values := model.GetValues()
+	ciphertexts := make([][]byte, (len(values)+slots-1)/slots)
+	err := parallel(len(ciphertexts), func(i int) error {
+		packed := values[i*slots : min((i+1)*slots, len(values))]
+		c, err := k.encrypt(random, pack(packed, slotBits))
+		if err != nil {
+			return err
+		}
+		ciphertexts[i] = c.FillBytes(make([]byte, k.ciphertextSize()))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &weight_pb.EncryptedModel{
+		PublicKey:   k.Bytes(),
+		Length:      int64(len(values)),
+		SlotBits:    int32(slotBits),
+		Slots:       int32(slots),
+		Summands:    1,
+		Ciphertexts: ciphertexts,
+	}, nil
+}
+
+// Add returns the encryption of the sum of encrypted models, which must be encrypted with the same key and packing.
+// No key is needed, so the aggregator can add the models without learning them.
+func Add(models ...*weight_pb.EncryptedModel) (*weight_pb.EncryptedModel, error) {
+	if len(models) == 0 {
+		return nil, errors.New("no encrypted model to add")
+	}
+
+	first := models[0]
+	key, err := ParsePublicKey(first.GetPublicKey())
+	if err != nil {
+		return nil, err
+	}
+	if err := key.checkLayout(first); err != nil {
+		return nil, err
+	}
+
+	var summands int64
+	for i, model := range models {
+		if !bytes.Equal(model.GetPublicKey(), first.GetPublicKey()) {
+			return nil, fmt.Errorf("encrypted model %d is encrypted with another key", i)
+		}
+		if model.GetLength() != first.GetLength() || model.GetSlotBits() != first.GetSlotBits() || model.GetSlots() != first.GetSlots() ||
+			len(model.GetCiphertexts()) != len(first.GetCiphertexts()) {
+			return nil, fmt.Errorf("encrypted model %d is packed differently", i)
+		}
+		if model.GetSummands() < 1 {
+			return nil, fmt.Errorf("encrypted model %d has an invalid number of summands %d", i, model.GetSummands())
+		}
+		summands += model.GetSummands()
+	}
+	if maxSummands := int64(1) << (first.GetSlotBits() - valueBits); summands > maxSummands {
+		return nil, fmt.Errorf("the sum of %d encrypted models would overflow slots made for at most %d", summands, maxSummands)
+	}
+
+	ciphertexts := make([][]byte, len(first.GetCiphertexts()))
+	err = parallel(len(ciphertexts), func(i int) error {
+		sum := new(big.Int).SetBytes(first.GetCiphertexts()[i])
+		for _, model := range models[1:] {
+			sum = key.add(sum, new(big.Int).SetBytes(model.GetCiphertexts()[i]))
+		}
+		ciphertexts[i] = sum.FillBytes(make([]byte, key.ciphertextSize()))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &weight_pb.EncryptedModel{
+		PublicKey:   first.GetPublicKey(),
+		Length:      first.GetLength(),
+		SlotBits:    first.GetSlotBits(),
+		Slots:       first.GetSlots(),
+		Summands:    summands,
+		Ciphertexts: ciphertexts,
+	}, nil
+}
+
+// DecryptModel decrypts an encrypted model, or a sum of them, into a weight model. The ciphertexts are decrypted
+// in parallel. A sum whose values overflow int64 is rejected.
+func (k *PrivateKey) DecryptModel(encrypted *weight_pb.EncryptedModel) (*weight_pb.WeightModel, error) {
+	if !bytes.Equal(encrypted.GetPublicKey(), k.PublicKey.Bytes()) {
+		return nil, errors.New("the model is encrypted with another key")
+	}
+	if err := k.checkLayout(encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.GetSummands() < 1 || encrypted.GetSummands() > int64(1)<<(encrypted.GetSlotBits()-valueBits) {
+		return nil, fmt.Errorf("invalid number of summands %d", encrypted.GetSummands())
+	}
+
+	slots := int(encrypted.GetSlots())
+	values := make([]int64, encrypted.GetLength())
+	offset := new(big.Int).Lsh(big.NewInt(encrypted.GetSummands()), valueBits-1)
+	err := parallel(len(encrypted.GetCiphertexts()), func(i int) error {
+		c := new(big.Int).SetBytes(encrypted.GetCiphertexts()[i])
+		if c.Cmp(k.nSquared) >= 0 {
+			return fmt.Errorf("ciphertext %d is out of range", i)
+		}
+
+		unpacked := values[i*slots : min((i+1)*slots, len(values))]
+		if err := unpack(k.decrypt(c), int(encrypted.GetSlotBits()), offset, unpacked); err != nil {
+			return fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &weight_pb.WeightModel{Values: values}, nil
+}
+
+// checkLayout checks that the packing of an encrypted model is valid for the key.
+func (k *PublicKey) checkLayout(encrypted *weight_pb.EncryptedModel) error {
+	slotBits, slots := int(encrypted.GetSlotBits()), int(encrypted.GetSlots())
+	if slotBits <= valueBits || slotBits > valueBits+62 || slots <= 0 || slots*slotBits >= k.N.BitLen() {
+		return fmt.Errorf("invalid packing of %d slots of %d bits", slots, slotBits)
+	}
+	if length := encrypted.GetLength(); length < 0 || int64(len(encrypted.GetCiphertexts())) != (length+int64(slots)-1)/int64(slots) {
+		return fmt.Errorf("%d ciphertexts cannot hold %d values", len(encrypted.GetCiphertexts()), length)
+	}
+
+	return nil
+}
+
+// ciphertextSize returns the size in bytes of a ciphertext, an integer modulo n^2.
+func (k *PublicKey) ciphertextSize() int {
+	return (k.nSquared.BitLen() + 7) / 8
+}
+
+// pack packs values offset by 2^63 into a plaintext, the first value in the least significant slot.
+func pack(values []int64, slotBits int) *big.Int {
+	m := new(big.Int)
+	slot := new(big.Int)
+	for i := len(values) - 1; i >= 0; i-- {
+		m.Lsh(m, uint(slotBits))
+		// Flipping the sign bit adds 2^63 to a two's complement value.
+		m.Or(m, slot.SetUint64(uint64(values[i])^(1<<63)))
+	}
+	return m
+}
+
+// unpack reads the slots of a plaintext into values, removing the offset of the summed values.
+func unpack(m *big.Int, slotBits int, offset *big.Int, values []int64) error {
+	mask := new(big.Int).Sub(new(big.Int).Lsh(one, uint(slotBits)), one)
+	slot := new(big.Int)
+	for i := range values {
+		slot.Rsh(m, uint(i*slotBits)).And(slot, mask).Sub(slot, offset)
+		if !slot.IsInt64() {
+			return fmt.Errorf("value %d of the sum overflows int64", i)
+		}
+		values[i] = slot.Int64()
+	}
+	return nil
+}
+
+// parallel calls work for each index below count, spread over all cores, and returns the first error.
+func parallel(count int, work func(i int) error) error {
+	workers := min(runtime.GOMAXPROCS(0), count)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := count * worker / workers; i < count*(worker+1)/workers; i++ {
+				if errs[worker] = work(i); errs[worker] != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// lockedReader serialises the reads of a source of randomness that may not be safe for concurrent use.
+type lockedReader struct {
+	mu     sync.Mutex
+	reader io.Reader
+}
+
+func (r *lockedReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reader.Read(p)
+}
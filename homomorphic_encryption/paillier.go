@@ -0,0 +1,191 @@
+// Package homomorphic_encryption encrypts weight models with the Paillier cryptosystem, which is additively
+// homomorphic: the product of two ciphertexts decrypts to the sum of their plaintexts. Participants encrypt their
+// models with the shared public key, the aggregator adds the encrypted models without learning them, see Add, and
+// only the holders of the private key can decrypt the aggregate.
+//
+// Several int64 values are packed into each plaintext, see EncryptModel, so that a model of m values takes about
+// m * 80 / 2048 ciphertexts with the default key size rather than m.
+package homomorphic_encryption
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// DefaultKeyBits is the size of the modulus generated by default.
+const DefaultKeyBits = 2048
+
+// MinKeyBits is the smallest modulus accepted.
+const MinKeyBits = 1024
+
+var one = big.NewInt(1)
+
+// PublicKey is a Paillier public key, with generator n + 1.
+// N - the modulus, the product of two primes.
+type PublicKey struct {
+	N *big.Int
+
+	nSquared *big.Int
+}
+
+// PrivateKey is a Paillier private key. Decryption is done modulo each prime with the Chinese remainder theorem.
+type PrivateKey struct {
+	PublicKey
+
+	p, q               *big.Int
+	pSquared, qSquared *big.Int
+	// hp and hq are the inverses of L(g^(p-1) mod p^2) mod p and L(g^(q-1) mod q^2) mod q.
+	hp, hq *big.Int
+	// qInverse is the inverse of q mod p.
+	qInverse *big.Int
+}
+
+// GenerateKey generates a private key whose modulus has the given number of bits, at least MinKeyBits.
+// random is crypto/rand if nil.
+func GenerateKey(random io.Reader, bits int) (*PrivateKey, error) {
+	if bits < MinKeyBits || bits%2 != 0 {
+		return nil, fmt.Errorf("invalid key size %d, it must be even and at least %d bits", bits, MinKeyBits)
+	}
+	if random == nil {
+		random = rand.Reader
+	}
+
+	for {
+		p, err := rand.Prime(random, bits/2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate a prime: %w", err)
+		}
+		q, err := rand.Prime(random, bits/2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate a prime: %w", err)
+		}
+
+		// With primes of the same size, gcd(n, (p-1)(q-1)) = 1 as the cryptosystem requires.
+		if p.Cmp(q) != 0 && new(big.Int).Mul(p, q).BitLen() == bits {
+			return newPrivateKey(p, q)
+		}
+	}
+}
+
+// newPrivateKey derives a private key from its primes.
+func newPrivateKey(p *big.Int, q *big.Int) (*PrivateKey, error) {
+	n := new(big.Int).Mul(p, q)
+	key := &PrivateKey{
+		PublicKey: PublicKey{N: n, nSquared: new(big.Int).Mul(n, n)},
+		p:         p,
+		q:         q,
+		pSquared:  new(big.Int).Mul(p, p),
+		qSquared:  new(big.Int).Mul(q, q),
+	}
+
+	key.hp = key.h(p, key.pSquared)
+	key.hq = key.h(q, key.qSquared)
+	key.qInverse = new(big.Int).ModInverse(q, p)
+	if key.hp == nil || key.hq == nil || key.qInverse == nil {
+		return nil, errors.New("invalid private key primes")
+	}
+
+	return key, nil
+}
+
+// h returns the inverse of L(g^(prime-1) mod prime^2) mod prime, or nil if it does not exist.
+func (k *PrivateKey) h(prime *big.Int, primeSquared *big.Int) *big.Int {
+	g := new(big.Int).Add(k.N, one)
+	x := new(big.Int).Exp(g, new(big.Int).Sub(prime, one), primeSquared)
+	return new(big.Int).ModInverse(l(x, prime), prime)
+}
+
+// l is the function L(x) = (x - 1) / d of the Paillier cryptosystem.
+func l(x *big.Int, d *big.Int) *big.Int {
+	return new(big.Int).Div(new(big.Int).Sub(x, one), d)
+}
+
+// Bytes returns the modulus, big-endian, from which ParsePublicKey restores the key.
+func (k *PublicKey) Bytes() []byte {
+	return k.N.Bytes()
+}
+
+// ParsePublicKey restores a public key from its modulus, as returned by PublicKey.Bytes.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	n := new(big.Int).SetBytes(data)
+	if n.BitLen() < MinKeyBits || n.Bit(0) == 0 {
+		return nil, fmt.Errorf("invalid public key of %d bits", n.BitLen())
+	}
+
+	return &PublicKey{N: n, nSquared: new(big.Int).Mul(n, n)}, nil
+}
+
+// Bytes returns the primes of the key, each big-endian in half the size of the modulus, from which ParsePrivateKey
+// restores the key. They must be kept secret.
+func (k *PrivateKey) Bytes() []byte {
+	size := (k.N.BitLen() + 15) / 16
+	data := make([]byte, 2*size)
+	k.p.FillBytes(data[:size])
+	k.q.FillBytes(data[size:])
+	return data
+}
+
+// ParsePrivateKey restores a private key from its primes, as returned by PrivateKey.Bytes.
+func ParsePrivateKey(data []byte) (*PrivateKey, error) {
+	if len(data) == 0 || len(data)%2 != 0 {
+		return nil, fmt.Errorf("invalid private key of %d bytes", len(data))
+	}
+
+	p := new(big.Int).SetBytes(data[:len(data)/2])
+	q := new(big.Int).SetBytes(data[len(data)/2:])
+	if !p.ProbablyPrime(20) || !q.ProbablyPrime(20) || p.Cmp(q) == 0 || new(big.Int).Mul(p, q).BitLen() < MinKeyBits {
+		return nil, errors.New("invalid private key primes")
+	}
+
+	return newPrivateKey(p, q)
+}
+
+// encrypt encrypts a plaintext in [0, n) as (1 + m*n) * r^n mod n^2 for a random r.
+func (k *PublicKey) encrypt(random io.Reader, m *big.Int) (*big.Int, error) {
+	var r *big.Int
+	for {
+		var err error
+		if r, err = rand.Int(random, k.N); err != nil {
+			return nil, fmt.Errorf("failed to generate the encryption randomness: %w", err)
+		}
+		if r.Sign() > 0 && new(big.Int).GCD(nil, nil, r, k.N).Cmp(one) == 0 {
+			break
+		}
+	}
+
+	c := new(big.Int).Exp(r, k.N, k.nSquared)
+	gm := new(big.Int).Mul(m, k.N)
+	gm.Add(gm, one)
+	c.Mul(c, gm)
+	return c.Mod(c, k.nSquared), nil
+}
+
+// add returns the ciphertext of the sum of the plaintexts of two ciphertexts.
+func (k *PublicKey) add(a *big.Int, b *big.Int) *big.Int {
+	c := new(big.Int).Mul(a, b)
+	return c.Mod(c, k.nSquared)
+}
+
+// decrypt decrypts a ciphertext modulo p and q and combines the results.
+func (k *PrivateKey) decrypt(c *big.Int) *big.Int {
+	mp := k.decryptModPrime(c, k.p, k.pSquared, k.hp)
+	mq := k.decryptModPrime(c, k.q, k.qSquared, k.hq)
+
+	// m = mq + q * ((mp - mq) * q^-1 mod p)
+	m := new(big.Int).Sub(mp, mq)
+	m.Mul(m, k.qInverse)
+	m.Mod(m, k.p)
+	m.Mul(m, k.q)
+	return m.Add(m, mq)
+}
+
+// decryptModPrime returns the plaintext of a ciphertext modulo one of the primes.
+func (k *PrivateKey) decryptModPrime(c *big.Int, prime *big.Int, primeSquared *big.Int, h *big.Int) *big.Int {
+	x := new(big.Int).Exp(c, new(big.Int).Sub(prime, one), primeSquared)
+	m := l(x, prime)
+	m.Mul(m, h)
+	return m.Mod(m, prime)
+}
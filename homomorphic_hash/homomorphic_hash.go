@@ -0,0 +1,194 @@
+// Package homomorphic_hash implements an additively homomorphic hash of model weight vectors, so that an auditor can
+// check that an aggregated model is the sum of the participants' models from their hashes alone.
+//
+// The hash of a vector v is the Pedersen-style vector commitment sum_i v_i * G_i in the ristretto255 group, where
+// each generator G_i is derived from its index by hashing to the group, so that no one knows discrete logarithms
+// between them. Finding two vectors with the same hash is as hard as computing discrete logarithms, and
+// Hash(a + b) = Combine(Hash(a), Hash(b)) for the integer sum of the vectors. As the scalars are integers modulo
+// the group order, sums of int64 vectors must not overflow int64 for the aggregate model to match.
+package homomorphic_hash
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/gtank/ristretto255"
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// domain separates the generators of this hash from any other use of hashing to ristretto255.
+const domain = "fabric-ipfs-interface/homomorphic-hash/v1"
+
+// chunkSize is the number of elements combined in one multi-scalar multiplication.
+const chunkSize = 1024
+
+// Digest is the hash of a weight vector, the encoding of a ristretto255 element.
+type Digest [32]byte
+
+// String returns the digest in hexadecimal, as stored in model metadata.
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// ParseDigest parses a digest in hexadecimal, as returned by Digest.String.
+func ParseDigest(s string) (Digest, error) {
+	var digest Digest
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != len(digest) {
+		return Digest{}, fmt.Errorf("invalid homomorphic hash %q", s)
+	}
+	copy(digest[:], data)
+
+	if _, err := digest.element(); err != nil {
+		return Digest{}, err
+	}
+
+	return digest, nil
+}
+
+// Hash returns the homomorphic hash of the values of a weight model.
+func Hash(model *weight_pb.WeightModel) Digest {
+	return HashValues(model.GetValues())
+}
+
+// HashValues returns the homomorphic hash of a weight vector. Chunks of the vector are hashed in parallel.
+func HashValues(values []int64) Digest {
+	workers := min(runtime.GOMAXPROCS(0), (len(values)+chunkSize-1)/chunkSize)
+	partials := make([]*ristretto255.Element, max(workers, 1))
+	partials[0] = ristretto255.NewElement()
+
+	var wg sync.WaitGroup
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			begin, end := len(values)*worker/workers, len(values)*(worker+1)/workers
+			partials[worker] = hashRange(values[begin:end], begin)
+		}()
+	}
+	wg.Wait()
+
+	sum := ristretto255.NewElement()
+	for _, partial := range partials {
+		sum.Add(sum, partial)
+	}
+
+	return encode(sum)
+}
+
+// Combine returns the hash of the sum of the vectors with the given hashes.
+func Combine(digests ...Digest) (Digest, error) {
+	sum := ristretto255.NewElement()
+	for _, digest := range digests {
+		element, err := digest.element()
+		if err != nil {
+			return Digest{}, err
+		}
+		sum.Add(sum, element)
+	}
+
+	return encode(sum), nil
+}
+
+// CombineWeighted returns the hash of the weighted sum of the vectors with the given hashes, e.g. of a model
+// aggregated with integer weights such as sample counts.
+func CombineWeighted(weights []int64, digests []Digest) (Digest, error) {
+	if len(weights) != len(digests) {
+		return Digest{}, fmt.Errorf("got %d weights for %d hashes", len(weights), len(digests))
+	}
+
+	scalars := make([]*ristretto255.Scalar, len(digests))
+	elements := make([]*ristretto255.Element, len(digests))
+	for i, digest := range digests {
+		element, err := digest.element()
+		if err != nil {
+			return Digest{}, err
+		}
+		scalars[i], elements[i] = scalar(weights[i]), element
+	}
+
+	return encode(ristretto255.NewElement().VarTimeMultiScalarMult(scalars, elements)), nil
+}
+
+// Verify reports whether an aggregate hash equals the combination of the given hashes, i.e. whether the aggregated
+// vector is the sum of the hashed vectors.
+func Verify(aggregate Digest, digests ...Digest) (bool, error) {
+	if _, err := aggregate.element(); err != nil {
+		return false, err
+	}
+
+	combined, err := Combine(digests...)
+	if err != nil {
+		return false, err
+	}
+
+	return combined == aggregate, nil
+}
+
+// element decodes the digest into a group element.
+func (d Digest) element() (*ristretto255.Element, error) {
+	element := ristretto255.NewElement()
+	if err := element.Decode(d[:]); err != nil {
+		return nil, errors.New("invalid homomorphic hash: not a group element")
+	}
+
+	return element, nil
+}
+
+// hashRange returns sum_i values[i] * G_(offset+i), skipping zero values.
+func hashRange(values []int64, offset int) *ristretto255.Element {
+	sum := ristretto255.NewElement()
+	scalars := make([]*ristretto255.Scalar, 0, chunkSize)
+	generators := make([]*ristretto255.Element, 0, chunkSize)
+
+	for i, value := range values {
+		if value != 0 {
+			scalars = append(scalars, scalar(value))
+			generators = append(generators, generator(offset+i))
+		}
+		if len(scalars) == chunkSize || (i == len(values)-1 && len(scalars) > 0) {
+			sum.Add(sum, ristretto255.NewElement().VarTimeMultiScalarMult(scalars, generators))
+			scalars, generators = scalars[:0], generators[:0]
+		}
+	}
+
+	return sum
+}
+
+// generator returns the generator of the given index, hashed to the group.
+func generator(index int) *ristretto255.Element {
+	h := sha512.New()
+	h.Write([]byte(domain))
+	h.Write(binary.LittleEndian.AppendUint64(nil, uint64(index)))
+
+	return ristretto255.NewElement().FromUniformBytes(h.Sum(nil))
+}
+
+// scalar returns an int64 as a scalar, negative values becoming their additive inverses.
+func scalar(value int64) *ristretto255.Scalar {
+	magnitude := uint64(value)
+	if value < 0 {
+		magnitude = -magnitude
+	}
+
+	var encoded [32]byte
+	binary.LittleEndian.PutUint64(encoded[:], magnitude)
+	s := ristretto255.NewScalar()
+	_ = s.Decode(encoded[:]) // Values below 2^64 are always canonical.
+	if value < 0 {
+		s.Negate(s)
+	}
+
+	return s
+}
+
+func encode(element *ristretto255.Element) Digest {
+	var digest Digest
+	element.Encode(digest[:0])
+	return digest
+}
@@ -0,0 +1,125 @@
+package homomorphic_hash
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+func randomValues(random *rand.Rand, n int) []int64 {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = random.Int64N(1<<40) - 1<<39
+	}
+	return values
+}
+
+func TestHashIsHomomorphic(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	n := 3*chunkSize + 17
+
+	participants := make([]*weight_pb.WeightModel, 4)
+	digests := make([]Digest, len(participants))
+	sum := make([]int64, n)
+	for i := range participants {
+		participants[i] = &weight_pb.WeightModel{Values: randomValues(random, n)}
+		digests[i] = Hash(participants[i])
+		for j, value := range participants[i].Values {
+			sum[j] += value
+		}
+	}
+
+	aggregate := HashValues(sum)
+	ok, err := Verify(aggregate, digests...)
+	if err != nil || !ok {
+		t.Fatalf("Expected the hash of the sum to verify, got %v (%v)", ok, err)
+	}
+
+	combined, err := Combine(digests...)
+	if err != nil || combined != aggregate {
+		t.Fatalf("Expected Combine to return the hash of the sum, got %v (%v)", combined, err)
+	}
+
+	// A single changed weight breaks the verification.
+	sum[n-1]++
+	if ok, err := Verify(HashValues(sum), digests...); err != nil || ok {
+		t.Fatalf("Expected a tampered aggregate not to verify, got %v (%v)", ok, err)
+	}
+	if ok, err := Verify(aggregate, digests[1:]...); err != nil || ok {
+		t.Fatalf("Expected an aggregate missing a participant not to verify, got %v (%v)", ok, err)
+	}
+}
+
+func TestHashValues(t *testing.T) {
+	if digest := HashValues(nil); digest != (Digest{}) {
+		t.Fatalf("Expected the empty vector to hash to the identity, got %v", digest)
+	}
+	if HashValues([]int64{0, 0, 0}) != HashValues(nil) {
+		t.Fatalf("Expected a zero vector to hash like the empty vector")
+	}
+
+	// The position of a value matters.
+	if HashValues([]int64{1, 2}) == HashValues([]int64{2, 1}) {
+		t.Fatalf("Expected permuted vectors to have different hashes")
+	}
+
+	// Negative values are additive inverses, including the most negative int64.
+	for _, value := range []int64{1, 12345, math.MaxInt64} {
+		combined, err := Combine(HashValues([]int64{value, 7}), HashValues([]int64{-value, -7}))
+		if err != nil || combined != (Digest{}) {
+			t.Fatalf("Expected %d and %d to cancel out, got %v (%v)", value, -value, combined, err)
+		}
+	}
+	// Sums beyond the int64 range are still hashed as integers: 2 * MinInt64 = -4 * 2^62.
+	combined, err := Combine(HashValues([]int64{math.MinInt64}), HashValues([]int64{math.MinInt64}))
+	if err != nil {
+		t.Fatalf("Failed to combine: %v", err)
+	}
+	expected, err := CombineWeighted([]int64{-4}, []Digest{HashValues([]int64{1 << 62})})
+	if err != nil || combined != expected {
+		t.Fatalf("Expected %v for 2 * MinInt64, got %v (%v)", expected, combined, err)
+	}
+}
+
+func TestCombineWeighted(t *testing.T) {
+	random := rand.New(rand.NewPCG(3, 4))
+	a, b := randomValues(random, 100), randomValues(random, 100)
+
+	weighted := make([]int64, len(a))
+	for i := range a {
+		weighted[i] = 3*a[i] - 5*b[i]
+	}
+
+	combined, err := CombineWeighted([]int64{3, -5}, []Digest{HashValues(a), HashValues(b)})
+	if err != nil || combined != HashValues(weighted) {
+		t.Fatalf("Expected the hash of the weighted sum, got %v (%v)", combined, err)
+	}
+
+	if _, err := CombineWeighted([]int64{1}, nil); err == nil {
+		t.Fatalf("Expected mismatched weights to be rejected")
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	digest := HashValues([]int64{1, 2, 3})
+	parsed, err := ParseDigest(digest.String())
+	if err != nil || parsed != digest {
+		t.Fatalf("Expected %v, got %v (%v)", digest, parsed, err)
+	}
+
+	for _, s := range []string{"", "homomorphic-hash-placeholder", digest.String()[:62], "ff" + digest.String()[2:]} {
+		if _, err := ParseDigest(s); err == nil {
+			t.Fatalf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func BenchmarkHashValues(b *testing.B) {
+	values := randomValues(rand.New(rand.NewPCG(5, 6)), 100000)
+	b.ResetTimer()
+	for range b.N {
+		HashValues(values)
+	}
+}
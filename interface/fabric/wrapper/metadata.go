@@ -336,15 +336,22 @@ func (s *MetadataService) GetAllParticipantModelMetadataByEpoch(epoch int) ([]sh
 // AddAggregatorModelMetadata submits a transaction to add a new aggregator model metadata record.
 // Only the owner of the aggregator record or an admin can add a new metadata record for the aggregator's id.
 // The metadata record will be bound to the caller's identity, thus changes made to the record can only be done by the creator or an admin.
-func (s *MetadataService) AddAggregatorModelMetadata(aggregatorId int, epoch int, modelHashCid string, participantIds []int) error {
+// The aggregation rule is recorded for auditors and must be one of the rules named in shared. The chaincode rejects the record unless the homomorphic
+// hash equals the combination of the listed participants' homomorphic hashes for the epoch, weighted by the recorded sample counts for "fedavg";
+// records of "median", "trimmed_mean", clipped model updates or no participants cannot be verified and can only be added by an admin.
+func (s *MetadataService) AddAggregatorModelMetadata(aggregatorId int, epoch int, modelHashCid string, participantIds []int, homomorphicHash string, aggregation shared.AggregationRule) error {
 	aggregatorIdStr := strconv.Itoa(aggregatorId)
 	epochStr := strconv.Itoa(epoch)
 	var participantIdsJSON, err = json.Marshal(participantIds)
 	if err != nil {
 		return fmt.Errorf("failed to marshal participant ids JSON: %w", err)
 	}
+	aggregationJSON, err := json.Marshal(aggregation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal aggregation rule JSON: %w", err)
+	}
 
-	err = s.client.SubmitTransaction(nil, "AddAggregatorModelMetadata", aggregatorIdStr, epochStr, modelHashCid, string(participantIdsJSON))
+	err = s.client.SubmitTransaction(nil, "AddAggregatorModelMetadata", aggregatorIdStr, epochStr, modelHashCid, string(participantIdsJSON), homomorphicHash, string(aggregationJSON))
 	if err != nil {
 		return fmt.Errorf("failed to add aggregator model metadata record for aggregator id %d and epoch %d: %w", aggregatorId, epoch, err)
 	}
@@ -394,15 +401,20 @@ func (s *MetadataService) DeleteAggregatorModelMetadata(aggregatorId int, epoch
 }
 
 // UpdateAggregatorModelMetadata updates an existing aggregator model metadata record. Can be done only by the record's owner or an admin.
-func (s *MetadataService) UpdateAggregatorModelMetadata(aggregatorId int, epoch int, modelHashCid string, participantIds []int) error {
+// The homomorphic hash is verified like in AddAggregatorModelMetadata.
+func (s *MetadataService) UpdateAggregatorModelMetadata(aggregatorId int, epoch int, modelHashCid string, participantIds []int, homomorphicHash string, aggregation shared.AggregationRule) error {
 	aggregatorIdStr := strconv.Itoa(aggregatorId)
 	epochStr := strconv.Itoa(epoch)
 	var participantIdsJSON, err = json.Marshal(participantIds)
 	if err != nil {
 		return fmt.Errorf("failed to marshal participant ids JSON: %w", err)
 	}
+	aggregationJSON, err := json.Marshal(aggregation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal aggregation rule JSON: %w", err)
+	}
 
-	err = s.client.SubmitTransaction(nil, "UpdateAggregatorModelMetadata", aggregatorIdStr, epochStr, modelHashCid, string(participantIdsJSON))
+	err = s.client.SubmitTransaction(nil, "UpdateAggregatorModelMetadata", aggregatorIdStr, epochStr, modelHashCid, string(participantIdsJSON), homomorphicHash, string(aggregationJSON))
 	if err != nil {
 		return fmt.Errorf("failed to update aggregator model metadata record for aggregator id %d and epoch %d: %w", aggregatorId, epoch, err)
 	}
@@ -443,6 +455,47 @@ func (s *MetadataService) GetAllAggregatorModelMetadataByAggregator(aggregatorId
 	return aggregatorModelMetadataList, nil
 }
 
+// ---------------------------------------------------------------------------
+// THIS SECTION IS FOR THE SECURE AGGREGATION MESSAGES' FUNCTIONALITIES
+// ---------------------------------------------------------------------------
+
+// AddSecureAggregationMessage submits a transaction to publish a participant's message for a round of the secure aggregation protocol.
+// Only the owner of the participant record or an admin can publish messages for the participant's id, and messages cannot be changed.
+func (s *MetadataService) AddSecureAggregationMessage(participantId int, epoch int, round string, payload string) error {
+	participantIdStr := strconv.Itoa(participantId)
+	epochStr := strconv.Itoa(epoch)
+
+	err := s.client.SubmitTransaction(nil, "AddSecureAggregationMessage", participantIdStr, epochStr, round, payload)
+	if err != nil {
+		return fmt.Errorf("failed to add secure aggregation message from participant %d for round %s of epoch %d: %w", participantId, round, epoch, err)
+	}
+
+	return nil
+}
+
+// GetAllSecureAggregationMessagesByRound queries the secure aggregation messages published for a round of an epoch. Can be done by anyone.
+func (s *MetadataService) GetAllSecureAggregationMessagesByRound(epoch int, round string) ([]shared.SecureAggregationMessage, error) {
+	epochStr := strconv.Itoa(epoch)
+	var messages []shared.SecureAggregationMessage
+
+	err := s.client.EvaluateTransaction(&messages, "GetAllSecureAggregationMessagesByRound", epochStr, round)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the secure aggregation messages for round %s of epoch %d: %w", round, epoch, err)
+	}
+
+	return messages, nil
+}
+
+// DeleteAllSecureAggregationMessages deletes all secure aggregation messages, returns nil if successful. Only the admin can delete all messages.
+func (s *MetadataService) DeleteAllSecureAggregationMessages() error {
+	err := s.client.SubmitTransaction(nil, "DeleteAllSecureAggregationMessages")
+	if err != nil {
+		return fmt.Errorf("failed to delete all secure aggregation messages: %w", err)
+	}
+
+	return nil
+}
+
 // --------------------------------------------
 // THIS SECTION DEALS WITH ACCESSING THE LOGS
 // --------------------------------------------
@@ -523,6 +576,11 @@ func (s *MetadataService) CleanLedger() error {
 		return fmt.Errorf("failed to delete all aggregators model metadata records: %w", err)
 	}
 
+	err = s.client.SubmitTransaction(nil, "DeleteAllSecureAggregationMessages")
+	if err != nil {
+		return fmt.Errorf("failed to delete all secure aggregation messages: %w", err)
+	}
+
 	err = s.client.SubmitTransaction(nil, "DeleteAllParticipants")
 	if err != nil {
 		return fmt.Errorf("failed to delete all participants records: %w", err)
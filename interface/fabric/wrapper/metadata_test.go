@@ -4,6 +4,9 @@ import (
 	"os"
 	"strconv"
 	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/homomorphic_hash"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
 )
 
 var testMetadataServiceUser1 *MetadataService
@@ -59,6 +62,11 @@ func teardown() {
 		panic("failed to delete all aggregator model metadata records: " + err.Error())
 	}
 
+	err = testMetadataServiceAdmin.DeleteAllSecureAggregationMessages()
+	if err != nil {
+		panic("failed to delete all secure aggregation messages: " + err.Error())
+	}
+
 	err = testMetadataServiceAdmin.DeleteAllParticipants()
 	if err != nil {
 		panic("failed to delete all participants records: " + err.Error())
@@ -244,23 +252,31 @@ func TestGeneral(t *testing.T) {
 	// --------------------------------------------
 	t.Log("-----Participant Model Metadata Functionalities-----")
 
+	// Homomorphic hashes of the participants' models, which the chaincode combines to verify aggregations
+	thomasModel := []int64{1, 2, 3}
+	mihneaModel := []int64{4, 5, 6}
+	mihneaModelUpdated := []int64{7, 8, 9}
+	thomasHash := homomorphic_hash.HashValues(thomasModel).String()
+	mihneaHash := homomorphic_hash.HashValues(mihneaModel).String()
+	mihneaHashUpdated := homomorphic_hash.HashValues(mihneaModelUpdated).String()
+
 	// Add participant model metadata
-	err = testMetadataServiceUser1.AddParticipantModelMetadata(thomasId, 10, "thomas-model-cid", "thomas-model-homomorphic-hash")
+	err = testMetadataServiceUser1.AddParticipantModelMetadata(thomasId, 10, "thomas-model-cid", thomasHash)
 	if err != nil {
 		t.Fatalf("Failed to add Thomas model metadata epoch 10: %v", err)
 	}
 
-	err = testMetadataServiceUser1.AddParticipantModelMetadata(thomasId, 20, "thomas-model-cid", "thomas-model-homomorphic-hash")
+	err = testMetadataServiceUser1.AddParticipantModelMetadata(thomasId, 20, "thomas-model-cid", thomasHash)
 	if err != nil {
 		t.Fatalf("Failed to add Thomas model metadata epoch 20: %v", err)
 	}
 
-	err = testMetadataServiceUser2.AddParticipantModelMetadata(mihneaId, 10, "mihnea-model-cid", "mihnea-model-homomorphic-hash")
+	err = testMetadataServiceUser2.AddParticipantModelMetadata(mihneaId, 10, "mihnea-model-cid", mihneaHash)
 	if err != nil {
 		t.Fatalf("Failed to add Mihnea model metadata epoch 10: %v", err)
 	}
 
-	err = testMetadataServiceUser2.AddParticipantModelMetadata(mihneaId, 20, "mihnea-model-cid", "mihnea-model-homomorphic-hash")
+	err = testMetadataServiceUser2.AddParticipantModelMetadata(mihneaId, 20, "mihnea-model-cid", mihneaHash)
 	if err != nil {
 		t.Fatalf("Failed to add Mihnea model metadata epoch 20: %v", err)
 	}
@@ -275,7 +291,7 @@ func TestGeneral(t *testing.T) {
 	t.Logf("Fetched Mihnea model metadata: %+v", modelMeta)
 
 	// Update Mihnea model metadata
-	err = testMetadataServiceUser2.UpdateParticipantModelMetadata(mihneaId, 10, "mihnea-model-cid-updated", "mihnea-model-homomorphic-hash-updated")
+	err = testMetadataServiceUser2.UpdateParticipantModelMetadata(mihneaId, 10, "mihnea-model-cid-updated", mihneaHashUpdated)
 	if err != nil {
 		t.Fatalf("Failed to update Mihnea model metadata epoch 10: %v", err)
 	}
@@ -314,13 +330,28 @@ func TestGeneral(t *testing.T) {
 	// -------------------------------------------
 	t.Log("-----Aggregator Model Metadata Functionalities-----")
 
+	// The aggregated model of epoch 10 is the sum of Thomas' model and Mihnea's updated model
+	aggregatedModel := make([]int64, len(thomasModel))
+	for i := range aggregatedModel {
+		aggregatedModel[i] = thomasModel[i] + mihneaModelUpdated[i]
+	}
+	aggregatedHash := homomorphic_hash.HashValues(aggregatedModel).String()
+	sumRule := shared.AggregationRule{Name: shared.SumAggregationRule}
+
+	// An aggregate hash that does not combine the participants' hashes is rejected
+	err = testMetadataServiceAdmin.AddAggregatorModelMetadata(aggregatorId, 10, "aggregator-model-cid", []int{thomasId, mihneaId}, mihneaHash, sumRule)
+	if err == nil {
+		t.Fatalf("Added aggregator model metadata with a mismatching homomorphic hash but should have been rejected")
+	}
+	t.Logf("Correctly rejected mismatching homomorphic hash: %v", err)
+
 	// Add aggregator model metadata (Admin)
-	err = testMetadataServiceAdmin.AddAggregatorModelMetadata(aggregatorId, 10, "aggregator-model-cid", []int{thomasId, mihneaId})
+	err = testMetadataServiceAdmin.AddAggregatorModelMetadata(aggregatorId, 10, "aggregator-model-cid", []int{thomasId, mihneaId}, aggregatedHash, sumRule)
 	if err != nil {
 		t.Fatalf("Failed to add aggregator model metadata epoch 10: %v", err)
 	}
 
-	err = testMetadataServiceAdmin.AddAggregatorModelMetadata(aggregatorId, 20, "aggregator-model-cid", []int{mihneaId})
+	err = testMetadataServiceAdmin.AddAggregatorModelMetadata(aggregatorId, 20, "aggregator-model-cid", []int{mihneaId}, mihneaHash, sumRule)
 	if err != nil {
 		t.Fatalf("Failed to add aggregator model metadata epoch 20: %v", err)
 	}
@@ -335,7 +366,7 @@ func TestGeneral(t *testing.T) {
 	t.Logf("Fetched aggregator model metadata epoch 10: %+v", aggMeta)
 
 	// Update aggregator model metadata epoch 10
-	err = testMetadataServiceAdmin.UpdateAggregatorModelMetadata(aggregatorId, 10, "aggregator-model-cid-updated", []int{thomasId, mihneaId})
+	err = testMetadataServiceAdmin.UpdateAggregatorModelMetadata(aggregatorId, 10, "aggregator-model-cid-updated", []int{thomasId, mihneaId}, aggregatedHash, sumRule)
 	if err != nil {
 		t.Fatalf("Failed to update aggregator model metadata epoch 10: %v", err)
 	}
@@ -363,6 +394,46 @@ func TestGeneral(t *testing.T) {
 	t.Logf("All aggregator model metadata: %+v", allAggMeta)
 }
 
+func TestSecureAggregationMessages(t *testing.T) {
+	participantId := 40
+	err := testMetadataServiceUser1.AddParticipant(participantId, "key", "homomorphic-key-cypher", "communication-key-cypher")
+	if err != nil {
+		t.Fatalf("User1 failed to add participant: %v", err)
+	}
+	defer testMetadataServiceUser1.DeleteParticipant(participantId)
+
+	err = testMetadataServiceUser1.AddSecureAggregationMessage(participantId, 1, "advertise_keys", `{"channel_key":"a2V5"}`)
+	if err != nil {
+		t.Fatalf("User1 failed to publish a secure aggregation message: %v", err)
+	}
+
+	// Messages cannot be replaced, and only the owner of the participant can publish them.
+	err = testMetadataServiceUser1.AddSecureAggregationMessage(participantId, 1, "advertise_keys", `{}`)
+	if err == nil {
+		t.Fatalf("User1 was able to replace a secure aggregation message")
+	}
+	err = testMetadataServiceUser2.AddSecureAggregationMessage(participantId, 1, "share_keys", `{}`)
+	if err == nil {
+		t.Fatalf("User2 was able to publish a message for a participant it does not own")
+	}
+
+	messages, err := testMetadataServiceUser2.GetAllSecureAggregationMessagesByRound(1, "advertise_keys")
+	if err != nil {
+		t.Fatalf("User2 failed to get the secure aggregation messages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ParticipantId != participantId || messages[0].Payload != `{"channel_key":"a2V5"}` {
+		t.Fatalf("Unexpected secure aggregation messages: %+v", messages)
+	}
+
+	messages, err = testMetadataServiceUser2.GetAllSecureAggregationMessagesByRound(1, "share_keys")
+	if err != nil {
+		t.Fatalf("User2 failed to get the secure aggregation messages: %v", err)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("Expected no messages for another round, got %+v", messages)
+	}
+}
+
 func TestDeleteAllAdminOnly(t *testing.T) {
 	// 1. Try as USER1 → SHOULD FAIL
 	err := testMetadataServiceUser1.DeleteAllParticipants()
@@ -389,6 +460,12 @@ func TestDeleteAllAdminOnly(t *testing.T) {
 	}
 	t.Log("Correctly blocked User1 from DeleteAllAggregatorModelMetadata")
 
+	err = testMetadataServiceUser1.DeleteAllSecureAggregationMessages()
+	if err == nil {
+		t.Fatalf("User1 was able to call DeleteAllSecureAggregationMessages but should NOT have permission")
+	}
+	t.Log("Correctly blocked User1 from DeleteAllSecureAggregationMessages")
+
 	// 2. Try as ADMIN → SHOULD PASS
 	if err := testMetadataServiceAdmin.DeleteAllParticipants(); err != nil {
 		t.Fatalf("Admin failed DeleteAllParticipants: %v", err)
@@ -409,6 +486,11 @@ func TestDeleteAllAdminOnly(t *testing.T) {
 		t.Fatalf("Admin failed DeleteAllAggregatorModelMetadata: %v", err)
 	}
 	t.Log("Admin successfully called DeleteAllAggregatorModelMetadata")
+
+	if err := testMetadataServiceAdmin.DeleteAllSecureAggregationMessages(); err != nil {
+		t.Fatalf("Admin failed DeleteAllSecureAggregationMessages: %v", err)
+	}
+	t.Log("Admin successfully called DeleteAllSecureAggregationMessages")
 }
 
 func TestLoggingAdminOnly(t *testing.T) {
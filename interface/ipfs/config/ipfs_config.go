@@ -3,6 +3,7 @@ package ipfs_config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,6 +12,132 @@ import (
 type IpfsConfig struct {
 	Ipfs struct {
 		NodePath string `yaml:"node_path"`
+
+		// Unixfs holds the UnixFS import settings used when adding files. Preset selects a named
+		// set of settings (currently only "canonical"), and any other field set here overrides it.
+		// The canonical preset also requires the nodes to keep the default Import.UnixFSFileMaxLinks.
+		// Fields left empty follow the defaults of the client, see ipfs_client.AddOptions.
+		Unixfs struct {
+			Preset       string `yaml:"preset"`
+			CidVersion   *int   `yaml:"cid_version"`
+			HashFunction string `yaml:"hash_function"`
+			Chunker      string `yaml:"chunker"`
+			RawLeaves    *bool  `yaml:"raw_leaves"`
+			Inline       *bool  `yaml:"inline"`
+			InlineLimit  int    `yaml:"inline_limit"`
+		} `yaml:"unixfs"`
+
+		// RemotePinning configures an IPFS Pinning Service API endpoint used as a second pinning backend.
+		// Remote pinning is disabled when the endpoint is empty.
+		RemotePinning struct {
+			Endpoint     string        `yaml:"endpoint"`
+			Token        string        `yaml:"token"`
+			PollInterval time.Duration `yaml:"poll_interval"`
+			Timeout      time.Duration `yaml:"timeout"`
+		} `yaml:"remote_pinning"`
+
+		// Replication lists the RPC API addresses of the IPFS nodes of the other organisations.
+		// Content is pinned on ReplicationFactor of them (all by default) and replication fails
+		// unless at least WriteQuorum of those pins succeed (all by default).
+		Replication struct {
+			Nodes             []string `yaml:"nodes"`
+			ReplicationFactor int      `yaml:"replication_factor"`
+			WriteQuorum       int      `yaml:"write_quorum"`
+		} `yaml:"replication"`
+
+		// Cache configures an on-disk cache of retrieved files. Caching is disabled when the directory
+		// is empty, and MaxBytes defaults to 1 GiB.
+		Cache struct {
+			Dir      string `yaml:"dir"`
+			MaxBytes int64  `yaml:"max_bytes"`
+		} `yaml:"cache"`
+
+		// Timeouts bound connecting to the node and whole requests to it, including reading the response.
+		// Dial defaults to 10 seconds, a negative value disables it. Request is not set by default, so that large
+		// transfers are only bounded by the context of the call; set it to bound every request to the node.
+		Timeouts struct {
+			Dial    time.Duration `yaml:"dial"`
+			Request time.Duration `yaml:"request"`
+		} `yaml:"timeouts"`
+
+		// Retry configures how idempotent operations (get, pin) are retried with exponential backoff
+		// when the node cannot be reached. Defaults to 3 attempts with a backoff from 200ms up to 5s.
+		Retry struct {
+			MaxAttempts    int           `yaml:"max_attempts"`
+			InitialBackoff time.Duration `yaml:"initial_backoff"`
+			MaxBackoff     time.Duration `yaml:"max_backoff"`
+		} `yaml:"retry"`
+
+		// CircuitBreaker stops sending requests to the node after FailureThreshold consecutive connection
+		// failures, until ResetTimeout has passed. Defaults to 5 failures and 30 seconds; a negative
+		// threshold disables the circuit breaker.
+		CircuitBreaker struct {
+			FailureThreshold int           `yaml:"failure_threshold"`
+			ResetTimeout     time.Duration `yaml:"reset_timeout"`
+		} `yaml:"circuit_breaker"`
+
+		// Auth holds the credentials sent to the node, matching an entry of Kubo's API.Authorizations.
+		// Either Username with a password, or a bearer token may be configured. Each secret can be given
+		// directly, as the path of a file holding it, or as the name of an environment variable holding it.
+		// The credentials are only sent to NodePath, never to the replica nodes.
+		Auth struct {
+			Username        string `yaml:"username"`
+			Password        string `yaml:"password"`
+			PasswordFile    string `yaml:"password_file"`
+			PasswordEnv     string `yaml:"password_env"`
+			BearerToken     string `yaml:"bearer_token"`
+			BearerTokenFile string `yaml:"bearer_token_file"`
+			BearerTokenEnv  string `yaml:"bearer_token_env"`
+		} `yaml:"auth"`
+
+		// Tls configures HTTPS connections to the nodes: a CA bundle to verify them, a client certificate
+		// for nodes behind a proxy requiring mutual TLS, and the expected server name. Only the CA bundle is
+		// used for the replica nodes, the client certificate and server name apply to NodePath alone.
+		Tls struct {
+			CaCertPath     string `yaml:"ca_cert_path"`
+			ClientCertPath string `yaml:"client_cert_path"`
+			ClientKeyPath  string `yaml:"client_key_path"`
+			ServerName     string `yaml:"server_name"`
+		} `yaml:"tls"`
+
+		// Mfs configures where models are mirrored in the node's MFS. The paths are templates where {federation},
+		// {epoch}, {participant} and {aggregator} are replaced, and default to /fl/{federation}/epoch-{epoch},
+		// /fl/{federation}/epoch-{epoch}/participant-{participant} and /fl/{federation}/epoch-{epoch}/global.
+		Mfs struct {
+			Federation      string `yaml:"federation"`
+			EpochPath       string `yaml:"epoch_path"`
+			ParticipantPath string `yaml:"participant_path"`
+			GlobalPath      string `yaml:"global_path"`
+		} `yaml:"mfs"`
+
+		// Embedded starts a Kubo node in-process instead of connecting to NodePath, for single-machine
+		// simulations and CI. RepoPath is initialised if needed; when it is empty, a temporary repository
+		// is used and removed when the client is closed. The node stays offline unless Online is set.
+		Embedded struct {
+			Enabled  bool   `yaml:"enabled"`
+			RepoPath string `yaml:"repo_path"`
+			Online   bool   `yaml:"online"`
+		} `yaml:"embedded"`
+
+		// Ipns configures the IPNS name the newest global model is published under. KeyName defaults to
+		// "global-model", Ttl to one minute and Lifetime to 48 hours.
+		Ipns struct {
+			KeyName  string        `yaml:"key_name"`
+			Ttl      time.Duration `yaml:"ttl"`
+			Lifetime time.Duration `yaml:"lifetime"`
+		} `yaml:"ipns"`
+
+		// Retrieval limits the files retrieved by GetFile and GetFileBytes, so that a CID pointing to a huge
+		// file cannot exhaust the memory of the client. MaxSize defaults to 2 GiB and -1 disables it;
+		// MaxDuration is unlimited unless set.
+		Retrieval struct {
+			MaxSize     int64         `yaml:"max_size"`
+			MaxDuration time.Duration `yaml:"max_duration"`
+		} `yaml:"retrieval"`
+
+		// CheckOnStart pings the node when the client is created, so that an unreachable node
+		// is reported right away instead of in the middle of an epoch.
+		CheckOnStart bool `yaml:"check_on_start"`
 	} `yaml:"ipfs"`
 }
 
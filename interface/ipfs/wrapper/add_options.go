@@ -0,0 +1,163 @@
+package ipfs_client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/kubo/client/rpc"
+	caopts "github.com/ipfs/kubo/core/coreiface/options"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/config"
+)
+
+// CanonicalPreset is the name of the preset returned by CanonicalAddOptions.
+const CanonicalPreset = "canonical"
+
+// CanonicalMaxLinks is the maximum number of links per file node required by the canonical preset.
+// It is the default of Kubo's Import.UnixFSFileMaxLinks and the value used by MemoryStorage.
+const CanonicalMaxLinks = 174
+
+// AddOptions holds the UnixFS import settings used when adding a file to IPFS.
+// These settings decide the CID of the added content, so every organisation of a federation
+// must use the same ones to get identical CIDs for identical models.
+// Fields left empty are not set by the client: the Kubo RPC client then sends the defaults of its options (sha2-256,
+// 256 KiB chunks, no inlining, inline limit 32), and only the CID version and raw leaves follow the node's Import
+// configuration. MemoryStorage uses the same defaults as a Kubo node without Import configuration.
+// CidVersion - the CID version (0 or 1).
+// HashFunction - the multihash function name, e.g. "sha2-256" or "blake3".
+// Chunker - the chunking algorithm, e.g. "size-1048576", "rabin-[min]-[avg]-[max]" or "buzhash".
+// RawLeaves - whether leaf blocks are stored as raw blocks instead of UnixFS nodes.
+// Inline - whether blocks smaller than InlineLimit are inlined into their CID.
+// InlineLimit - the maximum size in bytes of an inlined block.
+// Progress - if set, called with the progress of the upload; it does not affect the CID.
+type AddOptions struct {
+	CidVersion   *int
+	HashFunction string
+	Chunker      string
+	RawLeaves    *bool
+	Inline       *bool
+	InlineLimit  int
+	Progress     ProgressFunc
+}
+
+// CanonicalAddOptions returns the deterministic import settings agreed on by the federation:
+// CIDv1, sha2-256, 1 MiB fixed-size chunks, raw leaves and no inlining.
+// The maximum number of links per file node is not forwarded by the Kubo RPC client, so it
+// follows the node's Import.UnixFSFileMaxLinks. The preset requires it to be CanonicalMaxLinks on
+// every node of the federation, and NewIpfsClient checks it on the local and replica nodes.
+func CanonicalAddOptions() AddOptions {
+	cidVersion := 1
+	rawLeaves := true
+	inline := false
+
+	return AddOptions{
+		CidVersion:   &cidVersion,
+		HashFunction: "sha2-256",
+		Chunker:      "size-1048576",
+		RawLeaves:    &rawLeaves,
+		Inline:       &inline,
+	}
+}
+
+// addOptionsFromConfig builds the default import settings of a client from its configuration.
+// The preset is applied first and every field set in the configuration overrides it.
+func addOptionsFromConfig(cfg *ipfs_config.IpfsConfig) (AddOptions, error) {
+	var opts AddOptions
+
+	unixfsCfg := cfg.Ipfs.Unixfs
+	switch unixfsCfg.Preset {
+	case "":
+	case CanonicalPreset:
+		opts = CanonicalAddOptions()
+	default:
+		return AddOptions{}, fmt.Errorf("unknown UnixFS preset %q", unixfsCfg.Preset)
+	}
+
+	if unixfsCfg.CidVersion != nil {
+		opts.CidVersion = unixfsCfg.CidVersion
+	}
+	if unixfsCfg.HashFunction != "" {
+		opts.HashFunction = unixfsCfg.HashFunction
+	}
+	if unixfsCfg.Chunker != "" {
+		opts.Chunker = unixfsCfg.Chunker
+	}
+	if unixfsCfg.RawLeaves != nil {
+		opts.RawLeaves = unixfsCfg.RawLeaves
+	}
+	if unixfsCfg.Inline != nil {
+		opts.Inline = unixfsCfg.Inline
+	}
+	if unixfsCfg.InlineLimit != 0 {
+		opts.InlineLimit = unixfsCfg.InlineLimit
+	}
+
+	// Validate early so that a misconfigured client fails on creation instead of on the first upload.
+	if _, err := opts.unixfsAddOptions(); err != nil {
+		return AddOptions{}, err
+	}
+
+	return opts, nil
+}
+
+// checkMaxLinks checks that the Import.UnixFSFileMaxLinks setting of a node is CanonicalMaxLinks.
+// A node without the setting uses the default, which is CanonicalMaxLinks.
+func checkMaxLinks(ctx context.Context, api *rpc.HttpApi) error {
+	var nodeConfig struct {
+		Import struct {
+			UnixFSFileMaxLinks *int64
+		}
+	}
+	if err := api.Request("config/show").Exec(ctx, &nodeConfig); err != nil {
+		return fmt.Errorf("failed to get IPFS node configuration: %w", err)
+	}
+
+	maxLinks := nodeConfig.Import.UnixFSFileMaxLinks
+	if maxLinks != nil && *maxLinks != CanonicalMaxLinks {
+		return fmt.Errorf("the %s preset requires Import.UnixFSFileMaxLinks to be %d, the node uses %d",
+			CanonicalPreset, CanonicalMaxLinks, *maxLinks)
+	}
+
+	return nil
+}
+
+// unixfsAddOptions converts the settings into the options understood by the Kubo Unixfs API.
+func (o AddOptions) unixfsAddOptions() ([]caopts.UnixfsAddOption, error) {
+	var opts []caopts.UnixfsAddOption
+
+	if o.CidVersion != nil {
+		if *o.CidVersion != 0 && *o.CidVersion != 1 {
+			return nil, fmt.Errorf("unsupported CID version %d", *o.CidVersion)
+		}
+		opts = append(opts, caopts.Unixfs.CidVersion(*o.CidVersion))
+	}
+
+	if o.HashFunction != "" {
+		code, ok := mh.Names[o.HashFunction]
+		if !ok {
+			return nil, fmt.Errorf("unknown hash function %q", o.HashFunction)
+		}
+		if o.CidVersion != nil && *o.CidVersion == 0 && code != mh.SHA2_256 {
+			return nil, fmt.Errorf("CIDv0 only supports sha2-256, got %q", o.HashFunction)
+		}
+		opts = append(opts, caopts.Unixfs.Hash(code))
+	}
+
+	if o.Chunker != "" {
+		opts = append(opts, caopts.Unixfs.Chunker(o.Chunker))
+	}
+
+	if o.RawLeaves != nil {
+		opts = append(opts, caopts.Unixfs.RawLeaves(*o.RawLeaves))
+	}
+
+	if o.Inline != nil {
+		opts = append(opts, caopts.Unixfs.Inline(*o.Inline))
+	}
+
+	if o.InlineLimit != 0 {
+		opts = append(opts, caopts.Unixfs.InlineLimit(o.InlineLimit))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,150 @@
+package ipfs_client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/config"
+)
+
+func TestAddOptionsFromConfig(t *testing.T) {
+	var cfg ipfs_config.IpfsConfig
+
+	// Without a preset, nothing is set.
+	opts, err := addOptionsFromConfig(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to build the default options: %v", err)
+	}
+	if opts.CidVersion != nil || opts.HashFunction != "" || opts.Chunker != "" || opts.RawLeaves != nil || opts.Inline != nil || opts.InlineLimit != 0 {
+		t.Fatalf("Expected no option to be set, got %+v", opts)
+	}
+
+	// The canonical preset sets every field that decides the CID.
+	cfg.Ipfs.Unixfs.Preset = CanonicalPreset
+	opts, err = addOptionsFromConfig(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to build the canonical options: %v", err)
+	}
+	if *opts.CidVersion != 1 || opts.HashFunction != "sha2-256" || opts.Chunker != "size-1048576" || !*opts.RawLeaves || *opts.Inline {
+		t.Fatalf("Unexpected canonical options %+v", opts)
+	}
+
+	// Every field set in the configuration overrides the preset, the others are kept.
+	cidVersion, inline := 0, true
+	cfg.Ipfs.Unixfs.CidVersion = &cidVersion
+	cfg.Ipfs.Unixfs.Chunker = "size-4096"
+	cfg.Ipfs.Unixfs.Inline = &inline
+	cfg.Ipfs.Unixfs.InlineLimit = 64
+	opts, err = addOptionsFromConfig(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to build the overridden options: %v", err)
+	}
+	if *opts.CidVersion != 0 || opts.Chunker != "size-4096" || !*opts.Inline || opts.InlineLimit != 64 ||
+		opts.HashFunction != "sha2-256" || !*opts.RawLeaves {
+		t.Fatalf("Unexpected overridden options %+v", opts)
+	}
+}
+
+func TestAddOptionsFromConfigValidation(t *testing.T) {
+	cidVersion0, cidVersion2 := 0, 2
+
+	tests := []struct {
+		name      string
+		configure func(cfg *ipfs_config.IpfsConfig)
+		error     string
+	}{
+		{"UnknownPreset", func(cfg *ipfs_config.IpfsConfig) { cfg.Ipfs.Unixfs.Preset = "fast" }, "unknown UnixFS preset"},
+		{"UnsupportedCidVersion", func(cfg *ipfs_config.IpfsConfig) { cfg.Ipfs.Unixfs.CidVersion = &cidVersion2 }, "unsupported CID version"},
+		{"UnknownHashFunction", func(cfg *ipfs_config.IpfsConfig) { cfg.Ipfs.Unixfs.HashFunction = "md6" }, "unknown hash function"},
+		{"CidV0WithBlake3", func(cfg *ipfs_config.IpfsConfig) {
+			cfg.Ipfs.Unixfs.CidVersion = &cidVersion0
+			cfg.Ipfs.Unixfs.HashFunction = "blake3"
+		}, "CIDv0 only supports sha2-256"},
+		{"CanonicalWithCidV0", func(cfg *ipfs_config.IpfsConfig) {
+			// The canonical hash function is sha2-256, so CIDv0 is valid over the preset.
+			cfg.Ipfs.Unixfs.Preset = CanonicalPreset
+			cfg.Ipfs.Unixfs.CidVersion = &cidVersion0
+		}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfg ipfs_config.IpfsConfig
+			test.configure(&cfg)
+
+			_, err := addOptionsFromConfig(&cfg)
+			if test.error == "" && err != nil {
+				t.Fatalf("Expected the configuration to be valid: %v", err)
+			}
+			if test.error != "" && (err == nil || !strings.Contains(err.Error(), test.error)) {
+				t.Fatalf("Expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
+
+func TestCanonicalAddOptionsCid(t *testing.T) {
+	storage, err := NewMemoryStorage(CanonicalAddOptions())
+	if err != nil {
+		t.Fatalf("Failed to create the memory storage: %v", err)
+	}
+
+	// A file of a single chunk is stored as one raw block, so its CIDv1 uses the raw codec.
+	cid, err := storage.AddFileBytes(context.Background(), []byte("model"))
+	if err != nil {
+		t.Fatalf("Failed to add the file: %v", err)
+	}
+	if !strings.HasPrefix(cid, "/ipfs/bafkrei") {
+		t.Fatalf("Expected a CIDv1 of a raw sha2-256 block, got %s", cid)
+	}
+}
+
+func TestNewIpfsClientChecksCanonicalMaxLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLinks string
+		error    string
+	}{
+		{"Default", "null", ""},
+		{"Canonical", "174", ""},
+		{"Changed", "1024", "requires Import.UnixFSFileMaxLinks to be 174, the node uses 1024"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v0/config/show" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"Import":{"UnixFSFileMaxLinks":%s}}`, test.maxLinks)
+			}))
+			defer server.Close()
+
+			configPath := filepath.Join(t.TempDir(), "canonical.yaml")
+			config := fmt.Sprintf("ipfs:\n  node_path: %q\n  unixfs:\n    preset: %q\n", server.URL, CanonicalPreset)
+			if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			client, err := NewIpfsClient(configPath)
+			if test.error == "" {
+				if err != nil {
+					t.Fatalf("Failed to create the client: %v", err)
+				}
+				_ = client.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Fatalf("Expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package ipfs_client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// DefaultGetFilesConcurrency is the number of files GetFiles downloads at once unless told otherwise.
+const DefaultGetFilesConcurrency = 8
+
+// FileResult holds the outcome of fetching one file of a batch.
+// Index - the position of the CID in the requested batch.
+// Cid - the CID of the file.
+// Data - the content of the file, nil if fetching it failed.
+// Err - why fetching the file failed, nil on success.
+type FileResult struct {
+	Index int
+	Cid   string
+	Data  []byte
+	Err   error
+}
+
+// GetFiles fetches the content of several files, with at most concurrency downloads at once
+// (DefaultGetFilesConcurrency if it is not positive). Every file is fetched like GetFileBytes, so the cache and
+// the retry policy apply. The results are sent as they arrive, in no particular order, and the channel is closed
+// once every file has been handled. A failing file is reported in its result and does not stop the others.
+// Cancelling ctx fails the files not fetched yet. The channel is buffered for the whole batch, so the caller
+// may stop reading early without leaking goroutines.
+func (c *IpfsClient) GetFiles(ctx context.Context, cids []string, concurrency int) <-chan FileResult {
+	if concurrency <= 0 {
+		concurrency = DefaultGetFilesConcurrency
+	}
+	concurrency = min(concurrency, max(len(cids), 1))
+
+	results := make(chan FileResult, len(cids))
+	indexes := make(chan int, len(cids))
+	for i := range cids {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := FileResult{Index: i, Cid: cids[i]}
+				if err := ctx.Err(); err != nil {
+					result.Err = err
+				} else {
+					result.Data, result.Err = c.GetFileBytes(ctx, cids[i])
+				}
+				results <- result
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// GetEpochFiles fetches the participant models of an epoch, as recorded in the given metadata, like GetFiles.
+// The records of the epoch are returned sorted by participant id, and the Index of each result refers to them.
+func (c *IpfsClient) GetEpochFiles(ctx context.Context, epoch int, participantMetadata []shared.ParticipantModelMetadata, concurrency int) ([]shared.ParticipantModelMetadata, <-chan FileResult, error) {
+	var records []shared.ParticipantModelMetadata
+	for _, metadata := range participantMetadata {
+		if metadata.Epoch == epoch {
+			records = append(records, metadata)
+		}
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("no participant model metadata found for epoch %d", epoch)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ParticipantId < records[j].ParticipantId
+	})
+
+	cids := make([]string, len(records))
+	for i, record := range records {
+		cids[i] = record.ModelHashCid
+	}
+
+	return records, c.GetFiles(ctx, cids, concurrency), nil
+}
@@ -0,0 +1,70 @@
+package ipfs_client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetEpochFiles(t *testing.T) {
+	client := newEmbeddedTestClient(t, "")
+	ctx := context.Background()
+
+	var metadata []shared.ParticipantModelMetadata
+	for participantId := 1; participantId <= 10; participantId++ {
+		cid, err := client.AddFile(ctx, &pb.WeightModel{Values: []int64{int64(participantId)}})
+		if err != nil {
+			t.Fatalf("Failed to add model: %v", err)
+		}
+		metadata = append(metadata, shared.ParticipantModelMetadata{ParticipantId: participantId, Epoch: 1, ModelHashCid: cid})
+	}
+	// A record of another epoch and a record whose model cannot be fetched.
+	metadata = append(metadata,
+		shared.ParticipantModelMetadata{ParticipantId: 1, Epoch: 2, ModelHashCid: metadata[0].ModelHashCid},
+		shared.ParticipantModelMetadata{ParticipantId: 0, Epoch: 1, ModelHashCid: "/ipfs/not-a-cid"},
+	)
+
+	records, results, err := client.GetEpochFiles(ctx, 1, metadata, 3)
+	if err != nil {
+		t.Fatalf("Failed to get the files of epoch 1: %v", err)
+	}
+	if len(records) != 11 || records[0].ParticipantId != 0 {
+		t.Fatalf("Expected the 11 records of epoch 1 sorted by participant id, got %+v", records)
+	}
+
+	fetched := map[int]bool{}
+	failed := 0
+	for result := range results {
+		if fetched[result.Index] {
+			t.Fatalf("Got result %d twice", result.Index)
+		}
+		fetched[result.Index] = true
+
+		record := records[result.Index]
+		if result.Cid != record.ModelHashCid {
+			t.Fatalf("Expected result %d to be %s, got %s", result.Index, record.ModelHashCid, result.Cid)
+		}
+		if result.Err != nil {
+			failed++
+			continue
+		}
+
+		var model pb.WeightModel
+		if err := proto.Unmarshal(result.Data, &model); err != nil {
+			t.Fatalf("Failed to unmarshal model: %v", err)
+		}
+		if model.Values[0] != int64(record.ParticipantId) {
+			t.Fatalf("Expected the model of participant %d, got %v", record.ParticipantId, model.Values)
+		}
+	}
+	if len(fetched) != 11 || failed != 1 {
+		t.Fatalf("Expected 11 results with 1 failure, got %d with %d failures", len(fetched), failed)
+	}
+
+	if _, _, err := client.GetEpochFiles(ctx, 3, metadata, 0); err == nil {
+		t.Fatalf("Expected an error for an epoch without records")
+	}
+}
@@ -0,0 +1,334 @@
+package ipfs_client
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// defaultCacheMaxBytes bounds the cache when a directory is configured without a size.
+const defaultCacheMaxBytes = 1 << 30
+
+// errNotCacheable is returned for paths below a root CID, which are not cached.
+var errNotCacheable = errors.New("only the content of a root CID is cached")
+
+// cidSuffix is the extension of the file holding the CID a cached file was verified against.
+const cidSuffix = ".cid"
+
+// CacheStats holds the counters of a DiskCache.
+// Hits - reads served from the cache.
+// Misses - reads not found in the cache, including corrupted entries.
+// Evictions - entries removed to stay under the size bound.
+// Corrupted - entries whose content no longer matched their CID and were removed.
+// Entries - the number of cached files.
+// Bytes - the total size of the cached files.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Corrupted uint64
+	Entries   int
+	Bytes     int64
+}
+
+// DiskCache is a content-addressed on-disk cache of file contents keyed by CID.
+// CIDs are immutable, so entries never need to be invalidated; the least recently used
+// entries are evicted once the cache grows beyond its size bound. Content is only stored if it
+// matches its CID, and is checked against it again when read, corrupted entries are dropped.
+// Checking re-imports the content with the cache's UnixFS import settings, see verifyContent.
+type DiskCache struct {
+	dir        string
+	maxBytes   int64
+	addOptions AddOptions
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+	stats   CacheStats
+}
+
+// cacheEntry is an element of the LRU list of a DiskCache.
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewDiskCache opens a cache in the given directory, creating it if needed, bounded to maxBytes.
+// Files already present in the directory are indexed, ordered by their last access,
+// so a cache survives restarts. A maxBytes of 0 uses a default of 1 GiB.
+// Content is checked against its CID with the given UnixFS import settings, which must be the ones it was added with.
+func NewDiskCache(dir string, maxBytes int64, addOptions AddOptions) (*DiskCache, error) {
+	if maxBytes == 0 {
+		maxBytes = defaultCacheMaxBytes
+	}
+	if maxBytes < 0 {
+		return nil, fmt.Errorf("cache size must be positive, got %d", maxBytes)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &DiskCache{
+		dir:        dir,
+		maxBytes:   maxBytes,
+		addOptions: addOptions,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}
+
+	if err := c.index(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Get returns the cached content of a CID, given as an IPFS path or a bare CID. Paths below the CID are never cached.
+// The second return value is false if the CID is not cached or its entry no longer matched its CID.
+func (c *DiskCache) Get(cidStr string) ([]byte, bool) {
+	key, err := cacheKey(cidStr)
+	if err != nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	data, err := c.read(key)
+	if err != nil {
+		c.remove(elem)
+		c.stats.Corrupted++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	now := time.Now()
+	_ = os.Chtimes(c.dataPath(key), now, now)
+	c.stats.Hits++
+
+	return data, true
+}
+
+// Put stores the content of a CID, given as an IPFS path or a bare CID, evicting the least
+// recently used entries if the cache grows beyond its size bound. Content larger than the
+// whole cache is not stored, paths below the CID are rejected, and so is content that does
+// not match the CID, with ErrCidMismatch.
+func (c *DiskCache) Put(cidStr string, data []byte) error {
+	if _, err := cacheKey(cidStr); err != nil {
+		return err
+	}
+	if err := verifyContent(cidStr, data, c.addOptions); err != nil {
+		return err
+	}
+
+	return c.putVerified(cidStr, data)
+}
+
+// putVerified stores content already checked against its CID, like Put.
+func (c *DiskCache) putVerified(cidStr string, data []byte) error {
+	key, err := cacheKey(cidStr)
+	if err != nil {
+		return err
+	}
+	root, err := rootCid(cidStr)
+	if err != nil {
+		return err
+	}
+
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+
+	if err := writeFileAtomic(c.dataPath(key), data); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := writeFileAtomic(c.cidPath(key), []byte(root.String())); err != nil {
+		_ = os.Remove(c.dataPath(key))
+		return fmt.Errorf("failed to write cache entry CID: %w", err)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, size: size})
+	c.size += size
+	c.evict()
+
+	return nil
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *DiskCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.size
+	return stats
+}
+
+// index adds the entries already stored in the cache directory, least recently used first,
+// and removes leftovers of interrupted writes and files of other versions.
+func (c *DiskCache) index() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	type stored struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var found []stored
+
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() {
+			continue
+		}
+		if key, ok := strings.CutSuffix(name, cidSuffix); ok {
+			if _, err := os.Stat(c.dataPath(key)); err != nil {
+				_ = os.Remove(filepath.Join(c.dir, name))
+			}
+			continue
+		}
+		if _, err := cid.Decode(name); err != nil {
+			_ = os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(c.cidPath(name)); err != nil {
+			_ = os.Remove(c.dataPath(name))
+			continue
+		}
+
+		found = append(found, stored{key: name, size: info.Size(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].modTime.Before(found[j].modTime)
+	})
+
+	for _, entry := range found {
+		c.entries[entry.key] = c.lru.PushFront(&cacheEntry{key: entry.key, size: entry.size})
+		c.size += entry.size
+	}
+	c.evict()
+
+	return nil
+}
+
+// read returns the content of an entry after checking it against the CID it was stored under.
+// The CID is kept next to the content, as the key does not tell the CID version the content was added with.
+func (c *DiskCache) read(key string) ([]byte, error) {
+	data, err := os.ReadFile(c.dataPath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := os.ReadFile(c.cidPath(key))
+	if err != nil {
+		return nil, err
+	}
+	if rootKey, err := cacheKey(string(root)); err != nil || rootKey != key {
+		return nil, errors.New("cache entry is stored under another CID")
+	}
+	if err := verifyContent(string(root), data, c.addOptions); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// evict removes the least recently used entries until the cache fits its size bound.
+func (c *DiskCache) evict() {
+	for c.size > c.maxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			return
+		}
+		c.remove(oldest)
+		c.stats.Evictions++
+	}
+}
+
+// remove deletes an entry from the index and the disk.
+func (c *DiskCache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+
+	_ = os.Remove(c.dataPath(entry.key))
+	_ = os.Remove(c.cidPath(entry.key))
+}
+
+func (c *DiskCache) dataPath(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+func (c *DiskCache) cidPath(key string) string {
+	return filepath.Join(c.dir, key+cidSuffix)
+}
+
+// cacheKey returns the CIDv1 string of a CID, so that both CID versions of the same content share an entry.
+// Paths into a directory, such as /ipfs/<root>/file, have no key: their content is not the content of the root CID.
+func cacheKey(cidStr string) (string, error) {
+	c, err := rootCid(cidStr)
+	if errors.Is(err, errNotRootCid) {
+		return "", errNotCacheable
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return cid.NewCidV1(c.Type(), c.Hash()).String(), nil
+}
+
+// writeFileAtomic writes a file through a temporary file, so that readers never see partial content.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
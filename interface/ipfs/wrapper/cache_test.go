@@ -0,0 +1,183 @@
+package ipfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testCachePath returns the IPFS path of a piece of content added with the default UnixFS import settings, as returned by AddFile.
+func testCachePath(t *testing.T, content []byte) string {
+	storage, err := NewMemoryStorage(AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create the memory storage: %v", err)
+	}
+	cid, err := storage.AddFileBytes(context.Background(), content)
+	if err != nil {
+		t.Fatalf("Failed to add content: %v", err)
+	}
+	return cid
+}
+
+func TestDiskCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 25, AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	var cids []string
+	for i := 0; i < 3; i++ {
+		content := []byte(fmt.Sprintf("model %d", i))
+		cids = append(cids, testCachePath(t, content))
+		if err := cache.Put(cids[i], content); err != nil {
+			t.Fatalf("Failed to cache file: %v", err)
+		}
+	}
+
+	// Reading the first file makes the second one the least recently used.
+	if data, ok := cache.Get(cids[0]); !ok || string(data) != "model 0" {
+		t.Fatalf("Expected a cache hit for %s, got %q", cids[0], data)
+	}
+
+	if err := cache.Put(testCachePath(t, []byte("model 3")), []byte("model 3")); err != nil {
+		t.Fatalf("Failed to cache file: %v", err)
+	}
+
+	if _, ok := cache.Get(cids[1]); ok {
+		t.Fatalf("Expected %s to be evicted", cids[1])
+	}
+	if _, ok := cache.Get(cids[0]); !ok {
+		t.Fatalf("Expected %s to stay cached", cids[0])
+	}
+
+	stats := cache.Stats()
+	t.Logf("Cache stats: %+v", stats)
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 || stats.Entries != 3 || stats.Bytes != 21 {
+		t.Fatalf("Unexpected cache stats: %+v", stats)
+	}
+}
+
+func TestDiskCacheVerifiesOnRead(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 0, AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	content := []byte("global model")
+	cidPath := testCachePath(t, content)
+	if err := cache.Put(cidPath, content); err != nil {
+		t.Fatalf("Failed to cache file: %v", err)
+	}
+
+	key, err := cacheKey(cidPath)
+	if err != nil {
+		t.Fatalf("Failed to compute cache key: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, key), []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("Failed to tamper with the cache entry: %v", err)
+	}
+
+	if _, ok := cache.Get(cidPath); ok {
+		t.Fatalf("Expected a tampered entry to be rejected")
+	}
+	if stats := cache.Stats(); stats.Corrupted != 1 || stats.Entries != 0 {
+		t.Fatalf("Expected the tampered entry to be dropped, got %+v", stats)
+	}
+}
+
+func TestDiskCacheSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 0, AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	content := []byte("global model")
+	cidPath := testCachePath(t, content)
+	if err := cache.Put(cidPath, content); err != nil {
+		t.Fatalf("Failed to cache file: %v", err)
+	}
+
+	reopened, err := NewDiskCache(dir, 0, AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+
+	// The bare CIDv1 of the same content shares the entry of its CIDv0 path.
+	key, _ := cacheKey(cidPath)
+	if data, ok := reopened.Get(key); !ok || string(data) != string(content) {
+		t.Fatalf("Expected the reopened cache to hold %s, got %q", cidPath, data)
+	}
+}
+
+func TestDiskCacheSkipsSubpaths(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 0, AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	root := []byte("epoch directory")
+	rootPath := testCachePath(t, root)
+	if err := cache.Put(rootPath, root); err != nil {
+		t.Fatalf("Failed to cache file: %v", err)
+	}
+
+	// Files below the root share its CID but not its content, so they must neither be served from nor stored under it.
+	filePath := rootPath + "/participant_1.bin"
+	if _, ok := cache.Get(filePath); ok {
+		t.Fatalf("Expected a subpath not to be served from the entry of its root")
+	}
+	if err := cache.Put(filePath, []byte("participant model")); !errors.Is(err, errNotCacheable) {
+		t.Fatalf("Expected a subpath not to be cached")
+	}
+
+	data, ok := cache.Get(rootPath)
+	if !ok || string(data) != string(root) {
+		t.Fatalf("Expected the root entry to be kept, got %q", data)
+	}
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Fatalf("Expected a single entry, got %+v", stats)
+	}
+}
+
+func TestDiskCacheRejectsContentNotMatchingItsCid(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 0, AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	cidPath := testCachePath(t, []byte("global model"))
+	if err := cache.Put(cidPath, []byte("forged model")); !errors.Is(err, ErrCidMismatch) {
+		t.Fatalf("Expected ErrCidMismatch, got %v", err)
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Fatalf("Expected the forged content not to be cached, got %+v", stats)
+	}
+
+	// An entry whose content and CID file were both replaced still has to match the CID it is looked up by.
+	if err := cache.Put(cidPath, []byte("global model")); err != nil {
+		t.Fatalf("Failed to cache file: %v", err)
+	}
+	key, err := cacheKey(cidPath)
+	if err != nil {
+		t.Fatalf("Failed to compute cache key: %v", err)
+	}
+	otherPath := testCachePath(t, []byte("forged model"))
+	if err := os.WriteFile(filepath.Join(dir, key), []byte("forged model"), 0o644); err != nil {
+		t.Fatalf("Failed to tamper with the cache entry: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, key+cidSuffix), []byte(otherPath), 0o644); err != nil {
+		t.Fatalf("Failed to tamper with the cache entry CID: %v", err)
+	}
+	if _, ok := cache.Get(cidPath); ok {
+		t.Fatalf("Expected the tampered entry to be rejected")
+	}
+	if stats := cache.Stats(); stats.Corrupted != 1 || stats.Entries != 0 {
+		t.Fatalf("Expected the tampered entry to be dropped, got %+v", stats)
+	}
+}
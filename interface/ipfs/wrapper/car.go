@@ -0,0 +1,353 @@
+package ipfs_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	carstore "github.com/ipld/go-car/v2/blockstore"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// CarIndexEntry links a root CID of a CAR file to the metadata record referencing it.
+// Cid - the root CID as an IPFS path.
+// Kind - "participant" or "aggregator".
+// Id - the participant's or aggregator's id.
+// Epoch - the epoch of the record.
+type CarIndexEntry struct {
+	Cid   string `json:"cid"`
+	Kind  string `json:"kind"`
+	Id    int    `json:"id"`
+	Epoch int    `json:"epoch"`
+}
+
+// CarIndex describes which root of a CAR file belongs to which participant or aggregator and epoch.
+// It is written next to the CAR file, see CarIndexPath.
+type CarIndex struct {
+	Epoch   int             `json:"epoch"`
+	Entries []CarIndexEntry `json:"entries"`
+}
+
+// CarIndexPath returns the path of the index written next to the given CAR file.
+func CarIndexPath(carPath string) string {
+	return carPath + ".index.json"
+}
+
+// ReadCarIndex reads the index written next to a CAR file by ExportEpochCar.
+func ReadCarIndex(carPath string) (*CarIndex, error) {
+	data, err := os.ReadFile(CarIndexPath(carPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR index: %w", err)
+	}
+
+	var index CarIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal CAR index: %w", err)
+	}
+
+	return &index, nil
+}
+
+// ExportCar exports the DAG of a single CID from the IPFS node into a CARv2 file with the CID as its root.
+func (c *IpfsClient) ExportCar(ctx context.Context, cid string, carPath string) error {
+	return c.ExportCars(ctx, []string{cid}, carPath)
+}
+
+// ExportCars exports the DAGs of several CIDs from the IPFS node into a single CARv2 file with the CIDs as its roots.
+// Blocks shared between the DAGs are only written once. An existing file at carPath is overwritten.
+func (c *IpfsClient) ExportCars(ctx context.Context, cids []string, carPath string) error {
+	if len(cids) == 0 {
+		return errors.New("no CIDs to export")
+	}
+
+	roots := make([]cid.Cid, 0, len(cids))
+	for _, cidStr := range cids {
+		root, err := parseCid(cidStr)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, root)
+	}
+
+	// The CARv2 blockstore resumes from an existing file, so a previous export has to be removed first.
+	if err := os.Remove(carPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove existing CAR file: %w", err)
+	}
+
+	store, err := carstore.OpenReadWrite(carPath, roots)
+	if err != nil {
+		return fmt.Errorf("failed to create CAR file: %w", err)
+	}
+
+	for _, root := range roots {
+		if err := c.exportDag(ctx, root, store); err != nil {
+			store.Discard()
+			_ = os.Remove(carPath)
+			return err
+		}
+	}
+
+	if err := store.Finalize(); err != nil {
+		return fmt.Errorf("failed to finalize CAR file: %w", err)
+	}
+
+	return nil
+}
+
+// ExportEpochCar exports every model referenced by the metadata records of the given epoch into a single CARv2 file,
+// and writes an index mapping each root to its participant or aggregator next to it. Records of other epochs are ignored.
+func (c *IpfsClient) ExportEpochCar(ctx context.Context, epoch int, participantMetadata []shared.ParticipantModelMetadata, aggregatorMetadata []shared.AggregatorModelMetadata, carPath string) (*CarIndex, error) {
+	index := epochCarIndex(epoch, participantMetadata, aggregatorMetadata)
+	if len(index.Entries) == 0 {
+		return nil, fmt.Errorf("no model metadata found for epoch %d", epoch)
+	}
+
+	// Several records may reference the same model, it is only exported once.
+	var cids []string
+	seen := map[string]bool{}
+	for _, entry := range index.Entries {
+		if !seen[entry.Cid] {
+			seen[entry.Cid] = true
+			cids = append(cids, entry.Cid)
+		}
+	}
+
+	if err := c.ExportCars(ctx, cids, carPath); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CAR index: %w", err)
+	}
+	if err := os.WriteFile(CarIndexPath(carPath), data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write CAR index: %w", err)
+	}
+
+	return index, nil
+}
+
+// ImportCar verifies a CAR file with VerifyCar and imports it into the IPFS node, pinning its roots.
+// If expectedRoots are given, the roots of the CAR file must match them exactly.
+// The roots are returned as IPFS paths.
+func (c *IpfsClient) ImportCar(ctx context.Context, carPath string, expectedRoots ...string) ([]string, error) {
+	roots, err := VerifyCar(carPath, expectedRoots...)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(carPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CAR file: %w", err)
+	}
+	defer file.Close()
+
+	resp, err := c.NodeHttpApi.Request("dag/import").
+		Option("pin-roots", true).
+		FileBody(file).
+		Send(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import CAR file: %w", err)
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return nil, fmt.Errorf("failed to import CAR file: %w", resp.Error)
+	}
+
+	type importResult struct {
+		Root *struct {
+			Cid struct {
+				Value string `json:"/"`
+			}
+			PinErrorMsg string
+		}
+	}
+
+	pinned := map[string]bool{}
+	decoder := json.NewDecoder(resp.Output)
+	for {
+		var result importResult
+		if err := decoder.Decode(&result); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode CAR import result: %w", err)
+		}
+
+		if result.Root == nil {
+			continue
+		}
+		if result.Root.PinErrorMsg != "" {
+			return nil, fmt.Errorf("failed to pin root %s: %s", result.Root.Cid.Value, result.Root.PinErrorMsg)
+		}
+		pinned[result.Root.Cid.Value] = true
+	}
+
+	for _, root := range roots {
+		rootCid, _ := parseCid(root)
+		if !pinned[rootCid.String()] {
+			return nil, fmt.Errorf("root %s was not pinned by the IPFS node", root)
+		}
+	}
+
+	return roots, nil
+}
+
+// VerifyCar checks a CARv1 or CARv2 file without an IPFS node: the hash of every block must match its CID,
+// every root must be present, and every block linked from a dag-pb block must be present, so that the file
+// holds complete DAGs. If expectedRoots are given, the roots of the CAR file must match them exactly.
+// The roots are returned as IPFS paths.
+func VerifyCar(carPath string, expectedRoots ...string) ([]string, error) {
+	file, err := os.Open(carPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CAR file: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := carv2.NewBlockReader(file, carv2.WithTrustedCAR(false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR header: %w", err)
+	}
+	if len(reader.Roots) == 0 {
+		return nil, errors.New("CAR file has no roots")
+	}
+
+	roots := make([]string, len(reader.Roots))
+	for i, root := range reader.Roots {
+		roots[i] = path.FromCid(root).String()
+	}
+
+	if len(expectedRoots) > 0 {
+		if err := matchRoots(reader.Roots, expectedRoots); err != nil {
+			return nil, err
+		}
+	}
+
+	present := map[string]bool{}
+	linked := map[string]bool{}
+	for {
+		block, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid CAR block: %w", err)
+		}
+		present[block.Cid().KeyString()] = true
+
+		if block.Cid().Type() != cid.DagProtobuf {
+			continue
+		}
+		node, err := merkledag.DecodeProtobuf(block.RawData())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode block %s: %w", block.Cid(), err)
+		}
+		for _, link := range node.Links() {
+			linked[link.Cid.KeyString()] = true
+		}
+	}
+
+	for _, root := range reader.Roots {
+		if !present[root.KeyString()] {
+			return nil, fmt.Errorf("root %s is missing from the CAR file", root)
+		}
+	}
+	for key := range linked {
+		if !present[key] {
+			missing, _ := cid.Cast([]byte(key))
+			return nil, fmt.Errorf("linked block %s is missing from the CAR file", missing)
+		}
+	}
+
+	return roots, nil
+}
+
+// exportDag streams the DAG of a root from the IPFS node as a CARv1 and copies its blocks into the store.
+func (c *IpfsClient) exportDag(ctx context.Context, root cid.Cid, store *carstore.ReadWrite) error {
+	resp, err := c.NodeHttpApi.Request("dag/export", root.String()).Send(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to export DAG of %s: %w", root, err)
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return fmt.Errorf("failed to export DAG of %s: %w", root, resp.Error)
+	}
+
+	reader, err := carv2.NewBlockReader(resp.Output, carv2.WithTrustedCAR(false))
+	if err != nil {
+		return fmt.Errorf("failed to read exported DAG of %s: %w", root, err)
+	}
+
+	for {
+		block, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read exported DAG of %s: %w", root, err)
+		}
+
+		if err := store.Put(ctx, block); err != nil {
+			return fmt.Errorf("failed to write block %s: %w", block.Cid(), err)
+		}
+	}
+}
+
+// epochCarIndex lists the models referenced by the metadata records of an epoch, sorted by kind and id.
+func epochCarIndex(epoch int, participantMetadata []shared.ParticipantModelMetadata, aggregatorMetadata []shared.AggregatorModelMetadata) *CarIndex {
+	index := &CarIndex{Epoch: epoch, Entries: []CarIndexEntry{}}
+
+	for _, metadata := range participantMetadata {
+		if metadata.Epoch == epoch {
+			index.Entries = append(index.Entries, CarIndexEntry{Cid: metadata.ModelHashCid, Kind: "participant", Id: metadata.ParticipantId, Epoch: epoch})
+		}
+	}
+	for _, metadata := range aggregatorMetadata {
+		if metadata.Epoch == epoch {
+			index.Entries = append(index.Entries, CarIndexEntry{Cid: metadata.ModelHashCid, Kind: "aggregator", Id: metadata.AggregatorId, Epoch: epoch})
+		}
+	}
+
+	sort.SliceStable(index.Entries, func(i, j int) bool {
+		if index.Entries[i].Kind != index.Entries[j].Kind {
+			return index.Entries[i].Kind > index.Entries[j].Kind
+		}
+		return index.Entries[i].Id < index.Entries[j].Id
+	})
+
+	return index
+}
+
+// matchRoots checks that the roots of a CAR file are exactly the expected CIDs, in any order and CID version.
+func matchRoots(roots []cid.Cid, expectedRoots []string) error {
+	remaining := map[string]int{}
+	for _, root := range roots {
+		remaining[cid.NewCidV1(root.Type(), root.Hash()).KeyString()]++
+	}
+
+	for _, expected := range expectedRoots {
+		expectedCid, err := parseCid(expected)
+		if err != nil {
+			return err
+		}
+
+		key := cid.NewCidV1(expectedCid.Type(), expectedCid.Hash()).KeyString()
+		if remaining[key] == 0 {
+			return fmt.Errorf("expected root %s is not a root of the CAR file", expected)
+		}
+		remaining[key]--
+	}
+
+	for _, count := range remaining {
+		if count > 0 {
+			return fmt.Errorf("CAR file has %d roots, expected %d", len(roots), len(expectedRoots))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package ipfs_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/path"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/client/rpc"
+	carstore "github.com/ipld/go-car/v2/blockstore"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// writeTestCar writes a CAR file holding a dag-pb root that links to a raw leaf, optionally leaving the leaf out.
+func writeTestCar(t *testing.T, carPath string, withLeaf bool) cid.Cid {
+	leaf := merkledag.NewRawNode([]byte("model weights"))
+	root := merkledag.NodeWithData([]byte("model"))
+	if err := root.AddNodeLink("weights", leaf); err != nil {
+		t.Fatalf("Failed to link leaf: %v", err)
+	}
+
+	store, err := carstore.OpenReadWrite(carPath, []cid.Cid{root.Cid()})
+	if err != nil {
+		t.Fatalf("Failed to create CAR file: %v", err)
+	}
+
+	ctx := context.Background()
+	toPut := []blocks.Block{root}
+	if withLeaf {
+		toPut = append(toPut, leaf)
+	}
+	if err := store.PutMany(ctx, toPut); err != nil {
+		t.Fatalf("Failed to write blocks: %v", err)
+	}
+	if err := store.Finalize(); err != nil {
+		t.Fatalf("Failed to finalize CAR file: %v", err)
+	}
+
+	return root.Cid()
+}
+
+func TestVerifyCar(t *testing.T) {
+	dir := t.TempDir()
+
+	carPath := filepath.Join(dir, "model.car")
+	root := writeTestCar(t, carPath, true)
+	rootPath := path.FromCid(root).String()
+
+	roots, err := VerifyCar(carPath, rootPath)
+	if err != nil {
+		t.Fatalf("Failed to verify CAR file: %v", err)
+	}
+	if len(roots) != 1 || roots[0] != rootPath {
+		t.Fatalf("Expected root %s, got %v", rootPath, roots)
+	}
+
+	otherRoot := path.FromCid(merkledag.NodeWithData([]byte("other")).Cid()).String()
+	if _, err := VerifyCar(carPath, otherRoot); err == nil {
+		t.Fatalf("Expected a CAR file with unexpected roots to be rejected")
+	}
+
+	incompletePath := filepath.Join(dir, "incomplete.car")
+	writeTestCar(t, incompletePath, false)
+	if _, err := VerifyCar(incompletePath); err == nil {
+		t.Fatalf("Expected a CAR file with a missing block to be rejected")
+	}
+}
+
+func TestExportCar(t *testing.T) {
+	dir := t.TempDir()
+
+	// The stand-in node serves a previously written CAR file as the export of any CID.
+	sourcePath := filepath.Join(dir, "source.car")
+	root := writeTestCar(t, sourcePath, true)
+	source, err := os.ReadFile(sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to read CAR file: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/dag/export" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.ipld.car")
+		_, _ = w.Write(source)
+	}))
+	defer server.Close()
+
+	api, err := rpc.NewURLApiWithClient(server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create IPFS API: %v", err)
+	}
+	client := &IpfsClient{NodeHttpApi: api}
+
+	rootPath := path.FromCid(root).String()
+	carPath := filepath.Join(dir, "export.car")
+	if err := client.ExportCar(context.Background(), rootPath, carPath); err != nil {
+		t.Fatalf("Failed to export CAR file: %v", err)
+	}
+
+	if _, err := VerifyCar(carPath, rootPath); err != nil {
+		t.Fatalf("Failed to verify exported CAR file: %v", err)
+	}
+}
+
+func TestEpochCarIndex(t *testing.T) {
+	participantMetadata := []shared.ParticipantModelMetadata{
+		{Epoch: 1, ParticipantId: 2, ModelHashCid: "/ipfs/b"},
+		{Epoch: 2, ParticipantId: 1, ModelHashCid: "/ipfs/c"},
+		{Epoch: 1, ParticipantId: 1, ModelHashCid: "/ipfs/a"},
+	}
+	aggregatorMetadata := []shared.AggregatorModelMetadata{
+		{Epoch: 1, AggregatorId: 7, ModelHashCid: "/ipfs/d"},
+	}
+
+	index := epochCarIndex(1, participantMetadata, aggregatorMetadata)
+
+	expected := []CarIndexEntry{
+		{Cid: "/ipfs/a", Kind: "participant", Id: 1, Epoch: 1},
+		{Cid: "/ipfs/b", Kind: "participant", Id: 2, Epoch: 1},
+		{Cid: "/ipfs/d", Kind: "aggregator", Id: 7, Epoch: 1},
+	}
+	if len(index.Entries) != len(expected) {
+		t.Fatalf("Expected %d index entries, got %v", len(expected), index.Entries)
+	}
+	for i := range expected {
+		if index.Entries[i] != expected[i] {
+			t.Fatalf("Expected entry %d to be %v, got %v", i, expected[i], index.Entries[i])
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package ipfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/ipfs/kubo/commands"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/corehttp"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/plugin/loader"
+	"github.com/ipfs/kubo/repo/fsrepo"
+)
+
+// Kubo's plugins register the datastores used by file system repositories. They are global to the process,
+// so they are loaded once and shared by every embedded node.
+var (
+	pluginsOnce sync.Once
+	pluginsErr  error
+)
+
+// embeddedNode is a Kubo node running in-process. Its RPC API is served on a loopback port,
+// so the client talks to it exactly like to an external daemon.
+type embeddedNode struct {
+	node    *core.IpfsNode
+	server  *http.Server
+	url     string
+	tempDir string
+}
+
+// startEmbeddedNode starts a Kubo node using the repository at repoPath, initialising it if needed.
+// A temporary repository, removed on close, is used when repoPath is empty.
+// The node stays offline, without connecting to any peer, unless online is set.
+func startEmbeddedNode(ctx context.Context, repoPath string, online bool) (*embeddedNode, error) {
+	pluginsOnce.Do(func() {
+		pluginsErr = loadPlugins()
+	})
+	if pluginsErr != nil {
+		return nil, fmt.Errorf("failed to load IPFS plugins: %w", pluginsErr)
+	}
+
+	embedded := &embeddedNode{}
+	if repoPath == "" {
+		tempDir, err := os.MkdirTemp("", "ipfs-embedded-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary IPFS repository: %w", err)
+		}
+		embedded.tempDir = tempDir
+		repoPath = tempDir
+	}
+
+	node, err := newEmbeddedKuboNode(ctx, repoPath, online)
+	if err != nil {
+		embedded.removeTempDir()
+		return nil, err
+	}
+	embedded.node = node
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		embedded.close()
+		return nil, fmt.Errorf("failed to listen for the embedded IPFS RPC API: %w", err)
+	}
+
+	cmdContext := commands.Context{
+		ConfigRoot: repoPath,
+		ReqLog:     &commands.ReqLog{},
+		ConstructNode: func() (*core.IpfsNode, error) {
+			return node, nil
+		},
+	}
+	handler, err := corehttp.MakeHandler(node, listener, corehttp.CommandsOption(cmdContext))
+	if err != nil {
+		listener.Close()
+		embedded.close()
+		return nil, fmt.Errorf("failed to create the embedded IPFS RPC API: %w", err)
+	}
+
+	embedded.server = &http.Server{Handler: handler}
+	embedded.url = "http://" + listener.Addr().String()
+	go func() {
+		_ = embedded.server.Serve(listener)
+	}()
+
+	return embedded, nil
+}
+
+// newEmbeddedKuboNode opens the repository at repoPath, initialising it with an Ed25519 identity if needed,
+// and builds a node on it.
+func newEmbeddedKuboNode(ctx context.Context, repoPath string, online bool) (*core.IpfsNode, error) {
+	if !fsrepo.IsInitialized(repoPath) {
+		identity, err := config.CreateIdentity(io.Discard, []options.KeyGenerateOption{options.Key.Type(options.Ed25519Key)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IPFS identity: %w", err)
+		}
+
+		cfg, err := config.InitWithIdentity(identity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IPFS config: %w", err)
+		}
+
+		// The embedded node serves its RPC API itself and must not take the ports of a local daemon.
+		cfg.Addresses.API = nil
+		cfg.Addresses.Gateway = nil
+		cfg.Addresses.Swarm = []string{"/ip4/0.0.0.0/tcp/0", "/ip4/0.0.0.0/udp/0/quic-v1"}
+
+		if err := fsrepo.Init(repoPath, cfg); err != nil {
+			return nil, fmt.Errorf("failed to initialise IPFS repository: %w", err)
+		}
+	}
+
+	repo, err := fsrepo.Open(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IPFS repository: %w", err)
+	}
+
+	node, err := core.NewNode(ctx, &core.BuildCfg{
+		Online:    online,
+		Permanent: true,
+		Repo:      repo,
+	})
+	if err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("failed to start embedded IPFS node: %w", err)
+	}
+
+	return node, nil
+}
+
+// close stops the RPC API and the node and removes the temporary repository, if one was created.
+func (e *embeddedNode) close() error {
+	var errs []error
+
+	if e.server != nil {
+		errs = append(errs, e.server.Close())
+	}
+	if e.node != nil {
+		errs = append(errs, e.node.Close())
+	}
+	e.removeTempDir()
+
+	return errors.Join(errs...)
+}
+
+func (e *embeddedNode) removeTempDir() {
+	if e.tempDir != "" {
+		_ = os.RemoveAll(e.tempDir)
+	}
+}
+
+// loadPlugins loads Kubo's built-in plugins.
+func loadPlugins() error {
+	plugins, err := loader.NewPluginLoader("")
+	if err != nil {
+		return err
+	}
+	if err := plugins.Initialize(); err != nil {
+		return err
+	}
+
+	return plugins.Inject()
+}
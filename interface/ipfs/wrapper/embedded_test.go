@@ -0,0 +1,68 @@
+package ipfs_client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// newEmbeddedTestClient creates a client running an offline embedded node with a temporary repository.
+// Further settings of the ipfs section can be passed as indented YAML lines.
+func newEmbeddedTestClient(t *testing.T, settings string) *IpfsClient {
+	configPath := filepath.Join(t.TempDir(), "embedded.yaml")
+	config := "ipfs:\n  check_on_start: true\n  embedded:\n    enabled: true\n" + settings
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	client, err := NewIpfsClient(configPath)
+	if err != nil {
+		t.Fatalf("Failed to start embedded IPFS node: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return client
+}
+
+func TestEmbeddedNode(t *testing.T) {
+	client := newEmbeddedTestClient(t, "")
+	repoPath := client.embedded.tempDir
+
+	ctx := context.Background()
+	model := &pb.WeightModel{Values: []int64{1, 2, 3}}
+
+	cid, err := client.AddAndPinFile(ctx, model)
+	if err != nil {
+		t.Fatalf("Failed to add model to the embedded node: %v", err)
+	}
+
+	var retrieved pb.WeightModel
+	if err := client.GetFile(ctx, cid, &retrieved); err != nil {
+		t.Fatalf("Failed to get model from the embedded node: %v", err)
+	}
+	if len(retrieved.Values) != 3 || retrieved.Values[2] != 3 {
+		t.Fatalf("Retrieved model does not match the added model: %v", retrieved.Values)
+	}
+
+	// The embedded node uses Kubo's defaults, so it agrees with the in-memory storage.
+	storage, err := NewMemoryStorage(AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create memory storage: %v", err)
+	}
+	memoryCid, err := storage.AddFile(ctx, model)
+	if err != nil || memoryCid != cid {
+		t.Fatalf("Expected the embedded node and the memory storage to agree, got %s and %s (%v)", cid, memoryCid, err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Failed to close the embedded node: %v", err)
+	}
+	if _, err := os.Stat(repoPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected the temporary repository %s to be removed", repoPath)
+	}
+}
@@ -0,0 +1,74 @@
+package ipfs_client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/config"
+)
+
+// DefaultMaxFileSize is the largest file retrieved unless another limit is configured, 2 GiB.
+const DefaultMaxFileSize = 2 << 30
+
+// GetOptions holds the settings used when retrieving a file from IPFS.
+// Fields left zero fall back to the client's configured defaults, and a negative limit disables it.
+// Progress - if set, called with the progress of the download.
+// MaxSize - the largest file in bytes that is retrieved, checked before the download and enforced while reading.
+// MaxDuration - the longest a retrieval may take, retries included.
+type GetOptions struct {
+	Progress    ProgressFunc
+	MaxSize     int64
+	MaxDuration time.Duration
+}
+
+// FileTooLargeError is returned when a file exceeds the maximum size of a retrieval.
+// Size is the size announced by the node, or -1 if the file turned out larger than announced while reading.
+type FileTooLargeError struct {
+	Cid     string
+	Size    int64
+	MaxSize int64
+}
+
+func (e *FileTooLargeError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("file %s is larger than the maximum size of %d bytes", e.Cid, e.MaxSize)
+	}
+
+	return fmt.Sprintf("file %s has %d bytes, more than the maximum size of %d bytes", e.Cid, e.Size, e.MaxSize)
+}
+
+// getOptionsFromConfig builds the default retrieval settings of a client from its configuration.
+func getOptionsFromConfig(cfg *ipfs_config.IpfsConfig) GetOptions {
+	opts := GetOptions{MaxSize: DefaultMaxFileSize}
+
+	retrievalCfg := cfg.Ipfs.Retrieval
+	if retrievalCfg.MaxSize != 0 {
+		opts.MaxSize = retrievalCfg.MaxSize
+	}
+	if retrievalCfg.MaxDuration != 0 {
+		opts.MaxDuration = retrievalCfg.MaxDuration
+	}
+
+	return opts
+}
+
+// withDefaults fills the fields left zero with the given defaults.
+func (o GetOptions) withDefaults(defaults GetOptions) GetOptions {
+	if o.MaxSize == 0 {
+		o.MaxSize = defaults.MaxSize
+	}
+	if o.MaxDuration == 0 {
+		o.MaxDuration = defaults.MaxDuration
+	}
+
+	return o
+}
+
+// checkSize returns a FileTooLargeError if a file of the given size exceeds the maximum size.
+func (o GetOptions) checkSize(cid string, size int64) error {
+	if o.MaxSize > 0 && size > o.MaxSize {
+		return &FileTooLargeError{Cid: cid, Size: size, MaxSize: o.MaxSize}
+	}
+
+	return nil
+}
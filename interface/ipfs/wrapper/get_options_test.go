@@ -0,0 +1,65 @@
+package ipfs_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetrievalLimits(t *testing.T) {
+	client := newEmbeddedTestClient(t, "  retrieval:\n    max_size: 1024\n")
+	ctx := context.Background()
+
+	if opts := client.GetOptions(); opts.MaxSize != 1024 || opts.MaxDuration != 0 {
+		t.Fatalf("Unexpected default retrieval settings: %+v", opts)
+	}
+
+	small, err := client.AddFileBytes(ctx, make([]byte, 1024))
+	if err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	large, err := client.AddFileBytes(ctx, make([]byte, 1025))
+	if err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+
+	if _, err := client.GetFileBytes(ctx, small); err != nil {
+		t.Fatalf("Expected a file of the maximum size to be retrieved: %v", err)
+	}
+
+	_, err = client.GetFileBytes(ctx, large)
+	var tooLarge *FileTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 1025 || tooLarge.MaxSize != 1024 {
+		t.Fatalf("Expected a FileTooLargeError for 1025 bytes, got %v", err)
+	}
+
+	// Options override the defaults, and a negative limit disables it.
+	if _, err := client.GetFileBytesWithOptions(ctx, large, GetOptions{MaxSize: -1}); err != nil {
+		t.Fatalf("Expected an unlimited retrieval to succeed: %v", err)
+	}
+	_, err = client.GetFileBytesWithOptions(ctx, small, GetOptions{MaxSize: 100})
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected a FileTooLargeError, got %v", err)
+	}
+
+	_, err = client.GetFileBytesWithOptions(ctx, small, GetOptions{MaxDuration: time.Nanosecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the retrieval to exceed its maximum duration, got %v", err)
+	}
+}
+
+func TestFileTooLargeWhileReading(t *testing.T) {
+	// A node announcing a wrong size is caught while reading.
+	_, err := readFile(bytes.NewReader(make([]byte, 4096)), 10, "/ipfs/cid", GetOptions{MaxSize: 1000})
+	var tooLarge *FileTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != -1 {
+		t.Fatalf("Expected a FileTooLargeError while reading, got %v", err)
+	}
+
+	data, err := readFile(bytes.NewReader(make([]byte, 1000)), 10, "/ipfs/cid", GetOptions{MaxSize: 1000})
+	if err != nil || len(data) != 1000 {
+		t.Fatalf("Expected a file of the maximum size to be read, got %d bytes (%v)", len(data), err)
+	}
+}
@@ -0,0 +1,76 @@
+package ipfs_client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// NodeHealth holds the state of the IPFS node reported by Ping.
+// PeerId - the peer id of the node.
+// AgentVersion - the agent version the node announces to its peers, e.g. "kubo/0.38.1/".
+// Version - the version of the node.
+// RepoSize - the size of the node's repository in bytes.
+// StorageMax - the configured maximum size of the repository in bytes.
+// Latency - the time it took the node to answer all health requests.
+type NodeHealth struct {
+	PeerId       string
+	AgentVersion string
+	Version      string
+	RepoSize     uint64
+	StorageMax   uint64
+	Latency      time.Duration
+}
+
+// Ping checks that the IPFS node is reachable and returns its id, version and repository statistics.
+// Like any other request, Ping goes through the circuit breaker: it fails with ErrCircuitOpen while the circuit
+// is open, and once the reset timeout has passed it may be the probe whose success closes the circuit again.
+func (c *IpfsClient) Ping(ctx context.Context) (*NodeHealth, error) {
+	start := time.Now()
+
+	var health *NodeHealth
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		health, err = c.ping(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	health.Latency = time.Since(start)
+	return health, nil
+}
+
+func (c *IpfsClient) ping(ctx context.Context) (*NodeHealth, error) {
+	var id struct {
+		ID           string
+		AgentVersion string
+	}
+	if err := c.NodeHttpApi.Request("id").Exec(ctx, &id); err != nil {
+		return nil, fmt.Errorf("failed to get IPFS node id: %w", err)
+	}
+
+	var version struct {
+		Version string
+	}
+	if err := c.NodeHttpApi.Request("version").Exec(ctx, &version); err != nil {
+		return nil, fmt.Errorf("failed to get IPFS node version: %w", err)
+	}
+
+	var repoStat struct {
+		RepoSize   uint64
+		StorageMax uint64
+	}
+	if err := c.NodeHttpApi.Request("repo/stat").Option("size-only", true).Exec(ctx, &repoStat); err != nil {
+		return nil, fmt.Errorf("failed to get IPFS repository statistics: %w", err)
+	}
+
+	return &NodeHealth{
+		PeerId:       id.ID,
+		AgentVersion: id.AgentVersion,
+		Version:      version.Version,
+		RepoSize:     repoStat.RepoSize,
+		StorageMax:   repoStat.StorageMax,
+	}, nil
+}
@@ -0,0 +1,176 @@
+package ipfs_client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipfs/kubo/client/rpc/auth"
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/config"
+)
+
+// newHttpClients creates the HTTP clients used for the RPC APIs, applying the configured dial timeout and TLS settings.
+// The first client additionally sends the configured credentials, server name and client certificate and is meant
+// for node_path only; the second one is used for the replica nodes, which belong to other organisations and must not
+// receive the local credentials.
+func newHttpClients(cfg *ipfs_config.IpfsConfig) (*http.Client, *http.Client, error) {
+	tlsConfig, err := newTlsConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid TLS settings: %w", err)
+	}
+
+	authorization, err := authorizationHeader(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid credentials: %w", err)
+	}
+
+	timeouts := cfg.Ipfs.Timeouts
+	replicaClient := newHttpClient(timeouts.Dial, replicaTlsConfig(tlsConfig))
+
+	nodeClient := newHttpClient(timeouts.Dial, tlsConfig)
+	if authorization != "" {
+		nodeClient.Transport = auth.NewAuthorizedRoundTripper(authorization, nodeClient.Transport)
+	}
+
+	return nodeClient, replicaClient, nil
+}
+
+// replicaTlsConfig returns the TLS settings for the replica nodes: only the CA bundle is kept, as the server name
+// is that of node_path and the client certificate must not be presented to other organisations' nodes.
+func replicaTlsConfig(tlsConfig *tls.Config) *tls.Config {
+	if tlsConfig == nil || tlsConfig.RootCAs == nil {
+		return nil
+	}
+
+	return &tls.Config{
+		MinVersion: tlsConfig.MinVersion,
+		RootCAs:    tlsConfig.RootCAs,
+	}
+}
+
+// newHttpClient creates an HTTP client applying the given dial timeout, or its default, and TLS settings.
+// Requests are not bounded by the client, see IpfsClient.call, so that large transfers are not cut off.
+func newHttpClient(dialTimeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	if dialTimeout == 0 {
+		dialTimeout = defaultDialTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if dialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// newTlsConfig loads the configured CA bundle and client certificate, nil if none are configured.
+func newTlsConfig(cfg *ipfs_config.IpfsConfig) (*tls.Config, error) {
+	tlsCfg := cfg.Ipfs.Tls
+	if tlsCfg.CaCertPath == "" && tlsCfg.ClientCertPath == "" && tlsCfg.ClientKeyPath == "" && tlsCfg.ServerName == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: tlsCfg.ServerName,
+	}
+
+	if tlsCfg.CaCertPath != "" {
+		caCert, err := os.ReadFile(tlsCfg.CaCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", tlsCfg.CaCertPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if tlsCfg.ClientCertPath != "" || tlsCfg.ClientKeyPath != "" {
+		if tlsCfg.ClientCertPath == "" || tlsCfg.ClientKeyPath == "" {
+			return nil, errors.New("client_cert_path and client_key_path must be set together")
+		}
+
+		clientCert, err := tls.LoadX509KeyPair(tlsCfg.ClientCertPath, tlsCfg.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return tlsConfig, nil
+}
+
+// authorizationHeader returns the value of the Authorization header for the configured credentials,
+// matching the "Basic" and "Bearer" entries of Kubo's API.Authorizations. It is empty if no credentials are configured.
+func authorizationHeader(cfg *ipfs_config.IpfsConfig) (string, error) {
+	authCfg := cfg.Ipfs.Auth
+
+	password, err := resolveSecret("password", authCfg.Password, authCfg.PasswordFile, authCfg.PasswordEnv)
+	if err != nil {
+		return "", err
+	}
+
+	bearerToken, err := resolveSecret("bearer_token", authCfg.BearerToken, authCfg.BearerTokenFile, authCfg.BearerTokenEnv)
+	if err != nil {
+		return "", err
+	}
+
+	basic := authCfg.Username != "" || password != ""
+	switch {
+	case basic && bearerToken != "":
+		return "", errors.New("basic and bearer authentication cannot be configured together")
+	case basic:
+		if authCfg.Username == "" {
+			return "", errors.New("a password is configured without a username")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(authCfg.Username+":"+password)), nil
+	case bearerToken != "":
+		return "Bearer " + bearerToken, nil
+	default:
+		return "", nil
+	}
+}
+
+// resolveSecret returns a secret given either directly, as the path of a file holding it, or as the name of
+// an environment variable holding it. At most one of the three may be set.
+func resolveSecret(name string, value string, file string, env string) (string, error) {
+	set := 0
+	for _, source := range []string{value, file, env} {
+		if source != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return "", fmt.Errorf("only one of %s, %s_file and %s_env may be set", name, name, name)
+	}
+
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_file: %w", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case env != "":
+		secret, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s for %s is not set", env, name)
+		}
+		return secret, nil
+	default:
+		return value, nil
+	}
+}
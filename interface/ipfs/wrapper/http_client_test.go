@@ -0,0 +1,149 @@
+package ipfs_client
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/config"
+)
+
+func TestAuthorizationHeader(t *testing.T) {
+	var cfg ipfs_config.IpfsConfig
+	cfg.Ipfs.Auth.Username = "fabric"
+	cfg.Ipfs.Auth.Password = "secret"
+
+	header, err := authorizationHeader(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to build basic authorization: %v", err)
+	}
+	if header != "Basic ZmFicmljOnNlY3JldA==" {
+		t.Fatalf("Unexpected basic authorization header: %s", header)
+	}
+
+	cfg.Ipfs.Auth.BearerToken = "token"
+	if _, err := authorizationHeader(&cfg); err == nil {
+		t.Fatalf("Expected basic and bearer authentication together to be rejected")
+	}
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	cfg = ipfs_config.IpfsConfig{}
+	cfg.Ipfs.Auth.BearerTokenFile = tokenFile
+	header, err = authorizationHeader(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to read bearer token from file: %v", err)
+	}
+	if header != "Bearer file-token" {
+		t.Fatalf("Unexpected bearer authorization header: %s", header)
+	}
+
+	cfg.Ipfs.Auth.BearerTokenEnv = "IPFS_TEST_TOKEN"
+	if _, err := authorizationHeader(&cfg); err == nil {
+		t.Fatalf("Expected a token given both as a file and an environment variable to be rejected")
+	}
+}
+
+func TestHttpClientsWithTlsAndBearerToken(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer env-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPem, 0o600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+	t.Setenv("IPFS_TEST_TOKEN", "env-token")
+
+	var cfg ipfs_config.IpfsConfig
+	cfg.Ipfs.Tls.CaCertPath = caFile
+	cfg.Ipfs.Auth.BearerTokenEnv = "IPFS_TEST_TOKEN"
+
+	nodeClient, replicaClient, err := newHttpClients(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP clients: %v", err)
+	}
+
+	resp, err := nodeClient.Post(server.URL+"/api/v0/id", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to reach the TLS server: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the node client to be authorized, got status %d", resp.StatusCode)
+	}
+
+	// The replica client trusts the same CA but must not send the local credentials.
+	resp, err = replicaClient.Post(server.URL+"/api/v0/id", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to reach the TLS server: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected the replica client to send no credentials, got status %d", resp.StatusCode)
+	}
+}
+
+func TestReplicaTlsConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+
+	// The certificate of the test server doubles as the client certificate.
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	key, err := x509.MarshalPKCS8PrivateKey(server.TLS.Certificates[0].PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal the key: %v", err)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	for name, data := range map[string][]byte{caFile: certPem, certFile: certPem, keyFile: keyPem} {
+		if err := os.WriteFile(name, data, 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	var cfg ipfs_config.IpfsConfig
+	cfg.Ipfs.Tls.CaCertPath = caFile
+	cfg.Ipfs.Tls.ClientCertPath = certFile
+	cfg.Ipfs.Tls.ClientKeyPath = keyFile
+	cfg.Ipfs.Tls.ServerName = "ipfs.org1.example.com"
+
+	nodeClient, replicaClient, err := newHttpClients(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to create HTTP clients: %v", err)
+	}
+
+	nodeTls := nodeClient.Transport.(*http.Transport).TLSClientConfig
+	if nodeTls.ServerName != "ipfs.org1.example.com" || len(nodeTls.Certificates) != 1 {
+		t.Fatalf("Expected the node client to use the server name and client certificate")
+	}
+
+	replicaTls := replicaClient.Transport.(*http.Transport).TLSClientConfig
+	if replicaTls.ServerName != "" || len(replicaTls.Certificates) != 0 || replicaTls.RootCAs == nil {
+		t.Fatalf("Expected the replica client to use the CA bundle only")
+	}
+
+	// The replica client verifies the replica against its own name.
+	resp, err := replicaClient.Post(server.URL+"/api/v0/id", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to reach the replica: %v", err)
+	}
+	resp.Body.Close()
+}
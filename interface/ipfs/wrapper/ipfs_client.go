@@ -6,19 +6,41 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/ipfs/boxo/files"
 	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/kubo/client/rpc"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	caopts "github.com/ipfs/kubo/core/coreiface/options"
 	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/config"
 	"google.golang.org/protobuf/proto"
 )
 
 // IpfsClient is a wrapper around the IPFS node HTTP API. It provides
 // convenient methods for interacting with the IPFS node.
+// RemotePinning is nil unless a remote pinning service is configured,
+// Replicas is empty unless replica nodes are configured, and Cache is nil
+// unless a cache directory is configured. With an embedded node, the client
+// must be closed to stop it.
 type IpfsClient struct {
-	httpClient  *http.Client
-	NodeHttpApi *rpc.HttpApi
+	httpClient        *http.Client
+	nodePath          string
+	NodeHttpApi       *rpc.HttpApi
+	RemotePinning     *RemotePinningService
+	Replicas          []*ReplicaNode
+	Cache             *DiskCache
+	replicationFactor int
+	writeQuorum       int
+	addOptions        AddOptions
+	getOptions        GetOptions
+	retryPolicy       RetryPolicy
+	requestTimeout    time.Duration
+	breaker           *circuitBreaker
+	embedded          *embeddedNode
+	mfsLayout         MfsLayout
+	ipnsSettings      IpnsSettings
 }
 
 // NewIpfsClient creates a new IpfsClient instance.
@@ -28,87 +50,274 @@ func NewIpfsClient(configPath string) (*IpfsClient, error) {
 		return nil, fmt.Errorf("error loading IPFS config: %w", err)
 	}
 
-	httpClient := &http.Client{}
+	addOptions, err := addOptionsFromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UnixFS import settings: %w", err)
+	}
+
+	mfsCfg := cfg.Ipfs.Mfs
+	mfsLayout, err := newMfsLayout(mfsCfg.Federation, mfsCfg.EpochPath, mfsCfg.ParticipantPath, mfsCfg.GlobalPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MFS layout: %w", err)
+	}
+
+	httpClient, replicaHttpClient, err := newHttpClients(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	nodeHttpApi, err := rpc.NewURLApiWithClient(cfg.Ipfs.NodePath, httpClient)
+	replicationCfg := cfg.Ipfs.Replication
+	replicas, replicationFactor, writeQuorum, err := newReplicaNodes(
+		replicationCfg.Nodes,
+		replicationCfg.ReplicationFactor,
+		replicationCfg.WriteQuorum,
+		func(nodePath string) (*rpc.HttpApi, error) {
+			return rpc.NewURLApiWithClient(nodePath, replicaHttpClient)
+		},
+	)
 	if err != nil {
+		return nil, fmt.Errorf("invalid replication settings: %w", err)
+	}
+
+	var remotePinning *RemotePinningService
+	if remoteCfg := cfg.Ipfs.RemotePinning; remoteCfg.Endpoint != "" {
+		remotePinning = NewRemotePinningService(remoteCfg.Endpoint, remoteCfg.Token, remoteCfg.PollInterval, remoteCfg.Timeout)
+	}
+
+	var cache *DiskCache
+	if cacheCfg := cfg.Ipfs.Cache; cacheCfg.Dir != "" {
+		cache, err = NewDiskCache(cacheCfg.Dir, cacheCfg.MaxBytes, addOptions)
+		if err != nil {
+			return nil, fmt.Errorf("error opening the IPFS cache: %w", err)
+		}
+	}
+
+	// The embedded node is started last, so that an invalid configuration does not leave it running.
+	nodePath := cfg.Ipfs.NodePath
+	var embedded *embeddedNode
+	if embeddedCfg := cfg.Ipfs.Embedded; embeddedCfg.Enabled {
+		embedded, err = startEmbeddedNode(context.Background(), embeddedCfg.RepoPath, embeddedCfg.Online)
+		if err != nil {
+			return nil, err
+		}
+		nodePath = embedded.url
+	}
+
+	nodeHttpApi, err := rpc.NewURLApiWithClient(nodePath, httpClient)
+	if err != nil {
+		if embedded != nil {
+			_ = embedded.close()
+		}
 		return nil, fmt.Errorf("error creating an IPFS Node HTTP API: %w", err)
 	}
 
-	return &IpfsClient{
-		httpClient:  httpClient,
-		NodeHttpApi: nodeHttpApi,
-	}, nil
+	retryCfg := cfg.Ipfs.Retry
+	breakerCfg := cfg.Ipfs.CircuitBreaker
+	ipnsCfg := cfg.Ipfs.Ipns
+
+	client := &IpfsClient{
+		httpClient:        httpClient,
+		nodePath:          nodePath,
+		NodeHttpApi:       nodeHttpApi,
+		RemotePinning:     remotePinning,
+		Replicas:          replicas,
+		Cache:             cache,
+		replicationFactor: replicationFactor,
+		writeQuorum:       writeQuorum,
+		addOptions:        addOptions,
+		getOptions:        getOptionsFromConfig(cfg),
+		retryPolicy:       newRetryPolicy(retryCfg.MaxAttempts, retryCfg.InitialBackoff, retryCfg.MaxBackoff),
+		requestTimeout:    cfg.Ipfs.Timeouts.Request,
+		breaker:           newCircuitBreaker(breakerCfg.FailureThreshold, breakerCfg.ResetTimeout),
+		embedded:          embedded,
+		mfsLayout:         mfsLayout,
+		ipnsSettings:      newIpnsSettings(ipnsCfg.KeyName, ipnsCfg.Ttl, ipnsCfg.Lifetime),
+	}
+
+	// The canonical preset cannot set the maximum number of links per file node, so every node must use the default.
+	if cfg.Ipfs.Unixfs.Preset == CanonicalPreset {
+		nodes := append([]*ReplicaNode{{NodePath: nodePath, Api: nodeHttpApi}}, replicas...)
+		for _, node := range nodes {
+			if err := checkMaxLinks(context.Background(), node.Api); err != nil {
+				_ = client.Close()
+				return nil, fmt.Errorf("IPFS node %s does not match the %s preset: %w", node.NodePath, CanonicalPreset, err)
+			}
+		}
+	}
+
+	if cfg.Ipfs.CheckOnStart {
+		if _, err := client.Ping(context.Background()); err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("IPFS node %s is not reachable: %w", nodePath, err)
+		}
+	}
+
+	return client, nil
 }
 
-// AddFile adds a protobuf message to IPFS and returns its CID.
-func (c *IpfsClient) AddFile(ctx context.Context, msg proto.Message) (string, error) {
-	data, err := proto.Marshal(msg)
+// Close stops the embedded IPFS node, if the client runs one, and removes its temporary repository.
+// It does nothing for a client connected to an external node.
+func (c *IpfsClient) Close() error {
+	if c.embedded == nil {
+		return nil
+	}
+
+	err := c.embedded.close()
+	c.embedded = nil
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal protobuf message: %w", err)
+		return fmt.Errorf("failed to stop embedded IPFS node: %w", err)
 	}
 
-	file := files.NewReaderFile(bytes.NewReader(data))
+	return nil
+}
+
+// AddOptions returns the UnixFS import settings used by AddFile and AddFileBytes.
+func (c *IpfsClient) AddOptions() AddOptions {
+	return c.addOptions
+}
 
-	cid, err := c.NodeHttpApi.Unixfs().Add(ctx, file)
+// GetOptions returns the default retrieval settings used by GetFile and GetFileBytes.
+func (c *IpfsClient) GetOptions() GetOptions {
+	return c.getOptions
+}
+
+// AddFile adds a protobuf message to IPFS and returns its CID.
+// The file is imported with the client's configured UnixFS settings.
+func (c *IpfsClient) AddFile(ctx context.Context, msg proto.Message) (string, error) {
+	return c.AddFileWithOptions(ctx, msg, c.addOptions)
+}
+
+// AddFileWithOptions adds a protobuf message to IPFS using the given UnixFS import settings and returns its CID.
+func (c *IpfsClient) AddFileWithOptions(ctx context.Context, msg proto.Message, opts AddOptions) (string, error) {
+	data, err := proto.Marshal(msg)
 	if err != nil {
-		return "", fmt.Errorf("failed to add file to IPFS: %w", err)
+		return "", fmt.Errorf("failed to marshal protobuf message: %w", err)
 	}
 
-	return cid.String(), nil
+	return c.AddFileBytesWithOptions(ctx, data, opts)
 }
 
 // AddFileBytes adds a byte array to IPFS and returns its CID.
+// The file is imported with the client's configured UnixFS settings.
 func (c *IpfsClient) AddFileBytes(ctx context.Context, byteArray []byte) (string, error) {
-	file := files.NewReaderFile(bytes.NewReader(byteArray))
+	return c.AddFileBytesWithOptions(ctx, byteArray, c.addOptions)
+}
 
-	cid, err := c.NodeHttpApi.Unixfs().Add(ctx, file)
+// AddFileBytesWithOptions adds a byte array to IPFS using the given UnixFS import settings and returns its CID.
+func (c *IpfsClient) AddFileBytesWithOptions(ctx context.Context, byteArray []byte, opts AddOptions) (string, error) {
+	unixfsOpts, err := opts.unixfsAddOptions()
+	if err != nil {
+		return "", fmt.Errorf("invalid UnixFS import settings: %w", err)
+	}
+
+	reporter := newProgressReporter(opts.Progress, int64(len(byteArray)))
+
+	var cid path.ImmutablePath
+	err = c.call(ctx, func(ctx context.Context) error {
+		file := files.NewReaderFile(bytes.NewReader(byteArray))
+		if reporter == nil {
+			cid, err = c.NodeHttpApi.Unixfs().Add(ctx, file, unixfsOpts...)
+			return err
+		}
+
+		// Kubo reports the number of bytes it has imported so far as add events.
+		events := make(chan interface{})
+		eventsDone := make(chan struct{})
+		go func() {
+			defer close(eventsDone)
+			for event := range events {
+				if addEvent, ok := event.(*iface.AddEvent); ok && addEvent.Bytes > 0 {
+					reporter.update(addEvent.Bytes, false)
+				}
+			}
+		}()
+
+		cid, err = c.NodeHttpApi.Unixfs().Add(ctx, file, append(unixfsOpts, caopts.Unixfs.Progress(true), caopts.Unixfs.Events(events))...)
+		close(events)
+		<-eventsDone
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to add file to IPFS: %w", err)
 	}
+	reporter.update(int64(len(byteArray)), true)
 
 	return cid.String(), nil
 }
 
 // GetFile retrieves a protobuf message from IPFS, unmarshals it and leaves the result in msg.
 func (c *IpfsClient) GetFile(ctx context.Context, cid string, msg proto.Message) error {
-	ipfsPath, err := path.NewPath(cid)
+	return c.GetFileWithOptions(ctx, cid, msg, GetOptions{})
+}
+
+// GetFileWithOptions retrieves a protobuf message from IPFS using the given settings, unmarshals it and leaves the result in msg.
+func (c *IpfsClient) GetFileWithOptions(ctx context.Context, cid string, msg proto.Message, opts GetOptions) error {
+	data, err := c.GetFileBytesWithOptions(ctx, cid, opts)
 	if err != nil {
-		return fmt.Errorf("invalid CID path: %w", err)
+		return err
 	}
 
-	node, err := c.NodeHttpApi.Unixfs().Get(ctx, ipfsPath)
-	if err != nil {
-		return fmt.Errorf("failed to get file from IPFS: %w", err)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("failed to unmarshal protobuf: %w", err)
 	}
 
-	file, ok := node.(files.File)
-	if !ok {
-		return fmt.Errorf("unexpected node type: %T", node)
+	return nil
+}
+
+// GetFileBytes retrieves the content of a file from IPFS, within the client's default size and duration limits.
+// If a cache is configured, the file is read from the cache when present and cached otherwise.
+// Retrieval is retried according to the client's retry policy.
+func (c *IpfsClient) GetFileBytes(ctx context.Context, cid string) ([]byte, error) {
+	return c.GetFileBytesWithOptions(ctx, cid, GetOptions{})
+}
+
+// GetFileBytesWithOptions retrieves the content of a file from IPFS using the given settings, like GetFileBytes.
+// A file exceeding the maximum size fails with a *FileTooLargeError, and a retrieval exceeding the maximum duration
+// fails with context.DeadlineExceeded.
+// A file read from the cache is reported as completed at once; a retried download reports its progress from the start.
+func (c *IpfsClient) GetFileBytesWithOptions(ctx context.Context, cid string, opts GetOptions) ([]byte, error) {
+	opts = opts.withDefaults(c.getOptions)
+
+	if data, ok := c.cachedFile(cid); ok {
+		if err := opts.checkSize(cid, int64(len(data))); err != nil {
+			return nil, err
+		}
+		newProgressReporter(opts.Progress, int64(len(data))).update(int64(len(data)), true)
+		return data, nil
 	}
 
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return fmt.Errorf("failed to read IPFS file: %w", err)
+	if opts.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.MaxDuration)
+		defer cancel()
 	}
 
-	if err := proto.Unmarshal(data, msg); err != nil {
-		return fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	var data []byte
+	err := c.retry(ctx, func(ctx context.Context) error {
+		var err error
+		data, err = getFileBytes(ctx, c.NodeHttpApi, cid, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	c.cacheFile(cid, data)
 
-	return nil
+	return data, nil
 }
 
 // PinFile pins a CID to the local IPFS node. Without pinning, the data related
 // to the CID will be stored in the IPFS but will get deleted by the garbage collector later on.
-// Pinning the CID will prevent this from happening.
+// Pinning the CID will prevent this from happening. Pinning is retried according to the client's retry policy.
 func (c *IpfsClient) PinFile(ctx context.Context, cid string) error {
 	ipfsPath, err := path.NewPath(cid)
 	if err != nil {
 		return fmt.Errorf("invalid CID path: %w", err)
 	}
 
-	err = c.NodeHttpApi.Pin().Add(ctx, ipfsPath)
+	err = c.retry(ctx, func(ctx context.Context) error {
+		return c.NodeHttpApi.Pin().Add(ctx, ipfsPath)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to pin CID: %w", err)
 	}
@@ -124,7 +333,9 @@ func (c *IpfsClient) UnpinFile(ctx context.Context, cid string) error {
 		return fmt.Errorf("invalid CID path: %w", err)
 	}
 
-	err = c.NodeHttpApi.Pin().Rm(ctx, ipfsPath)
+	err = c.call(ctx, func(ctx context.Context) error {
+		return c.NodeHttpApi.Pin().Rm(ctx, ipfsPath)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to unpin CID from IPFS node: %w", err)
 	}
@@ -132,6 +343,28 @@ func (c *IpfsClient) UnpinFile(ctx context.Context, cid string) error {
 	return nil
 }
 
+// ListPins returns the recursive pins of the local IPFS node as IPFS paths, in the same form as the CIDs returned by AddFile.
+func (c *IpfsClient) ListPins(ctx context.Context) ([]string, error) {
+	var cids []string
+	err := c.call(ctx, func(ctx context.Context) error {
+		pins := make(chan iface.Pin)
+		lsErr := make(chan error, 1)
+		go func() {
+			lsErr <- c.NodeHttpApi.Pin().Ls(ctx, pins, caopts.Pin.Ls.Recursive())
+		}()
+
+		for pin := range pins {
+			cids = append(cids, pin.Path().String())
+		}
+		return <-lsErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pins: %w", err)
+	}
+
+	return cids, nil
+}
+
 // AddAndPinFile adds a protobuf message to IPFS and pins it.
 func (c *IpfsClient) AddAndPinFile(ctx context.Context, msg proto.Message) (string, error) {
 	cid, err := c.AddFile(ctx, msg)
@@ -161,3 +394,98 @@ func (c *IpfsClient) AddAndPinFileBytes(ctx context.Context, byteArray []byte) (
 
 	return cid, nil
 }
+
+// parseCid parses a CID given either as an IPFS path, as returned by AddFile, or as a bare CID.
+func parseCid(cidStr string) (cid.Cid, error) {
+	if c, err := cid.Decode(cidStr); err == nil {
+		return c, nil
+	}
+
+	ipfsPath, err := path.NewPath(cidStr)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid CID path: %w", err)
+	}
+
+	immutablePath, err := path.NewImmutablePath(ipfsPath)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid CID path: %w", err)
+	}
+
+	return immutablePath.RootCid(), nil
+}
+
+// cachedFile returns the content of a CID from the cache, if a cache is configured and holds it.
+func (c *IpfsClient) cachedFile(cid string) ([]byte, bool) {
+	if c.Cache == nil {
+		return nil, false
+	}
+
+	return c.Cache.Get(cid)
+}
+
+// cacheFile stores the content of a CID in the cache, if one is configured. The cache is only
+// an optimisation, so failing to write to it, e.g. for content not matching its CID, does not fail the retrieval.
+func (c *IpfsClient) cacheFile(cid string, data []byte) {
+	if c.Cache == nil {
+		return
+	}
+
+	_ = c.Cache.Put(cid, data)
+}
+
+// getFileBytes retrieves the content of a file from the IPFS node behind the given API, within the maximum size
+// of the settings and reporting the progress of the download if requested.
+func getFileBytes(ctx context.Context, api *rpc.HttpApi, cid string, opts GetOptions) ([]byte, error) {
+	ipfsPath, err := path.NewPath(cid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID path: %w", err)
+	}
+
+	node, err := api.Unixfs().Get(ctx, ipfsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from IPFS: %w", err)
+	}
+	defer node.Close()
+
+	file, ok := node.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("unexpected node type: %T", node)
+	}
+
+	// The size is announced by the node from the file's metadata before anything is downloaded. A node that
+	// cannot tell it leaves the total unknown; the limit is enforced while reading anyway.
+	size, err := file.Size()
+	if err != nil {
+		size = 0
+	}
+
+	return readFile(file, size, cid, opts)
+}
+
+// readFile reads a file of the announced size within the maximum size of the settings,
+// reporting the progress of the download if requested.
+func readFile(file io.Reader, size int64, cid string, opts GetOptions) ([]byte, error) {
+	if err := opts.checkSize(cid, size); err != nil {
+		return nil, err
+	}
+
+	reader := file
+	if opts.MaxSize > 0 {
+		reader = io.LimitReader(reader, opts.MaxSize+1)
+	}
+	reporter := newProgressReporter(opts.Progress, size)
+	if reporter != nil {
+		reader = &progressReader{reader: reader, reporter: reporter}
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IPFS file: %w", err)
+	}
+	if opts.MaxSize > 0 && int64(len(data)) > opts.MaxSize {
+		return nil, &FileTooLargeError{Cid: cid, Size: -1, MaxSize: opts.MaxSize}
+	}
+	reporter.update(int64(len(data)), true)
+
+	return data, nil
+}
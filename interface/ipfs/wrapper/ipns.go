@@ -0,0 +1,238 @@
+package ipfs_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	caopts "github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// Defaults of the IPNS settings, see IpnsSettings.
+const (
+	defaultIpnsKeyName  = "global-model"
+	defaultIpnsTtl      = time.Minute
+	defaultIpnsLifetime = 48 * time.Hour
+)
+
+// IpnsSettings holds how the newest global model is published under IPNS.
+// KeyName - the name of the node's key the global model is published under.
+// Ttl - how long resolvers may cache the record, short so that new epochs are picked up quickly.
+// Lifetime - how long the record stays valid without being republished.
+type IpnsSettings struct {
+	KeyName  string
+	Ttl      time.Duration
+	Lifetime time.Duration
+}
+
+// newIpnsSettings fills in the defaults of IPNS settings read from the config.
+func newIpnsSettings(keyName string, ttl time.Duration, lifetime time.Duration) IpnsSettings {
+	settings := IpnsSettings{KeyName: defaultIpnsKeyName, Ttl: defaultIpnsTtl, Lifetime: defaultIpnsLifetime}
+	if keyName != "" {
+		settings.KeyName = keyName
+	}
+	if ttl > 0 {
+		settings.Ttl = ttl
+	}
+	if lifetime > 0 {
+		settings.Lifetime = lifetime
+	}
+
+	return settings
+}
+
+// PublishedGlobalModel holds a global model published under IPNS.
+// IpnsName - the IPNS name the model is published under, e.g. "/ipns/k51...".
+// Cid - the published CID, as recorded on the ledger.
+// Epoch - the epoch of the ledger record.
+// AggregatorId - the aggregator of the ledger record.
+type PublishedGlobalModel struct {
+	IpnsName     string
+	Cid          string
+	Epoch        int
+	AggregatorId int
+}
+
+// IpnsSettings returns the settings used to publish the newest global model.
+func (c *IpfsClient) IpnsSettings() IpnsSettings {
+	return c.ipnsSettings
+}
+
+// GenerateIpnsKey creates a new Ed25519 key on the node and returns its IPNS name.
+func (c *IpfsClient) GenerateIpnsKey(ctx context.Context, keyName string) (string, error) {
+	key, err := c.NodeHttpApi.Key().Generate(ctx, keyName, caopts.Key.Type(caopts.Ed25519Key))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate IPNS key: %w", err)
+	}
+
+	return key.Path().String(), nil
+}
+
+// ImportIpnsKey imports a private key, exported with "ipfs key export", into the node under the given name
+// and returns its IPNS name. This lets several aggregators publish under the same well-known name.
+func (c *IpfsClient) ImportIpnsKey(ctx context.Context, keyName string, privateKey []byte) (string, error) {
+	var out struct {
+		Name string
+		Id   string
+	}
+	err := c.NodeHttpApi.Request("key/import", keyName).
+		FileBody(bytes.NewReader(privateKey)).
+		Exec(ctx, &out)
+	if err != nil {
+		return "", fmt.Errorf("failed to import IPNS key: %w", err)
+	}
+
+	name, err := ipns.NameFromString(out.Id)
+	if err != nil {
+		return "", fmt.Errorf("invalid IPNS name of imported key: %w", err)
+	}
+
+	return name.AsPath().String(), nil
+}
+
+// PublishIpns publishes a CID under the IPNS name of the given key, with the given cache TTL and record lifetime.
+// Publishing also works on an offline node. The IPNS name is returned.
+func (c *IpfsClient) PublishIpns(ctx context.Context, keyName string, cid string, ttl time.Duration, lifetime time.Duration) (string, error) {
+	ipfsPath, err := path.NewPath(cid)
+	if err != nil {
+		return "", fmt.Errorf("invalid CID path: %w", err)
+	}
+
+	name, err := c.NodeHttpApi.Name().Publish(ctx, ipfsPath,
+		caopts.Name.Key(keyName),
+		caopts.Name.TTL(ttl),
+		caopts.Name.ValidTime(lifetime),
+		caopts.Name.AllowOffline(true),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish IPNS record: %w", err)
+	}
+
+	return name.AsPath().String(), nil
+}
+
+// ResolveIpns resolves an IPNS name to the path it currently points to, bypassing the node's cache.
+func (c *IpfsClient) ResolveIpns(ctx context.Context, ipnsName string) (string, error) {
+	resolved, err := c.NodeHttpApi.Name().Resolve(ctx, ipnsName, caopts.Name.Cache(false))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve IPNS name: %w", err)
+	}
+
+	return resolved.String(), nil
+}
+
+// PublishLatestGlobalModel publishes the CID of the newest global model on the ledger under the configured IPNS key,
+// creating the key if it does not exist yet. It is meant to be called by an aggregator after each aggregation.
+// The name is resolved again after publishing and checked against the ledger record.
+func (c *IpfsClient) PublishLatestGlobalModel(ctx context.Context, aggregatorMetadata []shared.AggregatorModelMetadata) (*PublishedGlobalModel, error) {
+	latest, err := LatestAggregatorModelMetadata(aggregatorMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.ensureIpnsKey(ctx, c.ipnsSettings.KeyName); err != nil {
+		return nil, err
+	}
+
+	ipnsName, err := c.PublishIpns(ctx, c.ipnsSettings.KeyName, latest.ModelHashCid, c.ipnsSettings.Ttl, c.ipnsSettings.Lifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	published := &PublishedGlobalModel{IpnsName: ipnsName, Cid: latest.ModelHashCid, Epoch: latest.Epoch, AggregatorId: latest.AggregatorId}
+	if err := c.verifyIpns(ctx, ipnsName, *latest); err != nil {
+		return published, err
+	}
+
+	return published, nil
+}
+
+// ResolveLatestGlobalModel resolves the IPNS name of the newest global model and checks it against the newest
+// global model on the ledger, so that a new participant can bootstrap from it. An error is returned if the
+// name points to another model than the ledger record, e.g. because a newer epoch has not been published yet.
+func (c *IpfsClient) ResolveLatestGlobalModel(ctx context.Context, ipnsName string, aggregatorMetadata []shared.AggregatorModelMetadata) (*PublishedGlobalModel, error) {
+	latest, err := LatestAggregatorModelMetadata(aggregatorMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.verifyIpns(ctx, ipnsName, *latest); err != nil {
+		return nil, err
+	}
+
+	return &PublishedGlobalModel{IpnsName: ipnsName, Cid: latest.ModelHashCid, Epoch: latest.Epoch, AggregatorId: latest.AggregatorId}, nil
+}
+
+// LatestAggregatorModelMetadata returns the record of the highest epoch. If several aggregators recorded a model
+// for that epoch, they must agree on its CID; the record of the lowest aggregator id is returned.
+func LatestAggregatorModelMetadata(aggregatorMetadata []shared.AggregatorModelMetadata) (*shared.AggregatorModelMetadata, error) {
+	if len(aggregatorMetadata) == 0 {
+		return nil, errors.New("no aggregator model metadata on the ledger")
+	}
+
+	latest := aggregatorMetadata[0]
+	for _, metadata := range aggregatorMetadata[1:] {
+		if metadata.Epoch > latest.Epoch || (metadata.Epoch == latest.Epoch && metadata.AggregatorId < latest.AggregatorId) {
+			latest = metadata
+		}
+	}
+
+	for _, metadata := range aggregatorMetadata {
+		if metadata.Epoch == latest.Epoch && !sameCid(metadata.ModelHashCid, latest.ModelHashCid) {
+			return nil, fmt.Errorf("aggregators %d and %d recorded different global models for epoch %d", latest.AggregatorId, metadata.AggregatorId, latest.Epoch)
+		}
+	}
+
+	return &latest, nil
+}
+
+// verifyIpns checks that an IPNS name resolves to the CID of the given ledger record.
+func (c *IpfsClient) verifyIpns(ctx context.Context, ipnsName string, record shared.AggregatorModelMetadata) error {
+	resolved, err := c.ResolveIpns(ctx, ipnsName)
+	if err != nil {
+		return err
+	}
+
+	if !sameCid(resolved, record.ModelHashCid) {
+		return fmt.Errorf("IPNS name %s resolves to %s, but the global model of epoch %d on the ledger is %s", ipnsName, resolved, record.Epoch, record.ModelHashCid)
+	}
+
+	return nil
+}
+
+// ensureIpnsKey generates the key with the given name unless the node already holds it.
+func (c *IpfsClient) ensureIpnsKey(ctx context.Context, keyName string) error {
+	keys, err := c.NodeHttpApi.Key().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list IPNS keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if key.Name() == keyName {
+			return nil
+		}
+	}
+
+	_, err = c.GenerateIpnsKey(ctx, keyName)
+	return err
+}
+
+// sameCid reports whether two CIDs, given as IPFS paths or bare CIDs, address the same content in any CID version.
+func sameCid(a string, b string) bool {
+	aCid, err := parseCid(a)
+	if err != nil {
+		return false
+	}
+	bCid, err := parseCid(b)
+	if err != nil {
+		return false
+	}
+
+	return cid.NewCidV1(aCid.Type(), aCid.Hash()).Equals(cid.NewCidV1(bCid.Type(), bCid.Hash()))
+}
@@ -0,0 +1,85 @@
+package ipfs_client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+func TestPublishLatestGlobalModel(t *testing.T) {
+	client := newEmbeddedTestClient(t, "  ipns:\n    key_name: test-global-model\n    ttl: 30s\n")
+	ctx := context.Background()
+
+	settings := client.IpnsSettings()
+	if settings.KeyName != "test-global-model" || settings.Ttl != 30*time.Second || settings.Lifetime != defaultIpnsLifetime {
+		t.Fatalf("Unexpected IPNS settings: %+v", settings)
+	}
+
+	var records []shared.AggregatorModelMetadata
+	for epoch := 1; epoch <= 2; epoch++ {
+		cid, err := client.AddAndPinFile(ctx, &pb.WeightModel{Values: []int64{int64(epoch)}})
+		if err != nil {
+			t.Fatalf("Failed to add global model: %v", err)
+		}
+		records = append(records, shared.AggregatorModelMetadata{AggregatorId: 1, Epoch: epoch, ModelHashCid: cid})
+
+		published, err := client.PublishLatestGlobalModel(ctx, records)
+		if err != nil {
+			t.Fatalf("Failed to publish global model of epoch %d: %v", epoch, err)
+		}
+		if published.Epoch != epoch || published.Cid != cid {
+			t.Fatalf("Expected epoch %d with %s to be published, got %+v", epoch, cid, published)
+		}
+
+		resolved, err := client.ResolveLatestGlobalModel(ctx, published.IpnsName, records)
+		if err != nil {
+			t.Fatalf("Failed to resolve global model of epoch %d: %v", epoch, err)
+		}
+		if resolved.Cid != cid {
+			t.Fatalf("Expected %s to resolve to %s, got %s", published.IpnsName, cid, resolved.Cid)
+		}
+	}
+
+	// A newer ledger record which has not been published yet must be reported.
+	cid, err := client.AddFile(ctx, &pb.WeightModel{Values: []int64{3}})
+	if err != nil {
+		t.Fatalf("Failed to add global model: %v", err)
+	}
+	ipnsName, err := client.PublishIpns(ctx, "test-global-model", records[1].ModelHashCid, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to publish global model: %v", err)
+	}
+	records = append(records, shared.AggregatorModelMetadata{AggregatorId: 1, Epoch: 3, ModelHashCid: cid})
+	if _, err := client.ResolveLatestGlobalModel(ctx, ipnsName, records); err == nil {
+		t.Fatalf("Expected resolving a stale IPNS record to fail")
+	}
+}
+
+func TestLatestAggregatorModelMetadata(t *testing.T) {
+	records := []shared.AggregatorModelMetadata{
+		{AggregatorId: 2, Epoch: 4, ModelHashCid: "/ipfs/QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+		{AggregatorId: 1, Epoch: 3, ModelHashCid: "/ipfs/bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"},
+		{AggregatorId: 1, Epoch: 4, ModelHashCid: "/ipfs/bafybeicg2rebjoofv4kbyovkw7af3rpiitvnl6i7ckcywaq6xjcxnc2mby"},
+	}
+
+	// Aggregator 1 recorded the CIDv1 of the same model as aggregator 2.
+	latest, err := LatestAggregatorModelMetadata(records)
+	if err != nil {
+		t.Fatalf("Failed to find the latest global model: %v", err)
+	}
+	if latest.Epoch != 4 || latest.AggregatorId != 1 {
+		t.Fatalf("Expected the record of aggregator 1 in epoch 4, got %+v", latest)
+	}
+
+	records[2].ModelHashCid = records[1].ModelHashCid
+	if _, err := LatestAggregatorModelMetadata(records); err == nil {
+		t.Fatalf("Expected conflicting global models in one epoch to be reported")
+	}
+
+	if _, err := LatestAggregatorModelMetadata(nil); err == nil {
+		t.Fatalf("Expected an error without any records")
+	}
+}
@@ -0,0 +1,288 @@
+package ipfs_client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	unixfile "github.com/ipfs/boxo/ipld/unixfs/file"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-cidutil"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipld "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/proto"
+)
+
+// Defaults of a Kubo node without Import configuration, applied by MemoryStorage to unset AddOptions fields.
+const (
+	defaultChunker     = "size-262144"
+	defaultInlineLimit = 32
+)
+
+// MemoryStorage is an in-memory Storage that needs no IPFS daemon. Files are imported with boxo's
+// UnixFS importer using the same defaults as Kubo (CIDv0, sha2-256, 256 KiB chunks, balanced layout
+// with 174 links per node), so identical content gets the same CID as on a default Kubo node.
+// Content is never garbage collected, pins only decide what ListPins returns.
+type MemoryStorage struct {
+	dag        ipld.DAGService
+	addOptions AddOptions
+
+	mu   sync.Mutex
+	pins map[string]cid.Cid
+}
+
+// NewMemoryStorage creates an empty in-memory storage that adds files with the given UnixFS import settings.
+// Fields left empty follow the defaults of a Kubo node.
+func NewMemoryStorage(addOptions AddOptions) (*MemoryStorage, error) {
+	if _, err := addOptions.unixfsAddOptions(); err != nil {
+		return nil, fmt.Errorf("invalid UnixFS import settings: %w", err)
+	}
+
+	blocks := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	return &MemoryStorage{
+		dag:        merkledag.NewDAGService(blockservice.New(blocks, offline.Exchange(blocks))),
+		addOptions: addOptions,
+		pins:       map[string]cid.Cid{},
+	}, nil
+}
+
+// AddOptions returns the UnixFS import settings used by AddFile and AddFileBytes.
+func (s *MemoryStorage) AddOptions() AddOptions {
+	return s.addOptions
+}
+
+// AddFile adds a protobuf message to the storage and returns its CID.
+func (s *MemoryStorage) AddFile(ctx context.Context, msg proto.Message) (string, error) {
+	return s.AddFileWithOptions(ctx, msg, s.addOptions)
+}
+
+// AddFileWithOptions adds a protobuf message to the storage using the given UnixFS import settings and returns its CID.
+func (s *MemoryStorage) AddFileWithOptions(ctx context.Context, msg proto.Message, opts AddOptions) (string, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal protobuf message: %w", err)
+	}
+
+	return s.AddFileBytesWithOptions(ctx, data, opts)
+}
+
+// AddFileBytes adds a byte array to the storage and returns its CID.
+func (s *MemoryStorage) AddFileBytes(ctx context.Context, byteArray []byte) (string, error) {
+	return s.AddFileBytesWithOptions(ctx, byteArray, s.addOptions)
+}
+
+// AddFileBytesWithOptions adds a byte array to the storage using the given UnixFS import settings and returns its CID.
+func (s *MemoryStorage) AddFileBytesWithOptions(ctx context.Context, byteArray []byte, opts AddOptions) (string, error) {
+	reporter := newProgressReporter(opts.Progress, int64(len(byteArray)))
+	root, err := opts.importFile(s.dag, &progressReader{reader: bytes.NewReader(byteArray), reporter: reporter})
+	if err != nil {
+		return "", fmt.Errorf("failed to add file to storage: %w", err)
+	}
+	reporter.update(int64(len(byteArray)), true)
+
+	return path.FromCid(root.Cid()).String(), nil
+}
+
+// GetFile retrieves a protobuf message from the storage, unmarshals it and leaves the result in msg.
+func (s *MemoryStorage) GetFile(ctx context.Context, cid string, msg proto.Message) error {
+	data, err := s.GetFileBytes(ctx, cid)
+	if err != nil {
+		return err
+	}
+
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+
+	return nil
+}
+
+// GetFileBytes retrieves the content of a file from the storage.
+func (s *MemoryStorage) GetFileBytes(ctx context.Context, cid string) ([]byte, error) {
+	root, err := parseCid(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := s.dag.Get(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from storage: %w", err)
+	}
+
+	unixfsNode, err := unixfile.NewUnixfsFile(ctx, s.dag, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from storage: %w", err)
+	}
+	defer unixfsNode.Close()
+
+	file, ok := unixfsNode.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("unexpected node type: %T", unixfsNode)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return data, nil
+}
+
+// PinFile pins a CID. Like on an offline Kubo node, the whole DAG of the CID must be present.
+func (s *MemoryStorage) PinFile(ctx context.Context, cid string) error {
+	root, err := parseCid(cid)
+	if err != nil {
+		return err
+	}
+
+	if err := merkledag.FetchGraph(ctx, root, s.dag); err != nil {
+		return fmt.Errorf("failed to pin CID: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pins[root.KeyString()] = root
+
+	return nil
+}
+
+// UnpinFile removes the pin of a CID.
+func (s *MemoryStorage) UnpinFile(ctx context.Context, cid string) error {
+	root, err := parseCid(cid)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pins[root.KeyString()]; !ok {
+		return fmt.Errorf("failed to unpin CID from storage: %s is not pinned", cid)
+	}
+	delete(s.pins, root.KeyString())
+
+	return nil
+}
+
+// ListPins returns the pinned CIDs as IPFS paths, sorted.
+func (s *MemoryStorage) ListPins(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cids := make([]string, 0, len(s.pins))
+	for _, root := range s.pins {
+		cids = append(cids, path.FromCid(root).String())
+	}
+	sort.Strings(cids)
+
+	return cids, nil
+}
+
+// AddAndPinFile adds a protobuf message to the storage and pins it.
+func (s *MemoryStorage) AddAndPinFile(ctx context.Context, msg proto.Message) (string, error) {
+	cid, err := s.AddFile(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+
+	return cid, s.PinFile(ctx, cid)
+}
+
+// AddAndPinFileBytes adds a byte array to the storage and pins it.
+func (s *MemoryStorage) AddAndPinFileBytes(ctx context.Context, byteArray []byte) (string, error) {
+	cid, err := s.AddFileBytes(ctx, byteArray)
+	if err != nil {
+		return "", err
+	}
+
+	return cid, s.PinFile(ctx, cid)
+}
+
+// importFile chunks the content of a reader into a balanced UnixFS DAG, adds its nodes to the DAG service and returns its root.
+func (o AddOptions) importFile(dag ipld.DAGService, reader io.Reader) (ipld.Node, error) {
+	params, chunkerSpec, err := o.dagBuilderParams(dag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UnixFS import settings: %w", err)
+	}
+
+	splitter, err := chunker.FromString(reader, chunkerSpec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UnixFS import settings: %w", err)
+	}
+
+	builder, err := params.New(splitter)
+	if err != nil {
+		return nil, err
+	}
+
+	return balanced.Layout(builder)
+}
+
+// dagBuilderParams converts the settings into the parameters of boxo's UnixFS importer, applying Kubo's
+// defaults to unset fields: like Kubo, a hash function other than sha2-256 implies CIDv1, and CIDv1
+// implies raw leaves. The chunker specification is returned next to the parameters.
+func (o AddOptions) dagBuilderParams(dag ipld.DAGService) (helpers.DagBuilderParams, string, error) {
+	if _, err := o.unixfsAddOptions(); err != nil {
+		return helpers.DagBuilderParams{}, "", err
+	}
+
+	hashCode := uint64(mh.SHA2_256)
+	if o.HashFunction != "" {
+		hashCode = mh.Names[o.HashFunction]
+	}
+
+	cidVersion := 0
+	if o.CidVersion != nil {
+		cidVersion = *o.CidVersion
+	} else if hashCode != mh.SHA2_256 {
+		cidVersion = 1
+	}
+
+	rawLeaves := cidVersion == 1
+	if o.RawLeaves != nil {
+		rawLeaves = *o.RawLeaves
+	}
+
+	prefix, err := merkledag.PrefixForCidVersion(cidVersion)
+	if err != nil {
+		return helpers.DagBuilderParams{}, "", err
+	}
+	prefix.MhType = hashCode
+	prefix.MhLength = -1
+
+	var cidBuilder cid.Builder = prefix
+	if o.Inline != nil && *o.Inline {
+		inlineLimit := o.InlineLimit
+		if inlineLimit == 0 {
+			inlineLimit = defaultInlineLimit
+		}
+		cidBuilder = cidutil.InlineBuilder{Builder: prefix, Limit: inlineLimit}
+	}
+
+	chunkerSpec := o.Chunker
+	if chunkerSpec == "" {
+		chunkerSpec = defaultChunker
+	}
+
+	return helpers.DagBuilderParams{
+		Dagserv:    dag,
+		Maxlinks:   CanonicalMaxLinks,
+		RawLeaves:  rawLeaves,
+		CidBuilder: cidBuilder,
+	}, chunkerSpec, nil
+}
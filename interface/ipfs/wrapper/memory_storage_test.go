@@ -0,0 +1,96 @@
+package ipfs_client
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+func TestMemoryStorageMatchesKuboCids(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("hello world\n")
+
+	// The CIDs returned by "ipfs add" and "ipfs add --cid-version=1" on a default Kubo node.
+	tests := []struct {
+		name     string
+		options  AddOptions
+		expected string
+	}{
+		{name: "kubo defaults", options: AddOptions{}, expected: "/ipfs/QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+		{name: "canonical", options: CanonicalAddOptions(), expected: "/ipfs/bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"},
+	}
+
+	for _, test := range tests {
+		storage, err := NewMemoryStorage(test.options)
+		if err != nil {
+			t.Fatalf("Failed to create memory storage: %v", err)
+		}
+
+		cid, err := storage.AddFileBytes(ctx, content)
+		if err != nil {
+			t.Fatalf("Failed to add file: %v", err)
+		}
+		if cid != test.expected {
+			t.Fatalf("%s: expected CID %s, got %s", test.name, test.expected, cid)
+		}
+	}
+}
+
+func TestMemoryStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	storage, err := NewMemoryStorage(AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create memory storage: %v", err)
+	}
+
+	// A model spanning several chunks.
+	model := &pb.WeightModel{Values: make([]int64, 100000)}
+	for i := range model.Values {
+		model.Values[i] = rand.Int63()
+	}
+
+	cid, err := storage.AddAndPinFile(ctx, model)
+	if err != nil {
+		t.Fatalf("Failed to add and pin model: %v", err)
+	}
+
+	var retrieved pb.WeightModel
+	if err := storage.GetFile(ctx, cid, &retrieved); err != nil {
+		t.Fatalf("Failed to get model: %v", err)
+	}
+	if len(retrieved.Values) != len(model.Values) || retrieved.Values[12345] != model.Values[12345] {
+		t.Fatalf("Retrieved model does not match the added model")
+	}
+
+	pins, err := storage.ListPins(ctx)
+	if err != nil || len(pins) != 1 || pins[0] != cid {
+		t.Fatalf("Expected %s to be the only pin, got %v (%v)", cid, pins, err)
+	}
+
+	if err := storage.UnpinFile(ctx, cid); err != nil {
+		t.Fatalf("Failed to unpin model: %v", err)
+	}
+	if err := storage.UnpinFile(ctx, cid); err == nil {
+		t.Fatalf("Expected unpinning a CID that is not pinned to fail")
+	}
+
+	other, err := NewMemoryStorage(AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create memory storage: %v", err)
+	}
+	if err := other.PinFile(ctx, cid); err == nil {
+		t.Fatalf("Expected pinning a CID whose content is missing to fail")
+	}
+
+	data, err := storage.GetFileBytes(ctx, cid)
+	if err != nil {
+		t.Fatalf("Failed to get model bytes: %v", err)
+	}
+	otherCid, err := other.AddFileBytes(ctx, data)
+	if err != nil || otherCid != cid {
+		t.Fatalf("Expected identical content to get the same CID, got %s and %s (%v)", cid, otherCid, err)
+	}
+}
@@ -0,0 +1,254 @@
+package ipfs_client
+
+import (
+	"context"
+	"fmt"
+	gopath "path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// Placeholders of the MFS layout templates.
+const (
+	federationPlaceholder  = "{federation}"
+	epochPlaceholder       = "{epoch}"
+	participantPlaceholder = "{participant}"
+	aggregatorPlaceholder  = "{aggregator}"
+)
+
+// Default MFS layout templates, see MfsLayout.
+const (
+	defaultMfsFederation      = "default"
+	defaultMfsEpochPath       = "/fl/{federation}/epoch-{epoch}"
+	defaultMfsParticipantPath = "/fl/{federation}/epoch-{epoch}/participant-{participant}"
+	defaultMfsGlobalPath      = "/fl/{federation}/epoch-{epoch}/global"
+)
+
+// MfsLayout describes where models are mirrored in the node's MFS, the mutable file system of the node,
+// so that they can be browsed next to being found through the ledger.
+// The paths are templates where {federation}, {epoch}, {participant} and {aggregator} are replaced.
+// Federation - the name of the federation.
+// EpochPath - the directory of an epoch; its CID is the root CID of the epoch.
+// ParticipantPath - the path of a participant's model, inside EpochPath.
+// GlobalPath - the path of an aggregator's global model, inside EpochPath.
+type MfsLayout struct {
+	Federation      string
+	EpochPath       string
+	ParticipantPath string
+	GlobalPath      string
+}
+
+// DefaultMfsLayout returns the layout /fl/<federation>/epoch-<n>/participant-<id> and /fl/<federation>/epoch-<n>/global.
+func DefaultMfsLayout(federation string) MfsLayout {
+	return MfsLayout{
+		Federation:      federation,
+		EpochPath:       defaultMfsEpochPath,
+		ParticipantPath: defaultMfsParticipantPath,
+		GlobalPath:      defaultMfsGlobalPath,
+	}
+}
+
+// newMfsLayout fills in the defaults of a layout read from the config and validates it.
+func newMfsLayout(federation string, epochPath string, participantPath string, globalPath string) (MfsLayout, error) {
+	layout := DefaultMfsLayout(defaultMfsFederation)
+	if federation != "" {
+		layout.Federation = federation
+	}
+	if epochPath != "" {
+		layout.EpochPath = epochPath
+	}
+	if participantPath != "" {
+		layout.ParticipantPath = participantPath
+	}
+	if globalPath != "" {
+		layout.GlobalPath = globalPath
+	}
+
+	return layout, layout.validate()
+}
+
+// validate checks that the templates are absolute and that models are placed inside their epoch directory.
+func (l MfsLayout) validate() error {
+	if l.Federation == "" || strings.Contains(l.Federation, "/") {
+		return fmt.Errorf("invalid federation name %q", l.Federation)
+	}
+
+	for name, template := range map[string]string{"epoch_path": l.EpochPath, "participant_path": l.ParticipantPath, "global_path": l.GlobalPath} {
+		if !strings.HasPrefix(template, "/") {
+			return fmt.Errorf("%s %q must be an absolute path", name, template)
+		}
+		if !strings.Contains(template, epochPlaceholder) {
+			return fmt.Errorf("%s %q must contain %s", name, template, epochPlaceholder)
+		}
+	}
+	if !strings.Contains(l.ParticipantPath, participantPlaceholder) {
+		return fmt.Errorf("participant_path %q must contain %s", l.ParticipantPath, participantPlaceholder)
+	}
+
+	epochDir := l.epochPath(0) + "/"
+	if !strings.HasPrefix(l.participantPath(0, 0), epochDir) || !strings.HasPrefix(l.globalPath(0, 0), epochDir) {
+		return fmt.Errorf("participant_path and global_path must be inside epoch_path %q", l.EpochPath)
+	}
+
+	return nil
+}
+
+func (l MfsLayout) epochPath(epoch int) string {
+	return l.expand(l.EpochPath, epoch, 0, 0)
+}
+
+func (l MfsLayout) participantPath(epoch int, participantId int) string {
+	return l.expand(l.ParticipantPath, epoch, participantId, 0)
+}
+
+func (l MfsLayout) globalPath(epoch int, aggregatorId int) string {
+	return l.expand(l.GlobalPath, epoch, 0, aggregatorId)
+}
+
+func (l MfsLayout) expand(template string, epoch int, participantId int, aggregatorId int) string {
+	return gopath.Clean(strings.NewReplacer(
+		federationPlaceholder, l.Federation,
+		epochPlaceholder, strconv.Itoa(epoch),
+		participantPlaceholder, strconv.Itoa(participantId),
+		aggregatorPlaceholder, strconv.Itoa(aggregatorId),
+	).Replace(template))
+}
+
+// MfsLayout returns the layout used to mirror models into the node's MFS.
+func (c *IpfsClient) MfsLayout() MfsLayout {
+	return c.mfsLayout
+}
+
+// MirrorParticipantModel links a participant's model into the node's MFS at the participant path of the layout.
+// The content is not copied, only linked, so mirroring is cheap.
+func (c *IpfsClient) MirrorParticipantModel(ctx context.Context, epoch int, participantId int, cid string) error {
+	return c.mirrorToMfs(ctx, cid, c.mfsLayout.participantPath(epoch, participantId))
+}
+
+// MirrorGlobalModel links an aggregator's global model into the node's MFS at the global path of the layout.
+func (c *IpfsClient) MirrorGlobalModel(ctx context.Context, epoch int, aggregatorId int, cid string) error {
+	return c.mirrorToMfs(ctx, cid, c.mfsLayout.globalPath(epoch, aggregatorId))
+}
+
+// GetEpochRootCid returns the CID of the MFS directory of an epoch, which holds every mirrored model of the epoch.
+func (c *IpfsClient) GetEpochRootCid(ctx context.Context, epoch int) (string, error) {
+	stat, err := c.statMfs(ctx, c.mfsLayout.epochPath(epoch))
+	if err != nil {
+		return "", fmt.Errorf("failed to get the MFS directory of epoch %d: %w", epoch, err)
+	}
+
+	return path.FromCid(stat).String(), nil
+}
+
+// RebuildMfsLayout recreates the MFS directories of every epoch referenced by the given metadata records,
+// mirroring each participant and global model into them, and returns the root CID of each epoch.
+// Directories of epochs without records are left untouched.
+func (c *IpfsClient) RebuildMfsLayout(ctx context.Context, participantMetadata []shared.ParticipantModelMetadata, aggregatorMetadata []shared.AggregatorModelMetadata) (map[int]string, error) {
+	// Collect the mirrored paths first, so that a layout mapping two different models to one path is reported
+	// before anything is removed.
+	entries := map[string]string{}
+	epochs := map[int]bool{}
+	add := func(mfsPath string, cid string, epoch int) error {
+		if existing, ok := entries[mfsPath]; ok && existing != cid {
+			return fmt.Errorf("models %s and %s are both mapped to %s, add %s to the layout", existing, cid, mfsPath, aggregatorPlaceholder)
+		}
+		entries[mfsPath] = cid
+		epochs[epoch] = true
+		return nil
+	}
+
+	for _, metadata := range participantMetadata {
+		if err := add(c.mfsLayout.participantPath(metadata.Epoch, metadata.ParticipantId), metadata.ModelHashCid, metadata.Epoch); err != nil {
+			return nil, err
+		}
+	}
+	for _, metadata := range aggregatorMetadata {
+		if err := add(c.mfsLayout.globalPath(metadata.Epoch, metadata.AggregatorId), metadata.ModelHashCid, metadata.Epoch); err != nil {
+			return nil, err
+		}
+	}
+
+	for epoch := range epochs {
+		err := c.NodeHttpApi.Request("files/rm", c.mfsLayout.epochPath(epoch)).
+			Option("recursive", true).
+			Option("force", true).
+			Exec(ctx, nil)
+		if err != nil && !isMfsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove the MFS directory of epoch %d: %w", epoch, err)
+		}
+	}
+
+	mfsPaths := make([]string, 0, len(entries))
+	for mfsPath := range entries {
+		mfsPaths = append(mfsPaths, mfsPath)
+	}
+	sort.Strings(mfsPaths)
+
+	for _, mfsPath := range mfsPaths {
+		if err := c.mirrorToMfs(ctx, entries[mfsPath], mfsPath); err != nil {
+			return nil, err
+		}
+	}
+
+	roots := make(map[int]string, len(epochs))
+	for epoch := range epochs {
+		root, err := c.GetEpochRootCid(ctx, epoch)
+		if err != nil {
+			return nil, err
+		}
+		roots[epoch] = root
+	}
+
+	return roots, nil
+}
+
+// mirrorToMfs links a CID at an MFS path, creating the parent directories and replacing a different entry at the path.
+func (c *IpfsClient) mirrorToMfs(ctx context.Context, cid string, mfsPath string) error {
+	source, err := parseCid(cid)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.statMfs(ctx, mfsPath)
+	switch {
+	case err == nil && existing.Equals(source):
+		return nil
+	case err == nil:
+		if err := c.NodeHttpApi.Request("files/rm", mfsPath).Option("recursive", true).Exec(ctx, nil); err != nil {
+			return fmt.Errorf("failed to replace %s in MFS: %w", mfsPath, err)
+		}
+	case !isMfsNotExist(err):
+		return fmt.Errorf("failed to check %s in MFS: %w", mfsPath, err)
+	}
+
+	err = c.NodeHttpApi.Request("files/cp", path.FromCid(source).String(), mfsPath).
+		Option("parents", true).
+		Exec(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to mirror %s to %s in MFS: %w", cid, mfsPath, err)
+	}
+
+	return nil
+}
+
+// statMfs returns the CID of the MFS entry at the given path.
+func (c *IpfsClient) statMfs(ctx context.Context, mfsPath string) (cid.Cid, error) {
+	var stat struct {
+		Hash string
+	}
+	if err := c.NodeHttpApi.Request("files/stat", mfsPath).Exec(ctx, &stat); err != nil {
+		return cid.Undef, err
+	}
+
+	return parseCid(stat.Hash)
+}
+
+// isMfsNotExist reports whether an MFS command failed because the path does not exist.
+func isMfsNotExist(err error) bool {
+	return strings.Contains(err.Error(), "does not exist")
+}
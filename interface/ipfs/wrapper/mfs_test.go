@@ -0,0 +1,81 @@
+package ipfs_client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+func TestMfsLayoutValidation(t *testing.T) {
+	layout, err := newMfsLayout("mnist", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create default layout: %v", err)
+	}
+	if p := layout.participantPath(3, 7); p != "/fl/mnist/epoch-3/participant-7" {
+		t.Fatalf("Unexpected participant path: %s", p)
+	}
+	if p := layout.globalPath(3, 1); p != "/fl/mnist/epoch-3/global" {
+		t.Fatalf("Unexpected global path: %s", p)
+	}
+
+	if _, err := newMfsLayout("mnist", "", "", "/fl/{federation}/global-{epoch}"); err == nil {
+		t.Fatalf("Expected a global path outside of the epoch directory to be rejected")
+	}
+	if _, err := newMfsLayout("mnist", "", "/fl/{federation}/epoch-{epoch}/participant", ""); err == nil {
+		t.Fatalf("Expected a participant path without {participant} to be rejected")
+	}
+}
+
+func TestMirrorAndRebuildMfsLayout(t *testing.T) {
+	client := newEmbeddedTestClient(t, "  mfs:\n    federation: \"mnist\"\n")
+	ctx := context.Background()
+
+	participantCid, err := client.AddFileBytes(ctx, []byte("participant model"))
+	if err != nil {
+		t.Fatalf("Failed to add participant model: %v", err)
+	}
+	globalCid, err := client.AddFileBytes(ctx, []byte("global model"))
+	if err != nil {
+		t.Fatalf("Failed to add global model: %v", err)
+	}
+
+	if err := client.MirrorParticipantModel(ctx, 1, 4, participantCid); err != nil {
+		t.Fatalf("Failed to mirror participant model: %v", err)
+	}
+	// Mirroring the same model again is a no-op.
+	if err := client.MirrorParticipantModel(ctx, 1, 4, participantCid); err != nil {
+		t.Fatalf("Failed to mirror participant model again: %v", err)
+	}
+	if err := client.MirrorGlobalModel(ctx, 1, 9, globalCid); err != nil {
+		t.Fatalf("Failed to mirror global model: %v", err)
+	}
+
+	mirroredRoot, err := client.GetEpochRootCid(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get epoch root: %v", err)
+	}
+
+	// A stale entry is dropped when the epoch is rebuilt from the ledger records.
+	if err := client.MirrorParticipantModel(ctx, 1, 5, globalCid); err != nil {
+		t.Fatalf("Failed to mirror stale model: %v", err)
+	}
+
+	roots, err := client.RebuildMfsLayout(ctx,
+		[]shared.ParticipantModelMetadata{{Epoch: 1, ParticipantId: 4, ModelHashCid: participantCid}},
+		[]shared.AggregatorModelMetadata{{Epoch: 1, AggregatorId: 9, ModelHashCid: globalCid}},
+	)
+	if err != nil {
+		t.Fatalf("Failed to rebuild MFS layout: %v", err)
+	}
+	t.Logf("Epoch roots: %v", roots)
+
+	if roots[1] != mirroredRoot {
+		t.Fatalf("Expected the rebuilt epoch root %s to match the mirrored one %s", roots[1], mirroredRoot)
+	}
+
+	data, err := client.GetFileBytes(ctx, roots[1]+"/participant-4")
+	if err != nil || string(data) != "participant model" {
+		t.Fatalf("Expected the participant model under the epoch root, got %q (%v)", data, err)
+	}
+}
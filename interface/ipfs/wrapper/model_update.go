@@ -0,0 +1,49 @@
+package ipfs_client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// maxDeltaChain is the largest number of delta updates followed to reconstruct a model, so that a participant
+// cannot make an aggregator fetch an endless chain of bases.
+const maxDeltaChain = 64
+
+// GetTensorModel retrieves a model stored as a TensorModel, a WeightModel or a ModelUpdate and returns it densely.
+// The base model of a delta update is retrieved as well, and so on if the base is itself a delta.
+func (c *IpfsClient) GetTensorModel(ctx context.Context, cid string) (*weight_pb.TensorModel, error) {
+	return c.getTensorModel(ctx, cid, 0)
+}
+
+func (c *IpfsClient) getTensorModel(ctx context.Context, cid string, depth int) (*weight_pb.TensorModel, error) {
+	if depth > maxDeltaChain {
+		return nil, fmt.Errorf("model %s is more than %d deltas away from a full model", cid, maxDeltaChain)
+	}
+
+	data, err := c.GetFileBytes(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	return weight_pb.DecodeModel(ctx, data, func(ctx context.Context, baseCid string) (*weight_pb.TensorModel, error) {
+		return c.getTensorModel(ctx, baseCid, depth+1)
+	})
+}
+
+// AddModelDelta encodes a model as a delta against the model stored under baseCid, usually the previous global model,
+// and adds the update to IPFS. The base model is retrieved to compute the delta. The CID of the update is returned.
+func (c *IpfsClient) AddModelDelta(ctx context.Context, baseCid string, model *weight_pb.TensorModel, opts weight_pb.UpdateOptions) (string, error) {
+	base, err := c.GetTensorModel(ctx, baseCid)
+	if err != nil {
+		return "", fmt.Errorf("failed to get base model: %w", err)
+	}
+
+	update, err := weight_pb.EncodeDelta(baseCid, base, model, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode delta: %w", err)
+	}
+
+	return c.AddFile(ctx, update)
+}
@@ -0,0 +1,56 @@
+package ipfs_client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAddModelDelta(t *testing.T) {
+	client := newEmbeddedTestClient(t, "")
+	ctx := context.Background()
+
+	values := make([]int64, 10000)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	baseCid, err := client.AddFile(ctx, &weight_pb.WeightModel{Values: values})
+	if err != nil {
+		t.Fatalf("Failed to add base model: %v", err)
+	}
+
+	// The legacy base model is read as a single int64 tensor.
+	values[42] = -1
+	model := weight_pb.FromWeightModel(&weight_pb.WeightModel{Values: values})
+
+	deltaCid, err := client.AddModelDelta(ctx, baseCid, model, weight_pb.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to add delta: %v", err)
+	}
+
+	var update weight_pb.ModelUpdate
+	if err := client.GetFile(ctx, deltaCid, &update); err != nil {
+		t.Fatalf("Failed to get delta: %v", err)
+	}
+	if update.BaseCid != baseCid {
+		t.Fatalf("Expected the delta to record base %s, got %s", baseCid, update.BaseCid)
+	}
+
+	// A delta against the delta is resolved through both bases.
+	values[43] = -2
+	secondModel := weight_pb.FromWeightModel(&weight_pb.WeightModel{Values: values})
+	secondCid, err := client.AddModelDelta(ctx, deltaCid, secondModel, weight_pb.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to add second delta: %v", err)
+	}
+
+	reconstructed, err := client.GetTensorModel(ctx, secondCid)
+	if err != nil {
+		t.Fatalf("Failed to reconstruct model: %v", err)
+	}
+	if !proto.Equal(reconstructed, secondModel) {
+		t.Fatalf("Reconstructed model does not match the added model")
+	}
+}
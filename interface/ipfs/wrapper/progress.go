@@ -0,0 +1,91 @@
+package ipfs_client
+
+import (
+	"io"
+	"time"
+)
+
+// progressInterval is the minimum time between two progress reports of a transfer, so that
+// a callback printing to a terminal does not slow the transfer down.
+const progressInterval = 100 * time.Millisecond
+
+// Progress describes how far an upload to or a download from IPFS has come.
+// Bytes - the number of bytes transferred so far.
+// Total - the size of the file in bytes, or 0 if it is not known.
+// Elapsed - the time since the transfer started.
+// Rate - the average transfer rate in bytes per second.
+// Done - whether the transfer has completed.
+type Progress struct {
+	Bytes   int64
+	Total   int64
+	Elapsed time.Duration
+	Rate    float64
+	Done    bool
+}
+
+// Percent returns the transferred share of the file in percent, or 0 if its size is not known.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+
+	return float64(p.Bytes) / float64(p.Total) * 100
+}
+
+// ProgressFunc is called with the progress of a transfer, at most every 100ms and once more when the transfer completes.
+// It is called from the goroutine doing the transfer, so it should return quickly.
+type ProgressFunc func(Progress)
+
+// progressReporter throttles the progress reports of one transfer. A nil reporter reports nothing.
+type progressReporter struct {
+	report ProgressFunc
+	total  int64
+	start  time.Time
+	last   time.Time
+}
+
+// newProgressReporter returns a reporter for a transfer of total bytes, or nil if report is nil.
+func newProgressReporter(report ProgressFunc, total int64) *progressReporter {
+	if report == nil {
+		return nil
+	}
+
+	return &progressReporter{report: report, total: total, start: time.Now()}
+}
+
+// update reports that bytes have been transferred so far. Updates closer than progressInterval to the
+// previous report are dropped, except the final one.
+func (r *progressReporter) update(bytes int64, done bool) {
+	if r == nil {
+		return
+	}
+
+	now := time.Now()
+	if !done && now.Sub(r.last) < progressInterval {
+		return
+	}
+	r.last = now
+
+	elapsed := now.Sub(r.start)
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(bytes) / elapsed.Seconds()
+	}
+
+	r.report(Progress{Bytes: bytes, Total: r.total, Elapsed: elapsed, Rate: rate, Done: done})
+}
+
+// progressReader counts the bytes read from a reader and reports them.
+type progressReader struct {
+	reader   io.Reader
+	reporter *progressReporter
+	bytes    int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.bytes += int64(n)
+	r.reporter.update(r.bytes, false)
+
+	return n, err
+}
@@ -0,0 +1,73 @@
+package ipfs_client
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// checkProgress checks that the reports of a transfer of total bytes never go back and end with one final report.
+func checkProgress(t *testing.T, reports []Progress, total int64) {
+	t.Helper()
+
+	if len(reports) == 0 {
+		t.Fatalf("Expected progress to be reported")
+	}
+	for i, report := range reports {
+		if i > 0 && report.Bytes < reports[i-1].Bytes {
+			t.Fatalf("Progress went back from %d to %d bytes", reports[i-1].Bytes, report.Bytes)
+		}
+		if report.Done != (i == len(reports)-1) {
+			t.Fatalf("Expected only the last report to be final, report %d of %d is %+v", i, len(reports), report)
+		}
+	}
+
+	final := reports[len(reports)-1]
+	if final.Bytes != total || final.Total != total || final.Percent() != 100 {
+		t.Fatalf("Expected the final report to cover %d bytes, got %+v", total, final)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	client := newEmbeddedTestClient(t, "")
+	ctx := context.Background()
+
+	data := make([]byte, 4<<20)
+	rand.Read(data)
+
+	var addReports []Progress
+	opts := client.AddOptions()
+	opts.Progress = func(progress Progress) {
+		addReports = append(addReports, progress)
+	}
+	cid, err := client.AddFileBytesWithOptions(ctx, data, opts)
+	if err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	checkProgress(t, addReports, int64(len(data)))
+
+	var getReports []Progress
+	retrieved, err := client.GetFileBytesWithOptions(ctx, cid, GetOptions{Progress: func(progress Progress) {
+		getReports = append(getReports, progress)
+	}})
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	if len(retrieved) != len(data) {
+		t.Fatalf("Expected %d bytes, got %d", len(data), len(retrieved))
+	}
+	checkProgress(t, getReports, int64(len(data)))
+
+	storage, err := NewMemoryStorage(AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create memory storage: %v", err)
+	}
+	var memoryReports []Progress
+	memoryCid, err := storage.AddFileBytesWithOptions(ctx, data, AddOptions{Progress: func(progress Progress) {
+		memoryReports = append(memoryReports, progress)
+	}})
+	if err != nil || memoryCid != cid {
+		t.Fatalf("Expected the memory storage to return %s, got %s (%v)", cid, memoryCid, err)
+	}
+	checkProgress(t, memoryReports, int64(len(data)))
+}
@@ -0,0 +1,311 @@
+package ipfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pinclient "github.com/ipfs/boxo/pinning/remote/client"
+	"github.com/ipfs/go-cid"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// defaultRemotePollInterval is used when the configuration does not set a poll interval.
+	defaultRemotePollInterval = 2 * time.Second
+
+	// LocalPinBackend and RemotePinBackend name the pinning backends in a PinReport.
+	LocalPinBackend  = "local"
+	RemotePinBackend = "remote"
+
+	// PinStatusPinned and PinStatusFailed are the final statuses of a pin request.
+	// A remote pin request can also be "queued" or "pinning" while the service fetches the data.
+	PinStatusPinned = "pinned"
+	PinStatusFailed = "failed"
+)
+
+// RemotePinningService is a client for a service implementing the IPFS Pinning Service API.
+// It is used as a second pinning backend next to the local IPFS node, so that models
+// referenced on the ledger are stored redundantly.
+type RemotePinningService struct {
+	client       *pinclient.Client
+	pollInterval time.Duration
+	timeout      time.Duration
+}
+
+// RemotePinStatus describes a pin request known to a remote pinning service.
+// RequestId - the id given by the service to the pin request. It is used to check on or remove the pin.
+// Cid - the pinned CID.
+// Name - the optional name of the pin.
+// Status - the status of the pin request: queued, pinning, pinned or failed.
+// Created - the time at which the service received the pin request.
+type RemotePinStatus struct {
+	RequestId string
+	Cid       string
+	Name      string
+	Status    string
+	Created   time.Time
+}
+
+// PinBackendStatus holds the outcome of pinning a CID on one backend.
+// Backend - the name of the backend, LocalPinBackend or RemotePinBackend.
+// Status - the last known pin status on the backend.
+// Err - the error returned by the backend, nil if pinning succeeded.
+type PinBackendStatus struct {
+	Backend string
+	Status  string
+	Err     error
+}
+
+// PinReport holds the per-backend outcome of pinning a CID everywhere.
+type PinReport struct {
+	Cid      string
+	Backends []PinBackendStatus
+}
+
+// NewRemotePinningService creates a client for the pinning service at endpoint, authenticated with the bearer token.
+// PollInterval is the time between two status checks while waiting for a pin; zero uses a 2 second interval.
+// Timeout bounds how long WaitPinned waits for a pin to complete; zero waits until the context is done.
+func NewRemotePinningService(endpoint string, token string, pollInterval time.Duration, timeout time.Duration) *RemotePinningService {
+	if pollInterval <= 0 {
+		pollInterval = defaultRemotePollInterval
+	}
+
+	return &RemotePinningService{
+		client:       pinclient.NewClient(endpoint, token),
+		pollInterval: pollInterval,
+		timeout:      timeout,
+	}
+}
+
+// Pin sends a pin request for the CID to the remote service and returns its initial status.
+// The service fetches the data asynchronously, use WaitPinned to wait for it to finish.
+// Origins are the multiaddrs of peers known to hold the data, they speed up the transfer. Can be empty.
+func (s *RemotePinningService) Pin(ctx context.Context, cidStr string, name string, origins ...ma.Multiaddr) (*RemotePinStatus, error) {
+	c, err := parseCid(cidStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []pinclient.AddOption
+	if name != "" {
+		opts = append(opts, pinclient.PinOpts.WithName(name))
+	}
+	if len(origins) > 0 {
+		opts = append(opts, pinclient.PinOpts.WithOrigins(origins...))
+	}
+
+	status, err := s.client.Add(ctx, c, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request remote pin for CID %s: %w", cidStr, err)
+	}
+
+	return toRemotePinStatus(status), nil
+}
+
+// Status returns the current status of a pin request.
+func (s *RemotePinningService) Status(ctx context.Context, requestId string) (*RemotePinStatus, error) {
+	status, err := s.client.GetStatusByID(ctx, requestId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of remote pin request %s: %w", requestId, err)
+	}
+
+	return toRemotePinStatus(status), nil
+}
+
+// WaitPinned polls the status of a pin request until it is pinned or failed, the service's timeout
+// expires or the context is done. The last known status is returned together with any error.
+func (s *RemotePinningService) WaitPinned(ctx context.Context, requestId string) (*RemotePinStatus, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		status, err := s.Status(ctx, requestId)
+		if err != nil {
+			return status, err
+		}
+
+		switch status.Status {
+		case PinStatusPinned:
+			return status, nil
+		case PinStatusFailed:
+			return status, fmt.Errorf("remote pin request %s for CID %s failed", requestId, status.Cid)
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, fmt.Errorf("stopped waiting for remote pin request %s in status %s: %w", requestId, status.Status, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// List returns the pin requests known to the remote service in any status.
+// If CIDs are given, only the pin requests for those CIDs are returned.
+func (s *RemotePinningService) List(ctx context.Context, cids ...string) ([]RemotePinStatus, error) {
+	opts := []pinclient.LsOption{
+		pinclient.PinOpts.FilterStatus(pinclient.StatusQueued, pinclient.StatusPinning, pinclient.StatusPinned, pinclient.StatusFailed),
+	}
+
+	if len(cids) > 0 {
+		parsed := make([]cid.Cid, 0, len(cids))
+		for _, cidStr := range cids {
+			c, err := parseCid(cidStr)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, c)
+		}
+		opts = append(opts, pinclient.PinOpts.FilterCIDs(parsed...))
+	}
+
+	statuses, err := s.client.LsSync(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote pins: %w", err)
+	}
+
+	result := make([]RemotePinStatus, 0, len(statuses))
+	for _, status := range statuses {
+		result = append(result, *toRemotePinStatus(status))
+	}
+
+	return result, nil
+}
+
+// Remove deletes a single pin request by its id.
+func (s *RemotePinningService) Remove(ctx context.Context, requestId string) error {
+	err := s.client.DeleteByID(ctx, requestId)
+	if err != nil {
+		return fmt.Errorf("failed to remove remote pin request %s: %w", requestId, err)
+	}
+
+	return nil
+}
+
+// Unpin removes every pin request for the CID from the remote service.
+func (s *RemotePinningService) Unpin(ctx context.Context, cidStr string) error {
+	statuses, err := s.List(ctx, cidStr)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if err := s.Remove(ctx, status.RequestId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PinEverywhere pins a CID on the local IPFS node and, if configured, on the remote pinning service,
+// and waits for the remote pin to complete. The report holds the status of every backend.
+// An error is returned if pinning failed on any backend, the report is returned in every case.
+func (c *IpfsClient) PinEverywhere(ctx context.Context, cid string, name string) (*PinReport, error) {
+	report := &PinReport{Cid: cid}
+
+	local := PinBackendStatus{Backend: LocalPinBackend, Status: PinStatusPinned}
+	if err := c.PinFile(ctx, cid); err != nil {
+		local.Status = PinStatusFailed
+		local.Err = err
+	}
+	report.Backends = append(report.Backends, local)
+
+	if c.RemotePinning != nil {
+		report.Backends = append(report.Backends, c.pinRemote(ctx, cid, name))
+	}
+
+	var errs []error
+	for _, backend := range report.Backends {
+		if backend.Err != nil {
+			errs = append(errs, fmt.Errorf("%s pinning failed: %w", backend.Backend, backend.Err))
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// UnpinEverywhere removes the pins of a CID from the local IPFS node and, if configured, from the remote pinning service.
+func (c *IpfsClient) UnpinEverywhere(ctx context.Context, cid string) error {
+	var errs []error
+
+	if err := c.UnpinFile(ctx, cid); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.RemotePinning != nil {
+		if err := c.RemotePinning.Unpin(ctx, cid); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// pinRemote requests a remote pin for the CID and waits for it to complete.
+// The local node's addresses are passed as origins so the service can fetch the data directly.
+func (c *IpfsClient) pinRemote(ctx context.Context, cid string, name string) PinBackendStatus {
+	result := PinBackendStatus{Backend: RemotePinBackend}
+
+	status, err := c.RemotePinning.Pin(ctx, cid, name, c.localOrigins(ctx)...)
+	if err != nil {
+		result.Status = PinStatusFailed
+		result.Err = err
+		return result
+	}
+
+	status, err = c.RemotePinning.WaitPinned(ctx, status.RequestId)
+	if status != nil {
+		result.Status = status.Status
+	} else if err != nil {
+		// The status could not be read, so the request is reported as failed, like one that could not be made.
+		result.Status = PinStatusFailed
+	}
+	result.Err = err
+
+	return result
+}
+
+// localOrigins returns the addresses of the local IPFS node including its peer id.
+// Origins are only a hint for the pinning service, so failures result in an empty list.
+func (c *IpfsClient) localOrigins(ctx context.Context) []ma.Multiaddr {
+	self, err := c.NodeHttpApi.Key().Self(ctx)
+	if err != nil {
+		return nil
+	}
+
+	addrs, err := c.NodeHttpApi.Swarm().LocalAddrs(ctx)
+	if err != nil {
+		return nil
+	}
+
+	peerPart, err := ma.NewComponent("p2p", self.ID().String())
+	if err != nil {
+		return nil
+	}
+
+	origins := make([]ma.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		origins = append(origins, addr.Encapsulate(peerPart))
+	}
+
+	return origins
+}
+
+// toRemotePinStatus converts a pin status returned by the pinning service client.
+func toRemotePinStatus(status pinclient.PinStatusGetter) *RemotePinStatus {
+	return &RemotePinStatus{
+		RequestId: status.GetRequestId(),
+		Cid:       status.GetPin().GetCid().String(),
+		Name:      status.GetPin().GetName(),
+		Status:    status.GetStatus().String(),
+		Created:   status.GetCreated(),
+	}
+}
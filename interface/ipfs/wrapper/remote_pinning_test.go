@@ -0,0 +1,215 @@
+package ipfs_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPinningToken = "test-token"
+
+// testPinningService is a minimal in-memory stand-in for a service implementing the IPFS Pinning Service API.
+// Every status check moves a pin request one step forward: queued -> pinning -> pinned.
+type testPinningService struct {
+	mu      sync.Mutex
+	nextId  int
+	pins    map[string]map[string]any
+	ordered []string
+}
+
+func newTestPinningService() *testPinningService {
+	return &testPinningService{pins: map[string]map[string]any{}}
+}
+
+func (s *testPinningService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testPinningToken {
+		writeTestFailure(w, http.StatusUnauthorized, "UNAUTHORIZED")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requestId := strings.TrimPrefix(r.URL.Path, "/pins/")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/pins":
+		var pin map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&pin); err != nil {
+			writeTestFailure(w, http.StatusBadRequest, "BAD_REQUEST")
+			return
+		}
+
+		s.nextId++
+		requestId = fmt.Sprintf("request-%d", s.nextId)
+		s.pins[requestId] = map[string]any{
+			"requestid": requestId,
+			"status":    "queued",
+			"created":   time.Now().Add(time.Duration(s.nextId) * time.Millisecond).UTC().Format(time.RFC3339Nano),
+			"pin":       pin,
+			"delegates": []string{"/ip4/127.0.0.1/tcp/4001/p2p/12D3KooWQF6Q3i1QkziJQ9mkNNcyFD8GPQz6R6oEvT75wgsVXm4v"},
+		}
+		s.ordered = append(s.ordered, requestId)
+		writeTestJSON(w, http.StatusAccepted, s.pins[requestId])
+
+	case r.Method == http.MethodGet && r.URL.Path == "/pins":
+		cids := strings.Split(r.URL.Query().Get("cid"), ",")
+		statuses := r.URL.Query().Get("status")
+
+		var results []map[string]any
+		for i := len(s.ordered) - 1; i >= 0; i-- {
+			status := s.pins[s.ordered[i]]
+			if status == nil {
+				continue
+			}
+			if r.URL.Query().Get("cid") != "" && !containsString(cids, status["pin"].(map[string]any)["cid"].(string)) {
+				continue
+			}
+			if statuses != "" && !containsString(strings.Split(statuses, ","), status["status"].(string)) {
+				continue
+			}
+			results = append(results, status)
+		}
+		writeTestJSON(w, http.StatusOK, map[string]any{"count": len(results), "results": results})
+
+	case r.Method == http.MethodGet:
+		status, ok := s.pins[requestId]
+		if !ok {
+			writeTestFailure(w, http.StatusNotFound, "NOT_FOUND")
+			return
+		}
+		switch status["status"] {
+		case "queued":
+			status["status"] = "pinning"
+		case "pinning":
+			status["status"] = "pinned"
+		}
+		writeTestJSON(w, http.StatusOK, status)
+
+	case r.Method == http.MethodDelete:
+		if _, ok := s.pins[requestId]; !ok {
+			writeTestFailure(w, http.StatusNotFound, "NOT_FOUND")
+			return
+		}
+		delete(s.pins, requestId)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		writeTestFailure(w, http.StatusBadRequest, "BAD_REQUEST")
+	}
+}
+
+func writeTestJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeTestFailure(w http.ResponseWriter, code int, reason string) {
+	writeTestJSON(w, code, map[string]any{"error": map[string]any{"reason": reason}})
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRemotePinningLifecycle(t *testing.T) {
+	server := httptest.NewServer(newTestPinningService())
+	defer server.Close()
+
+	ctx := context.Background()
+	service := NewRemotePinningService(server.URL, testPinningToken, 10*time.Millisecond, time.Second)
+
+	cid := "/ipfs/bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+
+	status, err := service.Pin(ctx, cid, "model-epoch-1")
+	if err != nil {
+		t.Fatalf("Failed to request remote pin: %v", err)
+	}
+	if status.Status != "queued" {
+		t.Fatalf("Expected new pin request to be queued, got %s", status.Status)
+	}
+	t.Logf("Requested remote pin %s", status.RequestId)
+
+	status, err = service.WaitPinned(ctx, status.RequestId)
+	if err != nil {
+		t.Fatalf("Failed waiting for remote pin: %v", err)
+	}
+	if status.Status != PinStatusPinned {
+		t.Fatalf("Expected pin request to be pinned, got %s", status.Status)
+	}
+	if status.Name != "model-epoch-1" {
+		t.Fatalf("Expected pin name model-epoch-1, got %s", status.Name)
+	}
+
+	statuses, err := service.List(ctx, cid)
+	if err != nil {
+		t.Fatalf("Failed to list remote pins: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].RequestId != status.RequestId {
+		t.Fatalf("Expected to list pin request %s, got %+v", status.RequestId, statuses)
+	}
+
+	if err := service.Unpin(ctx, cid); err != nil {
+		t.Fatalf("Failed to unpin remotely: %v", err)
+	}
+
+	statuses, err = service.List(ctx, cid)
+	if err != nil {
+		t.Fatalf("Failed to list remote pins: %v", err)
+	}
+	if len(statuses) != 0 {
+		t.Fatalf("Expected no pin requests after unpinning, got %+v", statuses)
+	}
+}
+
+func TestRemotePinningRejectsBadToken(t *testing.T) {
+	server := httptest.NewServer(newTestPinningService())
+	defer server.Close()
+
+	service := NewRemotePinningService(server.URL, "wrong-token", 0, 0)
+
+	_, err := service.Pin(context.Background(), "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", "")
+	if err == nil {
+		t.Fatalf("Expected pinning with a wrong token to fail")
+	}
+	t.Logf("Pinning with a wrong token failed as expected: %v", err)
+}
+
+func TestPinRemoteReportsFailedStatusCheck(t *testing.T) {
+	pinningService := newTestPinningService()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Pin requests are accepted, but their status cannot be read.
+		if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/pins/") {
+			writeTestFailure(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR")
+			return
+		}
+		pinningService.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	local := newTestRpcNode(t)
+	api, err := newTestReplicaApi(local.server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create IPFS API: %v", err)
+	}
+	client := &IpfsClient{
+		NodeHttpApi:   api,
+		RemotePinning: NewRemotePinningService(server.URL, testPinningToken, 10*time.Millisecond, time.Second),
+	}
+
+	result := client.pinRemote(context.Background(), "/ipfs/bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", "model-epoch-1")
+	if result.Err == nil || result.Status != PinStatusFailed {
+		t.Fatalf("Expected a failed status next to the error, got %+v", result)
+	}
+}
@@ -0,0 +1,315 @@
+package ipfs_client
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/kubo/client/rpc"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrQuorumNotReached is returned when fewer replica nodes than the write quorum pinned a CID.
+var ErrQuorumNotReached = errors.New("write quorum not reached")
+
+// ReplicaNode is the IPFS node of another organisation of the federation that content is replicated to.
+type ReplicaNode struct {
+	NodePath string
+	Api      *rpc.HttpApi
+}
+
+// NodeReplicaStatus holds whether a CID is pinned on a single node.
+// NodePath - the RPC API address of the node.
+// Pinned - true if the CID is pinned on the node.
+// Err - the error returned by the node, nil if the node answered.
+type NodeReplicaStatus struct {
+	NodePath string
+	Pinned   bool
+	Err      error
+}
+
+// ReplicationStatus holds the replication state of a CID across the nodes of the federation.
+// Cid - the replicated CID.
+// Primary - the status of the node the content was added to.
+// Replicas - the status of every replica node that was asked or checked.
+// PinnedReplicas - the number of replica nodes that have the CID pinned.
+// QuorumMet - true if PinnedReplicas reaches the client's write quorum.
+type ReplicationStatus struct {
+	Cid            string
+	Primary        NodeReplicaStatus
+	Replicas       []NodeReplicaStatus
+	PinnedReplicas int
+	QuorumMet      bool
+}
+
+// newReplicaNodes creates an RPC API for every replica node address.
+func newReplicaNodes(nodePaths []string, replicationFactor int, writeQuorum int, newApi func(string) (*rpc.HttpApi, error)) ([]*ReplicaNode, int, int, error) {
+	if len(nodePaths) == 0 {
+		return nil, 0, 0, nil
+	}
+
+	if replicationFactor == 0 {
+		replicationFactor = len(nodePaths)
+	}
+	if writeQuorum == 0 {
+		writeQuorum = replicationFactor
+	}
+	if replicationFactor < 0 || replicationFactor > len(nodePaths) {
+		return nil, 0, 0, fmt.Errorf("replication factor %d must be between 1 and the number of replica nodes %d", replicationFactor, len(nodePaths))
+	}
+	if writeQuorum < 0 || writeQuorum > replicationFactor {
+		return nil, 0, 0, fmt.Errorf("write quorum %d must be between 1 and the replication factor %d", writeQuorum, replicationFactor)
+	}
+
+	replicas := make([]*ReplicaNode, 0, len(nodePaths))
+	for _, nodePath := range nodePaths {
+		api, err := newApi(nodePath)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("error creating an IPFS Node HTTP API for replica %s: %w", nodePath, err)
+		}
+		replicas = append(replicas, &ReplicaNode{NodePath: nodePath, Api: api})
+	}
+
+	return replicas, replicationFactor, writeQuorum, nil
+}
+
+// AddAndReplicateFile adds a protobuf message to IPFS, pins it on the local node and replicates it to the replica nodes.
+// The CID is returned together with the replication status, and ErrQuorumNotReached if the write quorum was not met.
+func (c *IpfsClient) AddAndReplicateFile(ctx context.Context, msg proto.Message) (string, *ReplicationStatus, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal protobuf message: %w", err)
+	}
+
+	return c.AddAndReplicateFileBytes(ctx, data)
+}
+
+// AddAndReplicateFileBytes adds a byte array to IPFS, pins it on the local node and replicates it to the replica nodes.
+// The CID is returned together with the replication status, and ErrQuorumNotReached if the write quorum was not met.
+func (c *IpfsClient) AddAndReplicateFileBytes(ctx context.Context, byteArray []byte) (string, *ReplicationStatus, error) {
+	cid, err := c.AddAndPinFileBytes(ctx, byteArray)
+	if err != nil {
+		return "", nil, err
+	}
+
+	status, err := c.ReplicateFile(ctx, cid)
+	return cid, status, err
+}
+
+// ReplicateFile pins a CID that is already stored on the local node on the client's replication factor of replica nodes.
+// Replica nodes are ranked per CID with rendezvous hashing, so every client picks the same nodes for the same CID.
+// When pinning fails on a node, the next node in the ranking is tried instead.
+// ErrQuorumNotReached is returned if fewer nodes than the write quorum pinned the CID.
+func (c *IpfsClient) ReplicateFile(ctx context.Context, cid string) (*ReplicationStatus, error) {
+	ipfsPath, err := path.NewPath(cid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID path: %w", err)
+	}
+
+	status := &ReplicationStatus{
+		Cid:     cid,
+		Primary: NodeReplicaStatus{NodePath: c.nodePath, Pinned: true},
+	}
+
+	// Connecting the replicas to the local node lets them fetch the content directly instead of searching the network.
+	self := c.localAddrInfo(ctx)
+
+	ranked := c.rankReplicas(cid)
+	next := 0
+	for status.PinnedReplicas < c.replicationFactor && next < len(ranked) {
+		wave := ranked[next:min(next+c.replicationFactor-status.PinnedReplicas, len(ranked))]
+		next += len(wave)
+
+		results := make([]NodeReplicaStatus, len(wave))
+		var wg sync.WaitGroup
+		for i, replica := range wave {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = pinOnReplica(ctx, replica, ipfsPath, self)
+			}()
+		}
+		wg.Wait()
+
+		for _, result := range results {
+			if result.Pinned {
+				status.PinnedReplicas++
+			}
+			status.Replicas = append(status.Replicas, result)
+		}
+	}
+
+	status.QuorumMet = status.PinnedReplicas >= c.writeQuorum
+	if !status.QuorumMet {
+		return status, fmt.Errorf("%w: CID %s pinned on %d of %d required replica nodes", ErrQuorumNotReached, cid, status.PinnedReplicas, c.writeQuorum)
+	}
+
+	return status, nil
+}
+
+// GetReplicationStatus checks on the local node and on every replica node whether the CID is pinned.
+func (c *IpfsClient) GetReplicationStatus(ctx context.Context, cid string) (*ReplicationStatus, error) {
+	ipfsPath, err := path.NewPath(cid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID path: %w", err)
+	}
+
+	status := &ReplicationStatus{
+		Cid:      cid,
+		Primary:  isPinnedOn(ctx, c.nodePath, c.NodeHttpApi, ipfsPath),
+		Replicas: make([]NodeReplicaStatus, len(c.Replicas)),
+	}
+
+	var wg sync.WaitGroup
+	for i, replica := range c.Replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status.Replicas[i] = isPinnedOn(ctx, replica.NodePath, replica.Api, ipfsPath)
+		}()
+	}
+	wg.Wait()
+
+	for _, replica := range status.Replicas {
+		if replica.Pinned {
+			status.PinnedReplicas++
+		}
+	}
+	status.QuorumMet = status.PinnedReplicas >= c.writeQuorum
+
+	return status, nil
+}
+
+// GetFileFromAny retrieves a protobuf message from whichever node, local or replica, first returns content matching
+// the CID, unmarshals it and leaves the result in msg. The requests to the other nodes are cancelled.
+// Replica nodes belong to other organisations, so every response is imported again with the client's add options and
+// its CID compared, see AddOptions; a response that does not match fails with ErrCidMismatch and the next one is used.
+// The CID must therefore be a root CID added with the same UnixFS import settings as the client's, apart from the CID
+// version and the hash function, which are taken from the CID.
+// If a cache is configured and holds the file, no node is asked. The client's default size and duration limits apply.
+func (c *IpfsClient) GetFileFromAny(ctx context.Context, cid string, msg proto.Message) error {
+	if _, err := rootCid(cid); err != nil {
+		return err
+	}
+
+	if data, ok := c.cachedFile(cid); ok {
+		if err := c.getOptions.checkSize(cid, int64(len(data))); err != nil {
+			return err
+		}
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return fmt.Errorf("failed to unmarshal protobuf: %w", err)
+		}
+		return nil
+	}
+
+	var cancel context.CancelFunc
+	if c.getOptions.MaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.getOptions.MaxDuration)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	nodes := []*ReplicaNode{{NodePath: c.nodePath, Api: c.NodeHttpApi}}
+	nodes = append(nodes, c.Replicas...)
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make(chan result, len(nodes))
+	for _, node := range nodes {
+		go func() {
+			data, err := getFileBytes(ctx, node.Api, cid, c.getOptions)
+			if err == nil {
+				err = verifyContent(cid, data, c.addOptions)
+			}
+			if err != nil {
+				err = fmt.Errorf("node %s: %w", node.NodePath, err)
+			}
+			results <- result{data: data, err: err}
+		}()
+	}
+
+	var errs []error
+	for range nodes {
+		res := <-results
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		if c.Cache != nil {
+			_ = c.Cache.putVerified(cid, res.data)
+		}
+
+		if err := proto.Unmarshal(res.data, msg); err != nil {
+			return fmt.Errorf("failed to unmarshal protobuf: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("failed to get file from any IPFS node: %w", errors.Join(errs...))
+}
+
+// rankReplicas orders the replica nodes by their rendezvous hash with the CID, highest first.
+func (c *IpfsClient) rankReplicas(cid string) []*ReplicaNode {
+	type scored struct {
+		replica *ReplicaNode
+		score   [sha256.Size]byte
+	}
+
+	scoredReplicas := make([]scored, len(c.Replicas))
+	for i, replica := range c.Replicas {
+		scoredReplicas[i] = scored{replica: replica, score: sha256.Sum256([]byte(cid + "\x00" + replica.NodePath))}
+	}
+
+	sort.Slice(scoredReplicas, func(i, j int) bool {
+		return string(scoredReplicas[i].score[:]) > string(scoredReplicas[j].score[:])
+	})
+
+	ranked := make([]*ReplicaNode, len(scoredReplicas))
+	for i, s := range scoredReplicas {
+		ranked[i] = s.replica
+	}
+
+	return ranked
+}
+
+// localAddrInfo returns the peer id and addresses of the local node, nil if they cannot be determined.
+func (c *IpfsClient) localAddrInfo(ctx context.Context) *peer.AddrInfo {
+	infos, err := peer.AddrInfosFromP2pAddrs(c.localOrigins(ctx)...)
+	if err != nil || len(infos) == 0 {
+		return nil
+	}
+
+	return &infos[0]
+}
+
+// pinOnReplica connects the replica to the local node, if its address is known, and pins the path on it.
+func pinOnReplica(ctx context.Context, replica *ReplicaNode, ipfsPath path.Path, self *peer.AddrInfo) NodeReplicaStatus {
+	if self != nil {
+		// Connecting is only an optimisation, the replica can still find the content through the network.
+		_ = replica.Api.Swarm().Connect(ctx, *self)
+	}
+
+	if err := replica.Api.Pin().Add(ctx, ipfsPath); err != nil {
+		return NodeReplicaStatus{NodePath: replica.NodePath, Err: fmt.Errorf("failed to pin CID: %w", err)}
+	}
+
+	return NodeReplicaStatus{NodePath: replica.NodePath, Pinned: true}
+}
+
+// isPinnedOn checks whether the path is pinned on the node behind the given API.
+func isPinnedOn(ctx context.Context, nodePath string, api *rpc.HttpApi, ipfsPath path.Path) NodeReplicaStatus {
+	_, pinned, err := api.Pin().IsPinned(ctx, ipfsPath)
+	if err != nil {
+		return NodeReplicaStatus{NodePath: nodePath, Err: fmt.Errorf("failed to check pin: %w", err)}
+	}
+
+	return NodeReplicaStatus{NodePath: nodePath, Pinned: pinned}
+}
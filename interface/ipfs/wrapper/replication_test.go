@@ -0,0 +1,256 @@
+package ipfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/client/rpc"
+	pb "github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestReplicaApi(nodePath string) (*rpc.HttpApi, error) {
+	return rpc.NewURLApiWithClient(nodePath, &http.Client{})
+}
+
+func TestReplicationSettingsDefaults(t *testing.T) {
+	nodes := []string{"http://org2:5001", "http://org3:5001", "http://org4:5001"}
+
+	replicas, factor, quorum, err := newReplicaNodes(nodes, 0, 0, newTestReplicaApi)
+	if err != nil {
+		t.Fatalf("Failed to create replica nodes: %v", err)
+	}
+	if len(replicas) != 3 || factor != 3 || quorum != 3 {
+		t.Fatalf("Expected 3 replicas with factor 3 and quorum 3, got %d replicas, factor %d, quorum %d", len(replicas), factor, quorum)
+	}
+
+	_, factor, quorum, err = newReplicaNodes(nodes, 2, 1, newTestReplicaApi)
+	if err != nil {
+		t.Fatalf("Failed to create replica nodes: %v", err)
+	}
+	if factor != 2 || quorum != 1 {
+		t.Fatalf("Expected factor 2 and quorum 1, got factor %d and quorum %d", factor, quorum)
+	}
+
+	if _, _, _, err = newReplicaNodes(nodes, 4, 0, newTestReplicaApi); err == nil {
+		t.Fatalf("Expected a replication factor above the number of nodes to be rejected")
+	}
+
+	if _, _, _, err = newReplicaNodes(nodes, 2, 3, newTestReplicaApi); err == nil {
+		t.Fatalf("Expected a write quorum above the replication factor to be rejected")
+	}
+}
+
+func TestRankReplicasIsDeterministic(t *testing.T) {
+	nodes := []string{"http://org2:5001", "http://org3:5001", "http://org4:5001", "http://org5:5001"}
+
+	replicas, factor, quorum, err := newReplicaNodes(nodes, 2, 2, newTestReplicaApi)
+	if err != nil {
+		t.Fatalf("Failed to create replica nodes: %v", err)
+	}
+	client := &IpfsClient{Replicas: replicas, replicationFactor: factor, writeQuorum: quorum}
+
+	// A client listing the same nodes in another order must pick the same nodes for a CID.
+	reversed := make([]*ReplicaNode, len(replicas))
+	for i, replica := range replicas {
+		reversed[len(replicas)-1-i] = replica
+	}
+	otherClient := &IpfsClient{Replicas: reversed, replicationFactor: factor, writeQuorum: quorum}
+
+	cid := "/ipfs/QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+	ranked := client.rankReplicas(cid)
+	otherRanked := otherClient.rankReplicas(cid)
+
+	if len(ranked) != len(nodes) {
+		t.Fatalf("Expected %d ranked replicas, got %d", len(nodes), len(ranked))
+	}
+	for i := range ranked {
+		if ranked[i].NodePath != otherRanked[i].NodePath {
+			t.Fatalf("Rankings differ at position %d: %s and %s", i, ranked[i].NodePath, otherRanked[i].NodePath)
+		}
+	}
+	t.Logf("Replicas chosen for %s: %s, %s", cid, ranked[0].NodePath, ranked[1].NodePath)
+}
+
+// testRpcNode is a stub Kubo RPC node serving a single file and pinning any CID.
+type testRpcNode struct {
+	server *httptest.Server
+	// content is returned for any CID, nil makes the node wait until the request is cancelled.
+	content []byte
+	// failPin makes pinning fail.
+	failPin bool
+	// pins counts the successful pins, cancelled the requests cancelled while waiting.
+	pins      atomic.Int32
+	cancelled chan struct{}
+}
+
+// newTestRpcNode starts a stub node, closed at the end of the test.
+func newTestRpcNode(t *testing.T) *testRpcNode {
+	t.Helper()
+
+	node := &testRpcNode{cancelled: make(chan struct{}, 1)}
+	node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v0/pin/add":
+			if node.failPin {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `{"Message":"pin failed","Code":0,"Type":"error"}`)
+				return
+			}
+			node.pins.Add(1)
+			fmt.Fprintf(w, `{"Pins":[%q]}`, r.URL.Query().Get("arg"))
+		case "/api/v0/files/stat":
+			if node.content == nil {
+				<-r.Context().Done()
+				node.cancelled <- struct{}{}
+				return
+			}
+			fmt.Fprintf(w, `{"Hash":%q,"Type":"file","Size":%d}`, r.URL.Query().Get("arg"), len(node.content))
+		case "/api/v0/cat":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write(node.content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(node.server.Close)
+
+	return node
+}
+
+// newTestReplicatingClient creates a client for a local node and replica nodes with the given replication settings.
+func newTestReplicatingClient(t *testing.T, local *testRpcNode, replicas []*testRpcNode, replicationFactor int, writeQuorum int) *IpfsClient {
+	t.Helper()
+
+	nodePaths := make([]string, len(replicas))
+	for i, replica := range replicas {
+		nodePaths[i] = replica.server.URL
+	}
+	replicaNodes, factor, quorum, err := newReplicaNodes(nodePaths, replicationFactor, writeQuorum, newTestReplicaApi)
+	if err != nil {
+		t.Fatalf("Failed to create replica nodes: %v", err)
+	}
+
+	api, err := newTestReplicaApi(local.server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create IPFS API: %v", err)
+	}
+
+	return &IpfsClient{
+		nodePath:          local.server.URL,
+		NodeHttpApi:       api,
+		Replicas:          replicaNodes,
+		replicationFactor: factor,
+		writeQuorum:       quorum,
+	}
+}
+
+func TestReplicateFileQuorumNotReached(t *testing.T) {
+	local := newTestRpcNode(t)
+	replicas := []*testRpcNode{newTestRpcNode(t), newTestRpcNode(t), newTestRpcNode(t)}
+	replicas[1].failPin = true
+	replicas[2].failPin = true
+	client := newTestReplicatingClient(t, local, replicas, 2, 2)
+
+	// Every node is tried, but only one of the two required pins succeeds.
+	status, err := client.ReplicateFile(context.Background(), "/ipfs/QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o")
+	if !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("Expected ErrQuorumNotReached, got %v", err)
+	}
+	if status == nil || status.QuorumMet || status.PinnedReplicas != 1 || len(status.Replicas) != 3 {
+		t.Fatalf("Unexpected replication status %+v", status)
+	}
+	for _, replica := range status.Replicas {
+		if replica.Pinned == (replica.Err != nil) {
+			t.Fatalf("Expected a replica to be either pinned or failed, got %+v", replica)
+		}
+	}
+}
+
+func TestReplicateFileFallsBackToNextReplica(t *testing.T) {
+	local := newTestRpcNode(t)
+	replicas := []*testRpcNode{newTestRpcNode(t), newTestRpcNode(t), newTestRpcNode(t)}
+	client := newTestReplicatingClient(t, local, replicas, 2, 2)
+
+	cid := "/ipfs/QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+	ranked := client.rankReplicas(cid)
+	var first, last *testRpcNode
+	for _, replica := range replicas {
+		switch replica.server.URL {
+		case ranked[0].NodePath:
+			first = replica
+		case ranked[2].NodePath:
+			last = replica
+		}
+	}
+	first.failPin = true
+
+	status, err := client.ReplicateFile(context.Background(), cid)
+	if err != nil {
+		t.Fatalf("Failed to replicate the file: %v", err)
+	}
+	if !status.QuorumMet || status.PinnedReplicas != 2 || len(status.Replicas) != 3 {
+		t.Fatalf("Unexpected replication status %+v", status)
+	}
+	// The lowest-ranked node is only asked because the highest-ranked one failed.
+	if first.pins.Load() != 0 || last.pins.Load() != 1 {
+		t.Fatalf("Expected the failed pin to fall back to the lowest-ranked node, got %d and %d pins", first.pins.Load(), last.pins.Load())
+	}
+	if status.Replicas[0].NodePath != ranked[0].NodePath || status.Replicas[0].Err == nil {
+		t.Fatalf("Expected the failure of the highest-ranked node to be reported, got %+v", status.Replicas[0])
+	}
+}
+
+func TestGetFileFromAny(t *testing.T) {
+	model := &pb.WeightModel{Values: []int64{1, 2, 3}}
+	content, err := proto.Marshal(model)
+	if err != nil {
+		t.Fatalf("Failed to marshal the model: %v", err)
+	}
+	forged, err := proto.Marshal(&pb.WeightModel{Values: []int64{1, 2, 1 << 40}})
+	if err != nil {
+		t.Fatalf("Failed to marshal the forged model: %v", err)
+	}
+	storage, err := NewMemoryStorage(AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create the memory storage: %v", err)
+	}
+	cid, err := storage.AddFileBytes(context.Background(), content)
+	if err != nil {
+		t.Fatalf("Failed to add the model: %v", err)
+	}
+
+	// The local node never answers, one replica serves a forged model and the other one the model.
+	local := newTestRpcNode(t)
+	replicas := []*testRpcNode{newTestRpcNode(t), newTestRpcNode(t)}
+	replicas[0].content = forged
+	replicas[1].content = content
+	client := newTestReplicatingClient(t, local, replicas, 0, 0)
+
+	var retrieved pb.WeightModel
+	if err := client.GetFileFromAny(context.Background(), cid, &retrieved); err != nil {
+		t.Fatalf("Failed to get the file from any node: %v", err)
+	}
+	if !proto.Equal(&retrieved, model) {
+		t.Fatalf("Expected the model matching the CID, got %v", retrieved.Values)
+	}
+	select {
+	case <-local.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the request to the local node to be cancelled")
+	}
+
+	// Without any node serving the model, the forged one is rejected.
+	replicas[1].content = forged
+	local.content = forged
+	if err := client.GetFileFromAny(context.Background(), cid, &retrieved); !errors.Is(err, ErrCidMismatch) {
+		t.Fatalf("Expected ErrCidMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package ipfs_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultDialTimeout      = 10 * time.Second
+	defaultMaxAttempts      = 3
+	defaultInitialBackoff   = 200 * time.Millisecond
+	defaultMaxBackoff       = 5 * time.Second
+	defaultFailureThreshold = 5
+	defaultResetTimeout     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting the IPFS node while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("IPFS node circuit breaker is open")
+
+// RetryPolicy configures how idempotent operations are retried when the IPFS node cannot be reached.
+// MaxAttempts - the total number of attempts, 1 disables retrying.
+// InitialBackoff - the wait before the second attempt, doubled after every further attempt.
+// MaxBackoff - the upper bound of the wait between attempts.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// newRetryPolicy fills in the defaults of a retry policy read from the config.
+func newRetryPolicy(maxAttempts int, initialBackoff time.Duration, maxBackoff time.Duration) RetryPolicy {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if initialBackoff <= 0 {
+		initialBackoff = defaultInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	return RetryPolicy{MaxAttempts: maxAttempts, InitialBackoff: initialBackoff, MaxBackoff: max(initialBackoff, maxBackoff)}
+}
+
+// circuitState is the state of a circuitBreaker.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops requests to an IPFS node after consecutive connection failures.
+// Once the reset timeout has passed, a single request is let through; the circuit closes again
+// if it succeeds and stays open for another reset timeout otherwise.
+type circuitBreaker struct {
+	failureThreshold int
+	resetTimeout     time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newCircuitBreaker creates a circuit breaker from the config, nil if the threshold is negative.
+func newCircuitBreaker(failureThreshold int, resetTimeout time.Duration) *circuitBreaker {
+	if failureThreshold < 0 {
+		return nil
+	}
+	if failureThreshold == 0 {
+		failureThreshold = defaultFailureThreshold
+	}
+	if resetTimeout <= 0 {
+		resetTimeout = defaultResetTimeout
+	}
+
+	return &circuitBreaker{failureThreshold: failureThreshold, resetTimeout: resetTimeout, now: time.Now}
+}
+
+// allow returns ErrCircuitOpen if a request must not be sent to the node.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.resetTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return nil
+	case circuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of a request. Only failures to reach the node count,
+// a node answering with an error is healthy.
+func (b *circuitBreaker) record(unreachable bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !unreachable {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.failureThreshold {
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release lets another request probe the node after a request whose outcome tells nothing about the node,
+// such as one cancelled by the caller, without changing the state of the breaker.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// call runs an operation against the IPFS node through the client's circuit breaker. The operation is given
+// a context bounded by the client's request timeout, if one is configured, and must use it for its requests.
+// Non-idempotent operations (add, unpin) only go through call and are never retried, not even after a timeout.
+// A request ended by the caller's context is not recorded by the breaker, as it tells nothing about the node.
+func (c *IpfsClient) call(ctx context.Context, op func(ctx context.Context) error) error {
+	if c.breaker != nil {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+	}
+
+	requestCtx := ctx
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		requestCtx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+	}
+
+	err := op(requestCtx)
+	if c.breaker != nil {
+		if ctx.Err() != nil {
+			c.breaker.release()
+		} else {
+			c.breaker.record(isUnreachable(ctx, err))
+		}
+	}
+	return err
+}
+
+// retry runs an idempotent operation through call, retrying it with exponential backoff
+// while the IPFS node cannot be reached or the request timed out, up to the client's retry policy.
+func (c *IpfsClient) retry(ctx context.Context, op func(ctx context.Context) error) error {
+	backoff := c.retryPolicy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.call(ctx, op)
+		if err == nil || attempt >= c.retryPolicy.MaxAttempts || !isUnreachable(ctx, err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, c.retryPolicy.MaxBackoff)
+	}
+}
+
+// isUnreachable reports whether an error means the IPFS node could not be reached or did not answer within
+// the request timeout, as opposed to the node answering with an error or the caller's context being done.
+func isUnreachable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
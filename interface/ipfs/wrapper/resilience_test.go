@@ -0,0 +1,208 @@
+package ipfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/client/rpc"
+)
+
+// errUnreachable is an error as returned by the HTTP client when the node cannot be reached.
+var errUnreachable = &url.Error{Op: "Post", URL: "http://localhost:5001/api/v0/cat", Err: errors.New("connection refused")}
+
+func TestRetryOnlyRetriesUnreachableNode(t *testing.T) {
+	client := &IpfsClient{retryPolicy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}}
+	ctx := context.Background()
+
+	attempts := 0
+	err := client.retry(ctx, func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errUnreachable
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("Expected success after 3 attempts, got %d attempts and error %v", attempts, err)
+	}
+
+	attempts = 0
+	err = client.retry(ctx, func(context.Context) error {
+		attempts++
+		return errUnreachable
+	})
+	if err == nil || attempts != 3 {
+		t.Fatalf("Expected failure after 3 attempts, got %d attempts and error %v", attempts, err)
+	}
+
+	attempts = 0
+	err = client.retry(ctx, func(context.Context) error {
+		attempts++
+		return fmt.Errorf("failed to pin CID: %w", errors.New("merkledag: not found"))
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("Expected an error returned by the node not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	client := &IpfsClient{breaker: breaker}
+	ctx := context.Background()
+	unreachable := func(context.Context) error { return errUnreachable }
+	healthy := func(context.Context) error { return nil }
+
+	for i := 0; i < 2; i++ {
+		if err := client.call(ctx, unreachable); !errors.Is(err, errUnreachable) {
+			t.Fatalf("Expected the node error, got %v", err)
+		}
+	}
+	if err := client.call(ctx, healthy); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the circuit to be open after 2 failures, got %v", err)
+	}
+
+	// After the reset timeout a single probe is let through; it fails and the circuit opens again.
+	now = now.Add(time.Minute)
+	if err := client.call(ctx, unreachable); !errors.Is(err, errUnreachable) {
+		t.Fatalf("Expected the probe to reach the node, got %v", err)
+	}
+	if err := client.call(ctx, healthy); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the circuit to open again after a failed probe, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := client.call(ctx, healthy); err != nil {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	if err := client.call(ctx, healthy); err != nil {
+		t.Fatalf("Expected the circuit to be closed after a successful probe, got %v", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresCancelledRequests(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	client := &IpfsClient{breaker: breaker}
+	unreachable := func(context.Context) error { return errUnreachable }
+	cancelled := func(ctx context.Context) error {
+		<-ctx.Done()
+		return &url.Error{Op: "Post", URL: "http://localhost:5001/api/v0/cat", Err: ctx.Err()}
+	}
+
+	// A request cancelled by the caller neither counts as a failure nor resets the failures counted so far.
+	if err := client.call(context.Background(), unreachable); !errors.Is(err, errUnreachable) {
+		t.Fatalf("Expected the node error, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.call(ctx, cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the request to be cancelled, got %v", err)
+	}
+	if err := client.call(context.Background(), unreachable); !errors.Is(err, errUnreachable) {
+		t.Fatalf("Expected the node error, got %v", err)
+	}
+	if err := client.call(context.Background(), unreachable); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the circuit to be open after 2 failures, got %v", err)
+	}
+
+	// A cancelled probe does not close the circuit, but lets the next request probe the node.
+	now = now.Add(time.Minute)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := client.call(ctx, cancelled); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the probe to time out, got %v", err)
+	}
+	if err := client.call(context.Background(), unreachable); !errors.Is(err, errUnreachable) {
+		t.Fatalf("Expected another probe to reach the node, got %v", err)
+	}
+	if err := client.call(context.Background(), unreachable); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the circuit to open again after the failed probe, got %v", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	// Without a request timeout, requests are only bounded by the caller's context.
+	client := &IpfsClient{}
+	err := client.call(ctx, func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok {
+			return errors.New("unexpected deadline")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no deadline without a request timeout: %v", err)
+	}
+
+	// With one, every attempt gets its own deadline, and a request that times out counts as a failure to reach the node.
+	client = &IpfsClient{
+		requestTimeout: 10 * time.Millisecond,
+		retryPolicy:    RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		breaker:        newCircuitBreaker(2, time.Minute),
+	}
+	attempts := 0
+	err = client.retry(ctx, func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return &url.Error{Op: "Post", URL: "http://localhost:5001/api/v0/cat", Err: ctx.Err()}
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || attempts != 2 {
+		t.Fatalf("Expected 2 timed out attempts, got %d attempts and error %v", attempts, err)
+	}
+	if err := client.call(ctx, func(context.Context) error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the circuit to be open after 2 timeouts, got %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v0/id":
+			fmt.Fprint(w, `{"ID":"12D3KooWTest","AgentVersion":"kubo/0.38.1/"}`)
+		case "/api/v0/version":
+			fmt.Fprint(w, `{"Version":"0.38.1"}`)
+		case "/api/v0/repo/stat":
+			fmt.Fprint(w, `{"RepoSize":1024,"StorageMax":10000000000}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	api, err := rpc.NewURLApiWithClient(server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create IPFS API: %v", err)
+	}
+	client := &IpfsClient{NodeHttpApi: api, breaker: newCircuitBreaker(0, 0)}
+
+	health, err := client.Ping(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to ping IPFS node: %v", err)
+	}
+	t.Logf("Node health: %+v", health)
+
+	if health.PeerId != "12D3KooWTest" || health.Version != "0.38.1" || health.RepoSize != 1024 {
+		t.Fatalf("Unexpected node health: %+v", health)
+	}
+
+	// While the circuit is open, Ping fails without contacting the node like any other request.
+	for i := 0; i < defaultFailureThreshold; i++ {
+		client.breaker.record(true)
+	}
+	if _, err := client.Ping(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ping to fail while the circuit is open, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package ipfs_client
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Storage is the content-addressed storage used for models. It is implemented by IpfsClient,
+// backed by a Kubo node, and by MemoryStorage, which needs no daemon and is meant for tests.
+// CIDs are passed and returned as IPFS paths, e.g. "/ipfs/<cid>".
+type Storage interface {
+	AddFile(ctx context.Context, msg proto.Message) (string, error)
+	AddFileBytes(ctx context.Context, byteArray []byte) (string, error)
+	AddAndPinFile(ctx context.Context, msg proto.Message) (string, error)
+	AddAndPinFileBytes(ctx context.Context, byteArray []byte) (string, error)
+	GetFile(ctx context.Context, cid string, msg proto.Message) error
+	GetFileBytes(ctx context.Context, cid string) ([]byte, error)
+	PinFile(ctx context.Context, cid string) error
+	UnpinFile(ctx context.Context, cid string) error
+	ListPins(ctx context.Context) ([]string, error)
+}
+
+var (
+	_ Storage = (*IpfsClient)(nil)
+	_ Storage = (*MemoryStorage)(nil)
+)
@@ -0,0 +1,100 @@
+package ipfs_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ErrCidMismatch is returned when content retrieved for a CID does not hash to that CID.
+var ErrCidMismatch = errors.New("content does not match its CID")
+
+// errNotRootCid is returned for paths below a root CID, whose content cannot be checked against the root.
+var errNotRootCid = errors.New("the path is below a root CID")
+
+// verifyContent checks that data is the content of a root CID, given as an IPFS path or a bare CID, by importing it
+// again with the given UnixFS import settings and comparing the CIDs. The CID version and hash function left unset in
+// the settings are taken from the CID, the other settings must be the ones the content was added with.
+func verifyContent(cidStr string, data []byte, opts AddOptions) error {
+	expected, err := rootCid(cidStr)
+	if err != nil {
+		return err
+	}
+
+	if opts.CidVersion == nil {
+		cidVersion := int(expected.Version())
+		opts.CidVersion = &cidVersion
+	}
+	if opts.HashFunction == "" && expected.Prefix().MhType != mh.IDENTITY {
+		opts.HashFunction = mh.Codes[expected.Prefix().MhType]
+	}
+
+	root, err := opts.importFile(discardDag{}, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to verify the content of %s: %w", cidStr, err)
+	}
+	if !root.Cid().Equals(expected) {
+		return fmt.Errorf("%w: %s was expected, the content hashes to %s", ErrCidMismatch, expected, root.Cid())
+	}
+
+	return nil
+}
+
+// rootCid parses a bare CID or an IPFS path of a root CID. Paths below the root, such as /ipfs/<root>/file, are rejected.
+func rootCid(cidStr string) (cid.Cid, error) {
+	if c, err := cid.Decode(cidStr); err == nil {
+		return c, nil
+	}
+
+	ipfsPath, err := path.NewPath(cidStr)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid CID path: %w", err)
+	}
+	immutablePath, err := path.NewImmutablePath(ipfsPath)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid CID path: %w", err)
+	}
+	if len(immutablePath.Segments()) > 2 {
+		return cid.Undef, errNotRootCid
+	}
+
+	return immutablePath.RootCid(), nil
+}
+
+// discardDag is a DAG service dropping the nodes added to it, to compute the CID of content without storing it.
+type discardDag struct{}
+
+func (discardDag) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	return nil, ipld.ErrNotFound{Cid: c}
+}
+
+func (discardDag) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	options := make(chan *ipld.NodeOption, len(cids))
+	for _, c := range cids {
+		options <- &ipld.NodeOption{Err: ipld.ErrNotFound{Cid: c}}
+	}
+	close(options)
+	return options
+}
+
+func (discardDag) Add(ctx context.Context, node ipld.Node) error {
+	return nil
+}
+
+func (discardDag) AddMany(ctx context.Context, nodes []ipld.Node) error {
+	return nil
+}
+
+func (discardDag) Remove(ctx context.Context, c cid.Cid) error {
+	return nil
+}
+
+func (discardDag) RemoveMany(ctx context.Context, cids []cid.Cid) error {
+	return nil
+}
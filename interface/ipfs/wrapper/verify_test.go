@@ -0,0 +1,55 @@
+package ipfs_client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestVerifyContent(t *testing.T) {
+	ctx := context.Background()
+
+	// Several chunks, so that the root is a dag-pb node linking to the leaves.
+	content := make([]byte, 600_000)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	cidVersion1 := 1
+	tests := []struct {
+		name    string
+		options AddOptions
+	}{
+		{"KuboDefaults", AddOptions{}},
+		{"CidV1", AddOptions{CidVersion: &cidVersion1}},
+		{"Canonical", CanonicalAddOptions()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage, err := NewMemoryStorage(test.options)
+			if err != nil {
+				t.Fatalf("Failed to create the memory storage: %v", err)
+			}
+			cid, err := storage.AddFileBytes(ctx, content)
+			if err != nil {
+				t.Fatalf("Failed to add the file: %v", err)
+			}
+
+			// The CID version is taken from the CID when the settings leave it unset.
+			verifyOptions := test.options
+			verifyOptions.CidVersion = nil
+			if err := verifyContent(cid, content, verifyOptions); err != nil {
+				t.Fatalf("Expected the content to match %s: %v", cid, err)
+			}
+
+			tampered := append([]byte{}, content...)
+			tampered[len(tampered)-1] ^= 1
+			if err := verifyContent(cid, tampered, verifyOptions); !errors.Is(err, ErrCidMismatch) {
+				t.Fatalf("Expected ErrCidMismatch for tampered content, got %v", err)
+			}
+			if err := verifyContent(cid+"/model.bin", content, verifyOptions); err == nil {
+				t.Fatalf("Expected a path below the CID to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// MetadataSource provides the metadata records whose CIDs must stay pinned.
+// It is implemented by fabric_client.MetadataService.
+type MetadataSource interface {
+	GetAllParticipantModelMetadata() ([]shared.ParticipantModelMetadata, error)
+	GetAllAggregatorModelMetadata() ([]shared.AggregatorModelMetadata, error)
+}
+
+// PinStore is the IPFS node whose pins are reconciled. It is implemented by ipfs_client.IpfsClient.
+type PinStore interface {
+	ListPins(ctx context.Context) ([]string, error)
+	PinFile(ctx context.Context, cid string) error
+	UnpinFile(ctx context.Context, cid string) error
+}
+
+// Options configures a Reconciler.
+// UnpinOrphans - whether pins that are not referenced by any metadata record are removed.
+// This assumes the IPFS node is dedicated to the federation, since every other pin is an orphan too.
+// GracePeriod - how long a pin must stay unreferenced before it is removed. This protects models that
+// were added and pinned but whose metadata record has not been submitted yet.
+// Protected - CIDs that are never unpinned, e.g. pins made by other applications on the node.
+type Options struct {
+	UnpinOrphans bool
+	GracePeriod  time.Duration
+	Protected    []string
+}
+
+// CidError holds an operation that failed for a CID.
+type CidError struct {
+	Cid string `json:"cid"`
+	Err string `json:"error"`
+}
+
+// Reference is a metadata record referencing a CID.
+// Kind - "participant" or "aggregator".
+// Id - the participant's or aggregator's id.
+// Epoch - the epoch of the record.
+type Reference struct {
+	Cid   string `json:"cid"`
+	Kind  string `json:"kind"`
+	Id    int    `json:"id"`
+	Epoch int    `json:"epoch"`
+}
+
+// Report holds the outcome of a reconciliation run.
+// ReferencedCids - the number of distinct CIDs referenced by the metadata records.
+// PinnedCids - the number of recursive pins found on the node before reconciling.
+// Repinned - referenced CIDs that were missing a pin and have been pinned again.
+// RepinFailures - referenced CIDs that could not be pinned.
+// Orphans - unreferenced pins that are kept, because unpinning is disabled, they are protected or still in their grace period.
+// Unpinned - unreferenced pins that have been removed.
+// UnpinFailures - unreferenced pins that could not be removed.
+// InvalidReferences - metadata records whose CID could not be parsed.
+type Report struct {
+	StartedAt         time.Time   `json:"started_at"`
+	FinishedAt        time.Time   `json:"finished_at"`
+	ReferencedCids    int         `json:"referenced_cids"`
+	PinnedCids        int         `json:"pinned_cids"`
+	Repinned          []string    `json:"repinned"`
+	RepinFailures     []CidError  `json:"repin_failures"`
+	Orphans           []string    `json:"orphans"`
+	Unpinned          []string    `json:"unpinned"`
+	UnpinFailures     []CidError  `json:"unpin_failures"`
+	InvalidReferences []Reference `json:"invalid_references"`
+}
+
+// Reconciler keeps the pins of an IPFS node in line with the CIDs referenced on the ledger.
+// It remembers since when each orphaned pin has been unreferenced, so it is meant to be kept
+// and run periodically rather than recreated for every run.
+type Reconciler struct {
+	metadata MetadataSource
+	pins     PinStore
+	options  Options
+	now      func() time.Time
+
+	mu          sync.Mutex
+	orphanSince map[string]time.Time
+}
+
+// NewReconciler creates a reconciler for the pins of the given store against the given metadata.
+func NewReconciler(metadata MetadataSource, pins PinStore, options Options) *Reconciler {
+	return &Reconciler{
+		metadata:    metadata,
+		pins:        pins,
+		options:     options,
+		now:         time.Now,
+		orphanSince: map[string]time.Time{},
+	}
+}
+
+// Run lists the pins of the node, compares them against every CID referenced by participant and
+// aggregator model metadata, pins the referenced CIDs that are missing and, if enabled, unpins the
+// orphans whose grace period has passed. Failures for single CIDs are recorded in the report;
+// an error is only returned if the pins or the metadata could not be listed.
+func (r *Reconciler) Run(ctx context.Context) (*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{StartedAt: r.now()}
+
+	references, err := r.references()
+	if err != nil {
+		return nil, err
+	}
+
+	pinnedPaths, err := r.pins.ListPins(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pins: %w", err)
+	}
+	report.PinnedCids = len(pinnedPaths)
+
+	// CIDs are compared in a normalised form, the ledger and the node may use different CID versions.
+	pinned := map[string]string{}
+	for _, pinnedPath := range pinnedPaths {
+		key, err := normaliseCid(pinnedPath)
+		if err != nil {
+			continue
+		}
+		pinned[key] = pinnedPath
+	}
+
+	referenced := map[string]string{}
+	for _, reference := range references {
+		key, err := normaliseCid(reference.Cid)
+		if err != nil {
+			report.InvalidReferences = append(report.InvalidReferences, reference)
+			continue
+		}
+		referenced[key] = reference.Cid
+	}
+	report.ReferencedCids = len(referenced)
+
+	for _, key := range sortedKeys(referenced) {
+		if _, ok := pinned[key]; ok {
+			continue
+		}
+
+		cidStr := referenced[key]
+		if err := r.pins.PinFile(ctx, cidStr); err != nil {
+			report.RepinFailures = append(report.RepinFailures, CidError{Cid: cidStr, Err: err.Error()})
+			continue
+		}
+		report.Repinned = append(report.Repinned, cidStr)
+	}
+
+	protected := map[string]bool{}
+	for _, cidStr := range r.options.Protected {
+		if key, err := normaliseCid(cidStr); err == nil {
+			protected[key] = true
+		}
+	}
+
+	now := r.now()
+	for key := range r.orphanSince {
+		// A pin that got referenced again, or disappeared, is no longer an orphan.
+		if _, ok := referenced[key]; ok {
+			delete(r.orphanSince, key)
+		} else if _, ok := pinned[key]; !ok {
+			delete(r.orphanSince, key)
+		}
+	}
+
+	for _, key := range sortedKeys(pinned) {
+		if _, ok := referenced[key]; ok {
+			continue
+		}
+
+		cidStr := pinned[key]
+		since, ok := r.orphanSince[key]
+		if !ok {
+			since = now
+			r.orphanSince[key] = now
+		}
+
+		if !r.options.UnpinOrphans || protected[key] || now.Sub(since) < r.options.GracePeriod {
+			report.Orphans = append(report.Orphans, cidStr)
+			continue
+		}
+
+		if err := r.pins.UnpinFile(ctx, cidStr); err != nil {
+			report.UnpinFailures = append(report.UnpinFailures, CidError{Cid: cidStr, Err: err.Error()})
+			continue
+		}
+		delete(r.orphanSince, key)
+		report.Unpinned = append(report.Unpinned, cidStr)
+	}
+
+	report.FinishedAt = r.now()
+	return report, nil
+}
+
+// references collects the CIDs referenced by every participant and aggregator model metadata record.
+func (r *Reconciler) references() ([]Reference, error) {
+	participantMetadata, err := r.metadata.GetAllParticipantModelMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participant model metadata: %w", err)
+	}
+
+	aggregatorMetadata, err := r.metadata.GetAllAggregatorModelMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aggregator model metadata: %w", err)
+	}
+
+	references := make([]Reference, 0, len(participantMetadata)+len(aggregatorMetadata))
+	for _, metadata := range participantMetadata {
+		references = append(references, Reference{Cid: metadata.ModelHashCid, Kind: "participant", Id: metadata.ParticipantId, Epoch: metadata.Epoch})
+	}
+	for _, metadata := range aggregatorMetadata {
+		references = append(references, Reference{Cid: metadata.ModelHashCid, Kind: "aggregator", Id: metadata.AggregatorId, Epoch: metadata.Epoch})
+	}
+
+	return references, nil
+}
+
+// String returns a short human-readable summary of the report.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "reconciled %d referenced CIDs against %d pins in %s: ", r.ReferencedCids, r.PinnedCids, r.FinishedAt.Sub(r.StartedAt))
+	fmt.Fprintf(&b, "%d repinned, %d repin failures, %d orphans kept, %d unpinned, %d unpin failures, %d invalid references",
+		len(r.Repinned), len(r.RepinFailures), len(r.Orphans), len(r.Unpinned), len(r.UnpinFailures), len(r.InvalidReferences))
+	return b.String()
+}
+
+// normaliseCid parses a CID given as an IPFS path or a bare CID and returns its CIDv1 string,
+// so that the CIDv0 and CIDv1 forms of the same content compare equal.
+func normaliseCid(cidStr string) (string, error) {
+	c, err := cid.Decode(cidStr)
+	if err != nil {
+		ipfsPath, err := path.NewPath(cidStr)
+		if err != nil {
+			return "", err
+		}
+
+		immutablePath, err := path.NewImmutablePath(ipfsPath)
+		if err != nil {
+			return "", err
+		}
+
+		c = immutablePath.RootCid()
+	}
+
+	return cid.NewCidV1(c.Type(), c.Hash()).String(), nil
+}
+
+// sortedKeys returns the keys of the map in ascending order, so that reports are stable.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,171 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// testMetadata is an in-memory MetadataSource.
+type testMetadata struct {
+	participants []shared.ParticipantModelMetadata
+	aggregators  []shared.AggregatorModelMetadata
+}
+
+func (m *testMetadata) GetAllParticipantModelMetadata() ([]shared.ParticipantModelMetadata, error) {
+	return m.participants, nil
+}
+
+func (m *testMetadata) GetAllAggregatorModelMetadata() ([]shared.AggregatorModelMetadata, error) {
+	return m.aggregators, nil
+}
+
+// testPins is an in-memory PinStore keyed by IPFS path.
+type testPins struct {
+	pins map[string]bool
+}
+
+func (p *testPins) ListPins(ctx context.Context) ([]string, error) {
+	var cids []string
+	for cidStr := range p.pins {
+		cids = append(cids, cidStr)
+	}
+	return cids, nil
+}
+
+func (p *testPins) PinFile(ctx context.Context, cidStr string) error {
+	p.pins[cidStr] = true
+	return nil
+}
+
+func (p *testPins) UnpinFile(ctx context.Context, cidStr string) error {
+	if !p.pins[cidStr] {
+		return fmt.Errorf("%s is not pinned", cidStr)
+	}
+	delete(p.pins, cidStr)
+	return nil
+}
+
+// testCid returns the CIDv0 IPFS path of a piece of content.
+func testCid(t *testing.T, content string) string {
+	hash, err := mh.Sum([]byte(content), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatalf("Failed to hash content: %v", err)
+	}
+	return path.FromCid(cid.NewCidV0(hash)).String()
+}
+
+func TestReconcilerRepinsAndUnpinsAfterGracePeriod(t *testing.T) {
+	participantCid := testCid(t, "participant model")
+	aggregatorCid := testCid(t, "global model")
+	deletedCid := testCid(t, "deleted model")
+
+	metadata := &testMetadata{
+		participants: []shared.ParticipantModelMetadata{
+			{Epoch: 1, ParticipantId: 1, ModelHashCid: participantCid},
+			{Epoch: 1, ParticipantId: 2, ModelHashCid: "not-a-cid"},
+		},
+		aggregators: []shared.AggregatorModelMetadata{
+			{Epoch: 1, AggregatorId: 10, ModelHashCid: aggregatorCid},
+		},
+	}
+	pins := &testPins{pins: map[string]bool{participantCid: true, deletedCid: true}}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewReconciler(metadata, pins, Options{UnpinOrphans: true, GracePeriod: time.Hour})
+	r.now = func() time.Time { return now }
+
+	// First run: the global model is repinned, the deleted model's pin enters its grace period.
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	t.Logf("First run: %s", report)
+
+	if len(report.Repinned) != 1 || report.Repinned[0] != aggregatorCid {
+		t.Fatalf("Expected %s to be repinned, got %v", aggregatorCid, report.Repinned)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0] != deletedCid {
+		t.Fatalf("Expected %s to be kept as an orphan, got %v", deletedCid, report.Orphans)
+	}
+	if len(report.InvalidReferences) != 1 || report.InvalidReferences[0].Kind != "participant" || report.InvalidReferences[0].Id != 2 {
+		t.Fatalf("Expected the record of participant 2 to be reported as invalid, got %v", report.InvalidReferences)
+	}
+	if !pins.pins[aggregatorCid] || !pins.pins[deletedCid] {
+		t.Fatalf("Expected the global model and the orphan to be pinned, got %v", pins.pins)
+	}
+
+	// Second run after the grace period: the orphan is unpinned.
+	now = now.Add(2 * time.Hour)
+	report, err = r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	t.Logf("Second run: %s", report)
+
+	if len(report.Unpinned) != 1 || report.Unpinned[0] != deletedCid {
+		t.Fatalf("Expected %s to be unpinned, got %v", deletedCid, report.Unpinned)
+	}
+	if pins.pins[deletedCid] {
+		t.Fatalf("Expected %s to no longer be pinned", deletedCid)
+	}
+	if !pins.pins[participantCid] || !pins.pins[aggregatorCid] {
+		t.Fatalf("Expected referenced CIDs to stay pinned, got %v", pins.pins)
+	}
+}
+
+func TestReconcilerKeepsOrphansWhenDisabledOrProtected(t *testing.T) {
+	protectedCid := testCid(t, "protected")
+	orphanCid := testCid(t, "orphan")
+
+	pins := &testPins{pins: map[string]bool{protectedCid: true, orphanCid: true}}
+
+	r := NewReconciler(&testMetadata{}, pins, Options{})
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if len(report.Orphans) != 2 || len(report.Unpinned) != 0 {
+		t.Fatalf("Expected both orphans to be kept when unpinning is disabled, got %s", report)
+	}
+
+	r = NewReconciler(&testMetadata{}, pins, Options{UnpinOrphans: true, Protected: []string{protectedCid}})
+	report, err = r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if len(report.Unpinned) != 1 || report.Unpinned[0] != orphanCid {
+		t.Fatalf("Expected only %s to be unpinned, got %v", orphanCid, report.Unpinned)
+	}
+	if !pins.pins[protectedCid] {
+		t.Fatalf("Expected the protected CID to stay pinned")
+	}
+}
+
+func TestNormaliseCidMatchesVersions(t *testing.T) {
+	v0Path := testCid(t, "model")
+
+	v0, err := normaliseCid(v0Path)
+	if err != nil {
+		t.Fatalf("Failed to normalise %s: %v", v0Path, err)
+	}
+
+	c, err := cid.Decode(v0Path[len("/ipfs/"):])
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %v", v0Path, err)
+	}
+	v1, err := normaliseCid(cid.NewCidV1(cid.DagProtobuf, c.Hash()).String())
+	if err != nil {
+		t.Fatalf("Failed to normalise the CIDv1 form: %v", err)
+	}
+
+	if v0 != v1 {
+		t.Fatalf("Expected the CIDv0 and CIDv1 forms to match, got %s and %s", v0, v1)
+	}
+}
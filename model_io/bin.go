@@ -0,0 +1,46 @@
+package model_io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// DecodeBin reads raw little-endian int64 values.
+func DecodeBin(data []byte) ([]int64, error) {
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("raw model of %d bytes is not a multiple of 8 bytes", len(data))
+	}
+
+	values := make([]int64, len(data)/8)
+	for i := range values {
+		values[i] = int64(binary.LittleEndian.Uint64(data[8*i:]))
+	}
+
+	return values, nil
+}
+
+// EncodeBin writes values as raw little-endian int64 values.
+func EncodeBin(values []int64) []byte {
+	data := make([]byte, 8*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], uint64(value))
+	}
+
+	return data
+}
+
+// ReadBinFile reads the raw little-endian int64 values of a file, e.g. one generated by testing_utils/generate_model.
+func ReadBinFile(path string) ([]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model file: %w", err)
+	}
+
+	values, err := DecodeBin(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return values, nil
+}
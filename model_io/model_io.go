@@ -0,0 +1,212 @@
+package model_io
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// Format is a model file format.
+type Format string
+
+const (
+	// FormatNpy is a single NumPy array, read as a tensor named weight_pb.LegacyTensorName.
+	FormatNpy Format = "npy"
+	// FormatNpz is a NumPy archive of named arrays, as written by numpy.savez. It holds no architecture id or metadata.
+	FormatNpz Format = "npz"
+	// FormatSafetensors is the safetensors format of Hugging Face, whose metadata holds the architecture id under
+	// ArchitectureMetadataKey.
+	FormatSafetensors Format = "safetensors"
+	// FormatBin is a raw sequence of little-endian int64 values, as written by testing_utils/generate_model.
+	FormatBin Format = "bin"
+	// FormatProto is a serialised TensorModel, or a serialised WeightModel when read.
+	FormatProto Format = "pb"
+)
+
+// FormatFromPath returns the format of a file from its extension.
+func FormatFromPath(path string) (Format, error) {
+	format := Format(strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."))
+	switch format {
+	case FormatNpy, FormatNpz, FormatSafetensors, FormatBin, FormatProto:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown model format of file %s", path)
+	}
+}
+
+// Decode reads a model in the given format.
+func Decode(data []byte, format Format) (*weight_pb.TensorModel, error) {
+	switch format {
+	case FormatNpy:
+		tensor, err := DecodeNpy(weight_pb.LegacyTensorName, data)
+		if err != nil {
+			return nil, err
+		}
+		model := weight_pb.NewTensorModel("")
+		model.Tensors = []*weight_pb.Tensor{tensor}
+		return model, nil
+	case FormatNpz:
+		return DecodeNpz(data)
+	case FormatSafetensors:
+		return DecodeSafetensors(data)
+	case FormatBin:
+		values, err := DecodeBin(data)
+		if err != nil {
+			return nil, err
+		}
+		return weight_pb.FromWeightModel(&weight_pb.WeightModel{Values: values}), nil
+	case FormatProto:
+		return weight_pb.UnmarshalModel(data)
+	default:
+		return nil, fmt.Errorf("unknown model format %q", format)
+	}
+}
+
+// Encode writes a model in the given format. The npy and bin formats hold a single tensor, and the bin format only
+// integer values.
+func Encode(model *weight_pb.TensorModel, format Format) ([]byte, error) {
+	switch format {
+	case FormatNpy:
+		tensor, err := singleTensor(model, format)
+		if err != nil {
+			return nil, err
+		}
+		return EncodeNpy(tensor)
+	case FormatNpz:
+		return EncodeNpz(model)
+	case FormatSafetensors:
+		return EncodeSafetensors(model)
+	case FormatBin:
+		tensor, err := singleTensor(model, format)
+		if err != nil {
+			return nil, err
+		}
+		values, err := tensor.Int64s()
+		if err != nil {
+			return nil, err
+		}
+		return EncodeBin(values), nil
+	case FormatProto:
+		data, err := proto.Marshal(model)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal model: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown model format %q", format)
+	}
+}
+
+// ReadFile reads a model file, in the format given by its extension.
+func ReadFile(path string) (*weight_pb.TensorModel, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model file: %w", err)
+	}
+
+	return Decode(data, format)
+}
+
+// WriteFile writes a model file, in the format given by its extension.
+func WriteFile(path string, model *weight_pb.TensorModel) error {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := Encode(model, format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write model file: %w", err)
+	}
+
+	return nil
+}
+
+// singleTensor returns the only tensor of a model written in a format holding a single array.
+func singleTensor(model *weight_pb.TensorModel, format Format) (*weight_pb.Tensor, error) {
+	if len(model.GetTensors()) != 1 {
+		return nil, fmt.Errorf("the %s format holds a single tensor, the model has %d", format, len(model.GetTensors()))
+	}
+
+	return model.GetTensors()[0], nil
+}
+
+// elementType is the element type of an array in a file, which may differ from the dtypes of weight_pb.
+// kind - 'f' for IEEE floats, 'b' for bfloat16, 'i' for signed integers.
+// size - the size of an element in bytes.
+type elementType struct {
+	kind byte
+	size int
+}
+
+// decodeTensor creates a tensor from the elements of an array in a file. Elements are byte-swapped if big-endian,
+// float64 values are narrowed to float32 and int16 and int32 values are widened to int64.
+func decodeTensor(name string, shape []int64, elem elementType, bigEndian bool, data []byte) (*weight_pb.Tensor, error) {
+	n, err := weight_pb.NumElements(shape)
+	if err != nil {
+		return nil, fmt.Errorf("array %q: %w", name, err)
+	}
+	if n > math.MaxInt64/int64(elem.size) || int64(len(data)) != n*int64(elem.size) {
+		return nil, fmt.Errorf("array %q of shape %v has %d bytes of data", name, shape, len(data))
+	}
+
+	data = bytes.Clone(data)
+	if bigEndian {
+		for i := 0; i < len(data); i += elem.size {
+			element := data[i : i+elem.size]
+			for j := range elem.size / 2 {
+				element[j], element[elem.size-1-j] = element[elem.size-1-j], element[j]
+			}
+		}
+	}
+
+	var dtype weight_pb.DType
+	switch elem {
+	case elementType{'f', 2}:
+		dtype = weight_pb.DType_DTYPE_FLOAT16
+	case elementType{'f', 4}:
+		dtype = weight_pb.DType_DTYPE_FLOAT32
+	case elementType{'b', 2}:
+		dtype = weight_pb.DType_DTYPE_BFLOAT16
+	case elementType{'i', 1}:
+		dtype = weight_pb.DType_DTYPE_INT8
+	case elementType{'i', 8}:
+		dtype = weight_pb.DType_DTYPE_INT64
+	case elementType{'f', 8}:
+		values := make([]float32, n)
+		for i := range values {
+			values[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:])))
+		}
+		return weight_pb.NewFloat32Tensor(name, shape, values)
+	case elementType{'i', 2}, elementType{'i', 4}:
+		values := make([]int64, n)
+		for i := range values {
+			if elem.size == 2 {
+				values[i] = int64(int16(binary.LittleEndian.Uint16(data[2*i:])))
+			} else {
+				values[i] = int64(int32(binary.LittleEndian.Uint32(data[4*i:])))
+			}
+		}
+		return weight_pb.NewInt64Tensor(name, shape, values)
+	default:
+		return nil, fmt.Errorf("array %q has unsupported element type %c%d", name, elem.kind, elem.size)
+	}
+
+	return &weight_pb.Tensor{Name: name, Shape: append([]int64(nil), shape...), Dtype: dtype, Data: data}, nil
+}
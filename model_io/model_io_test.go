@@ -0,0 +1,225 @@
+package model_io
+
+import (
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// npyFile builds an npy file of version 1.0 the way NumPy writes it.
+func npyFile(header string, data []byte) []byte {
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n"
+	file := []byte("\x93NUMPY\x01\x00")
+	file = binary.LittleEndian.AppendUint16(file, uint16(len(header)))
+	file = append(file, header...)
+	return append(file, data...)
+}
+
+// newTestModel creates a model with tensors of every dtype.
+func newTestModel(t *testing.T) *weight_pb.TensorModel {
+	t.Helper()
+
+	model := weight_pb.NewTensorModel("mlp")
+	model.Metadata["framework"] = "pytorch"
+
+	float32Tensor, _ := weight_pb.NewFloat32Tensor("fc1.weight", []int64{2, 3}, []float32{1, -2, 3.5, 0, 1e-3, -7})
+	float16Tensor, _ := weight_pb.NewFloat16Tensor("fc1.bias", []int64{2}, []float32{0.5, -1})
+	bfloat16Tensor, _ := weight_pb.NewBFloat16Tensor("fc2.weight", []int64{1, 2}, []float32{2, -0.25})
+	int8Tensor, _ := weight_pb.NewInt8Tensor("mask", []int64{3}, []int8{-128, 0, 127})
+	int64Tensor, _ := weight_pb.NewInt64Tensor("steps", []int64{}, []int64{math.MaxInt64})
+	for _, tensor := range []*weight_pb.Tensor{float32Tensor, float16Tensor, bfloat16Tensor, int8Tensor, int64Tensor} {
+		if err := model.AddTensor(tensor); err != nil {
+			t.Fatalf("Failed to add tensor: %v", err)
+		}
+	}
+
+	return model
+}
+
+func TestDecodeNpy(t *testing.T) {
+	// numpy.arange(6, dtype="<f4").reshape(2, 3)
+	data := make([]byte, 0, 24)
+	for i := range 6 {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(i)))
+	}
+	tensor, err := DecodeNpy("x", npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }", data))
+	if err != nil {
+		t.Fatalf("Failed to decode npy: %v", err)
+	}
+	values, _ := tensor.Float32s()
+	if tensor.Dtype != weight_pb.DType_DTYPE_FLOAT32 || !slices.Equal(tensor.Shape, []int64{2, 3}) || !slices.Equal(values, []float32{0, 1, 2, 3, 4, 5}) {
+		t.Fatalf("Unexpected tensor %v", tensor)
+	}
+
+	// numpy.array([1.5, -2], dtype=">f8") is narrowed to float32.
+	data = binary.BigEndian.AppendUint64(nil, math.Float64bits(1.5))
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(-2))
+	tensor, err = DecodeNpy("x", npyFile("{'descr': '>f8', 'fortran_order': False, 'shape': (2,), }", data))
+	if err != nil {
+		t.Fatalf("Failed to decode npy: %v", err)
+	}
+	values, _ = tensor.Float32s()
+	if tensor.Dtype != weight_pb.DType_DTYPE_FLOAT32 || !slices.Equal(values, []float32{1.5, -2}) {
+		t.Fatalf("Unexpected tensor %v", tensor)
+	}
+
+	// numpy.array([-1, 2], dtype="<i4") is widened to int64.
+	data = binary.LittleEndian.AppendUint32(nil, uint32(0xffffffff))
+	data = binary.LittleEndian.AppendUint32(data, 2)
+	tensor, err = DecodeNpy("x", npyFile("{'descr': '<i4', 'fortran_order': False, 'shape': (2,), }", data))
+	if err != nil {
+		t.Fatalf("Failed to decode npy: %v", err)
+	}
+	ints, _ := tensor.Int64s()
+	if !slices.Equal(ints, []int64{-1, 2}) {
+		t.Fatalf("Unexpected values %v", ints)
+	}
+
+	invalid := map[string][]byte{
+		"fortran order": npyFile("{'descr': '<f4', 'fortran_order': True, 'shape': (1, 2), }", make([]byte, 8)),
+		"complex":       npyFile("{'descr': '<c8', 'fortran_order': False, 'shape': (1,), }", make([]byte, 8)),
+		"short data":    npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (3,), }", make([]byte, 8)),
+		"not npy":       []byte("PK\x03\x04"),
+	}
+	for name, data := range invalid {
+		if _, err := DecodeNpy("x", data); err == nil {
+			t.Fatalf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestEncodeNpy(t *testing.T) {
+	model := newTestModel(t)
+	for _, tensor := range model.Tensors {
+		data, err := EncodeNpy(tensor)
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", tensor.Name, err)
+		}
+		if headerEnd := 10 + int(binary.LittleEndian.Uint16(data[8:])); headerEnd%64 != 0 || data[headerEnd-1] != '\n' {
+			t.Fatalf("Header of %s is not padded to 64 bytes", tensor.Name)
+		}
+
+		decoded, err := DecodeNpy(tensor.Name, data)
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", tensor.Name, err)
+		}
+		if tensor.Dtype == weight_pb.DType_DTYPE_BFLOAT16 {
+			// NumPy has no bfloat16, the values come back as float32.
+			expected, _ := tensor.Float32s()
+			values, _ := decoded.Float32s()
+			if decoded.Dtype != weight_pb.DType_DTYPE_FLOAT32 || !slices.Equal(values, expected) {
+				t.Fatalf("Unexpected tensor %v", decoded)
+			}
+			continue
+		}
+		if !proto.Equal(decoded, tensor) {
+			t.Fatalf("Expected %v, got %v", tensor, decoded)
+		}
+	}
+}
+
+func TestSafetensorsRoundTrip(t *testing.T) {
+	model := newTestModel(t)
+
+	data, err := EncodeSafetensors(model)
+	if err != nil {
+		t.Fatalf("Failed to encode safetensors: %v", err)
+	}
+	if headerSize := binary.LittleEndian.Uint64(data); headerSize%8 != 0 {
+		t.Fatalf("Expected the header to be padded to 8 bytes, got %d", headerSize)
+	}
+
+	decoded, err := DecodeSafetensors(data)
+	if err != nil {
+		t.Fatalf("Failed to decode safetensors: %v", err)
+	}
+	if !proto.Equal(decoded, model) {
+		t.Fatalf("Expected %v, got %v", model, decoded)
+	}
+}
+
+func TestDecodeSafetensors(t *testing.T) {
+	// As written by safetensors.torch.save_file, with the data of "b" before that of "a".
+	header := `{"a":{"dtype":"F32","shape":[1],"data_offsets":[8,12]},"b":{"dtype":"I32","shape":[2],"data_offsets":[0,8]},"__metadata__":{"format":"pt"}}`
+	data := binary.LittleEndian.AppendUint64(nil, uint64(len(header)))
+	data = append(data, header...)
+	data = binary.LittleEndian.AppendUint32(data, 7)
+	data = binary.LittleEndian.AppendUint32(data, uint32(0xfffffff9))
+	data = binary.LittleEndian.AppendUint32(data, math.Float32bits(0.5))
+
+	model, err := DecodeSafetensors(data)
+	if err != nil {
+		t.Fatalf("Failed to decode safetensors: %v", err)
+	}
+	if len(model.Tensors) != 2 || model.Tensors[0].Name != "b" || model.Metadata["format"] != "pt" {
+		t.Fatalf("Unexpected model %v", model)
+	}
+	ints, _ := model.Tensor("b").Int64s()
+	floats, _ := model.Tensor("a").Float32s()
+	if !slices.Equal(ints, []int64{7, -7}) || !slices.Equal(floats, []float32{0.5}) {
+		t.Fatalf("Unexpected values %v and %v", ints, floats)
+	}
+
+	binary.LittleEndian.PutUint64(data, uint64(len(data)))
+	if _, err := DecodeSafetensors(data); err == nil {
+		t.Fatalf("Expected a header larger than the file to be rejected")
+	}
+}
+
+func TestFilesRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	model := newTestModel(t)
+
+	for _, file := range []string{"model.safetensors", "model.pb"} {
+		path := filepath.Join(dir, file)
+		if err := WriteFile(path, model); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+		read, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		if !proto.Equal(read, model) {
+			t.Fatalf("Expected %v from %s, got %v", model, file, read)
+		}
+	}
+
+	// npz archives keep the tensors but not the architecture id or the metadata.
+	model.Tensors = slices.DeleteFunc(model.Tensors, func(tensor *weight_pb.Tensor) bool {
+		return tensor.Dtype == weight_pb.DType_DTYPE_BFLOAT16
+	})
+	path := filepath.Join(dir, "model.npz")
+	if err := WriteFile(path, model); err != nil {
+		t.Fatalf("Failed to write npz: %v", err)
+	}
+	read, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read npz: %v", err)
+	}
+	if !proto.Equal(read, &weight_pb.TensorModel{Metadata: map[string]string{}, Tensors: model.Tensors}) {
+		t.Fatalf("Unexpected model %v", read)
+	}
+
+	// The bin format holds the values of a WeightModel.
+	path = filepath.Join(dir, "data_3.bin")
+	if err := WriteFile(path, weight_pb.FromWeightModel(&weight_pb.WeightModel{Values: []int64{1, -2, 3}})); err != nil {
+		t.Fatalf("Failed to write bin: %v", err)
+	}
+	values, err := ReadBinFile(path)
+	if err != nil || !slices.Equal(values, []int64{1, -2, 3}) {
+		t.Fatalf("Expected [1 -2 3], got %v (%v)", values, err)
+	}
+	if err := WriteFile(path, model); err == nil {
+		t.Fatalf("Expected a model of several tensors not to be written as bin")
+	}
+
+	if _, err := ReadFile(filepath.Join(dir, "model.onnx")); err == nil {
+		t.Fatalf("Expected an unknown format to be rejected")
+	}
+}
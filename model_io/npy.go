@@ -0,0 +1,237 @@
+package model_io
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// npyMagic starts every npy file, followed by the major and minor version of the format.
+const npyMagic = "\x93NUMPY"
+
+var (
+	npyDescr        = regexp.MustCompile(`['"]descr['"]\s*:\s*['"]([^'"]*)['"]`)
+	npyFortranOrder = regexp.MustCompile(`['"]fortran_order['"]\s*:\s*(True|False)`)
+	npyShape        = regexp.MustCompile(`['"]shape['"]\s*:\s*\(([^)]*)\)`)
+)
+
+// DecodeNpy reads a NumPy array into a tensor with the given name. Arrays of float16, float32, float64, int8, int16,
+// int32 and int64 are supported, in C order and either byte order.
+func DecodeNpy(name string, data []byte) (*weight_pb.Tensor, error) {
+	if len(data) < len(npyMagic)+4 || string(data[:len(npyMagic)]) != npyMagic {
+		return nil, fmt.Errorf("array %q is not an npy file", name)
+	}
+
+	major := data[len(npyMagic)]
+	offset := len(npyMagic) + 2
+	var headerLength int
+	switch major {
+	case 1:
+		headerLength = int(binary.LittleEndian.Uint16(data[offset:]))
+		offset += 2
+	case 2, 3:
+		if len(data) < offset+4 {
+			return nil, fmt.Errorf("array %q has a truncated header", name)
+		}
+		headerLength = int(binary.LittleEndian.Uint32(data[offset:]))
+		offset += 4
+	default:
+		return nil, fmt.Errorf("array %q has unsupported npy version %d", name, major)
+	}
+	if headerLength < 0 || len(data)-offset < headerLength {
+		return nil, fmt.Errorf("array %q has a truncated header", name)
+	}
+	header := string(data[offset : offset+headerLength])
+
+	descr := npyDescr.FindStringSubmatch(header)
+	fortranOrder := npyFortranOrder.FindStringSubmatch(header)
+	shapeMatch := npyShape.FindStringSubmatch(header)
+	if descr == nil || fortranOrder == nil || shapeMatch == nil {
+		return nil, fmt.Errorf("array %q has an invalid header %q", name, header)
+	}
+
+	shape, err := parseNpyShape(shapeMatch[1])
+	if err != nil {
+		return nil, fmt.Errorf("array %q: %w", name, err)
+	}
+	if fortranOrder[1] == "True" && len(shape) > 1 {
+		return nil, fmt.Errorf("array %q is in Fortran order, only C order is supported", name)
+	}
+
+	elem, bigEndian, err := parseNpyDescr(descr[1])
+	if err != nil {
+		return nil, fmt.Errorf("array %q: %w", name, err)
+	}
+
+	return decodeTensor(name, shape, elem, bigEndian, data[offset+headerLength:])
+}
+
+// EncodeNpy writes a tensor as a NumPy array. NumPy has no bfloat16, so bfloat16 tensors are written as float32.
+func EncodeNpy(tensor *weight_pb.Tensor) ([]byte, error) {
+	if err := tensor.Validate(); err != nil {
+		return nil, err
+	}
+
+	descr, data := "", tensor.GetData()
+	switch tensor.GetDtype() {
+	case weight_pb.DType_DTYPE_FLOAT32:
+		descr = "<f4"
+	case weight_pb.DType_DTYPE_FLOAT16:
+		descr = "<f2"
+	case weight_pb.DType_DTYPE_INT8:
+		descr = "|i1"
+	case weight_pb.DType_DTYPE_INT64:
+		descr = "<i8"
+	case weight_pb.DType_DTYPE_BFLOAT16:
+		values, err := tensor.Float32s()
+		if err != nil {
+			return nil, err
+		}
+		converted, err := weight_pb.NewFloat32Tensor(tensor.GetName(), tensor.GetShape(), values)
+		if err != nil {
+			return nil, err
+		}
+		descr, data = "<f4", converted.GetData()
+	}
+
+	dims := make([]string, len(tensor.GetShape()))
+	for i, dim := range tensor.GetShape() {
+		dims[i] = strconv.FormatInt(dim, 10)
+	}
+	shape := "(" + strings.Join(dims, ", ") + ")"
+	if len(dims) == 1 {
+		shape = "(" + dims[0] + ",)"
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': %s, }", descr, shape)
+
+	// Like NumPy, pad the header with spaces and a newline so that the data starts at a multiple of 64 bytes.
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	prefix := len(npyMagic) + 4
+	if len(header) >= 65535-64 {
+		prefix += 2
+	}
+	header += strings.Repeat(" ", 63-(prefix+len(header))%64) + "\n"
+	if prefix == len(npyMagic)+4 {
+		buf.Write([]byte{1, 0})
+		buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(header))))
+	} else {
+		buf.Write([]byte{2, 0})
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(header))))
+	}
+	buf.WriteString(header)
+	buf.Write(data)
+
+	return buf.Bytes(), nil
+}
+
+// DecodeNpz reads a NumPy archive, as written by numpy.savez or numpy.savez_compressed, into a model with one
+// tensor per array, named after the array.
+func DecodeNpz(data []byte) (*weight_pb.TensorModel, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open npz archive: %w", err)
+	}
+
+	model := weight_pb.NewTensorModel("")
+	for _, file := range archive.File {
+		name, ok := strings.CutSuffix(file.Name, ".npy")
+		if !ok {
+			return nil, fmt.Errorf("npz archive holds %s, which is not an npy file", file.Name)
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in npz archive: %w", file.Name, err)
+		}
+		arrayData, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in npz archive: %w", file.Name, err)
+		}
+
+		tensor, err := DecodeNpy(name, arrayData)
+		if err != nil {
+			return nil, err
+		}
+		if err := model.AddTensor(tensor); err != nil {
+			return nil, err
+		}
+	}
+
+	return model, nil
+}
+
+// EncodeNpz writes the tensors of a model as a NumPy archive, like numpy.savez. The architecture id and the metadata
+// of the model are not kept.
+func EncodeNpz(model *weight_pb.TensorModel) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for _, tensor := range model.GetTensors() {
+		arrayData, err := EncodeNpy(tensor)
+		if err != nil {
+			return nil, err
+		}
+
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: tensor.GetName() + ".npy", Method: zip.Store})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to npz archive: %w", tensor.GetName(), err)
+		}
+		if _, err := writer.Write(arrayData); err != nil {
+			return nil, fmt.Errorf("failed to add %s to npz archive: %w", tensor.GetName(), err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write npz archive: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseNpyShape parses the elements of the shape tuple of an npy header, e.g. "3, 4" or "3,".
+func parseNpyShape(tuple string) ([]int64, error) {
+	shape := []int64{}
+	for _, dim := range strings.Split(tuple, ",") {
+		dim = strings.TrimSpace(dim)
+		if dim == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(strings.TrimSuffix(dim, "L"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shape (%s): %w", tuple, err)
+		}
+		shape = append(shape, value)
+	}
+
+	return shape, nil
+}
+
+// parseNpyDescr parses a NumPy type string, e.g. "<f4", into an element type and whether it is big-endian.
+func parseNpyDescr(descr string) (elementType, bool, error) {
+	if len(descr) < 3 {
+		return elementType{}, false, fmt.Errorf("unsupported dtype %q", descr)
+	}
+
+	size, err := strconv.Atoi(descr[2:])
+	if err != nil || (descr[1] != 'f' && descr[1] != 'i') {
+		return elementType{}, false, fmt.Errorf("unsupported dtype %q", descr)
+	}
+
+	switch descr[0] {
+	case '<', '|', '=':
+		return elementType{descr[1], size}, false, nil
+	case '>':
+		return elementType{descr[1], size}, true, nil
+	default:
+		return elementType{}, false, fmt.Errorf("unsupported dtype %q", descr)
+	}
+}
@@ -0,0 +1,159 @@
+package model_io
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// ArchitectureMetadataKey is the key of the safetensors metadata holding the architecture id of a model.
+const ArchitectureMetadataKey = "architecture_id"
+
+// maxSafetensorsHeaderSize bounds the JSON header of a safetensors file, like the reference implementation.
+const maxSafetensorsHeaderSize = 100 << 20
+
+// safetensorsDTypes maps the safetensors dtypes that can be read to their element types.
+var safetensorsDTypes = map[string]elementType{
+	"F16":  {'f', 2},
+	"BF16": {'b', 2},
+	"F32":  {'f', 4},
+	"F64":  {'f', 8},
+	"I8":   {'i', 1},
+	"I16":  {'i', 2},
+	"I32":  {'i', 4},
+	"I64":  {'i', 8},
+}
+
+// safetensorsTensor is the entry of a tensor in the header of a safetensors file.
+type safetensorsTensor struct {
+	Dtype       string   `json:"dtype"`
+	Shape       []int64  `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// DecodeSafetensors reads a safetensors file into a model. Tensors keep the order of their data in the file, and
+// the metadata of the file becomes the metadata of the model, except for ArchitectureMetadataKey.
+func DecodeSafetensors(data []byte) (*weight_pb.TensorModel, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("safetensors file of %d bytes has no header", len(data))
+	}
+	headerSize := binary.LittleEndian.Uint64(data)
+	if headerSize > maxSafetensorsHeaderSize || headerSize > uint64(len(data)-8) {
+		return nil, fmt.Errorf("safetensors file of %d bytes has a header of %d bytes", len(data), headerSize)
+	}
+	buffer := data[8+headerSize:]
+
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(data[8:8+headerSize], &header); err != nil {
+		return nil, fmt.Errorf("failed to parse safetensors header: %w", err)
+	}
+
+	model := weight_pb.NewTensorModel("")
+	if rawMetadata, ok := header["__metadata__"]; ok {
+		if err := json.Unmarshal(rawMetadata, &model.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse safetensors metadata: %w", err)
+		}
+		model.ArchitectureId = model.Metadata[ArchitectureMetadataKey]
+		delete(model.Metadata, ArchitectureMetadataKey)
+		delete(header, "__metadata__")
+	}
+
+	entries := make(map[string]safetensorsTensor, len(header))
+	for name, rawEntry := range header {
+		var entry safetensorsTensor
+		if err := json.Unmarshal(rawEntry, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse safetensors entry of %q: %w", name, err)
+		}
+		begin, end := entry.DataOffsets[0], entry.DataOffsets[1]
+		if begin < 0 || begin > end || end > int64(len(buffer)) {
+			return nil, fmt.Errorf("tensor %q has data offsets %v outside of the %d bytes of data", name, entry.DataOffsets, len(buffer))
+		}
+		entries[name] = entry
+	}
+
+	names := slices.SortedFunc(maps.Keys(entries), func(a, b string) int {
+		return cmp.Compare(entries[a].DataOffsets[0], entries[b].DataOffsets[0])
+	})
+	for _, name := range names {
+		entry := entries[name]
+		elem, ok := safetensorsDTypes[entry.Dtype]
+		if !ok {
+			return nil, fmt.Errorf("tensor %q has unsupported dtype %s", name, entry.Dtype)
+		}
+
+		tensor, err := decodeTensor(name, entry.Shape, elem, false, buffer[entry.DataOffsets[0]:entry.DataOffsets[1]])
+		if err != nil {
+			return nil, err
+		}
+		if err := model.AddTensor(tensor); err != nil {
+			return nil, err
+		}
+	}
+
+	return model, nil
+}
+
+// EncodeSafetensors writes a model as a safetensors file, storing its architecture id in the metadata under
+// ArchitectureMetadataKey.
+func EncodeSafetensors(model *weight_pb.TensorModel) ([]byte, error) {
+	header := map[string]any{}
+	metadata := maps.Clone(model.GetMetadata())
+	if model.GetArchitectureId() != "" {
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[ArchitectureMetadataKey] = model.GetArchitectureId()
+	}
+	if len(metadata) > 0 {
+		header["__metadata__"] = metadata
+	}
+
+	var buffer bytes.Buffer
+	for _, tensor := range model.GetTensors() {
+		if err := tensor.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := header[tensor.GetName()]; ok {
+			return nil, fmt.Errorf("model has several tensors named %q", tensor.GetName())
+		}
+
+		var dtype string
+		switch tensor.GetDtype() {
+		case weight_pb.DType_DTYPE_FLOAT32:
+			dtype = "F32"
+		case weight_pb.DType_DTYPE_FLOAT16:
+			dtype = "F16"
+		case weight_pb.DType_DTYPE_BFLOAT16:
+			dtype = "BF16"
+		case weight_pb.DType_DTYPE_INT8:
+			dtype = "I8"
+		case weight_pb.DType_DTYPE_INT64:
+			dtype = "I64"
+		}
+
+		begin := int64(buffer.Len())
+		buffer.Write(tensor.GetData())
+		header[tensor.GetName()] = safetensorsTensor{
+			Dtype:       dtype,
+			Shape:       append([]int64{}, tensor.GetShape()...),
+			DataOffsets: [2]int64{begin, int64(buffer.Len())},
+		}
+	}
+
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal safetensors header: %w", err)
+	}
+	// Pad the header with spaces so that the data is aligned on 8 bytes.
+	headerData = append(headerData, bytes.Repeat([]byte(" "), (8-len(headerData)%8)%8)...)
+
+	data := binary.LittleEndian.AppendUint64(nil, uint64(len(headerData)))
+	data = append(data, headerData...)
+	return append(data, buffer.Bytes()...), nil
+}
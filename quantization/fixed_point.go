@@ -0,0 +1,101 @@
+package quantization
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// FixedPoint encodes floats as int64 values scaled by 2^FractionalBits, the integer domain used by the
+// homomorphic hash and the encryption schemes, in which models are summed without overflow as long as
+// the scaled values leave enough headroom, see FractionalBitsFor.
+// Stochastic and Rand select the rounding, like in Options.
+type FixedPoint struct {
+	FractionalBits int
+	Stochastic     bool
+	Rand           *rand.Rand
+}
+
+// FractionalBitsFor returns the largest number of fractional bits with which a sum of summands values of magnitude
+// at most maxAbs still fits in an int64.
+func FractionalBitsFor(maxAbs float64, summands int) (int, error) {
+	if maxAbs <= 0 || math.IsInf(maxAbs, 0) || math.IsNaN(maxAbs) || summands <= 0 {
+		return 0, fmt.Errorf("invalid bound %g for %d summands", maxAbs, summands)
+	}
+
+	// A sum of summands values below maxAbs is below summands * maxAbs, which must stay below 2^63 once scaled.
+	magnitude := math.Log2(maxAbs) + math.Log2(float64(summands))
+	if magnitude >= 62 {
+		return 0, fmt.Errorf("a sum of %d values up to %g does not fit an int64", summands, maxAbs)
+	}
+
+	return min(int(math.Floor(62-magnitude)), 62), nil
+}
+
+// Encode scales and rounds float values to int64 values.
+func (f FixedPoint) Encode(values []float32) ([]int64, error) {
+	if f.FractionalBits < 0 || f.FractionalBits > 62 {
+		return nil, fmt.Errorf("invalid number of fractional bits %d", f.FractionalBits)
+	}
+
+	scale := math.Ldexp(1, f.FractionalBits)
+	opts := Options{Stochastic: f.Stochastic, Rand: f.Rand}
+
+	encoded := make([]int64, len(values))
+	for i, value := range values {
+		scaled := round(float64(value)*scale, opts)
+		// float64(math.MaxInt64) is 2^63, which does not fit an int64 itself.
+		if math.IsNaN(scaled) || scaled >= math.MaxInt64 || scaled < math.MinInt64 {
+			return nil, fmt.Errorf("value %v does not fit an int64 with %d fractional bits", value, f.FractionalBits)
+		}
+		encoded[i] = int64(scaled)
+	}
+
+	return encoded, nil
+}
+
+// Decode converts int64 values back to floats.
+func (f FixedPoint) Decode(encoded []int64) []float32 {
+	scale := math.Ldexp(1, -f.FractionalBits)
+
+	values := make([]float32, len(encoded))
+	for i, value := range encoded {
+		values[i] = float32(float64(value) * scale)
+	}
+
+	return values
+}
+
+// EncodeTensor encodes a float tensor as an int64 tensor.
+func (f FixedPoint) EncodeTensor(tensor *weight_pb.Tensor) (*weight_pb.Tensor, error) {
+	if !isFloat(tensor.GetDtype()) {
+		return nil, fmt.Errorf("tensor %q has dtype %v, only float tensors can be encoded", tensor.GetName(), tensor.GetDtype())
+	}
+
+	values, err := tensor.Float32s()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := f.Encode(values)
+	if err != nil {
+		return nil, fmt.Errorf("tensor %q: %w", tensor.GetName(), err)
+	}
+
+	return weight_pb.NewInt64Tensor(tensor.GetName(), tensor.GetShape(), encoded)
+}
+
+// DecodeTensor decodes an int64 tensor into a float32 tensor.
+func (f FixedPoint) DecodeTensor(tensor *weight_pb.Tensor) (*weight_pb.Tensor, error) {
+	if tensor.GetDtype() != weight_pb.DType_DTYPE_INT64 {
+		return nil, fmt.Errorf("tensor %q has dtype %v, expected int64", tensor.GetName(), tensor.GetDtype())
+	}
+
+	encoded, err := tensor.Int64s()
+	if err != nil {
+		return nil, err
+	}
+
+	return weight_pb.NewFloat32Tensor(tensor.GetName(), tensor.GetShape(), f.Decode(encoded))
+}
@@ -0,0 +1,63 @@
+package quantization
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFixedPointRoundTrip(t *testing.T) {
+	fixedPoint := FixedPoint{FractionalBits: 16}
+	values := []float32{0, 1, -1, 0.5, 3.14159, -1234.5678, 1e-6}
+
+	encoded, err := fixedPoint.Encode(values)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if encoded[1] != 1<<16 || encoded[2] != -(1<<16) || encoded[6] != 0 {
+		t.Fatalf("Unexpected encoding %v", encoded)
+	}
+
+	decoded := fixedPoint.Decode(encoded)
+	for i := range values {
+		if math.Abs(float64(decoded[i]-values[i])) > math.Ldexp(1, -17)*1.001 {
+			t.Fatalf("Value %v came back as %v", values[i], decoded[i])
+		}
+	}
+
+	if _, err := (FixedPoint{FractionalBits: 62}).Encode([]float32{4}); err == nil {
+		t.Fatalf("Expected a value overflowing an int64 to be rejected")
+	}
+}
+
+func TestFractionalBitsFor(t *testing.T) {
+	bits, err := FractionalBitsFor(10, 1000)
+	if err != nil {
+		t.Fatalf("Failed to compute fractional bits: %v", err)
+	}
+
+	// The sum of 1000 values of 10 must fit.
+	fixedPoint := FixedPoint{FractionalBits: bits}
+	values := make([]float32, 1000)
+	for i := range values {
+		values[i] = 10
+	}
+	encoded, err := fixedPoint.Encode(values)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	var sum int64
+	for _, value := range encoded {
+		if sum > math.MaxInt64-value {
+			t.Fatalf("Sum overflows with %d fractional bits", bits)
+		}
+		sum += value
+	}
+	if decoded := fixedPoint.Decode([]int64{sum}); decoded[0] != 10000 {
+		t.Fatalf("Expected a sum of 10000, got %v", decoded[0])
+	}
+
+	if _, err := FractionalBitsFor(math.MaxFloat64, 2); err == nil {
+		t.Fatalf("Expected a bound beyond the int64 range to be rejected")
+	}
+}
@@ -0,0 +1,242 @@
+package quantization
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// Options holds how float tensors are quantized.
+// Bits - the bits per quantized element, 8 or 4.
+// PerChannel - whether each slice along the first dimension gets its own scale and zero point, instead of one
+// for the whole tensor. This keeps the error low when channels have very different ranges.
+// Stochastic - whether values are rounded up or down at random, with probabilities making the rounding unbiased,
+// instead of to the nearest level. Errors then average out when many updates are aggregated.
+// Rand - the source of randomness of stochastic rounding, the global source if nil.
+type Options struct {
+	Bits       int
+	PerChannel bool
+	Stochastic bool
+	Rand       *rand.Rand
+}
+
+// QuantizeModel quantizes the float tensors of a model. Integer tensors are kept as they are.
+func QuantizeModel(model *weight_pb.TensorModel, opts Options) (*weight_pb.QuantizedModel, error) {
+	quantized := &weight_pb.QuantizedModel{ArchitectureId: model.GetArchitectureId(), Metadata: maps.Clone(model.GetMetadata())}
+
+	for _, tensor := range model.GetTensors() {
+		if !isFloat(tensor.GetDtype()) {
+			if err := tensor.Validate(); err != nil {
+				return nil, err
+			}
+			quantized.Tensors = append(quantized.Tensors, &weight_pb.QuantizedModelTensor{
+				Encoding: &weight_pb.QuantizedModelTensor_Raw{Raw: tensor},
+			})
+			continue
+		}
+
+		quantizedTensor, err := QuantizeTensor(tensor, opts)
+		if err != nil {
+			return nil, err
+		}
+		quantized.Tensors = append(quantized.Tensors, &weight_pb.QuantizedModelTensor{
+			Encoding: &weight_pb.QuantizedModelTensor_Quantized{Quantized: quantizedTensor},
+		})
+	}
+
+	return quantized, nil
+}
+
+// DequantizeModel restores the tensors of a quantized model in their original dtypes.
+func DequantizeModel(quantized *weight_pb.QuantizedModel) (*weight_pb.TensorModel, error) {
+	model := weight_pb.NewTensorModel(quantized.GetArchitectureId())
+	maps.Copy(model.Metadata, quantized.GetMetadata())
+
+	for _, quantizedTensor := range quantized.GetTensors() {
+		var tensor *weight_pb.Tensor
+		switch {
+		case quantizedTensor.GetRaw() != nil:
+			tensor = quantizedTensor.GetRaw()
+		case quantizedTensor.GetQuantized() != nil:
+			var err error
+			if tensor, err = DequantizeTensor(quantizedTensor.GetQuantized()); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("quantized model tensor holds no tensor")
+		}
+
+		if err := model.AddTensor(tensor); err != nil {
+			return nil, err
+		}
+	}
+
+	return model, nil
+}
+
+// QuantizeTensor quantizes a float tensor with an affine mapping onto 2^bits levels. The range of each group of
+// values, the whole tensor or a channel, is widened to include zero so that zero is represented exactly.
+func QuantizeTensor(tensor *weight_pb.Tensor, opts Options) (*weight_pb.QuantizedTensor, error) {
+	if opts.Bits != 8 && opts.Bits != 4 {
+		return nil, fmt.Errorf("unsupported number of bits %d, expected 8 or 4", opts.Bits)
+	}
+	if !isFloat(tensor.GetDtype()) {
+		return nil, fmt.Errorf("tensor %q has dtype %v, only float tensors can be quantized", tensor.GetName(), tensor.GetDtype())
+	}
+
+	values, err := tensor.Float32s()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+			return nil, fmt.Errorf("tensor %q holds %v, which cannot be quantized", tensor.GetName(), value)
+		}
+	}
+
+	channels := 1
+	if opts.PerChannel && len(tensor.GetShape()) > 0 && tensor.GetShape()[0] > 0 {
+		channels = int(tensor.GetShape()[0])
+	}
+	channelSize := len(values) / channels
+
+	quantized := &weight_pb.QuantizedTensor{
+		Name:  tensor.GetName(),
+		Shape: tensor.GetShape(),
+		Dtype: tensor.GetDtype(),
+		Bits:  int32(opts.Bits),
+	}
+	levels := make([]uint8, len(values))
+	qmax := float64(int(1)<<opts.Bits - 1)
+
+	for channel := range channels {
+		group := values[channel*channelSize : (channel+1)*channelSize]
+		scale, zeroPoint := affineParameters(group, qmax)
+		quantized.Scales = append(quantized.Scales, float32(scale))
+		quantized.ZeroPoints = append(quantized.ZeroPoints, int32(zeroPoint))
+
+		// The stored float32 scale is used, so that dequantization inverts exactly this mapping.
+		scale = float64(float32(scale))
+		for i, value := range group {
+			level := round(float64(value)/scale, opts) + zeroPoint
+			levels[channel*channelSize+i] = uint8(min(max(level, 0), qmax))
+		}
+	}
+
+	quantized.Data = pack(levels, opts.Bits)
+	return quantized, nil
+}
+
+// DequantizeTensor restores a quantized tensor in its original dtype.
+func DequantizeTensor(quantized *weight_pb.QuantizedTensor) (*weight_pb.Tensor, error) {
+	n, err := weight_pb.NumElements(quantized.GetShape())
+	if err != nil {
+		return nil, fmt.Errorf("quantized tensor %q: %w", quantized.GetName(), err)
+	}
+
+	bits := int(quantized.GetBits())
+	if bits != 8 && bits != 4 {
+		return nil, fmt.Errorf("quantized tensor %q has unsupported number of bits %d", quantized.GetName(), bits)
+	}
+	if int64(len(quantized.GetData())) != (n*int64(bits)+7)/8 {
+		return nil, fmt.Errorf("quantized tensor %q of shape %v has %d bytes of data", quantized.GetName(), quantized.GetShape(), len(quantized.GetData()))
+	}
+
+	channels := len(quantized.GetScales())
+	if channels == 0 || channels != len(quantized.GetZeroPoints()) || n%int64(channels) != 0 ||
+		(channels > 1 && (len(quantized.GetShape()) == 0 || quantized.GetShape()[0] != int64(channels))) {
+		return nil, fmt.Errorf("quantized tensor %q has %d scales and %d zero points for shape %v",
+			quantized.GetName(), channels, len(quantized.GetZeroPoints()), quantized.GetShape())
+	}
+	channelSize := int(n) / channels
+
+	levels := unpack(quantized.GetData(), bits, int(n))
+	values := make([]float32, n)
+	for i, level := range levels {
+		channel := i / channelSize
+		values[i] = float32((float64(level) - float64(quantized.GetZeroPoints()[channel])) * float64(quantized.GetScales()[channel]))
+	}
+
+	switch quantized.GetDtype() {
+	case weight_pb.DType_DTYPE_FLOAT16:
+		return weight_pb.NewFloat16Tensor(quantized.GetName(), quantized.GetShape(), values)
+	case weight_pb.DType_DTYPE_BFLOAT16:
+		return weight_pb.NewBFloat16Tensor(quantized.GetName(), quantized.GetShape(), values)
+	case weight_pb.DType_DTYPE_FLOAT32:
+		return weight_pb.NewFloat32Tensor(quantized.GetName(), quantized.GetShape(), values)
+	default:
+		return nil, fmt.Errorf("quantized tensor %q has dtype %v, not a float dtype", quantized.GetName(), quantized.GetDtype())
+	}
+}
+
+// affineParameters returns the scale and zero point mapping the range of values, widened to include zero,
+// onto the levels 0 to qmax.
+func affineParameters(values []float32, qmax float64) (float64, float64) {
+	low, high := 0.0, 0.0
+	for _, value := range values {
+		low = min(low, float64(value))
+		high = max(high, float64(value))
+	}
+
+	if high == low {
+		return 1, 0
+	}
+
+	scale := (high - low) / qmax
+	zeroPoint := min(max(math.Round(-low/scale), 0), qmax)
+	return scale, zeroPoint
+}
+
+// round rounds a value to the nearest integer, or stochastically if requested: up with a probability equal to
+// its fractional part, so that the expected result is the value itself.
+func round(value float64, opts Options) float64 {
+	if !opts.Stochastic {
+		return math.Round(value)
+	}
+
+	floor := math.Floor(value)
+	random := rand.Float64
+	if opts.Rand != nil {
+		random = opts.Rand.Float64
+	}
+	if random() < value-floor {
+		return floor + 1
+	}
+
+	return floor
+}
+
+// pack stores levels of 8 bits one per byte, and levels of 4 bits two per byte, low nibble first.
+func pack(levels []uint8, bits int) []byte {
+	if bits == 8 {
+		return levels
+	}
+
+	data := make([]byte, (len(levels)+1)/2)
+	for i, level := range levels {
+		data[i/2] |= level << (4 * (i % 2))
+	}
+
+	return data
+}
+
+// unpack reverses pack for n levels.
+func unpack(data []byte, bits int, n int) []uint8 {
+	if bits == 8 {
+		return data[:n]
+	}
+
+	levels := make([]uint8, n)
+	for i := range levels {
+		levels[i] = data[i/2] >> (4 * (i % 2)) & 0x0f
+	}
+
+	return levels
+}
+
+func isFloat(dtype weight_pb.DType) bool {
+	return dtype == weight_pb.DType_DTYPE_FLOAT32 || dtype == weight_pb.DType_DTYPE_FLOAT16 || dtype == weight_pb.DType_DTYPE_BFLOAT16
+}
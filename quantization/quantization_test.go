@@ -0,0 +1,170 @@
+package quantization
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// newRandomTensor creates a float32 tensor of the given shape whose rows have very different ranges.
+func newRandomTensor(t *testing.T, rows int, columns int) *weight_pb.Tensor {
+	t.Helper()
+
+	random := rand.New(rand.NewPCG(1, 2))
+	values := make([]float32, rows*columns)
+	for i := range values {
+		row := i / columns
+		values[i] = float32(random.NormFloat64() * math.Pow(10, float64(row-rows/2)))
+	}
+
+	tensor, err := weight_pb.NewFloat32Tensor("weight", []int64{int64(rows), int64(columns)}, values)
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+
+	return tensor
+}
+
+func TestQuantizeTensorRoundTrip(t *testing.T) {
+	tensor := newRandomTensor(t, 4, 1001)
+
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{name: "8-bit per tensor", options: Options{Bits: 8}},
+		{name: "8-bit per channel", options: Options{Bits: 8, PerChannel: true}},
+		{name: "4-bit per tensor", options: Options{Bits: 4}},
+		{name: "4-bit per channel", options: Options{Bits: 4, PerChannel: true}},
+	}
+
+	var perTensorError float64
+	for _, test := range tests {
+		quantized, err := QuantizeTensor(tensor, test.options)
+		if err != nil {
+			t.Fatalf("%s: failed to quantize: %v", test.name, err)
+		}
+		if expected := (4*1001*test.options.Bits + 7) / 8; len(quantized.Data) != expected {
+			t.Fatalf("%s: expected %d bytes of data, got %d", test.name, expected, len(quantized.Data))
+		}
+
+		dequantized, err := DequantizeTensor(quantized)
+		if err != nil {
+			t.Fatalf("%s: failed to dequantize: %v", test.name, err)
+		}
+		stats, err := CompareTensors(tensor, dequantized)
+		if err != nil {
+			t.Fatalf("%s: failed to compare: %v", test.name, err)
+		}
+		t.Logf("%s: %+v", test.name, stats)
+
+		// Rounding to the nearest level is off by at most half a step of the widest range.
+		values, _ := tensor.Float32s()
+		low, high := 0.0, 0.0
+		for _, value := range values {
+			low, high = min(low, float64(value)), max(high, float64(value))
+		}
+		step := (high - low) / float64(int(1)<<test.options.Bits-1)
+		if stats.MaxAbsError > step/2*1.001 {
+			t.Fatalf("%s: maximum error %g exceeds half a step %g", test.name, stats.MaxAbsError, step/2)
+		}
+
+		if test.options.PerChannel {
+			if stats.Rmse >= perTensorError {
+				t.Fatalf("%s: expected a lower error per channel, got %g against %g", test.name, stats.Rmse, perTensorError)
+			}
+		} else {
+			perTensorError = stats.Rmse
+		}
+	}
+}
+
+func TestStochasticRoundingIsUnbiased(t *testing.T) {
+	values := make([]float32, 10000)
+	for i := range values {
+		values[i] = 0.3
+	}
+	values[0] = 1 // The range is [0, 1], so 0.3 lies between two 4-bit levels.
+	tensor, err := weight_pb.NewFloat32Tensor("bias", []int64{int64(len(values))}, values)
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+
+	quantized, err := QuantizeTensor(tensor, Options{Bits: 4, Stochastic: true, Rand: rand.New(rand.NewPCG(3, 4))})
+	if err != nil {
+		t.Fatalf("Failed to quantize: %v", err)
+	}
+	dequantized, err := DequantizeTensor(quantized)
+	if err != nil {
+		t.Fatalf("Failed to dequantize: %v", err)
+	}
+
+	reconstructed, _ := dequantized.Float32s()
+	var sum float64
+	for _, value := range reconstructed[1:] {
+		sum += float64(value)
+	}
+	if mean := sum / float64(len(reconstructed)-1); math.Abs(mean-0.3) > 0.005 {
+		t.Fatalf("Expected stochastic rounding to average to 0.3, got %g", mean)
+	}
+}
+
+func TestQuantizeModel(t *testing.T) {
+	model := weight_pb.NewTensorModel("mlp")
+	model.Metadata["round"] = "3"
+	if err := model.AddTensor(newRandomTensor(t, 2, 10)); err != nil {
+		t.Fatalf("Failed to add tensor: %v", err)
+	}
+	steps, err := weight_pb.NewInt64Tensor("steps", []int64{1}, []int64{12345})
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+	if err := model.AddTensor(steps); err != nil {
+		t.Fatalf("Failed to add tensor: %v", err)
+	}
+
+	quantized, err := QuantizeModel(model, Options{Bits: 8, PerChannel: true})
+	if err != nil {
+		t.Fatalf("Failed to quantize model: %v", err)
+	}
+
+	data, err := proto.Marshal(quantized)
+	if err != nil {
+		t.Fatalf("Failed to marshal quantized model: %v", err)
+	}
+	var read weight_pb.QuantizedModel
+	if err := proto.Unmarshal(data, &read); err != nil {
+		t.Fatalf("Failed to unmarshal quantized model: %v", err)
+	}
+
+	dequantized, err := DequantizeModel(&read)
+	if err != nil {
+		t.Fatalf("Failed to dequantize model: %v", err)
+	}
+	if dequantized.ArchitectureId != "mlp" || dequantized.Metadata["round"] != "3" || !proto.Equal(dequantized.Tensor("steps"), steps) {
+		t.Fatalf("Expected the metadata and the integer tensor to be kept, got %v", dequantized)
+	}
+
+	stats, err := CompareModels(model, dequantized)
+	if err != nil || stats.Count != 21 || stats.Snr < 30 {
+		t.Fatalf("Unexpected error statistics %+v (%v)", stats, err)
+	}
+}
+
+func TestQuantizeRejectsInvalidInput(t *testing.T) {
+	tensor, err := weight_pb.NewFloat32Tensor("weight", []int64{2}, []float32{1, float32(math.NaN())})
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+	if _, err := QuantizeTensor(tensor, Options{Bits: 8}); err == nil {
+		t.Fatalf("Expected a NaN to be rejected")
+	}
+
+	tensor = newRandomTensor(t, 1, 4)
+	if _, err := QuantizeTensor(tensor, Options{Bits: 3}); err == nil {
+		t.Fatalf("Expected 3 bits to be rejected")
+	}
+}
@@ -0,0 +1,104 @@
+package quantization
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// ErrorStats describes how far reconstructed values are from the original ones.
+// Count - the number of compared values.
+// MaxAbsError - the largest absolute difference.
+// MeanAbsError - the mean absolute difference.
+// Rmse - the root mean squared difference.
+// Snr - the signal-to-noise ratio in dB, infinite if there is no error.
+type ErrorStats struct {
+	Count        int64
+	MaxAbsError  float64
+	MeanAbsError float64
+	Rmse         float64
+	Snr          float64
+}
+
+// CompareTensors returns the error of a reconstructed tensor, e.g. a dequantized one, against the original tensor.
+func CompareTensors(original *weight_pb.Tensor, reconstructed *weight_pb.Tensor) (ErrorStats, error) {
+	var acc errorAccumulator
+	if err := acc.add(original, reconstructed); err != nil {
+		return ErrorStats{}, err
+	}
+
+	return acc.stats(), nil
+}
+
+// CompareModels returns the error of a reconstructed model against the original model, over all their tensors.
+func CompareModels(original *weight_pb.TensorModel, reconstructed *weight_pb.TensorModel) (ErrorStats, error) {
+	var acc errorAccumulator
+	for _, tensor := range original.GetTensors() {
+		reconstructedTensor := reconstructed.Tensor(tensor.GetName())
+		if reconstructedTensor == nil {
+			return ErrorStats{}, fmt.Errorf("reconstructed model has no tensor named %q", tensor.GetName())
+		}
+		if err := acc.add(tensor, reconstructedTensor); err != nil {
+			return ErrorStats{}, err
+		}
+	}
+
+	return acc.stats(), nil
+}
+
+// errorAccumulator sums the errors of several tensors.
+type errorAccumulator struct {
+	count     int64
+	maxAbs    float64
+	sumAbs    float64
+	sumSquare float64
+	signal    float64
+}
+
+func (a *errorAccumulator) add(original *weight_pb.Tensor, reconstructed *weight_pb.Tensor) error {
+	if !slices.Equal(original.GetShape(), reconstructed.GetShape()) {
+		return fmt.Errorf("tensor %q has shape %v, the reconstructed one %v", original.GetName(), original.GetShape(), reconstructed.GetShape())
+	}
+
+	originalValues, err := original.Float32s()
+	if err != nil {
+		return err
+	}
+	reconstructedValues, err := reconstructed.Float32s()
+	if err != nil {
+		return err
+	}
+
+	for i := range originalValues {
+		value := float64(originalValues[i])
+		diff := math.Abs(value - float64(reconstructedValues[i]))
+		a.count++
+		a.maxAbs = max(a.maxAbs, diff)
+		a.sumAbs += diff
+		a.sumSquare += diff * diff
+		a.signal += value * value
+	}
+
+	return nil
+}
+
+func (a *errorAccumulator) stats() ErrorStats {
+	if a.count == 0 {
+		return ErrorStats{Snr: math.Inf(1)}
+	}
+
+	snr := math.Inf(1)
+	if a.sumSquare > 0 {
+		snr = 10 * math.Log10(a.signal/a.sumSquare)
+	}
+
+	return ErrorStats{
+		Count:        a.count,
+		MaxAbsError:  a.maxAbs,
+		MeanAbsError: a.sumAbs / float64(a.count),
+		Rmse:         math.Sqrt(a.sumSquare / float64(a.count)),
+		Snr:          snr,
+	}
+}
@@ -0,0 +1,168 @@
+package secure_aggregation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"fmt"
+	"slices"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// Aggregator computes the sum of the participants' vectors of an epoch from their masked vectors.
+type Aggregator struct {
+	Epoch int
+
+	board MessageBoard
+	store VectorStore
+}
+
+// NewAggregator creates the aggregator of an epoch.
+func NewAggregator(epoch int, board MessageBoard, store VectorStore) *Aggregator {
+	return &Aggregator{Epoch: epoch, board: board, store: store}
+}
+
+// Result holds the outcome of a secure aggregation.
+// Sum - the sum of the vectors of the participants who uploaded one, wrapping around on overflow.
+// ParticipantIds - the sorted ids of the participants whose vectors are summed.
+// DroppedIds - the sorted ids of the participants who shared their keys but dropped out before uploading a vector.
+type Result struct {
+	Sum            []int64
+	ParticipantIds []int
+	DroppedIds     []int
+}
+
+// Sum unmasks the sum of the masked vectors once the Unmask round is closed. The self-mask seeds of the participants
+// who uploaded a vector and the mask private keys of their peers who did not are reconstructed from the shares
+// revealed by the participants who uploaded one.
+func (a *Aggregator) Sum(ctx context.Context) (*Result, error) {
+	advertised, err := collect[advertisedKeys](a.board, a.Epoch, RoundAdvertiseKeys)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := collect[sharedKeys](a.board, a.Epoch, RoundShareKeys)
+	if err != nil {
+		return nil, err
+	}
+	uploaded, err := collect[maskedInput](a.board, a.Epoch, RoundMaskedInput)
+	if err != nil {
+		return nil, err
+	}
+	revealed, err := collect[unmasking](a.board, a.Epoch, RoundUnmask)
+	if err != nil {
+		return nil, err
+	}
+	if len(uploaded) == 0 {
+		return nil, fmt.Errorf("no masked vector was uploaded for epoch %d", a.Epoch)
+	}
+
+	participantIds := sortedKeys(uploaded)
+	dropped := make(map[int]bool)
+	for _, participantId := range participantIds {
+		if _, ok := shared[participantId]; !ok {
+			return nil, fmt.Errorf("participant %d uploaded a masked vector without sharing its keys", participantId)
+		}
+		for _, peerId := range uploaded[participantId].Peers {
+			peer, ok := uploaded[peerId]
+			if !ok {
+				dropped[peerId] = true
+			} else if !slices.Contains(peer.Peers, participantId) {
+				return nil, fmt.Errorf("participants %d and %d disagree on their pairwise masks", participantId, peerId)
+			}
+		}
+	}
+
+	// Only the shares revealed by participants who uploaded a vector are used.
+	sharesOf := func(participantId int, pick func(unmasking) map[int][]byte) map[int][]byte {
+		shares := make(map[int][]byte)
+		for _, holderId := range participantIds {
+			if share, ok := pick(revealed[holderId])[participantId]; ok {
+				shares[holderId] = share
+			}
+		}
+		return shares
+	}
+
+	sum, err := a.sumMaskedVectors(ctx, participantIds, uploaded)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, participantId := range participantIds {
+		seed, err := combineShares(sharesOf(participantId, func(u unmasking) map[int][]byte { return u.SeedShares }), shared[participantId].Threshold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reconstruct the self-mask seed of participant %d: %w", participantId, err)
+		}
+		if err := addMask(sum, seed, true); err != nil {
+			return nil, err
+		}
+	}
+
+	droppedIds := sortedKeys(dropped)
+	for _, droppedId := range droppedIds {
+		threshold := 0
+		if message, ok := shared[droppedId]; ok {
+			threshold = message.Threshold
+		}
+		maskKeyBytes, err := combineShares(sharesOf(droppedId, func(u unmasking) map[int][]byte { return u.MaskKeyShares }), threshold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reconstruct the mask key of participant %d: %w", droppedId, err)
+		}
+		maskKey, err := ecdh.X25519().NewPrivateKey(maskKeyBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(maskKey.PublicKey().Bytes(), advertised[droppedId].MaskKey) {
+			return nil, fmt.Errorf("the reconstructed mask key of participant %d does not match its advertised key", droppedId)
+		}
+
+		// The pairwise masks the participants who uploaded a vector added with the dropped one did not cancel out.
+		for _, participantId := range participantIds {
+			if !slices.Contains(uploaded[participantId].Peers, droppedId) {
+				continue
+			}
+			pairSeed, err := agree(maskKey, advertised[participantId].MaskKey, "mask", a.Epoch)
+			if err != nil {
+				return nil, err
+			}
+			if err := addMask(sum, pairSeed, !subtractsPairMask(participantId, droppedId)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Result{Sum: sum, ParticipantIds: participantIds, DroppedIds: droppedIds}, nil
+}
+
+// sumMaskedVectors downloads and adds the masked vectors of the participants, wrapping around on overflow.
+func (a *Aggregator) sumMaskedVectors(ctx context.Context, participantIds []int, uploaded map[int]maskedInput) ([]int64, error) {
+	var sum []int64
+	for _, participantId := range participantIds {
+		var model weight_pb.TensorModel
+		if err := a.store.GetFile(ctx, uploaded[participantId].Cid, &model); err != nil {
+			return nil, fmt.Errorf("failed to download the masked vector of participant %d: %w", participantId, err)
+		}
+		tensor := model.Tensor(MaskedInputTensor)
+		if tensor == nil {
+			return nil, fmt.Errorf("the model of participant %d has no %s tensor", participantId, MaskedInputTensor)
+		}
+		values, err := tensor.Int64s()
+		if err != nil {
+			return nil, fmt.Errorf("invalid masked vector of participant %d: %w", participantId, err)
+		}
+
+		if sum == nil {
+			sum = values
+			continue
+		}
+		if len(values) != len(sum) {
+			return nil, fmt.Errorf("masked vector of participant %d has %d values, expected %d", participantId, len(values), len(sum))
+		}
+		for i, value := range values {
+			sum[i] += value
+		}
+	}
+
+	return sum, nil
+}
@@ -0,0 +1,110 @@
+package secure_aggregation
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// domain separates the keys derived by the protocol from any other use of the same key agreements.
+const domain = "fabric-ipfs-interface/secure-aggregation/v1"
+
+// agree derives a 32-byte key from the X25519 agreement between a private and a public key, for a purpose and an epoch.
+// Both ends of the agreement derive the same key.
+func agree(privateKey *ecdh.PrivateKey, publicKey []byte, purpose string, epoch int) ([]byte, error) {
+	peerKey, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	secret, err := privateKey.ECDH(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on a key: %w", err)
+	}
+
+	return hkdf.Key(sha256.New, secret, nil, fmt.Sprintf("%s/%s/%d", domain, purpose, epoch), secretSize)
+}
+
+// encryptFor encrypts a message with AES-GCM under a key, binding it to its sender and recipient.
+// The random nonce is prepended to the ciphertext.
+func encryptFor(key []byte, sender int, recipient int, plaintext []byte, random io.Reader) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate a nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, channelData(sender, recipient)), nil
+}
+
+// decryptFrom decrypts a message encrypted with encryptFor.
+func decryptFrom(key []byte, sender int, recipient int, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext of %d bytes is too short", len(ciphertext))
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, channelData(sender, recipient))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the message from participant %d: %w", sender, err)
+	}
+
+	return plaintext, nil
+}
+
+// newAEAD creates an AES-256-GCM cipher.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// channelData returns the additional data authenticated with a message, so it cannot be replayed to another recipient.
+func channelData(sender int, recipient int) []byte {
+	return fmt.Appendf(nil, "%s/channel/%d/%d", domain, sender, recipient)
+}
+
+// addMask adds, or subtracts if negative is set, the pseudorandom mask expanded from a seed to values, wrapping around.
+// The mask is the AES-256-CTR keystream of the seed, read as little-endian 64-bit integers.
+func addMask(values []int64, seed []byte, negative bool) error {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return err
+	}
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+
+	buffer := make([]byte, 8*min(len(values), 4096))
+	for start := 0; start < len(values); start += len(buffer) / 8 {
+		chunk := values[start:min(start+len(buffer)/8, len(values))]
+		keystream := buffer[:8*len(chunk)]
+		clear(keystream)
+		stream.XORKeyStream(keystream, keystream)
+
+		for i := range chunk {
+			mask := int64(binary.LittleEndian.Uint64(keystream[8*i:]))
+			if negative {
+				chunk[i] -= mask
+			} else {
+				chunk[i] += mask
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package secure_aggregation
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+)
+
+// MemoryBoard is an in-memory MessageBoard, to run the protocol in-process. Like the chaincode, it rejects a second
+// message from a participant for the same round, and a message for a round once a later round of the epoch started.
+type MemoryBoard struct {
+	mu       sync.Mutex
+	messages map[memoryBoardKey]shared.SecureAggregationMessage
+}
+
+// memoryBoardKey identifies a message on a MemoryBoard.
+type memoryBoardKey struct {
+	epoch         int
+	round         string
+	participantId int
+}
+
+// NewMemoryBoard creates an empty MemoryBoard.
+func NewMemoryBoard() *MemoryBoard {
+	return &MemoryBoard{messages: make(map[memoryBoardKey]shared.SecureAggregationMessage)}
+}
+
+// AddSecureAggregationMessage publishes a participant's message for a round of an epoch.
+func (b *MemoryBoard) AddSecureAggregationMessage(participantId int, epoch int, round string, payload string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	index := slices.Index(shared.SecureAggregationRounds, round)
+	if index < 0 {
+		return fmt.Errorf("unknown secure aggregation round %s", round)
+	}
+	key := memoryBoardKey{epoch: epoch, round: round, participantId: participantId}
+	if _, ok := b.messages[key]; ok {
+		return fmt.Errorf("the secure aggregation message from participant %d for round %s of epoch %d already exists", participantId, round, epoch)
+	}
+	for existing := range b.messages {
+		if existing.epoch == epoch && slices.Index(shared.SecureAggregationRounds, existing.round) > index {
+			return fmt.Errorf("the secure aggregation round %s of epoch %d is closed, round %s has started", round, epoch, existing.round)
+		}
+	}
+	b.messages[key] = shared.SecureAggregationMessage{Epoch: epoch, Round: round, ParticipantId: participantId, Payload: payload}
+
+	return nil
+}
+
+// GetAllSecureAggregationMessagesByRound returns the messages published for a round of an epoch, sorted by participant id.
+func (b *MemoryBoard) GetAllSecureAggregationMessagesByRound(epoch int, round string) ([]shared.SecureAggregationMessage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []shared.SecureAggregationMessage
+	for key, message := range b.messages {
+		if key.epoch == epoch && key.round == round {
+			messages = append(messages, message)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ParticipantId < messages[j].ParticipantId
+	})
+
+	return messages, nil
+}
@@ -0,0 +1,318 @@
+package secure_aggregation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+// Config holds the settings of a participant.
+// Threshold - the number of shares needed to reconstruct the participant's secrets, at least 2 and more than half of
+// the participants who advertised keys, so that no two disjoint groups of participants can reconstruct both secrets of
+// a participant. The aggregator learns nothing about a vector unless it colludes with this many participants. If it
+// is 0, a majority of the participants who advertised keys is used.
+// Rand - the source of randomness, crypto/rand if nil.
+type Config struct {
+	Threshold int
+	Rand      io.Reader
+}
+
+// Participant runs the participant's side of the protocol for an epoch. Its rounds must be called in order,
+// each once the previous round of the epoch is closed.
+type Participant struct {
+	Id    int
+	Epoch int
+
+	board     MessageBoard
+	store     VectorStore
+	threshold int
+	random    io.Reader
+
+	channelKey *ecdh.PrivateKey
+	maskKey    *ecdh.PrivateKey
+	seed       []byte
+
+	// peerKeys holds the keys advertised by the participants the shares were sent to, including this one.
+	peerKeys map[int]advertisedKeys
+	// received holds the shares of the secrets of the peers, including this participant's own ones.
+	received map[int]keyShares
+	// peers holds the sorted ids of the participants whose pairwise masks were added.
+	peers []int
+	// uploaded is set once the masked vector is published.
+	uploaded bool
+}
+
+// NewParticipant creates the participant with the given id for an epoch. Ids must not be negative.
+func NewParticipant(id int, epoch int, board MessageBoard, store VectorStore, config Config) (*Participant, error) {
+	if id < 0 {
+		return nil, fmt.Errorf("invalid participant id %d", id)
+	}
+	if config.Threshold == 1 || config.Threshold < 0 {
+		return nil, fmt.Errorf("invalid threshold %d, at least 2 shares must be needed", config.Threshold)
+	}
+
+	random := config.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+
+	return &Participant{
+		Id:        id,
+		Epoch:     epoch,
+		board:     board,
+		store:     store,
+		threshold: config.Threshold,
+		random:    random,
+	}, nil
+}
+
+// AdvertiseKeys generates the participant's key pairs for the epoch and publishes the public keys.
+func (p *Participant) AdvertiseKeys() error {
+	if p.channelKey != nil {
+		return fmt.Errorf("participant %d already advertised its keys", p.Id)
+	}
+
+	var err error
+	if p.channelKey, err = ecdh.X25519().GenerateKey(p.random); err != nil {
+		return fmt.Errorf("failed to generate the channel key: %w", err)
+	}
+	if p.maskKey, err = ecdh.X25519().GenerateKey(p.random); err != nil {
+		return fmt.Errorf("failed to generate the mask key: %w", err)
+	}
+
+	return publish(p.board, p.Id, p.Epoch, RoundAdvertiseKeys, advertisedKeys{
+		ChannelKey: p.channelKey.PublicKey().Bytes(),
+		MaskKey:    p.maskKey.PublicKey().Bytes(),
+	})
+}
+
+// ShareKeys generates the self-mask seed and publishes the shares of the mask private key and of the seed for every
+// participant who advertised valid keys, each encrypted for its holder.
+func (p *Participant) ShareKeys() error {
+	if p.channelKey == nil || p.peerKeys != nil {
+		return fmt.Errorf("participant %d must share its keys once, after advertising them", p.Id)
+	}
+
+	advertised, err := collect[advertisedKeys](p.board, p.Epoch, RoundAdvertiseKeys)
+	if err != nil {
+		return err
+	}
+	own, ok := advertised[p.Id]
+	if !ok || !bytes.Equal(own.ChannelKey, p.channelKey.PublicKey().Bytes()) || !bytes.Equal(own.MaskKey, p.maskKey.PublicKey().Bytes()) {
+		return fmt.Errorf("the keys advertised for participant %d are not its own", p.Id)
+	}
+
+	// Channels are agreed right away, so a participant advertising invalid keys is left out rather than failing the round.
+	peerKeys := make(map[int]advertisedKeys, len(advertised))
+	channels := make(map[int][]byte, len(advertised))
+	for participantId, keys := range advertised {
+		if participantId < 0 {
+			continue
+		}
+		if participantId != p.Id {
+			if _, err := ecdh.X25519().NewPublicKey(keys.MaskKey); err != nil {
+				continue
+			}
+			channel, err := agree(p.channelKey, keys.ChannelKey, "channel", p.Epoch)
+			if err != nil {
+				continue
+			}
+			channels[participantId] = channel
+		}
+		peerKeys[participantId] = keys
+	}
+
+	participantIds := sortedKeys(peerKeys)
+	if p.threshold == 0 {
+		p.threshold = max(len(participantIds)/2+1, 2)
+	}
+	if p.threshold > len(participantIds) {
+		return fmt.Errorf("only %d participants advertised keys, fewer than the threshold %d", len(participantIds), p.threshold)
+	}
+	if p.threshold <= len(participantIds)/2 {
+		return fmt.Errorf("invalid threshold %d, more than half of the %d participants must be needed", p.threshold, len(participantIds))
+	}
+
+	p.seed = make([]byte, secretSize)
+	if _, err := io.ReadFull(p.random, p.seed); err != nil {
+		return fmt.Errorf("failed to generate the self-mask seed: %w", err)
+	}
+	maskKeyShares, err := splitSecret(p.maskKey.Bytes(), participantIds, p.threshold, p.random)
+	if err != nil {
+		return fmt.Errorf("failed to share the mask key: %w", err)
+	}
+	seedShares, err := splitSecret(p.seed, participantIds, p.threshold, p.random)
+	if err != nil {
+		return fmt.Errorf("failed to share the self-mask seed: %w", err)
+	}
+
+	payload := sharedKeys{Threshold: p.threshold, Shares: make(map[int][]byte, len(participantIds)-1)}
+	for _, participantId := range participantIds {
+		shares := keyShares{MaskKey: maskKeyShares[participantId], Seed: seedShares[participantId]}
+		if participantId == p.Id {
+			p.received = map[int]keyShares{p.Id: shares}
+			continue
+		}
+
+		plaintext, err := json.Marshal(shares)
+		if err != nil {
+			return err
+		}
+		if payload.Shares[participantId], err = encryptFor(channels[participantId], p.Id, participantId, plaintext, p.random); err != nil {
+			return fmt.Errorf("failed to encrypt the shares for participant %d: %w", participantId, err)
+		}
+	}
+	p.peerKeys = peerKeys
+
+	return publish(p.board, p.Id, p.Epoch, RoundShareKeys, payload)
+}
+
+// MaskedInput masks the participant's vector, uploads it to the store and publishes its CID, which is returned.
+// Pairwise masks are added for every participant the shares were exchanged with in both directions.
+// The values wrap around on overflow, like the sum computed by the aggregator. It fails once unmasking started, as the
+// participants who already unmasked revealed the shares of this participant's mask private key.
+func (p *Participant) MaskedInput(ctx context.Context, values []int64) (string, error) {
+	if p.received == nil || p.peers != nil {
+		return "", fmt.Errorf("participant %d must upload its masked vector once, after sharing its keys", p.Id)
+	}
+
+	unmasked, err := collect[unmasking](p.board, p.Epoch, RoundUnmask)
+	if err != nil {
+		return "", err
+	}
+	if len(unmasked) > 0 {
+		return "", fmt.Errorf("participant %d cannot upload its masked vector, the unmasking of epoch %d has started", p.Id, p.Epoch)
+	}
+
+	shared, err := collect[sharedKeys](p.board, p.Epoch, RoundShareKeys)
+	if err != nil {
+		return "", err
+	}
+
+	var peers []int
+	for participantId, message := range shared {
+		keys, ok := p.peerKeys[participantId]
+		ciphertext, sent := message.Shares[p.Id]
+		if participantId == p.Id || !ok || !sent {
+			continue
+		}
+
+		channel, err := agree(p.channelKey, keys.ChannelKey, "channel", p.Epoch)
+		if err != nil {
+			return "", err
+		}
+		plaintext, err := decryptFrom(channel, participantId, p.Id, ciphertext)
+		if err != nil {
+			return "", err
+		}
+		var shares keyShares
+		if err := json.Unmarshal(plaintext, &shares); err != nil {
+			return "", fmt.Errorf("invalid shares from participant %d: %w", participantId, err)
+		}
+
+		p.received[participantId] = shares
+		peers = append(peers, participantId)
+	}
+	slices.Sort(peers)
+	if len(peers)+1 < p.threshold {
+		return "", fmt.Errorf("only %d participants shared their keys with participant %d, fewer than the threshold %d", len(peers)+1, p.Id, p.threshold)
+	}
+
+	masked := slices.Clone(values)
+	if err := addMask(masked, p.seed, false); err != nil {
+		return "", err
+	}
+	for _, peerId := range peers {
+		pairSeed, err := agree(p.maskKey, p.peerKeys[peerId].MaskKey, "mask", p.Epoch)
+		if err != nil {
+			return "", err
+		}
+		if err := addMask(masked, pairSeed, subtractsPairMask(p.Id, peerId)); err != nil {
+			return "", err
+		}
+	}
+
+	tensor, err := weight_pb.NewInt64Tensor(MaskedInputTensor, []int64{int64(len(masked))}, masked)
+	if err != nil {
+		return "", err
+	}
+	model := weight_pb.NewTensorModel("")
+	if err := model.AddTensor(tensor); err != nil {
+		return "", err
+	}
+	cid, err := p.store.AddAndPinFile(ctx, model)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload the masked vector of participant %d: %w", p.Id, err)
+	}
+
+	p.peers = peers
+	if err := publish(p.board, p.Id, p.Epoch, RoundMaskedInput, maskedInput{Cid: cid, Peers: peers}); err != nil {
+		return "", err
+	}
+	p.uploaded = true
+
+	return cid, nil
+}
+
+// Unmask reveals, among the peers of the participant and itself, the shares of the self-mask seeds of those who
+// uploaded a masked vector and of the mask private keys of those who did not. No share of a participant's other
+// secret is ever revealed, and nothing is revealed unless at least threshold of them uploaded.
+func (p *Participant) Unmask() error {
+	if !p.uploaded {
+		return fmt.Errorf("participant %d must upload its masked vector before unmasking", p.Id)
+	}
+
+	uploaded, err := collect[maskedInput](p.board, p.Epoch, RoundMaskedInput)
+	if err != nil {
+		return err
+	}
+	unmasked, err := collect[unmasking](p.board, p.Epoch, RoundUnmask)
+	if err != nil {
+		return err
+	}
+
+	payload := unmasking{SeedShares: make(map[int][]byte), MaskKeyShares: make(map[int][]byte)}
+	for participantId, shares := range p.received {
+		message, ok := uploaded[participantId]
+		// The participants who already unmasked must agree on who uploaded, otherwise both secrets of a participant
+		// would be revealed.
+		for peerId, peerPayload := range unmasked {
+			_, revealedSeed := peerPayload.SeedShares[participantId]
+			_, revealedMaskKey := peerPayload.MaskKeyShares[participantId]
+			if (ok && revealedMaskKey) || (!ok && revealedSeed) {
+				return fmt.Errorf("participant %d disagrees on whether participant %d uploaded a masked vector", peerId, participantId)
+			}
+		}
+		if !ok {
+			payload.MaskKeyShares[participantId] = shares.MaskKey
+			continue
+		}
+		// Masks only cancel out if the peer added the pairwise mask with this participant as well.
+		if participantId != p.Id && !slices.Contains(message.Peers, p.Id) {
+			return fmt.Errorf("participant %d did not mask its vector with participant %d", participantId, p.Id)
+		}
+		payload.SeedShares[participantId] = shares.Seed
+	}
+	if len(payload.SeedShares) < p.threshold {
+		return fmt.Errorf("only %d participants uploaded a masked vector, fewer than the threshold %d", len(payload.SeedShares), p.threshold)
+	}
+
+	return publish(p.board, p.Id, p.Epoch, RoundUnmask, payload)
+}
+
+// sortedKeys returns the keys of a map keyed by participant id in ascending order.
+func sortedKeys[T any](m map[int]T) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
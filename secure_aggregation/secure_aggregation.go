@@ -0,0 +1,133 @@
+// Package secure_aggregation implements the pairwise-masking secure aggregation protocol of Bonawitz et al.
+// ("Practical Secure Aggregation for Privacy-Preserving Machine Learning", CCS 2017) over int64 vectors, such as
+// fixed-point encoded models. The aggregator learns the sum of the participants' vectors and nothing else, even
+// when some participants drop out before uploading their masked vector.
+//
+// An epoch runs four rounds, each of which is closed once the next one starts:
+//  1. AdvertiseKeys: every participant publishes two X25519 public keys, one for its channels to the other
+//     participants and one for its pairwise masks.
+//  2. ShareKeys: every participant splits its mask private key and a fresh self-mask seed into Shamir shares,
+//     and publishes each share encrypted for the participant holding it.
+//  3. MaskedInput: every participant adds to its vector a self mask and, for every peer, a pairwise mask which
+//     cancels out with the peer's, uploads the masked vector to IPFS and publishes its CID.
+//  4. Unmask: every participant still present reveals the shares of the self-mask seeds of the participants who
+//     uploaded a vector and of the mask private keys of those who dropped out, which lets the aggregator remove
+//     the self masks and the pairwise masks that did not cancel out, see Aggregator.Sum.
+//
+// Messages are exchanged through the ledger, see MessageBoard, and masked vectors through IPFS, see VectorStore.
+// MemoryBoard and ipfs_client.MemoryStorage run the protocol in-process.
+package secure_aggregation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/thcrull/fabric-ipfs-interface/shared"
+	"google.golang.org/protobuf/proto"
+)
+
+// The rounds of the protocol, recorded in the messages published on the board. The board rejects a message for a round
+// once a later round of the epoch has a message, so that no masked vector is uploaded after unmasking started.
+const (
+	RoundAdvertiseKeys = shared.AdvertiseKeysRound
+	RoundShareKeys     = shared.ShareKeysRound
+	RoundMaskedInput   = shared.MaskedInputRound
+	RoundUnmask        = shared.UnmaskRound
+)
+
+// MaskedInputTensor is the name of the int64 tensor holding a masked vector in the model uploaded to IPFS.
+const MaskedInputTensor = "masked_input"
+
+// MessageBoard publishes and lists the messages of the protocol. Published messages cannot be changed, and a message
+// for a round is rejected once a later round of the epoch has a message.
+// It is implemented by fabric_client.MetadataService and MemoryBoard.
+type MessageBoard interface {
+	AddSecureAggregationMessage(participantId int, epoch int, round string, payload string) error
+	GetAllSecureAggregationMessagesByRound(epoch int, round string) ([]shared.SecureAggregationMessage, error)
+}
+
+// advertisedKeys is the payload of the AdvertiseKeys round.
+// ChannelKey - the X25519 public key the participant's channels are encrypted with.
+// MaskKey - the X25519 public key the participant's pairwise masks are agreed with.
+type advertisedKeys struct {
+	ChannelKey []byte `json:"channel_key"`
+	MaskKey    []byte `json:"mask_key"`
+}
+
+// sharedKeys is the payload of the ShareKeys round.
+// Threshold - the number of shares needed to reconstruct the participant's secrets.
+// Shares - the encrypted keyShares of the participant's secrets, by the id of the participant holding them.
+type sharedKeys struct {
+	Threshold int            `json:"threshold"`
+	Shares    map[int][]byte `json:"shares"`
+}
+
+// keyShares holds the shares of a participant's secrets held by another participant.
+// MaskKey - the share of the mask private key.
+// Seed - the share of the self-mask seed.
+type keyShares struct {
+	MaskKey []byte `json:"mask_key"`
+	Seed    []byte `json:"seed"`
+}
+
+// maskedInput is the payload of the MaskedInput round.
+// Cid - the IPFS CID of the masked vector.
+// Peers - the ids of the participants whose pairwise masks were added, those whose shares the participant received.
+type maskedInput struct {
+	Cid   string `json:"cid"`
+	Peers []int  `json:"peers"`
+}
+
+// unmasking is the payload of the Unmask round.
+// SeedShares - the shares of the self-mask seeds of the participants who uploaded a masked vector, by participant id.
+// MaskKeyShares - the shares of the mask private keys of the participants who dropped out, by participant id.
+type unmasking struct {
+	SeedShares    map[int][]byte `json:"seed_shares"`
+	MaskKeyShares map[int][]byte `json:"mask_key_shares"`
+}
+
+// VectorStore stores the masked vectors. It is implemented by ipfs_client.IpfsClient and ipfs_client.MemoryStorage.
+type VectorStore interface {
+	AddAndPinFile(ctx context.Context, msg proto.Message) (string, error)
+	GetFile(ctx context.Context, cid string, msg proto.Message) error
+}
+
+// publish publishes the payload of a participant for a round.
+func publish(board MessageBoard, participantId int, epoch int, round string, payload any) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the %s message: %w", round, err)
+	}
+
+	if err := board.AddSecureAggregationMessage(participantId, epoch, round, string(payloadJSON)); err != nil {
+		return fmt.Errorf("failed to publish the %s message of participant %d: %w", round, participantId, err)
+	}
+
+	return nil
+}
+
+// collect returns the payloads published for a round, by participant id.
+func collect[T any](board MessageBoard, epoch int, round string) (map[int]T, error) {
+	messages, err := board.GetAllSecureAggregationMessagesByRound(epoch, round)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the %s messages of epoch %d: %w", round, epoch, err)
+	}
+
+	payloads := make(map[int]T, len(messages))
+	for _, message := range messages {
+		var payload T
+		if err := json.Unmarshal([]byte(message.Payload), &payload); err != nil {
+			return nil, fmt.Errorf("invalid %s message from participant %d: %w", round, message.ParticipantId, err)
+		}
+		payloads[message.ParticipantId] = payload
+	}
+
+	return payloads, nil
+}
+
+// subtractsPairMask tells whether a participant subtracts its pairwise mask with a peer rather than adding it.
+// The participant with the smaller id adds it and the other subtracts it, so that their masks cancel out.
+func subtractsPairMask(participantId int, peerId int) bool {
+	return participantId > peerId
+}
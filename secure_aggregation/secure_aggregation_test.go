@@ -0,0 +1,243 @@
+package secure_aggregation
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/thcrull/fabric-ipfs-interface/interface/fabric/wrapper"
+	"github.com/thcrull/fabric-ipfs-interface/interface/ipfs/wrapper"
+	"github.com/thcrull/fabric-ipfs-interface/weight_pb"
+)
+
+var _ MessageBoard = (*fabric_client.MetadataService)(nil)
+var _ VectorStore = (*ipfs_client.IpfsClient)(nil)
+var _ VectorStore = (*ipfs_client.MemoryStorage)(nil)
+
+// testRun runs an epoch of the protocol in-process for the given vectors, by participant id.
+// The participants in dropBeforeUpload stop after sharing their keys, those in dropBeforeUnmask after uploading.
+func testRun(t *testing.T, vectors map[int][]int64, config Config, dropBeforeUpload []int, dropBeforeUnmask []int) (*Result, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	board := NewMemoryBoard()
+	store, err := ipfs_client.NewMemoryStorage(ipfs_client.AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create the memory storage: %v", err)
+	}
+
+	participants := make(map[int]*Participant)
+	for _, participantId := range sortedKeys(vectors) {
+		if participants[participantId], err = NewParticipant(participantId, 1, board, store, config); err != nil {
+			t.Fatalf("Failed to create participant %d: %v", participantId, err)
+		}
+		if err := participants[participantId].AdvertiseKeys(); err != nil {
+			t.Fatalf("Failed to advertise the keys of participant %d: %v", participantId, err)
+		}
+	}
+	for participantId, participant := range participants {
+		if err := participant.ShareKeys(); err != nil {
+			t.Fatalf("Failed to share the keys of participant %d: %v", participantId, err)
+		}
+	}
+	for participantId, participant := range participants {
+		if slices.Contains(dropBeforeUpload, participantId) {
+			continue
+		}
+		cid, err := participant.MaskedInput(ctx, vectors[participantId])
+		if err != nil {
+			t.Fatalf("Failed to upload the masked vector of participant %d: %v", participantId, err)
+		}
+
+		// The uploaded vector must not reveal the participant's one.
+		var model weight_pb.TensorModel
+		if err := store.GetFile(ctx, cid, &model); err != nil {
+			t.Fatalf("Failed to get the masked vector: %v", err)
+		}
+		masked, err := model.Tensor(MaskedInputTensor).Int64s()
+		if err != nil {
+			t.Fatalf("Invalid masked vector: %v", err)
+		}
+		if slices.Equal(masked, vectors[participantId]) {
+			t.Fatalf("The masked vector of participant %d equals its vector", participantId)
+		}
+	}
+	for participantId, participant := range participants {
+		if slices.Contains(dropBeforeUpload, participantId) || slices.Contains(dropBeforeUnmask, participantId) {
+			continue
+		}
+		if err := participant.Unmask(); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewAggregator(1, board, store).Sum(ctx)
+}
+
+func TestSecureAggregation(t *testing.T) {
+	vectors := map[int][]int64{
+		0:  {1, -2, 3, 1 << 62},
+		3:  {10, 20, 30, 1 << 62},
+		4:  {-5, 0, 5, 0},
+		8:  {7, 7, 7, 7},
+		11: {100, -100, 0, -1},
+	}
+
+	sumOf := func(participantIds []int) []int64 {
+		sum := make([]int64, 4)
+		for _, participantId := range participantIds {
+			for i, value := range vectors[participantId] {
+				sum[i] += value
+			}
+		}
+		return sum
+	}
+
+	t.Run("AllParticipants", func(t *testing.T) {
+		result, err := testRun(t, vectors, Config{}, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to aggregate: %v", err)
+		}
+		if !slices.Equal(result.Sum, sumOf([]int{0, 3, 4, 8, 11})) {
+			t.Fatalf("Unexpected sum %v", result.Sum)
+		}
+		if !slices.Equal(result.ParticipantIds, []int{0, 3, 4, 8, 11}) || len(result.DroppedIds) != 0 {
+			t.Fatalf("Unexpected participants %v, dropped %v", result.ParticipantIds, result.DroppedIds)
+		}
+	})
+
+	t.Run("Dropouts", func(t *testing.T) {
+		// Participant 4 drops out before uploading, so its pairwise masks are removed with its reconstructed key.
+		// Participant 8 drops out after uploading, so its vector is still unmasked with the others' shares.
+		result, err := testRun(t, vectors, Config{Threshold: 3}, []int{4}, []int{8})
+		if err != nil {
+			t.Fatalf("Failed to aggregate: %v", err)
+		}
+		if !slices.Equal(result.Sum, sumOf([]int{0, 3, 8, 11})) {
+			t.Fatalf("Unexpected sum %v", result.Sum)
+		}
+		if !slices.Equal(result.ParticipantIds, []int{0, 3, 8, 11}) || !slices.Equal(result.DroppedIds, []int{4}) {
+			t.Fatalf("Unexpected participants %v, dropped %v", result.ParticipantIds, result.DroppedIds)
+		}
+	})
+
+	t.Run("TooManyDropouts", func(t *testing.T) {
+		// Only two participants upload, fewer than the threshold, so nothing is revealed.
+		if _, err := testRun(t, vectors, Config{Threshold: 3}, []int{0, 4, 8}, nil); err == nil {
+			t.Fatalf("Expected the participants to refuse to unmask")
+		}
+	})
+}
+
+func TestParticipantRoundOrder(t *testing.T) {
+	board := NewMemoryBoard()
+	store, err := ipfs_client.NewMemoryStorage(ipfs_client.AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create the memory storage: %v", err)
+	}
+
+	if _, err := NewParticipant(-1, 1, board, store, Config{}); err == nil {
+		t.Fatalf("Expected a negative id to be rejected")
+	}
+	if _, err := NewParticipant(1, 1, board, store, Config{Threshold: 1}); err == nil {
+		t.Fatalf("Expected a threshold of 1 to be rejected")
+	}
+
+	participant, err := NewParticipant(1, 1, board, store, Config{})
+	if err != nil {
+		t.Fatalf("Failed to create the participant: %v", err)
+	}
+	if err := participant.ShareKeys(); err == nil {
+		t.Fatalf("Expected sharing keys before advertising them to fail")
+	}
+	if err := participant.AdvertiseKeys(); err != nil {
+		t.Fatalf("Failed to advertise the keys: %v", err)
+	}
+	if err := participant.AdvertiseKeys(); err == nil {
+		t.Fatalf("Expected advertising keys twice to fail")
+	}
+	// A single participant cannot reach a threshold of 2.
+	if err := participant.ShareKeys(); err == nil {
+		t.Fatalf("Expected sharing keys alone to fail")
+	}
+}
+
+func TestLateMaskedInput(t *testing.T) {
+	ctx := context.Background()
+	board := NewMemoryBoard()
+	store, err := ipfs_client.NewMemoryStorage(ipfs_client.AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create the memory storage: %v", err)
+	}
+
+	participantIds := []int{0, 1, 2, 3, 4}
+	participants := make([]*Participant, len(participantIds))
+	for i, participantId := range participantIds {
+		if participants[i], err = NewParticipant(participantId, 1, board, store, Config{Threshold: 3}); err != nil {
+			t.Fatalf("Failed to create participant %d: %v", participantId, err)
+		}
+		if err := participants[i].AdvertiseKeys(); err != nil {
+			t.Fatalf("Failed to advertise the keys of participant %d: %v", participantId, err)
+		}
+	}
+	for _, participant := range participants {
+		if err := participant.ShareKeys(); err != nil {
+			t.Fatalf("Failed to share the keys of participant %d: %v", participant.Id, err)
+		}
+	}
+	// Participant 4 is late, so the others reveal the shares of its mask private key.
+	for _, participant := range participants[:4] {
+		if _, err := participant.MaskedInput(ctx, []int64{1, 2, 3}); err != nil {
+			t.Fatalf("Failed to upload the masked vector of participant %d: %v", participant.Id, err)
+		}
+	}
+	if err := participants[0].Unmask(); err != nil {
+		t.Fatalf("Failed to unmask: %v", err)
+	}
+
+	// Uploading now would let the next participants to unmask reveal the shares of its seed as well.
+	if _, err := participants[4].MaskedInput(ctx, []int64{1, 2, 3}); err == nil {
+		t.Fatalf("Expected the late participant to refuse to upload")
+	}
+	if err := board.AddSecureAggregationMessage(4, 1, RoundMaskedInput, `{"cid":"late"}`); err == nil {
+		t.Fatalf("Expected the board to reject a masked vector published after unmasking started")
+	}
+	if err := board.AddSecureAggregationMessage(4, 1, "late_input", "{}"); err == nil {
+		t.Fatalf("Expected the board to reject an unknown round")
+	}
+
+	for _, participant := range participants[1:4] {
+		if err := participant.Unmask(); err != nil {
+			t.Fatalf("Failed to unmask: %v", err)
+		}
+	}
+	result, err := NewAggregator(1, board, store).Sum(ctx)
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if !slices.Equal(result.Sum, []int64{4, 8, 12}) || !slices.Equal(result.DroppedIds, []int{4}) {
+		t.Fatalf("Unexpected sum %v, dropped %v", result.Sum, result.DroppedIds)
+	}
+}
+
+func TestMajorityThreshold(t *testing.T) {
+	board := NewMemoryBoard()
+	store, err := ipfs_client.NewMemoryStorage(ipfs_client.AddOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create the memory storage: %v", err)
+	}
+
+	participants := make([]*Participant, 4)
+	for i := range participants {
+		if participants[i], err = NewParticipant(i, 1, board, store, Config{Threshold: 2}); err != nil {
+			t.Fatalf("Failed to create participant %d: %v", i, err)
+		}
+		if err := participants[i].AdvertiseKeys(); err != nil {
+			t.Fatalf("Failed to advertise the keys of participant %d: %v", i, err)
+		}
+	}
+	// Two disjoint pairs of the four participants could reconstruct both secrets of a participant.
+	if err := participants[0].ShareKeys(); err == nil {
+		t.Fatalf("Expected a threshold of 2 of 4 participants to be rejected")
+	}
+}
@@ -0,0 +1,101 @@
+package secure_aggregation
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// secretSize is the size of the secrets shared with Shamir's scheme, X25519 private keys and PRG seeds.
+const secretSize = 32
+
+// fieldPrime is the Mersenne prime 2^521 - 1, the order of the field the secrets are shared in.
+// Any 32-byte secret is an element of the field.
+var fieldPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 521), big.NewInt(1))
+
+// shareSize is the size of an encoded share, a field element.
+const shareSize = 66
+
+// shareX returns the point at which the share of a participant is evaluated. Ids are not negative, so it is never 0.
+func shareX(participantId int) *big.Int {
+	return big.NewInt(int64(participantId) + 1)
+}
+
+// splitSecret splits a secret into one share per participant, any threshold of which reconstruct it.
+func splitSecret(secret []byte, participantIds []int, threshold int, random io.Reader) (map[int][]byte, error) {
+	if len(secret) != secretSize {
+		return nil, fmt.Errorf("invalid secret size %d", len(secret))
+	}
+	if threshold < 2 || threshold > len(participantIds) {
+		return nil, fmt.Errorf("invalid threshold %d for %d participants", threshold, len(participantIds))
+	}
+
+	// The secret is the constant term of a random polynomial of degree threshold - 1.
+	coefficients := make([]*big.Int, threshold)
+	coefficients[0] = new(big.Int).SetBytes(secret)
+	for i := 1; i < threshold; i++ {
+		coefficient, err := rand.Int(random, fieldPrime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate a polynomial coefficient: %w", err)
+		}
+		coefficients[i] = coefficient
+	}
+
+	shares := make(map[int][]byte, len(participantIds))
+	for _, participantId := range participantIds {
+		x := shareX(participantId)
+		y := new(big.Int)
+		for i := threshold - 1; i >= 0; i-- {
+			y.Mul(y, x)
+			y.Add(y, coefficients[i])
+			y.Mod(y, fieldPrime)
+		}
+		shares[participantId] = y.FillBytes(make([]byte, shareSize))
+	}
+
+	return shares, nil
+}
+
+// combineShares reconstructs a secret from threshold shares, keyed by the id of the participant holding them.
+// The shares of the participants with the smallest ids are used if there are more.
+func combineShares(shares map[int][]byte, threshold int) ([]byte, error) {
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("%d shares are not enough to reconstruct a secret shared with threshold %d", len(shares), threshold)
+	}
+
+	participantIds := make([]int, 0, len(shares))
+	for participantId := range shares {
+		participantIds = append(participantIds, participantId)
+	}
+	sort.Ints(participantIds)
+	participantIds = participantIds[:threshold]
+
+	// Lagrange interpolation at 0: secret = sum of y_i * prod x_j / (x_j - x_i).
+	secret := new(big.Int)
+	for _, i := range participantIds {
+		if len(shares[i]) != shareSize {
+			return nil, fmt.Errorf("share of participant %d has an invalid size %d", i, len(shares[i]))
+		}
+		xi := shareX(i)
+		numerator, denominator := big.NewInt(1), big.NewInt(1)
+		for _, j := range participantIds {
+			if j == i {
+				continue
+			}
+			xj := shareX(j)
+			numerator.Mul(numerator, xj).Mod(numerator, fieldPrime)
+			denominator.Mul(denominator, new(big.Int).Sub(xj, xi)).Mod(denominator, fieldPrime)
+		}
+		term := new(big.Int).SetBytes(shares[i])
+		term.Mul(term, numerator).Mul(term, denominator.ModInverse(denominator, fieldPrime))
+		secret.Add(secret, term).Mod(secret, fieldPrime)
+	}
+
+	if secret.BitLen() > 8*secretSize {
+		return nil, fmt.Errorf("the shares do not reconstruct a valid secret")
+	}
+
+	return secret.FillBytes(make([]byte, secretSize)), nil
+}
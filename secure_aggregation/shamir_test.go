@@ -0,0 +1,72 @@
+package secure_aggregation
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestShamirSharing(t *testing.T) {
+	secret := make([]byte, secretSize)
+	for i := range secret {
+		secret[i] = 0xff // The largest secret still fits the field.
+	}
+	participantIds := []int{0, 3, 7, 10, 42}
+
+	shares, err := splitSecret(secret, participantIds, 3, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to split the secret: %v", err)
+	}
+
+	// Any threshold of shares reconstruct the secret.
+	for _, holders := range [][]int{{0, 3, 7}, {10, 42, 3}, {0, 42, 7, 10}} {
+		subset := make(map[int][]byte)
+		for _, holderId := range holders {
+			subset[holderId] = shares[holderId]
+		}
+		reconstructed, err := combineShares(subset, 3)
+		if err != nil {
+			t.Fatalf("Failed to reconstruct the secret from %v: %v", holders, err)
+		}
+		if !bytes.Equal(reconstructed, secret) {
+			t.Fatalf("Shares of %v reconstruct a wrong secret", holders)
+		}
+	}
+
+	if _, err := combineShares(map[int][]byte{0: shares[0], 3: shares[3]}, 3); err == nil {
+		t.Fatalf("Expected fewer shares than the threshold to be rejected")
+	}
+	if _, err := splitSecret(secret, participantIds, 1, rand.Reader); err == nil {
+		t.Fatalf("Expected a threshold of 1 to be rejected")
+	}
+	if _, err := splitSecret(secret, participantIds, 6, rand.Reader); err == nil {
+		t.Fatalf("Expected a threshold above the number of participants to be rejected")
+	}
+}
+
+func TestAddMask(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, secretSize)
+	values := make([]int64, 10000)
+
+	if err := addMask(values, seed, false); err != nil {
+		t.Fatalf("Failed to add the mask: %v", err)
+	}
+	zeros := 0
+	for _, value := range values {
+		if value == 0 {
+			zeros++
+		}
+	}
+	if zeros > 1 {
+		t.Fatalf("Expected the mask to look random, got %d zeros", zeros)
+	}
+
+	if err := addMask(values, seed, true); err != nil {
+		t.Fatalf("Failed to subtract the mask: %v", err)
+	}
+	for i, value := range values {
+		if value != 0 {
+			t.Fatalf("Expected subtracting the mask to restore the values, got %d at %d", value, i)
+		}
+	}
+}
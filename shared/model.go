@@ -57,11 +57,79 @@ type ParticipantModelMetadata struct {
 // Epoch - the epoch of the model update.
 // ParticipantIds - the participants' ids that contributed to the global model update.
 // ModelHashCid - the IPFS CID of the global model update.
+// HomomorphicHash - the homomorphic hash of the weighted sum of the participants' model updates, which must combine their
+// homomorphic hashes. The weights are the sample counts of a "fedavg" aggregation and 1 otherwise, so for a "sum" it is the
+// hash of the global model update. For the averaging rules, "fedavg", "fedprox" and "multi_krum", it is bound to the weighted
+// sum and not to the rounded average published under ModelHashCid, which cannot be checked against it.
+// Aggregation - the rule that produced the global model update from the participants' model updates.
 type AggregatorModelMetadata struct {
-	Epoch          int    `json:"epoch"`
-	AggregatorId   int    `json:"aggregator_id"`
-	ParticipantIds []int  `json:"participant_ids"`
-	ModelHashCid   string `json:"model_hash_cid"`
+	Epoch           int             `json:"epoch"`
+	AggregatorId    int             `json:"aggregator_id"`
+	ParticipantIds  []int           `json:"participant_ids"`
+	ModelHashCid    string          `json:"model_hash_cid"`
+	HomomorphicHash string          `json:"homomorphic_hash"`
+	Aggregation     AggregationRule `json:"aggregation"`
+}
+
+// Names of the aggregation rules accepted in aggregator model metadata records.
+const (
+	// SumAggregationRule adds the participants' model updates, as does an unspecified rule.
+	SumAggregationRule = "sum"
+	// FedAvgAggregationRule averages the participants' model updates weighted by the sample counts recorded under
+	// SampleCountsAggregationParameter.
+	FedAvgAggregationRule = "fedavg"
+	// FedProxAggregationRule averages the participants' model updates with equal weights.
+	FedProxAggregationRule = "fedprox"
+	// MedianAggregationRule takes the coordinate-wise median, whose homomorphic hash cannot be verified.
+	MedianAggregationRule = "median"
+	// TrimmedMeanAggregationRule takes the coordinate-wise trimmed mean, whose homomorphic hash cannot be verified.
+	TrimmedMeanAggregationRule = "trimmed_mean"
+	// KrumAggregationRule selects one participant's model update, the only participant listed.
+	KrumAggregationRule = "krum"
+	// MultiKrumAggregationRule averages the selected participants' model updates, the participants listed.
+	MultiKrumAggregationRule = "multi_krum"
+)
+
+// Parameters of aggregation rules that the chaincode reads to verify homomorphic hashes.
+const (
+	// SampleCountsAggregationParameter holds the comma-separated sample counts of a "fedavg" aggregation, in the order of
+	// the participant ids.
+	SampleCountsAggregationParameter = "sample_counts"
+	// ClipNormAggregationParameter holds the norm the model updates were clipped to before aggregating, in which case
+	// the global model update no longer combines the participants' homomorphic hashes.
+	ClipNormAggregationParameter = "clip_norm"
+)
+
+// AggregationRule identifies how a global model update was aggregated.
+// Name - the name of the rule, e.g. "fedavg", "median", "trimmed_mean" or "krum".
+// Parameters - the parameters of the rule, e.g. "trim_fraction": "0.1".
+type AggregationRule struct {
+	Name       string            `json:"name"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// Rounds of the secure aggregation protocol, recorded in secure aggregation messages.
+const (
+	AdvertiseKeysRound = "advertise_keys"
+	ShareKeysRound     = "share_keys"
+	MaskedInputRound   = "masked_input"
+	UnmaskRound        = "unmasking"
+)
+
+// SecureAggregationRounds lists the rounds of the secure aggregation protocol in order. A round of an epoch is closed
+// once a later round of the epoch has a message.
+var SecureAggregationRounds = []string{AdvertiseKeysRound, ShareKeysRound, MaskedInputRound, UnmaskRound}
+
+// SecureAggregationMessage holds a message a participant published in a round of the secure aggregation protocol.
+// Epoch - the epoch being aggregated.
+// Round - the round of the protocol, e.g. "advertise_keys" or "unmasking".
+// ParticipantId - the id of the participant who published the message.
+// Payload - the content of the message, whose format depends on the round.
+type SecureAggregationMessage struct {
+	Epoch         int    `json:"epoch"`
+	Round         string `json:"round"`
+	ParticipantId int    `json:"participant_id"`
+	Payload       string `json:"payload"`
 }
 
 // LogEntry holds a transaction log entry.
@@ -0,0 +1,178 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: encrypted.proto
+
+package weight_pb
+
+import (
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// EncryptedModel is a WeightModel encrypted with the Paillier cryptosystem, several values packed per ciphertext.
+// Each value v is packed as v + 2^63 in a slot of slot_bits bits, so that adding ciphertexts adds the slots without
+// carrying from one to the next.
+type EncryptedModel struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Modulus n of the public key the model is encrypted with, big-endian.
+	PublicKey []byte `protobuf:"bytes,12,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	// Number of values of the model.
+	Length int64 `protobuf:"varint,13,opt,name=length,proto3" json:"length,omitempty"`
+	// Bits per slot, 64 plus enough bits for the number of models that may be added.
+	SlotBits int32 `protobuf:"varint,14,opt,name=slot_bits,json=slotBits,proto3" json:"slot_bits,omitempty"`
+	// Values packed per ciphertext.
+	Slots int32 `protobuf:"varint,15,opt,name=slots,proto3" json:"slots,omitempty"`
+	// Number of encrypted models added into this one, 1 for a model that was encrypted directly.
+	Summands int64 `protobuf:"varint,16,opt,name=summands,proto3" json:"summands,omitempty"`
+	// Ciphertexts modulo n^2, big-endian and padded to the size of n^2.
+	Ciphertexts   [][]byte `protobuf:"bytes,17,rep,name=ciphertexts,proto3" json:"ciphertexts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EncryptedModel) Reset() {
+	*x = EncryptedModel{}
+	mi := &file_encrypted_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EncryptedModel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncryptedModel) ProtoMessage() {}
+
+func (x *EncryptedModel) ProtoReflect() protoreflect.Message {
+	mi := &file_encrypted_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncryptedModel.ProtoReflect.Descriptor instead.
+func (*EncryptedModel) Descriptor() ([]byte, []int) {
+	return file_encrypted_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *EncryptedModel) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+func (x *EncryptedModel) GetLength() int64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *EncryptedModel) GetSlotBits() int32 {
+	if x != nil {
+		return x.SlotBits
+	}
+	return 0
+}
+
+func (x *EncryptedModel) GetSlots() int32 {
+	if x != nil {
+		return x.Slots
+	}
+	return 0
+}
+
+func (x *EncryptedModel) GetSummands() int64 {
+	if x != nil {
+		return x.Summands
+	}
+	return 0
+}
+
+func (x *EncryptedModel) GetCiphertexts() [][]byte {
+	if x != nil {
+		return x.Ciphertexts
+	}
+	return nil
+}
+
+var File_encrypted_proto protoreflect.FileDescriptor
+
+const file_encrypted_proto_rawDesc = "" +
+	"\n" +
+	"\x0fencrypted.proto\x12\x06weight\"\xbe\x01\n" +
+	"\x0eEncryptedModel\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\f \x01(\fR\tpublicKey\x12\x16\n" +
+	"\x06length\x18\r \x01(\x03R\x06length\x12\x1b\n" +
+	"\tslot_bits\x18\x0e \x01(\x05R\bslotBits\x12\x14\n" +
+	"\x05slots\x18\x0f \x01(\x05R\x05slots\x12\x1a\n" +
+	"\bsummands\x18\x10 \x01(\x03R\bsummands\x12 \n" +
+	"\vciphertexts\x18\x11 \x03(\fR\vciphertextsJ\x04\b\x01\x10\fB\rZ\v./weight_pbb\x06proto3"
+
+var (
+	file_encrypted_proto_rawDescOnce sync.Once
+	file_encrypted_proto_rawDescData []byte
+)
+
+func file_encrypted_proto_rawDescGZIP() []byte {
+	file_encrypted_proto_rawDescOnce.Do(func() {
+		file_encrypted_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_encrypted_proto_rawDesc), len(file_encrypted_proto_rawDesc)))
+	})
+	return file_encrypted_proto_rawDescData
+}
+
+var file_encrypted_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_encrypted_proto_goTypes = []any{
+	(*EncryptedModel)(nil), // 0: weight.EncryptedModel
+}
+var file_encrypted_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_encrypted_proto_init() }
+func file_encrypted_proto_init() {
+	if File_encrypted_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_encrypted_proto_rawDesc), len(file_encrypted_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_encrypted_proto_goTypes,
+		DependencyIndexes: file_encrypted_proto_depIdxs,
+		MessageInfos:      file_encrypted_proto_msgTypes,
+	}.Build()
+	File_encrypted_proto = out.File
+	file_encrypted_proto_goTypes = nil
+	file_encrypted_proto_depIdxs = nil
+}
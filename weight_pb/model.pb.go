@@ -0,0 +1,299 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: model.proto
+
+package weight_pb
+
+import (
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// DType is the element type of a tensor.
+type DType int32
+
+const (
+	DType_DTYPE_UNSPECIFIED DType = 0
+	DType_DTYPE_FLOAT32     DType = 1
+	DType_DTYPE_FLOAT16     DType = 2
+	DType_DTYPE_BFLOAT16    DType = 3
+	DType_DTYPE_INT8        DType = 4
+	DType_DTYPE_INT64       DType = 5
+)
+
+// Enum value maps for DType.
+var (
+	DType_name = map[int32]string{
+		0: "DTYPE_UNSPECIFIED",
+		1: "DTYPE_FLOAT32",
+		2: "DTYPE_FLOAT16",
+		3: "DTYPE_BFLOAT16",
+		4: "DTYPE_INT8",
+		5: "DTYPE_INT64",
+	}
+	DType_value = map[string]int32{
+		"DTYPE_UNSPECIFIED": 0,
+		"DTYPE_FLOAT32":     1,
+		"DTYPE_FLOAT16":     2,
+		"DTYPE_BFLOAT16":    3,
+		"DTYPE_INT8":        4,
+		"DTYPE_INT64":       5,
+	}
+)
+
+func (x DType) Enum() *DType {
+	p := new(DType)
+	*p = x
+	return p
+}
+
+func (x DType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DType) Descriptor() protoreflect.EnumDescriptor {
+	return file_model_proto_enumTypes[0].Descriptor()
+}
+
+func (DType) Type() protoreflect.EnumType {
+	return &file_model_proto_enumTypes[0]
+}
+
+func (x DType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DType.Descriptor instead.
+func (DType) EnumDescriptor() ([]byte, []int) {
+	return file_model_proto_rawDescGZIP(), []int{0}
+}
+
+// Tensor is a named, shaped array of weights.
+type Tensor struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name of the tensor, e.g. "conv1.weight".
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Dimensions of the tensor, an empty shape is a scalar.
+	Shape []int64 `protobuf:"varint,2,rep,packed,name=shape,proto3" json:"shape,omitempty"`
+	Dtype DType   `protobuf:"varint,3,opt,name=dtype,proto3,enum=weight.DType" json:"dtype,omitempty"`
+	// Elements in row-major order, each packed little-endian in the size of the dtype.
+	Data          []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Tensor) Reset() {
+	*x = Tensor{}
+	mi := &file_model_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tensor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tensor) ProtoMessage() {}
+
+func (x *Tensor) ProtoReflect() protoreflect.Message {
+	mi := &file_model_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tensor.ProtoReflect.Descriptor instead.
+func (*Tensor) Descriptor() ([]byte, []int) {
+	return file_model_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Tensor) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Tensor) GetShape() []int64 {
+	if x != nil {
+		return x.Shape
+	}
+	return nil
+}
+
+func (x *Tensor) GetDtype() DType {
+	if x != nil {
+		return x.Dtype
+	}
+	return DType_DTYPE_UNSPECIFIED
+}
+
+func (x *Tensor) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// TensorModel is a model made of named tensors.
+type TensorModel struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Identifies the architecture the tensors belong to, e.g. "resnet18".
+	ArchitectureId string    `protobuf:"bytes,2,opt,name=architecture_id,json=architectureId,proto3" json:"architecture_id,omitempty"`
+	Tensors        []*Tensor `protobuf:"bytes,3,rep,name=tensors,proto3" json:"tensors,omitempty"`
+	// Free-form metadata, e.g. the framework or the training round.
+	Metadata      map[string]string `protobuf:"bytes,4,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TensorModel) Reset() {
+	*x = TensorModel{}
+	mi := &file_model_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TensorModel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TensorModel) ProtoMessage() {}
+
+func (x *TensorModel) ProtoReflect() protoreflect.Message {
+	mi := &file_model_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TensorModel.ProtoReflect.Descriptor instead.
+func (*TensorModel) Descriptor() ([]byte, []int) {
+	return file_model_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *TensorModel) GetArchitectureId() string {
+	if x != nil {
+		return x.ArchitectureId
+	}
+	return ""
+}
+
+func (x *TensorModel) GetTensors() []*Tensor {
+	if x != nil {
+		return x.Tensors
+	}
+	return nil
+}
+
+func (x *TensorModel) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+var File_model_proto protoreflect.FileDescriptor
+
+const file_model_proto_rawDesc = "" +
+	"\n" +
+	"\vmodel.proto\x12\x06weight\"k\n" +
+	"\x06Tensor\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05shape\x18\x02 \x03(\x03R\x05shape\x12#\n" +
+	"\x05dtype\x18\x03 \x01(\x0e2\r.weight.DTypeR\x05dtype\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\"\xe2\x01\n" +
+	"\vTensorModel\x12'\n" +
+	"\x0farchitecture_id\x18\x02 \x01(\tR\x0earchitectureId\x12(\n" +
+	"\atensors\x18\x03 \x03(\v2\x0e.weight.TensorR\atensors\x12=\n" +
+	"\bmetadata\x18\x04 \x03(\v2!.weight.TensorModel.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01J\x04\b\x01\x10\x02*y\n" +
+	"\x05DType\x12\x15\n" +
+	"\x11DTYPE_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rDTYPE_FLOAT32\x10\x01\x12\x11\n" +
+	"\rDTYPE_FLOAT16\x10\x02\x12\x12\n" +
+	"\x0eDTYPE_BFLOAT16\x10\x03\x12\x0e\n" +
+	"\n" +
+	"DTYPE_INT8\x10\x04\x12\x0f\n" +
+	"\vDTYPE_INT64\x10\x05B\rZ\v./weight_pbb\x06proto3"
+
+var (
+	file_model_proto_rawDescOnce sync.Once
+	file_model_proto_rawDescData []byte
+)
+
+func file_model_proto_rawDescGZIP() []byte {
+	file_model_proto_rawDescOnce.Do(func() {
+		file_model_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_model_proto_rawDesc), len(file_model_proto_rawDesc)))
+	})
+	return file_model_proto_rawDescData
+}
+
+var file_model_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_model_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_model_proto_goTypes = []any{
+	(DType)(0),          // 0: weight.DType
+	(*Tensor)(nil),      // 1: weight.Tensor
+	(*TensorModel)(nil), // 2: weight.TensorModel
+	nil,                 // 3: weight.TensorModel.MetadataEntry
+}
+var file_model_proto_depIdxs = []int32{
+	0, // 0: weight.Tensor.dtype:type_name -> weight.DType
+	1, // 1: weight.TensorModel.tensors:type_name -> weight.Tensor
+	3, // 2: weight.TensorModel.metadata:type_name -> weight.TensorModel.MetadataEntry
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_model_proto_init() }
+func file_model_proto_init() {
+	if File_model_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_model_proto_rawDesc), len(file_model_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_model_proto_goTypes,
+		DependencyIndexes: file_model_proto_depIdxs,
+		EnumInfos:         file_model_proto_enumTypes,
+		MessageInfos:      file_model_proto_msgTypes,
+	}.Build()
+	File_model_proto = out.File
+	file_model_proto_goTypes = nil
+	file_model_proto_depIdxs = nil
+}
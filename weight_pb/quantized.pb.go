@@ -0,0 +1,356 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: quantized.proto
+
+package weight_pb
+
+import (
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// QuantizedTensor is a float tensor quantized to unsigned integers of a few bits with the affine mapping
+// value = (q - zero_point) * scale, for the whole tensor or for each slice along its first dimension.
+type QuantizedTensor struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Shape []int64                `protobuf:"varint,2,rep,packed,name=shape,proto3" json:"shape,omitempty"`
+	// Dtype of the original tensor, restored on dequantization.
+	Dtype DType `protobuf:"varint,3,opt,name=dtype,proto3,enum=weight.DType" json:"dtype,omitempty"`
+	// Bits per quantized element, 8 or 4.
+	Bits int32 `protobuf:"varint,4,opt,name=bits,proto3" json:"bits,omitempty"`
+	// One scale and zero point for the whole tensor, or one per slice along the first dimension.
+	Scales     []float32 `protobuf:"fixed32,5,rep,packed,name=scales,proto3" json:"scales,omitempty"`
+	ZeroPoints []int32   `protobuf:"varint,6,rep,packed,name=zero_points,json=zeroPoints,proto3" json:"zero_points,omitempty"`
+	// Quantized elements in row-major order, one per byte for 8 bits, two per byte, low nibble first, for 4 bits.
+	Data          []byte `protobuf:"bytes,7,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QuantizedTensor) Reset() {
+	*x = QuantizedTensor{}
+	mi := &file_quantized_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QuantizedTensor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuantizedTensor) ProtoMessage() {}
+
+func (x *QuantizedTensor) ProtoReflect() protoreflect.Message {
+	mi := &file_quantized_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuantizedTensor.ProtoReflect.Descriptor instead.
+func (*QuantizedTensor) Descriptor() ([]byte, []int) {
+	return file_quantized_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *QuantizedTensor) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *QuantizedTensor) GetShape() []int64 {
+	if x != nil {
+		return x.Shape
+	}
+	return nil
+}
+
+func (x *QuantizedTensor) GetDtype() DType {
+	if x != nil {
+		return x.Dtype
+	}
+	return DType_DTYPE_UNSPECIFIED
+}
+
+func (x *QuantizedTensor) GetBits() int32 {
+	if x != nil {
+		return x.Bits
+	}
+	return 0
+}
+
+func (x *QuantizedTensor) GetScales() []float32 {
+	if x != nil {
+		return x.Scales
+	}
+	return nil
+}
+
+func (x *QuantizedTensor) GetZeroPoints() []int32 {
+	if x != nil {
+		return x.ZeroPoints
+	}
+	return nil
+}
+
+func (x *QuantizedTensor) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// QuantizedModelTensor is a tensor of a QuantizedModel, quantized or, if it is not a float tensor, kept as is.
+type QuantizedModelTensor struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Encoding:
+	//
+	//	*QuantizedModelTensor_Raw
+	//	*QuantizedModelTensor_Quantized
+	Encoding      isQuantizedModelTensor_Encoding `protobuf_oneof:"encoding"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QuantizedModelTensor) Reset() {
+	*x = QuantizedModelTensor{}
+	mi := &file_quantized_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QuantizedModelTensor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuantizedModelTensor) ProtoMessage() {}
+
+func (x *QuantizedModelTensor) ProtoReflect() protoreflect.Message {
+	mi := &file_quantized_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuantizedModelTensor.ProtoReflect.Descriptor instead.
+func (*QuantizedModelTensor) Descriptor() ([]byte, []int) {
+	return file_quantized_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *QuantizedModelTensor) GetEncoding() isQuantizedModelTensor_Encoding {
+	if x != nil {
+		return x.Encoding
+	}
+	return nil
+}
+
+func (x *QuantizedModelTensor) GetRaw() *Tensor {
+	if x != nil {
+		if x, ok := x.Encoding.(*QuantizedModelTensor_Raw); ok {
+			return x.Raw
+		}
+	}
+	return nil
+}
+
+func (x *QuantizedModelTensor) GetQuantized() *QuantizedTensor {
+	if x != nil {
+		if x, ok := x.Encoding.(*QuantizedModelTensor_Quantized); ok {
+			return x.Quantized
+		}
+	}
+	return nil
+}
+
+type isQuantizedModelTensor_Encoding interface {
+	isQuantizedModelTensor_Encoding()
+}
+
+type QuantizedModelTensor_Raw struct {
+	Raw *Tensor `protobuf:"bytes,1,opt,name=raw,proto3,oneof"`
+}
+
+type QuantizedModelTensor_Quantized struct {
+	Quantized *QuantizedTensor `protobuf:"bytes,2,opt,name=quantized,proto3,oneof"`
+}
+
+func (*QuantizedModelTensor_Raw) isQuantizedModelTensor_Encoding() {}
+
+func (*QuantizedModelTensor_Quantized) isQuantizedModelTensor_Encoding() {}
+
+// QuantizedModel is a TensorModel whose float tensors are quantized.
+type QuantizedModel struct {
+	state          protoimpl.MessageState  `protogen:"open.v1"`
+	ArchitectureId string                  `protobuf:"bytes,9,opt,name=architecture_id,json=architectureId,proto3" json:"architecture_id,omitempty"`
+	Tensors        []*QuantizedModelTensor `protobuf:"bytes,10,rep,name=tensors,proto3" json:"tensors,omitempty"`
+	Metadata       map[string]string       `protobuf:"bytes,11,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *QuantizedModel) Reset() {
+	*x = QuantizedModel{}
+	mi := &file_quantized_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QuantizedModel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuantizedModel) ProtoMessage() {}
+
+func (x *QuantizedModel) ProtoReflect() protoreflect.Message {
+	mi := &file_quantized_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuantizedModel.ProtoReflect.Descriptor instead.
+func (*QuantizedModel) Descriptor() ([]byte, []int) {
+	return file_quantized_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *QuantizedModel) GetArchitectureId() string {
+	if x != nil {
+		return x.ArchitectureId
+	}
+	return ""
+}
+
+func (x *QuantizedModel) GetTensors() []*QuantizedModelTensor {
+	if x != nil {
+		return x.Tensors
+	}
+	return nil
+}
+
+func (x *QuantizedModel) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+var File_quantized_proto protoreflect.FileDescriptor
+
+const file_quantized_proto_rawDesc = "" +
+	"\n" +
+	"\x0fquantized.proto\x12\x06weight\x1a\vmodel.proto\"\xc1\x01\n" +
+	"\x0fQuantizedTensor\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05shape\x18\x02 \x03(\x03R\x05shape\x12#\n" +
+	"\x05dtype\x18\x03 \x01(\x0e2\r.weight.DTypeR\x05dtype\x12\x12\n" +
+	"\x04bits\x18\x04 \x01(\x05R\x04bits\x12\x16\n" +
+	"\x06scales\x18\x05 \x03(\x02R\x06scales\x12\x1f\n" +
+	"\vzero_points\x18\x06 \x03(\x05R\n" +
+	"zeroPoints\x12\x12\n" +
+	"\x04data\x18\a \x01(\fR\x04data\"\x7f\n" +
+	"\x14QuantizedModelTensor\x12\"\n" +
+	"\x03raw\x18\x01 \x01(\v2\x0e.weight.TensorH\x00R\x03raw\x127\n" +
+	"\tquantized\x18\x02 \x01(\v2\x17.weight.QuantizedTensorH\x00R\tquantizedB\n" +
+	"\n" +
+	"\bencoding\"\xf6\x01\n" +
+	"\x0eQuantizedModel\x12'\n" +
+	"\x0farchitecture_id\x18\t \x01(\tR\x0earchitectureId\x126\n" +
+	"\atensors\x18\n" +
+	" \x03(\v2\x1c.weight.QuantizedModelTensorR\atensors\x12@\n" +
+	"\bmetadata\x18\v \x03(\v2$.weight.QuantizedModel.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01J\x04\b\x01\x10\tB\rZ\v./weight_pbb\x06proto3"
+
+var (
+	file_quantized_proto_rawDescOnce sync.Once
+	file_quantized_proto_rawDescData []byte
+)
+
+func file_quantized_proto_rawDescGZIP() []byte {
+	file_quantized_proto_rawDescOnce.Do(func() {
+		file_quantized_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_quantized_proto_rawDesc), len(file_quantized_proto_rawDesc)))
+	})
+	return file_quantized_proto_rawDescData
+}
+
+var file_quantized_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_quantized_proto_goTypes = []any{
+	(*QuantizedTensor)(nil),      // 0: weight.QuantizedTensor
+	(*QuantizedModelTensor)(nil), // 1: weight.QuantizedModelTensor
+	(*QuantizedModel)(nil),       // 2: weight.QuantizedModel
+	nil,                          // 3: weight.QuantizedModel.MetadataEntry
+	(DType)(0),                   // 4: weight.DType
+	(*Tensor)(nil),               // 5: weight.Tensor
+}
+var file_quantized_proto_depIdxs = []int32{
+	4, // 0: weight.QuantizedTensor.dtype:type_name -> weight.DType
+	5, // 1: weight.QuantizedModelTensor.raw:type_name -> weight.Tensor
+	0, // 2: weight.QuantizedModelTensor.quantized:type_name -> weight.QuantizedTensor
+	1, // 3: weight.QuantizedModel.tensors:type_name -> weight.QuantizedModelTensor
+	3, // 4: weight.QuantizedModel.metadata:type_name -> weight.QuantizedModel.MetadataEntry
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_quantized_proto_init() }
+func file_quantized_proto_init() {
+	if File_quantized_proto != nil {
+		return
+	}
+	file_model_proto_init()
+	file_quantized_proto_msgTypes[1].OneofWrappers = []any{
+		(*QuantizedModelTensor_Raw)(nil),
+		(*QuantizedModelTensor_Quantized)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_quantized_proto_rawDesc), len(file_quantized_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_quantized_proto_goTypes,
+		DependencyIndexes: file_quantized_proto_depIdxs,
+		MessageInfos:      file_quantized_proto_msgTypes,
+	}.Build()
+	File_quantized_proto = out.File
+	file_quantized_proto_goTypes = nil
+	file_quantized_proto_depIdxs = nil
+}
@@ -0,0 +1,328 @@
+package weight_pb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// LegacyTensorName is the name of the tensor holding the values of a WeightModel read as a TensorModel.
+const LegacyTensorName = "values"
+
+// Size returns the size in bytes of one element of the dtype, or 0 if the dtype is unspecified or unknown.
+func (x DType) Size() int {
+	switch x {
+	case DType_DTYPE_FLOAT32:
+		return 4
+	case DType_DTYPE_FLOAT16, DType_DTYPE_BFLOAT16:
+		return 2
+	case DType_DTYPE_INT8:
+		return 1
+	case DType_DTYPE_INT64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// NumElements returns the number of elements of a tensor with the given shape.
+func NumElements(shape []int64) (int64, error) {
+	n := int64(1)
+	for _, dim := range shape {
+		if dim < 0 {
+			return 0, fmt.Errorf("invalid dimension %d in shape %v", dim, shape)
+		}
+		if dim != 0 && n > math.MaxInt64/dim {
+			return 0, fmt.Errorf("shape %v has too many elements", shape)
+		}
+		n *= dim
+	}
+
+	return n, nil
+}
+
+// NewTensorModel creates an empty model of the given architecture.
+func NewTensorModel(architectureId string) *TensorModel {
+	return &TensorModel{ArchitectureId: architectureId, Metadata: map[string]string{}}
+}
+
+// AddTensor validates a tensor and appends it to the model. Tensor names must be unique within a model.
+func (x *TensorModel) AddTensor(tensor *Tensor) error {
+	if err := tensor.Validate(); err != nil {
+		return err
+	}
+	if x.Tensor(tensor.Name) != nil {
+		return fmt.Errorf("model already has a tensor named %q", tensor.Name)
+	}
+
+	x.Tensors = append(x.Tensors, tensor)
+	return nil
+}
+
+// Tensor returns the tensor with the given name, or nil if the model has none.
+func (x *TensorModel) Tensor(name string) *Tensor {
+	for _, tensor := range x.GetTensors() {
+		if tensor.Name == name {
+			return tensor
+		}
+	}
+
+	return nil
+}
+
+// NewFloat32Tensor creates a float32 tensor from values in row-major order.
+func NewFloat32Tensor(name string, shape []int64, values []float32) (*Tensor, error) {
+	return newTensor(name, shape, DType_DTYPE_FLOAT32, len(values), func(data []byte) {
+		for i, value := range values {
+			binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+		}
+	})
+}
+
+// NewFloat16Tensor creates a float16 tensor from values in row-major order, rounding them to the nearest float16.
+func NewFloat16Tensor(name string, shape []int64, values []float32) (*Tensor, error) {
+	return newTensor(name, shape, DType_DTYPE_FLOAT16, len(values), func(data []byte) {
+		for i, value := range values {
+			binary.LittleEndian.PutUint16(data[2*i:], Float32ToFloat16(value))
+		}
+	})
+}
+
+// NewBFloat16Tensor creates a bfloat16 tensor from values in row-major order, rounding them to the nearest bfloat16.
+func NewBFloat16Tensor(name string, shape []int64, values []float32) (*Tensor, error) {
+	return newTensor(name, shape, DType_DTYPE_BFLOAT16, len(values), func(data []byte) {
+		for i, value := range values {
+			binary.LittleEndian.PutUint16(data[2*i:], Float32ToBFloat16(value))
+		}
+	})
+}
+
+// NewInt8Tensor creates an int8 tensor from values in row-major order.
+func NewInt8Tensor(name string, shape []int64, values []int8) (*Tensor, error) {
+	return newTensor(name, shape, DType_DTYPE_INT8, len(values), func(data []byte) {
+		for i, value := range values {
+			data[i] = byte(value)
+		}
+	})
+}
+
+// NewInt64Tensor creates an int64 tensor from values in row-major order.
+func NewInt64Tensor(name string, shape []int64, values []int64) (*Tensor, error) {
+	return newTensor(name, shape, DType_DTYPE_INT64, len(values), func(data []byte) {
+		for i, value := range values {
+			binary.LittleEndian.PutUint64(data[8*i:], uint64(value))
+		}
+	})
+}
+
+// newTensor checks that count values fill the shape and packs them with pack into the data of a new tensor.
+func newTensor(name string, shape []int64, dtype DType, count int, pack func(data []byte)) (*Tensor, error) {
+	n, err := NumElements(shape)
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(count) {
+		return nil, fmt.Errorf("tensor %q of shape %v needs %d values, got %d", name, shape, n, count)
+	}
+
+	data := make([]byte, count*dtype.Size())
+	pack(data)
+
+	return &Tensor{Name: name, Shape: append([]int64(nil), shape...), Dtype: dtype, Data: data}, nil
+}
+
+// Validate checks that the tensor has a name, a known dtype and as much data as its shape requires.
+func (x *Tensor) Validate() error {
+	if x.GetName() == "" {
+		return fmt.Errorf("tensor has no name")
+	}
+	if x.GetDtype().Size() == 0 {
+		return fmt.Errorf("tensor %q has unsupported dtype %v", x.GetName(), x.GetDtype())
+	}
+
+	n, err := x.NumElements()
+	if err != nil {
+		return fmt.Errorf("tensor %q: %w", x.GetName(), err)
+	}
+	size := int64(x.GetDtype().Size())
+	if n > math.MaxInt64/size || int64(len(x.GetData())) != n*size {
+		return fmt.Errorf("tensor %q of shape %v and dtype %v has %d bytes of data", x.GetName(), x.GetShape(), x.GetDtype(), len(x.GetData()))
+	}
+
+	return nil
+}
+
+// NumElements returns the number of elements of the tensor.
+func (x *Tensor) NumElements() (int64, error) {
+	return NumElements(x.GetShape())
+}
+
+// Float32s returns the elements of a tensor of any dtype as float32 values.
+// Integer values beyond 2^24 lose precision.
+func (x *Tensor) Float32s() ([]float32, error) {
+	if err := x.Validate(); err != nil {
+		return nil, err
+	}
+
+	data := x.GetData()
+	values := make([]float32, len(data)/x.GetDtype().Size())
+	for i := range values {
+		switch x.GetDtype() {
+		case DType_DTYPE_FLOAT32:
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+		case DType_DTYPE_FLOAT16:
+			values[i] = Float16ToFloat32(binary.LittleEndian.Uint16(data[2*i:]))
+		case DType_DTYPE_BFLOAT16:
+			values[i] = BFloat16ToFloat32(binary.LittleEndian.Uint16(data[2*i:]))
+		case DType_DTYPE_INT8:
+			values[i] = float32(int8(data[i]))
+		case DType_DTYPE_INT64:
+			values[i] = float32(int64(binary.LittleEndian.Uint64(data[8*i:])))
+		}
+	}
+
+	return values, nil
+}
+
+// Int64s returns the elements of an integer tensor as int64 values.
+func (x *Tensor) Int64s() ([]int64, error) {
+	if err := x.Validate(); err != nil {
+		return nil, err
+	}
+
+	data := x.GetData()
+	switch x.GetDtype() {
+	case DType_DTYPE_INT8:
+		values := make([]int64, len(data))
+		for i := range values {
+			values[i] = int64(int8(data[i]))
+		}
+		return values, nil
+	case DType_DTYPE_INT64:
+		values := make([]int64, len(data)/8)
+		for i := range values {
+			values[i] = int64(binary.LittleEndian.Uint64(data[8*i:]))
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("tensor %q has dtype %v, not an integer dtype", x.GetName(), x.GetDtype())
+	}
+}
+
+// FromWeightModel converts a WeightModel into a TensorModel holding its values as a single
+// one-dimensional int64 tensor named LegacyTensorName.
+func FromWeightModel(weightModel *WeightModel) *TensorModel {
+	values := weightModel.GetValues()
+	model := NewTensorModel("")
+	tensor, _ := NewInt64Tensor(LegacyTensorName, []int64{int64(len(values))}, values)
+	model.Tensors = []*Tensor{tensor}
+
+	return model
+}
+
+// UnmarshalModel reads a serialised TensorModel, or a serialised WeightModel, which is converted with FromWeightModel.
+// Both can be told apart because a TensorModel never uses field 1, which holds the values of a WeightModel.
+func UnmarshalModel(data []byte) (*TensorModel, error) {
+	model := &TensorModel{}
+	if err := proto.Unmarshal(data, model); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal model: %w", err)
+	}
+	if len(model.Tensors) > 0 || len(model.ProtoReflect().GetUnknown()) == 0 {
+		return model, nil
+	}
+
+	weightModel := &WeightModel{}
+	if err := proto.Unmarshal(data, weightModel); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal weight model: %w", err)
+	}
+
+	return FromWeightModel(weightModel), nil
+}
+
+// Float32ToFloat16 converts a float32 to the bits of the nearest IEEE 754 half-precision float, rounding half to even.
+// Values beyond the range of float16 become infinities.
+func Float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	if exp == 0xff {
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+
+	e := exp - 127 + 15
+	if e >= 0x1f {
+		return sign | 0x7c00
+	}
+
+	if e <= 0 {
+		// The value is a float16 subnormal, or rounds to zero.
+		if e < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint32(14 - e)
+		half := mant >> shift
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rem > halfway || (rem == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	// Rounding up may carry into the exponent, which is still correct, up to infinity.
+	half := uint32(e)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++
+	}
+
+	return sign | uint16(half)
+}
+
+// Float16ToFloat32 converts the bits of an IEEE 754 half-precision float to a float32, exactly.
+func Float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Normalise the subnormal.
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		return math.Float32frombits(sign | e<<23 | (mant&0x3ff)<<13)
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
+
+// Float32ToBFloat16 converts a float32 to the bits of the nearest bfloat16, rounding half to even.
+func Float32ToBFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	if bits&0x7fffffff > 0x7f800000 {
+		// Keep NaNs quiet instead of rounding them to infinity.
+		return uint16(bits>>16) | 0x40
+	}
+
+	return uint16((bits + 0x7fff + (bits>>16)&1) >> 16)
+}
+
+// BFloat16ToFloat32 converts the bits of a bfloat16 to a float32, exactly.
+func BFloat16ToFloat32(b uint16) float32 {
+	return math.Float32frombits(uint32(b) << 16)
+}
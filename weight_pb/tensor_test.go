@@ -0,0 +1,120 @@
+package weight_pb
+
+import (
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTensorModelRoundTrip(t *testing.T) {
+	model := NewTensorModel("mlp")
+	model.Metadata["framework"] = "pytorch"
+
+	weights, err := NewFloat32Tensor("fc.weight", []int64{2, 3}, []float32{1, -2, 3.5, 0, 1e-3, -7})
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+	half, err := NewFloat16Tensor("fc.bias", []int64{2}, []float32{0.5, -1.25})
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+	counts, err := NewInt8Tensor("counts", []int64{3}, []int8{-128, 0, 127})
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+	for _, tensor := range []*Tensor{weights, half, counts} {
+		if err := model.AddTensor(tensor); err != nil {
+			t.Fatalf("Failed to add tensor: %v", err)
+		}
+	}
+	if err := model.AddTensor(weights); err == nil {
+		t.Fatalf("Expected a duplicate tensor name to be rejected")
+	}
+	if _, err := NewFloat32Tensor("wrong", []int64{2, 2}, []float32{1}); err == nil {
+		t.Fatalf("Expected values not filling the shape to be rejected")
+	}
+
+	data, err := proto.Marshal(model)
+	if err != nil {
+		t.Fatalf("Failed to marshal model: %v", err)
+	}
+	read, err := UnmarshalModel(data)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal model: %v", err)
+	}
+	if read.ArchitectureId != "mlp" || read.Metadata["framework"] != "pytorch" || len(read.Tensors) != 3 {
+		t.Fatalf("Unexpected model: %v", read)
+	}
+
+	values, err := read.Tensor("fc.weight").Float32s()
+	if err != nil || values[2] != 3.5 || values[5] != -7 {
+		t.Fatalf("Unexpected fc.weight values %v (%v)", values, err)
+	}
+	values, err = read.Tensor("fc.bias").Float32s()
+	if err != nil || values[0] != 0.5 || values[1] != -1.25 {
+		t.Fatalf("Unexpected fc.bias values %v (%v)", values, err)
+	}
+	ints, err := read.Tensor("counts").Int64s()
+	if err != nil || ints[0] != -128 || ints[2] != 127 {
+		t.Fatalf("Unexpected counts values %v (%v)", ints, err)
+	}
+	if _, err := read.Tensor("fc.weight").Int64s(); err == nil {
+		t.Fatalf("Expected reading a float tensor as integers to fail")
+	}
+}
+
+func TestUnmarshalWeightModel(t *testing.T) {
+	data, err := proto.Marshal(&WeightModel{Values: []int64{1, -2, 3}})
+	if err != nil {
+		t.Fatalf("Failed to marshal weight model: %v", err)
+	}
+
+	model, err := UnmarshalModel(data)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal weight model: %v", err)
+	}
+
+	tensor := model.Tensor(LegacyTensorName)
+	if tensor == nil || tensor.Dtype != DType_DTYPE_INT64 || len(tensor.Shape) != 1 || tensor.Shape[0] != 3 {
+		t.Fatalf("Expected a single int64 tensor of 3 values, got %v", model)
+	}
+	values, err := tensor.Int64s()
+	if err != nil || values[1] != -2 {
+		t.Fatalf("Unexpected values %v (%v)", values, err)
+	}
+}
+
+func TestHalfPrecisionConversions(t *testing.T) {
+	tests := []struct {
+		value    float32
+		float16  uint16
+		bfloat16 uint16
+	}{
+		{value: 1, float16: 0x3c00, bfloat16: 0x3f80},
+		{value: -2, float16: 0xc000, bfloat16: 0xc000},
+		{value: 65504, float16: 0x7bff, bfloat16: 0x4780},
+		{value: 1e6, float16: 0x7c00, bfloat16: 0x4974},
+		{value: float32(math.Pow(2, -24)), float16: 0x0001, bfloat16: 0x3380},
+		{value: 0, float16: 0x0000, bfloat16: 0x0000},
+	}
+
+	for _, test := range tests {
+		if got := Float32ToFloat16(test.value); got != test.float16 {
+			t.Fatalf("Expected %g to be float16 %#04x, got %#04x", test.value, test.float16, got)
+		}
+		if got := Float32ToBFloat16(test.value); got != test.bfloat16 {
+			t.Fatalf("Expected %g to be bfloat16 %#04x, got %#04x", test.value, test.bfloat16, got)
+		}
+	}
+
+	// Every finite float16 survives a round trip through float32.
+	for h := 0; h < 0x10000; h++ {
+		if h&0x7c00 == 0x7c00 {
+			continue
+		}
+		if got := Float32ToFloat16(Float16ToFloat32(uint16(h))); got != uint16(h) {
+			t.Fatalf("Float16 %#04x became %#04x", h, got)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package weight_pb
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ModelFetcher returns the model stored under a CID. It resolves the base model of a delta update.
+type ModelFetcher func(ctx context.Context, cid string) (*TensorModel, error)
+
+// UpdateOptions holds how a model is encoded into a ModelUpdate.
+// TopKFraction - if set, only this fraction of the elements of each tensor, those of the largest magnitude, is kept
+// and the others are dropped (top-k sparsification); 0.01 keeps 1%. Zero elements are never stored.
+type UpdateOptions struct {
+	TopKFraction float64
+}
+
+// EncodeSparse encodes a model as a ModelUpdate without base. Each tensor is stored sparsely when that is smaller.
+func EncodeSparse(model *TensorModel, opts UpdateOptions) (*ModelUpdate, error) {
+	update := &ModelUpdate{ArchitectureId: model.GetArchitectureId(), Metadata: copyMetadata(model.GetMetadata())}
+
+	for _, tensor := range model.GetTensors() {
+		if err := tensor.Validate(); err != nil {
+			return nil, err
+		}
+
+		updateTensor, err := encodeTensor(tensor, opts)
+		if err != nil {
+			return nil, err
+		}
+		update.Tensors = append(update.Tensors, updateTensor)
+	}
+
+	return update, nil
+}
+
+// EncodeDelta encodes a model as its difference to a base model, the model stored under baseCid, which is recorded
+// in the update. Both models must have the same tensors, with the same shapes and dtypes. Differences of float tensors
+// are stored as float32 and those of integer tensors as int64; unchanged tensors are left out.
+func EncodeDelta(baseCid string, base *TensorModel, model *TensorModel, opts UpdateOptions) (*ModelUpdate, error) {
+	if baseCid == "" {
+		return nil, fmt.Errorf("a delta needs the CID of its base model")
+	}
+	if len(base.GetTensors()) != len(model.GetTensors()) {
+		return nil, fmt.Errorf("base model has %d tensors, model has %d", len(base.GetTensors()), len(model.GetTensors()))
+	}
+
+	update := &ModelUpdate{BaseCid: baseCid, ArchitectureId: model.GetArchitectureId(), Metadata: copyMetadata(model.GetMetadata())}
+
+	for _, tensor := range model.GetTensors() {
+		baseTensor := base.Tensor(tensor.GetName())
+		if baseTensor == nil {
+			return nil, fmt.Errorf("base model has no tensor named %q", tensor.GetName())
+		}
+		if err := checkSameLayout(baseTensor, tensor); err != nil {
+			return nil, err
+		}
+
+		delta, changed, err := tensorDelta(baseTensor, tensor)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+
+		updateTensor, err := encodeTensor(delta, opts)
+		if err != nil {
+			return nil, err
+		}
+		update.Tensors = append(update.Tensors, updateTensor)
+	}
+
+	return update, nil
+}
+
+// Apply reconstructs the dense model held by the update. An update with a base CID needs the base model,
+// whose tensors it changes; other updates ignore base.
+// Float tensors of a delta are reconstructed with float32 arithmetic, so they may differ from the encoded model
+// by rounding, but always reconstruct the same way.
+func (x *ModelUpdate) Apply(base *TensorModel) (*TensorModel, error) {
+	if x.GetBaseCid() == "" {
+		model := NewTensorModel(x.GetArchitectureId())
+		model.Metadata = copyMetadata(x.GetMetadata())
+		for _, updateTensor := range x.GetTensors() {
+			tensor, err := updateTensor.toDense()
+			if err != nil {
+				return nil, err
+			}
+			if err := model.AddTensor(tensor); err != nil {
+				return nil, err
+			}
+		}
+		return model, nil
+	}
+
+	if base == nil {
+		return nil, fmt.Errorf("update is a delta against %s, but no base model was given", x.GetBaseCid())
+	}
+
+	model := proto.Clone(base).(*TensorModel)
+	if x.GetArchitectureId() != "" {
+		model.ArchitectureId = x.GetArchitectureId()
+	}
+	if model.Metadata == nil {
+		model.Metadata = map[string]string{}
+	}
+	maps.Copy(model.Metadata, x.GetMetadata())
+
+	for _, updateTensor := range x.GetTensors() {
+		if err := updateTensor.addTo(model); err != nil {
+			return nil, err
+		}
+	}
+
+	return model, nil
+}
+
+// DecodeModel reads a serialised ModelUpdate, TensorModel or WeightModel and returns the dense model.
+// The base model of a delta update is fetched with fetch, which may be nil if no delta is expected.
+func DecodeModel(ctx context.Context, data []byte, fetch ModelFetcher) (*TensorModel, error) {
+	// A ModelUpdate reserves the fields of the other formats, which therefore always leave unknown fields.
+	update := &ModelUpdate{}
+	if err := proto.Unmarshal(data, update); err != nil || len(data) == 0 || len(update.ProtoReflect().GetUnknown()) > 0 {
+		return UnmarshalModel(data)
+	}
+
+	var base *TensorModel
+	if update.GetBaseCid() != "" {
+		if fetch == nil {
+			return nil, fmt.Errorf("update is a delta against %s, but no base model can be fetched", update.GetBaseCid())
+		}
+
+		var err error
+		base, err = fetch(ctx, update.GetBaseCid())
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch base model %s: %w", update.GetBaseCid(), err)
+		}
+	}
+
+	return update.Apply(base)
+}
+
+// NewSparseTensor stores the non-zero elements of a tensor.
+func NewSparseTensor(tensor *Tensor) (*SparseTensor, error) {
+	if err := tensor.Validate(); err != nil {
+		return nil, err
+	}
+
+	return sparsify(tensor, -1)
+}
+
+// TopK stores the k elements of a tensor with the largest magnitude, leaving out zero elements.
+// Elements of equal magnitude are kept in row-major order.
+func TopK(tensor *Tensor, k int) (*SparseTensor, error) {
+	if err := tensor.Validate(); err != nil {
+		return nil, err
+	}
+	if k < 0 {
+		return nil, fmt.Errorf("invalid k %d", k)
+	}
+
+	return sparsify(tensor, int64(k))
+}
+
+// ToDense expands a sparse tensor into a dense one, filling the elements not stored with zeros.
+func (x *SparseTensor) ToDense() (*Tensor, error) {
+	if err := x.validate(); err != nil {
+		return nil, err
+	}
+
+	size := int64(x.GetDtype().Size())
+	n, _ := NumElements(x.GetShape())
+	tensor := &Tensor{Name: x.GetName(), Shape: x.GetShape(), Dtype: x.GetDtype(), Data: make([]byte, n*size)}
+	for i, index := range x.GetIndices() {
+		copy(tensor.Data[index*size:(index+1)*size], x.GetValues()[int64(i)*size:])
+	}
+
+	return tensor, nil
+}
+
+// validate checks that the indices are ascending and within the shape, and that there is one value per index.
+func (x *SparseTensor) validate() error {
+	if err := x.values().Validate(); err != nil {
+		return fmt.Errorf("invalid sparse tensor: %w", err)
+	}
+
+	n, err := NumElements(x.GetShape())
+	if err != nil {
+		return fmt.Errorf("sparse tensor %q: %w", x.GetName(), err)
+	}
+	for i, index := range x.GetIndices() {
+		if index < 0 || index >= n || (i > 0 && index <= x.GetIndices()[i-1]) {
+			return fmt.Errorf("sparse tensor %q has invalid index %d at position %d", x.GetName(), index, i)
+		}
+	}
+
+	return nil
+}
+
+// values returns the stored elements as a tensor of one dimension.
+func (x *SparseTensor) values() *Tensor {
+	return &Tensor{Name: x.GetName(), Shape: []int64{int64(len(x.GetIndices()))}, Dtype: x.GetDtype(), Data: x.GetValues()}
+}
+
+// encodeTensor stores a tensor sparsely or densely, whichever is smaller, keeping only its top-k elements if requested.
+func encodeTensor(tensor *Tensor, opts UpdateOptions) (*UpdateTensor, error) {
+	k := int64(-1)
+	if opts.TopKFraction != 0 {
+		if opts.TopKFraction < 0 || opts.TopKFraction > 1 {
+			return nil, fmt.Errorf("top-k fraction %g is not between 0 and 1", opts.TopKFraction)
+		}
+		n, _ := tensor.NumElements()
+		k = int64(math.Ceil(opts.TopKFraction * float64(n)))
+	}
+
+	sparse, err := sparsify(tensor, k)
+	if err != nil {
+		return nil, err
+	}
+	if proto.Size(sparse) < len(tensor.GetData()) {
+		return &UpdateTensor{Encoding: &UpdateTensor_Sparse{Sparse: sparse}}, nil
+	}
+
+	if k >= 0 {
+		// The dropped elements must stay dropped in the dense form.
+		if tensor, err = sparse.ToDense(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &UpdateTensor{Encoding: &UpdateTensor_Dense{Dense: tensor}}, nil
+}
+
+// sparsify stores the non-zero elements of a valid tensor, or only the k largest in magnitude if k is not negative.
+func sparsify(tensor *Tensor, k int64) (*SparseTensor, error) {
+	magnitudes, err := tensor.magnitudes()
+	if err != nil {
+		return nil, err
+	}
+
+	var threshold float64
+	equalAllowed := int64(math.MaxInt64)
+	if k >= 0 && k < int64(len(magnitudes)) {
+		if k == 0 {
+			threshold = math.Inf(1)
+			equalAllowed = 0
+		} else {
+			threshold = kthLargest(append([]float64(nil), magnitudes...), int(k))
+			greater := int64(0)
+			for _, magnitude := range magnitudes {
+				if magnitude > threshold {
+					greater++
+				}
+			}
+			equalAllowed = k - greater
+		}
+	}
+
+	size := int64(tensor.GetDtype().Size())
+	sparse := &SparseTensor{Name: tensor.GetName(), Shape: tensor.GetShape(), Dtype: tensor.GetDtype()}
+	for i, magnitude := range magnitudes {
+		if magnitude == 0 || magnitude < threshold {
+			continue
+		}
+		if magnitude == threshold {
+			if equalAllowed == 0 {
+				continue
+			}
+			equalAllowed--
+		}
+
+		sparse.Indices = append(sparse.Indices, int64(i))
+		sparse.Values = append(sparse.Values, tensor.GetData()[int64(i)*size:int64(i+1)*size]...)
+	}
+
+	return sparse, nil
+}
+
+// magnitudes returns the absolute values of the elements of a valid tensor. NaNs have an infinite magnitude,
+// so that they are kept, and negative zeros a magnitude of zero.
+func (x *Tensor) magnitudes() ([]float64, error) {
+	if isFloat(x.GetDtype()) {
+		values, err := x.Float32s()
+		if err != nil {
+			return nil, err
+		}
+		magnitudes := make([]float64, len(values))
+		for i, value := range values {
+			magnitudes[i] = math.Abs(float64(value))
+			if math.IsNaN(magnitudes[i]) {
+				magnitudes[i] = math.Inf(1)
+			}
+		}
+		return magnitudes, nil
+	}
+
+	values, err := x.Int64s()
+	if err != nil {
+		return nil, err
+	}
+	magnitudes := make([]float64, len(values))
+	for i, value := range values {
+		magnitudes[i] = math.Abs(float64(value))
+	}
+
+	return magnitudes, nil
+}
+
+// kthLargest returns the k-th largest value, reordering values.
+func kthLargest(values []float64, k int) float64 {
+	target := k - 1
+	lo, hi := 0, len(values)-1
+	for lo < hi {
+		pivot := values[(lo+hi)/2]
+		i, j := lo, hi
+		for i <= j {
+			for values[i] > pivot {
+				i++
+			}
+			for values[j] < pivot {
+				j--
+			}
+			if i <= j {
+				values[i], values[j] = values[j], values[i]
+				i++
+				j--
+			}
+		}
+
+		switch {
+		case target <= j:
+			hi = j
+		case target >= i:
+			lo = i
+		default:
+			return values[target]
+		}
+	}
+
+	return values[target]
+}
+
+// tensorDelta returns the difference of a tensor to its base tensor, and whether there is any difference.
+func tensorDelta(base *Tensor, tensor *Tensor) (*Tensor, bool, error) {
+	if isFloat(tensor.GetDtype()) {
+		baseValues, err := base.Float32s()
+		if err != nil {
+			return nil, false, err
+		}
+		values, err := tensor.Float32s()
+		if err != nil {
+			return nil, false, err
+		}
+
+		changed := false
+		for i := range values {
+			values[i] -= baseValues[i]
+			changed = changed || values[i] != 0
+		}
+		delta, err := NewFloat32Tensor(tensor.GetName(), tensor.GetShape(), values)
+		return delta, changed, err
+	}
+
+	baseValues, err := base.Int64s()
+	if err != nil {
+		return nil, false, err
+	}
+	values, err := tensor.Int64s()
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := false
+	for i := range values {
+		values[i] -= baseValues[i]
+		changed = changed || values[i] != 0
+	}
+	delta, err := NewInt64Tensor(tensor.GetName(), tensor.GetShape(), values)
+	return delta, changed, err
+}
+
+// toDense returns the tensor held by an update tensor, expanding it if it is sparse.
+func (x *UpdateTensor) toDense() (*Tensor, error) {
+	switch {
+	case x.GetDense() != nil:
+		return x.GetDense(), nil
+	case x.GetSparse() != nil:
+		return x.GetSparse().ToDense()
+	default:
+		return nil, fmt.Errorf("update tensor holds no tensor")
+	}
+}
+
+// addTo adds the difference held by an update tensor to the tensor of the model with the same name.
+func (x *UpdateTensor) addTo(model *TensorModel) error {
+	var delta *Tensor
+	var shape, indices []int64
+	switch {
+	case x.GetDense() != nil:
+		delta = x.GetDense()
+		shape = delta.GetShape()
+	case x.GetSparse() != nil:
+		if err := x.GetSparse().validate(); err != nil {
+			return err
+		}
+		delta = x.GetSparse().values()
+		shape = x.GetSparse().GetShape()
+		indices = x.GetSparse().GetIndices()
+	default:
+		return fmt.Errorf("update tensor holds no tensor")
+	}
+
+	name := delta.GetName()
+	target := model.Tensor(name)
+	if target == nil {
+		return fmt.Errorf("base model has no tensor named %q", name)
+	}
+	if !slices.Equal(target.GetShape(), shape) {
+		return fmt.Errorf("tensor %q has shape %v in the base model and %v in the update", name, target.GetShape(), shape)
+	}
+
+	var sum *Tensor
+	var err error
+	if isFloat(target.GetDtype()) {
+		sum, err = addFloats(target, delta, indices)
+	} else {
+		sum, err = addInts(target, delta, indices)
+	}
+	if err != nil {
+		return err
+	}
+
+	target.Data = sum.Data
+	return nil
+}
+
+// addFloats adds the elements of delta to the elements of a float tensor at indices, or to all of them if indices is nil.
+func addFloats(target *Tensor, delta *Tensor, indices []int64) (*Tensor, error) {
+	values, err := target.Float32s()
+	if err != nil {
+		return nil, err
+	}
+	deltaValues, err := delta.Float32s()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range deltaValues {
+		values[position(indices, i)] += value
+	}
+
+	return newFloatTensor(target.GetName(), target.GetShape(), target.GetDtype(), values)
+}
+
+// addInts adds the elements of delta to the elements of an integer tensor at indices, or to all of them if indices is nil.
+func addInts(target *Tensor, delta *Tensor, indices []int64) (*Tensor, error) {
+	if isFloat(delta.GetDtype()) {
+		return nil, fmt.Errorf("tensor %q has an integer dtype, its difference %v", target.GetName(), delta.GetDtype())
+	}
+
+	values, err := target.Int64s()
+	if err != nil {
+		return nil, err
+	}
+	deltaValues, err := delta.Int64s()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range deltaValues {
+		values[position(indices, i)] += value
+	}
+
+	return newIntTensor(target.GetName(), target.GetShape(), target.GetDtype(), values)
+}
+
+// position returns the element of a tensor changed by the i-th element of a difference stored at indices.
+func position(indices []int64, i int) int64 {
+	if indices == nil {
+		return int64(i)
+	}
+
+	return indices[i]
+}
+
+// newFloatTensor creates a tensor of a float dtype from float32 values.
+func newFloatTensor(name string, shape []int64, dtype DType, values []float32) (*Tensor, error) {
+	switch dtype {
+	case DType_DTYPE_FLOAT16:
+		return NewFloat16Tensor(name, shape, values)
+	case DType_DTYPE_BFLOAT16:
+		return NewBFloat16Tensor(name, shape, values)
+	default:
+		return NewFloat32Tensor(name, shape, values)
+	}
+}
+
+// newIntTensor creates a tensor of an integer dtype from int64 values, which must fit the dtype.
+func newIntTensor(name string, shape []int64, dtype DType, values []int64) (*Tensor, error) {
+	if dtype != DType_DTYPE_INT8 {
+		return NewInt64Tensor(name, shape, values)
+	}
+
+	narrow := make([]int8, len(values))
+	for i, value := range values {
+		if value < math.MinInt8 || value > math.MaxInt8 {
+			return nil, fmt.Errorf("value %d of tensor %q does not fit int8", value, name)
+		}
+		narrow[i] = int8(value)
+	}
+
+	return NewInt8Tensor(name, shape, narrow)
+}
+
+// checkSameLayout checks that two tensors have the same shape and dtype.
+func checkSameLayout(base *Tensor, tensor *Tensor) error {
+	if !slices.Equal(base.GetShape(), tensor.GetShape()) || base.GetDtype() != tensor.GetDtype() {
+		return fmt.Errorf("tensor %q is %v %v in the base model and %v %v in the model",
+			tensor.GetName(), base.GetDtype(), base.GetShape(), tensor.GetDtype(), tensor.GetShape())
+	}
+	if err := base.Validate(); err != nil {
+		return err
+	}
+
+	return tensor.Validate()
+}
+
+func isFloat(dtype DType) bool {
+	return dtype == DType_DTYPE_FLOAT32 || dtype == DType_DTYPE_FLOAT16 || dtype == DType_DTYPE_BFLOAT16
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	copied := make(map[string]string, len(metadata))
+	maps.Copy(copied, metadata)
+
+	return copied
+}
@@ -0,0 +1,344 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: update.proto
+
+package weight_pb
+
+import (
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// SparseTensor holds only some elements of a tensor, the others being zero.
+type SparseTensor struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Shape []int64                `protobuf:"varint,2,rep,packed,name=shape,proto3" json:"shape,omitempty"`
+	Dtype DType                  `protobuf:"varint,3,opt,name=dtype,proto3,enum=weight.DType" json:"dtype,omitempty"`
+	// Row-major positions of the stored elements, in ascending order.
+	Indices []int64 `protobuf:"varint,4,rep,packed,name=indices,proto3" json:"indices,omitempty"`
+	// Stored elements, packed like the data of a Tensor.
+	Values        []byte `protobuf:"bytes,5,opt,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SparseTensor) Reset() {
+	*x = SparseTensor{}
+	mi := &file_update_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SparseTensor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SparseTensor) ProtoMessage() {}
+
+func (x *SparseTensor) ProtoReflect() protoreflect.Message {
+	mi := &file_update_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SparseTensor.ProtoReflect.Descriptor instead.
+func (*SparseTensor) Descriptor() ([]byte, []int) {
+	return file_update_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SparseTensor) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SparseTensor) GetShape() []int64 {
+	if x != nil {
+		return x.Shape
+	}
+	return nil
+}
+
+func (x *SparseTensor) GetDtype() DType {
+	if x != nil {
+		return x.Dtype
+	}
+	return DType_DTYPE_UNSPECIFIED
+}
+
+func (x *SparseTensor) GetIndices() []int64 {
+	if x != nil {
+		return x.Indices
+	}
+	return nil
+}
+
+func (x *SparseTensor) GetValues() []byte {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+// UpdateTensor is a tensor of a ModelUpdate, stored densely or sparsely.
+type UpdateTensor struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Encoding:
+	//
+	//	*UpdateTensor_Dense
+	//	*UpdateTensor_Sparse
+	Encoding      isUpdateTensor_Encoding `protobuf_oneof:"encoding"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateTensor) Reset() {
+	*x = UpdateTensor{}
+	mi := &file_update_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateTensor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateTensor) ProtoMessage() {}
+
+func (x *UpdateTensor) ProtoReflect() protoreflect.Message {
+	mi := &file_update_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateTensor.ProtoReflect.Descriptor instead.
+func (*UpdateTensor) Descriptor() ([]byte, []int) {
+	return file_update_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UpdateTensor) GetEncoding() isUpdateTensor_Encoding {
+	if x != nil {
+		return x.Encoding
+	}
+	return nil
+}
+
+func (x *UpdateTensor) GetDense() *Tensor {
+	if x != nil {
+		if x, ok := x.Encoding.(*UpdateTensor_Dense); ok {
+			return x.Dense
+		}
+	}
+	return nil
+}
+
+func (x *UpdateTensor) GetSparse() *SparseTensor {
+	if x != nil {
+		if x, ok := x.Encoding.(*UpdateTensor_Sparse); ok {
+			return x.Sparse
+		}
+	}
+	return nil
+}
+
+type isUpdateTensor_Encoding interface {
+	isUpdateTensor_Encoding()
+}
+
+type UpdateTensor_Dense struct {
+	Dense *Tensor `protobuf:"bytes,1,opt,name=dense,proto3,oneof"`
+}
+
+type UpdateTensor_Sparse struct {
+	Sparse *SparseTensor `protobuf:"bytes,2,opt,name=sparse,proto3,oneof"`
+}
+
+func (*UpdateTensor_Dense) isUpdateTensor_Encoding() {}
+
+func (*UpdateTensor_Sparse) isUpdateTensor_Encoding() {}
+
+// ModelUpdate is a model encoded sparsely or as a delta against a base model.
+type ModelUpdate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// CID of the model the update is a delta against, empty if the update holds the model itself.
+	BaseCid string `protobuf:"bytes,5,opt,name=base_cid,json=baseCid,proto3" json:"base_cid,omitempty"`
+	// Tensors of the model, or differences to the tensors of the base model with the same name.
+	Tensors        []*UpdateTensor   `protobuf:"bytes,6,rep,name=tensors,proto3" json:"tensors,omitempty"`
+	ArchitectureId string            `protobuf:"bytes,7,opt,name=architecture_id,json=architectureId,proto3" json:"architecture_id,omitempty"`
+	Metadata       map[string]string `protobuf:"bytes,8,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ModelUpdate) Reset() {
+	*x = ModelUpdate{}
+	mi := &file_update_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ModelUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ModelUpdate) ProtoMessage() {}
+
+func (x *ModelUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_update_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ModelUpdate.ProtoReflect.Descriptor instead.
+func (*ModelUpdate) Descriptor() ([]byte, []int) {
+	return file_update_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ModelUpdate) GetBaseCid() string {
+	if x != nil {
+		return x.BaseCid
+	}
+	return ""
+}
+
+func (x *ModelUpdate) GetTensors() []*UpdateTensor {
+	if x != nil {
+		return x.Tensors
+	}
+	return nil
+}
+
+func (x *ModelUpdate) GetArchitectureId() string {
+	if x != nil {
+		return x.ArchitectureId
+	}
+	return ""
+}
+
+func (x *ModelUpdate) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+var File_update_proto protoreflect.FileDescriptor
+
+const file_update_proto_rawDesc = "" +
+	"\n" +
+	"\fupdate.proto\x12\x06weight\x1a\vmodel.proto\"\x8f\x01\n" +
+	"\fSparseTensor\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05shape\x18\x02 \x03(\x03R\x05shape\x12#\n" +
+	"\x05dtype\x18\x03 \x01(\x0e2\r.weight.DTypeR\x05dtype\x12\x18\n" +
+	"\aindices\x18\x04 \x03(\x03R\aindices\x12\x16\n" +
+	"\x06values\x18\x05 \x01(\fR\x06values\"r\n" +
+	"\fUpdateTensor\x12&\n" +
+	"\x05dense\x18\x01 \x01(\v2\x0e.weight.TensorH\x00R\x05dense\x12.\n" +
+	"\x06sparse\x18\x02 \x01(\v2\x14.weight.SparseTensorH\x00R\x06sparseB\n" +
+	"\n" +
+	"\bencoding\"\x83\x02\n" +
+	"\vModelUpdate\x12\x19\n" +
+	"\bbase_cid\x18\x05 \x01(\tR\abaseCid\x12.\n" +
+	"\atensors\x18\x06 \x03(\v2\x14.weight.UpdateTensorR\atensors\x12'\n" +
+	"\x0farchitecture_id\x18\a \x01(\tR\x0earchitectureId\x12=\n" +
+	"\bmetadata\x18\b \x03(\v2!.weight.ModelUpdate.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01J\x04\b\x01\x10\x05B\rZ\v./weight_pbb\x06proto3"
+
+var (
+	file_update_proto_rawDescOnce sync.Once
+	file_update_proto_rawDescData []byte
+)
+
+func file_update_proto_rawDescGZIP() []byte {
+	file_update_proto_rawDescOnce.Do(func() {
+		file_update_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_update_proto_rawDesc), len(file_update_proto_rawDesc)))
+	})
+	return file_update_proto_rawDescData
+}
+
+var file_update_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_update_proto_goTypes = []any{
+	(*SparseTensor)(nil), // 0: weight.SparseTensor
+	(*UpdateTensor)(nil), // 1: weight.UpdateTensor
+	(*ModelUpdate)(nil),  // 2: weight.ModelUpdate
+	nil,                  // 3: weight.ModelUpdate.MetadataEntry
+	(DType)(0),           // 4: weight.DType
+	(*Tensor)(nil),       // 5: weight.Tensor
+}
+var file_update_proto_depIdxs = []int32{
+	4, // 0: weight.SparseTensor.dtype:type_name -> weight.DType
+	5, // 1: weight.UpdateTensor.dense:type_name -> weight.Tensor
+	0, // 2: weight.UpdateTensor.sparse:type_name -> weight.SparseTensor
+	1, // 3: weight.ModelUpdate.tensors:type_name -> weight.UpdateTensor
+	3, // 4: weight.ModelUpdate.metadata:type_name -> weight.ModelUpdate.MetadataEntry
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_update_proto_init() }
+func file_update_proto_init() {
+	if File_update_proto != nil {
+		return
+	}
+	file_model_proto_init()
+	file_update_proto_msgTypes[1].OneofWrappers = []any{
+		(*UpdateTensor_Dense)(nil),
+		(*UpdateTensor_Sparse)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_update_proto_rawDesc), len(file_update_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_update_proto_goTypes,
+		DependencyIndexes: file_update_proto_depIdxs,
+		MessageInfos:      file_update_proto_msgTypes,
+	}.Build()
+	File_update_proto = out.File
+	file_update_proto_goTypes = nil
+	file_update_proto_depIdxs = nil
+}
@@ -0,0 +1,157 @@
+package weight_pb
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestModel creates a model with a float32 tensor of n elements, a float16 tensor and an int8 tensor.
+func newTestModel(t *testing.T, weights []float32, bias []float32, counts []int8) *TensorModel {
+	t.Helper()
+
+	model := NewTensorModel("mlp")
+	tensors := []func() (*Tensor, error){
+		func() (*Tensor, error) { return NewFloat32Tensor("fc.weight", []int64{int64(len(weights))}, weights) },
+		func() (*Tensor, error) { return NewFloat16Tensor("fc.bias", []int64{int64(len(bias))}, bias) },
+		func() (*Tensor, error) { return NewInt8Tensor("counts", []int64{int64(len(counts))}, counts) },
+	}
+	for _, newTensor := range tensors {
+		tensor, err := newTensor()
+		if err != nil {
+			t.Fatalf("Failed to create tensor: %v", err)
+		}
+		if err := model.AddTensor(tensor); err != nil {
+			t.Fatalf("Failed to add tensor: %v", err)
+		}
+	}
+
+	return model
+}
+
+func TestEncodeDelta(t *testing.T) {
+	ctx := context.Background()
+
+	weights := make([]float32, 1000)
+	for i := range weights {
+		weights[i] = float32(i)
+	}
+	base := newTestModel(t, weights, []float32{0.5, 1}, []int8{1, 2, 3})
+
+	updatedWeights := append([]float32(nil), weights...)
+	updatedWeights[10] += 0.25
+	updatedWeights[500] -= 4
+	model := newTestModel(t, updatedWeights, []float32{0.5, 1}, []int8{1, -2, 3})
+
+	update, err := EncodeDelta("/ipfs/base", base, model, UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to encode delta: %v", err)
+	}
+	if update.BaseCid != "/ipfs/base" || len(update.Tensors) != 2 {
+		t.Fatalf("Expected a delta of the 2 changed tensors against /ipfs/base, got %v", update)
+	}
+	if sparse := update.Tensors[0].GetSparse(); sparse == nil || len(sparse.Indices) != 2 {
+		t.Fatalf("Expected the changes of fc.weight to be stored sparsely, got %v", update.Tensors[0])
+	}
+
+	data, err := proto.Marshal(update)
+	if err != nil {
+		t.Fatalf("Failed to marshal update: %v", err)
+	}
+	decoded, err := DecodeModel(ctx, data, func(ctx context.Context, cid string) (*TensorModel, error) {
+		if cid != "/ipfs/base" {
+			t.Fatalf("Expected the base model to be fetched, got %s", cid)
+		}
+		return base, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode update: %v", err)
+	}
+	if !proto.Equal(decoded, model) {
+		t.Fatalf("Decoded model does not match the encoded model")
+	}
+
+	if _, err := DecodeModel(ctx, data, nil); err == nil {
+		t.Fatalf("Expected decoding a delta without a base model to fail")
+	}
+}
+
+func TestEncodeTopK(t *testing.T) {
+	weights := []float32{0.1, -5, 0, 3, -0.2, 3, 7, 0}
+	model := newTestModel(t, weights, []float32{0}, []int8{0})
+
+	update, err := EncodeSparse(model, UpdateOptions{TopKFraction: 0.375})
+	if err != nil {
+		t.Fatalf("Failed to encode model: %v", err)
+	}
+
+	decoded, err := update.Apply(nil)
+	if err != nil {
+		t.Fatalf("Failed to apply update: %v", err)
+	}
+	values, err := decoded.Tensor("fc.weight").Float32s()
+	if err != nil {
+		t.Fatalf("Failed to read tensor: %v", err)
+	}
+
+	// The 3 largest magnitudes are kept, of the two 3s the first one.
+	expected := []float32{0, -5, 0, 3, 0, 0, 7, 0}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, values)
+		}
+	}
+}
+
+func TestTopK(t *testing.T) {
+	tensor, err := NewInt64Tensor("values", []int64{6}, []int64{4, -9, 4, 0, 1, 4})
+	if err != nil {
+		t.Fatalf("Failed to create tensor: %v", err)
+	}
+
+	sparse, err := TopK(tensor, 3)
+	if err != nil {
+		t.Fatalf("Failed to select top-k: %v", err)
+	}
+	if len(sparse.Indices) != 3 || sparse.Indices[0] != 0 || sparse.Indices[1] != 1 || sparse.Indices[2] != 2 {
+		t.Fatalf("Expected indices [0 1 2], got %v", sparse.Indices)
+	}
+
+	dense, err := sparse.ToDense()
+	if err != nil {
+		t.Fatalf("Failed to expand sparse tensor: %v", err)
+	}
+	values, err := dense.Int64s()
+	if err != nil || values[1] != -9 || values[5] != 0 {
+		t.Fatalf("Unexpected values %v (%v)", values, err)
+	}
+
+	sparse.Indices[2] = 0
+	if _, err := sparse.ToDense(); err == nil {
+		t.Fatalf("Expected indices out of order to be rejected")
+	}
+}
+
+func TestDecodeModelFormats(t *testing.T) {
+	ctx := context.Background()
+
+	weightData, err := proto.Marshal(&WeightModel{Values: []int64{7, 8}})
+	if err != nil {
+		t.Fatalf("Failed to marshal weight model: %v", err)
+	}
+	model, err := DecodeModel(ctx, weightData, nil)
+	if err != nil || model.Tensor(LegacyTensorName) == nil {
+		t.Fatalf("Expected a weight model to be decoded, got %v (%v)", model, err)
+	}
+
+	tensorModel := newTestModel(t, []float32{1}, []float32{2}, []int8{3})
+	tensorData, err := proto.Marshal(tensorModel)
+	if err != nil {
+		t.Fatalf("Failed to marshal tensor model: %v", err)
+	}
+	model, err = DecodeModel(ctx, tensorData, nil)
+	if err != nil || !proto.Equal(model, tensorModel) {
+		t.Fatalf("Expected a tensor model to be decoded, got %v (%v)", model, err)
+	}
+}